@@ -0,0 +1,72 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/enescakir/emoji"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/rabbitstack/fibratus/pkg/filter/attack"
+	"io"
+	"os"
+)
+
+const coverageTitle = "Fibratus rules ATT&CK coverage"
+
+// exportCoverage writes the ATT&CK coverage of enabled rules in the
+// specified format. Rules with missing or malformed technique labels
+// are reported on the standard error, so they don't pollute the export.
+func exportCoverage(filters []*config.FilterConfig) error {
+	coverage := attack.NewCoverage(filters)
+
+	var w io.Writer = os.Stdout
+	if exportFile != "" {
+		f, err := os.Create(exportFile)
+		if err != nil {
+			return fmt.Errorf("%v %v", emoji.DisappointedFace, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	var err error
+	switch exportFormat {
+	case "navigator":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(coverage.Layer(coverageTitle))
+	case "markdown":
+		err = coverage.Markdown(w, coverageTitle)
+	case "html":
+		err = coverage.HTML(w, coverageTitle)
+	}
+	if err != nil {
+		return fmt.Errorf("%v %v", emoji.DisappointedFace, err)
+	}
+
+	for _, issue := range coverage.Issues {
+		fmt.Fprintf(os.Stderr, "%v %s\n", emoji.Warning, issue)
+	}
+	if exportFile != "" {
+		emo("%v ATT&CK coverage of %d rule(s) written to %s\n", emoji.CheckMarkButton, coverage.Rules, exportFile)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/enescakir/emoji"
+	"github.com/rabbitstack/fibratus/internal/bootstrap"
+	"github.com/rabbitstack/fibratus/pkg/filter"
+	"github.com/rabbitstack/fibratus/pkg/filter/ql"
+	"github.com/rabbitstack/fibratus/pkg/filter/ruletest"
+	"io"
+	"os"
+	"strings"
+)
+
+func explainRules(rule, path string) error {
+	if err := bootstrap.InitConfigAndLogger(cfg); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("%v %v", emoji.DisappointedFace, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	explained, err := ruletest.Explain(cfg.Filters, rule, r)
+	if err != nil {
+		return fmt.Errorf("%v %v", emoji.DisappointedFace, err)
+	}
+
+	if explainOutput == "json" {
+		type event struct {
+			Seq         uint64              `json:"seq"`
+			Name        string              `json:"name"`
+			Fired       bool                `json:"fired"`
+			Explanation *filter.Explanation `json:"explanation"`
+		}
+		events := make([]event, 0, len(explained))
+		for _, e := range explained {
+			events = append(events, event{Seq: e.Event.Seq, Name: e.Event.Name, Fired: e.Fired, Explanation: e.Explanation})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(events)
+	}
+
+	for _, e := range explained {
+		printExplanation(e)
+	}
+	return nil
+}
+
+func printExplanation(e ruletest.Explained) {
+	exp := e.Explanation
+	switch {
+	case e.Fired:
+		emo("%v %s: rule fired\n", emoji.Warning, sample(e.Event))
+	case !exp.Evaluated:
+		emo("%v %s: rule is not evaluated for %s events\n", emoji.Information, sample(e.Event), e.Event.Name)
+		return
+	case exp.Match:
+		emo("%v %s: condition matched\n", emoji.CheckMarkButton, sample(e.Event))
+	default:
+		emo("%v %s: condition not matched\n", emoji.CrossMark, sample(e.Event))
+	}
+
+	if exp.Threshold != nil {
+		fmt.Printf("  threshold: %d/%d event(s) within %v", exp.Threshold.Count, exp.Threshold.Required, exp.Threshold.Window)
+		if exp.Threshold.Key != nil {
+			fmt.Printf(" for group %v", exp.Threshold.Key)
+		}
+		fmt.Println()
+	}
+	printTrace(exp.Trace, "  ")
+
+	seq := exp.Sequence
+	if seq == nil {
+		return
+	}
+	fmt.Printf("  state: %s\n", seq.State)
+	for _, step := range seq.Steps {
+		var status []string
+		if step.Negated {
+			status = append(status, "negated")
+		}
+		if !step.Evaluable {
+			status = append(status, "not evaluable")
+		}
+		if !step.Reachable {
+			status = append(status, "awaiting upstream matches")
+		}
+		if step.Matched {
+			status = append(status, "matched")
+		}
+		fmt.Printf("  slot %d: %s\n", step.Slot, step.Expr)
+		if len(status) > 0 {
+			fmt.Printf("    %s\n", strings.Join(status, ", "))
+		}
+		if step.By != "" {
+			fmt.Printf("    join by %s = %v\n", step.By, step.JoinKey)
+		}
+		fmt.Printf("    match: %t\n", step.Match)
+		printTrace(step.Trace, "    ")
+		for _, p := range step.Partials {
+			fmt.Printf("    partial #%d %s %s", p.Seq, p.Timestamp.Format("2006-01-02T15:04:05.999Z07:00"), p.Name)
+			if p.JoinKey != nil {
+				fmt.Printf(" joined by %v", p.JoinKey)
+			}
+			fmt.Println()
+		}
+	}
+}
+
+// printTrace renders the trace tree with the given indentation.
+func printTrace(trace *ql.Trace, indent string) {
+	if trace == nil {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(trace.String(), "\n"), "\n") {
+		fmt.Printf("%s%s\n", indent, line)
+	}
+}
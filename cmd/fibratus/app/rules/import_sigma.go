@@ -0,0 +1,110 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"github.com/enescakir/emoji"
+	"github.com/rabbitstack/fibratus/internal/bootstrap"
+	"github.com/rabbitstack/fibratus/pkg/filter"
+	"github.com/rabbitstack/fibratus/pkg/filter/sigma"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var nonAlnum = regexp.MustCompile(`[^a-z0-9]+`)
+
+func importSigmaRules(paths []string) error {
+	if err := bootstrap.InitConfigAndLogger(cfg); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	var imported, skipped int
+	for _, p := range paths {
+		files, err := filepath.Glob(p)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			ext := filepath.Ext(file)
+			if ext != ".yml" && ext != ".yaml" {
+				continue
+			}
+			path, err := importSigmaRule(file)
+			if err != nil {
+				skipped++
+				var e *sigma.UnsupportedError
+				if errors.As(err, &e) {
+					emo("%v %s: %s\n", emoji.CrossMark, file, e.Rule)
+					for _, reason := range e.Reasons {
+						emo("   %v %s\n", emoji.Warning, reason)
+					}
+					continue
+				}
+				emo("%v %s: %v\n", emoji.CrossMark, file, err)
+				continue
+			}
+			imported++
+			emo("%v %s -> %s\n", emoji.CheckMarkButton, file, path)
+		}
+	}
+
+	fmt.Printf("%d imported, %d skipped\n", imported, skipped)
+	if imported == 0 {
+		return fmt.Errorf("%v no Sigma rules imported", emoji.DisappointedFace)
+	}
+	return nil
+}
+
+// importSigmaRule converts the Sigma rule and writes the
+// rule file to the output directory. The rule condition
+// is compiled to make sure the produced rule is valid.
+func importSigmaRule(file string) (string, error) {
+	r, err := sigma.Load(file)
+	if err != nil {
+		return "", err
+	}
+	rule, err := sigma.Convert(r)
+	if err != nil {
+		return "", err
+	}
+	if err := filter.New(rule.Condition, cfg).Compile(); err != nil {
+		return "", filter.ErrInvalidFilter(rule.Name, err)
+	}
+	b, err := sigma.Marshal(rule)
+	if err != nil {
+		return "", err
+	}
+
+	n := strings.Trim(nonAlnum.ReplaceAllString(strings.ToLower(rule.Name), "_"), "_") + ".yml"
+	if tactic := rule.Labels["tactic.name"]; tactic != "" {
+		n = strings.Replace(strings.ToLower(tactic), " ", "_", -1) + "_" + n
+	}
+	path := filepath.Join(outputDir, n)
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
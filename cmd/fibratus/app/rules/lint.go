@@ -0,0 +1,115 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rules
+
+import (
+	"fmt"
+	"github.com/enescakir/emoji"
+	"github.com/rabbitstack/fibratus/internal/bootstrap"
+	rulelint "github.com/rabbitstack/fibratus/pkg/filter/lint"
+	"github.com/rabbitstack/fibratus/pkg/filter/lists"
+	"github.com/rabbitstack/fibratus/pkg/util/version"
+	"os"
+	"strings"
+)
+
+func lintRules() error {
+	var threshold *rulelint.Severity
+	if failOn != "none" {
+		sev, err := rulelint.ParseSeverity(failOn)
+		if err != nil {
+			return fmt.Errorf("invalid fail-on severity: %s. Possible values are error, warning, note, and none", failOn)
+		}
+		threshold = &sev
+	}
+
+	if err := bootstrap.InitConfigAndLogger(cfg); err != nil {
+		return err
+	}
+	if err := cfg.Filters.LoadMacros(); err != nil {
+		return fmt.Errorf("%v %v", emoji.DisappointedFace, err)
+	}
+	if err := cfg.Filters.LoadExceptions(); err != nil {
+		return fmt.Errorf("%v %v", emoji.DisappointedFace, err)
+	}
+	if err := cfg.Filters.LoadFilters(); err != nil {
+		return fmt.Errorf("%v %v", emoji.DisappointedFace, err)
+	}
+	reg := lists.NewRegistry()
+	if err := reg.Load(cfg.Filters.Lists); err != nil {
+		return fmt.Errorf("%v %v", emoji.DisappointedFace, err)
+	}
+	if len(cfg.GetFilters()) == 0 {
+		return fmt.Errorf("%v no rules found in %s", emoji.DisappointedFace, strings.Join(cfg.Filters.Rules.FromPaths, ","))
+	}
+
+	linter := rulelint.New(cfg.Filters)
+	linter.SetLists(reg)
+	findings := linter.Lint(cfg.GetFilters())
+
+	switch lintOutput {
+	case "json":
+		if err := rulelint.WriteJSON(os.Stdout, findings); err != nil {
+			return err
+		}
+	case "sarif":
+		if err := rulelint.WriteSARIF(os.Stdout, findings, version.Get()); err != nil {
+			return err
+		}
+	default:
+		printFindings(findings)
+	}
+
+	if threshold == nil {
+		return nil
+	}
+	var failed int
+	for _, f := range findings {
+		if f.Severity >= *threshold {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d finding(s) with %s or higher severity", failed, threshold)
+	}
+	return nil
+}
+
+func printFindings(findings []rulelint.Finding) {
+	if len(findings) == 0 {
+		emo("%v No findings. Ready to go!\n", emoji.Rocket)
+		return
+	}
+	counts := make(map[rulelint.Severity]int)
+	for _, f := range findings {
+		counts[f.Severity]++
+		switch f.Severity {
+		case rulelint.Error:
+			emo("%v %s\n", emoji.CrossMark, f)
+		case rulelint.Warning:
+			emo("%v %s\n", emoji.Warning, f)
+		default:
+			emo("%v %s\n", emoji.Information, f)
+		}
+		if f.Source != "" {
+			fmt.Printf("   in %s\n", f.Source)
+		}
+	}
+	fmt.Printf("\n%d error(s), %d warning(s), %d note(s)\n", counts[rulelint.Error], counts[rulelint.Warning], counts[rulelint.Note])
+}
@@ -31,6 +31,9 @@ func listRules() error {
 	if err := bootstrap.InitConfigAndLogger(cfg); err != nil {
 		return err
 	}
+	if err := cfg.Filters.LoadExceptions(); err != nil {
+		return fmt.Errorf("%v %v", emoji.DisappointedFace, err)
+	}
 	if err := cfg.Filters.LoadFilters(); err != nil {
 		return fmt.Errorf("%v %v", emoji.DisappointedFace, err)
 	}
@@ -38,6 +41,9 @@ func listRules() error {
 	if len(filters) == 0 {
 		return fmt.Errorf("%v no rules found in %s", emoji.DisappointedFace, strings.Join(cfg.Filters.Rules.FromPaths, ","))
 	}
+	if exportFormat != "" {
+		return exportCoverage(filters)
+	}
 
 	t := table.NewWriter()
 	t.SetOutputMirror(os.Stdout)
@@ -73,15 +79,17 @@ func listRules() error {
 		t.AppendFooter(table.Row{"TOTAL", tot})
 	} else {
 		// show all rules
-		t.AppendHeader(table.Row{"#", "Rule", "Technique", "Tactic"})
+		t.AppendHeader(table.Row{"#", "Rule", "Technique", "Tactic", "Exceptions"})
 		t.SetColumnConfigs([]table.ColumnConfig{
 			{Name: "#", WidthMax: 5},
 			{Name: "Rule"},
 			{Name: "Technique"},
 			{Name: "Tactic", WidthMax: 50},
+			{Name: "Exceptions", WidthMax: 10},
 		})
 
 		n := 0
+		excs := 0
 		tactics := make(map[string]int)
 		techniques := make(map[string]int)
 
@@ -94,7 +102,9 @@ func listRules() error {
 			if _, ok := tactics[tec]; !ok {
 				techniques[tec] = 1
 			}
-			t.AppendRow(table.Row{n + 1, f.Name, tec, tac})
+			exceptions := len(cfg.Filters.GetExceptions(f))
+			t.AppendRow(table.Row{n + 1, f.Name, tec, tac, exceptions})
+			excs += exceptions
 			n++
 		}
 
@@ -110,7 +120,7 @@ func listRules() error {
 			totTec += n
 		}
 
-		t.AppendFooter(table.Row{"TOTAL", n, totTec, totTat})
+		t.AppendFooter(table.Row{"TOTAL", n, totTec, totTat, excs})
 	}
 
 	t.Render()
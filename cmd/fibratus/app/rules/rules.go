@@ -28,7 +28,7 @@ import (
 
 var Command = &cobra.Command{
 	Use:   "rules",
-	Short: "Validate, list, or search detection rules",
+	Short: "Validate, lint, list, test, simulate, explain, import, or search detection rules",
 }
 
 var validateCmd = &cobra.Command{
@@ -37,6 +37,12 @@ var validateCmd = &cobra.Command{
 	RunE:  validate,
 }
 
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Analyze rule conditions for likely mistakes beyond syntax errors",
+	RunE:  lint,
+}
+
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List rules",
@@ -49,11 +55,46 @@ var createCmd = &cobra.Command{
 	RunE:  create,
 }
 
+var testCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Run rule test cases and report pass/fail per rule",
+	RunE:  test,
+}
+
+var importSigmaCmd = &cobra.Command{
+	Use:   "import-sigma",
+	Short: "Convert Sigma rules to Fibratus rules",
+	RunE:  importSigma,
+}
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate [events.ndjson]",
+	Short: "Replay the JSON event log through the ruleset and report rule hits",
+	RunE:  simulate,
+}
+
+var explainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "Explain how the rule evaluates against each event of the JSON event log",
+	RunE:  explain,
+}
+
 var cfg = config.NewWithOpts(config.WithValidate(), config.WithList())
 
 var (
 	summarized bool
 	tacticID   string
+	outputDir  string
+	samples    int
+	lintOutput string
+	failOn     string
+
+	explainRule   string
+	explainEvents string
+	explainOutput string
+
+	exportFormat string
+	exportFile   string
 )
 
 func init() {
@@ -61,18 +102,81 @@ func init() {
 
 	Command.AddCommand(validateCmd)
 
+	lintCmd.PersistentFlags().StringVarP(&lintOutput, "output", "o", "text", "Specifies the output format of lint findings. Possible values are text, json, and sarif")
+	lintCmd.PersistentFlags().StringVar(&failOn, "fail-on", "error", "Specifies the minimum severity of findings that fail the command. Possible values are error, warning, note, and none")
+	Command.AddCommand(lintCmd)
+
 	listCmd.PersistentFlags().BoolVarP(&summarized, "summary", "s", false, "Show rules summary by MITRE tactics and techniques")
+	listCmd.PersistentFlags().StringVarP(&exportFormat, "export", "e", "", "Exports the MITRE ATT&CK coverage of enabled rules. Possible values are navigator, markdown, and html")
+	listCmd.PersistentFlags().StringVar(&exportFile, "export-file", "", "Specifies the file where the coverage is exported. The coverage is written to stdout by default")
 	Command.AddCommand(listCmd)
 
 	createCmd.PersistentFlags().StringVarP(&tacticID, "tactic-id", "t", "", "Specifies the MITRE tactic identifier for the rule (e.g. TA0001)")
 	Command.AddCommand(createCmd)
+
+	Command.AddCommand(testCmd)
+
+	importSigmaCmd.PersistentFlags().StringVarP(&outputDir, "output-dir", "o", ".", "Specifies the directory where converted rules are written")
+	Command.AddCommand(importSigmaCmd)
+
+	simulateCmd.PersistentFlags().IntVarP(&samples, "samples", "n", 3, "Specifies the number of sample matches reported per rule")
+	Command.AddCommand(simulateCmd)
+
+	explainCmd.PersistentFlags().StringVarP(&explainRule, "rule", "r", "", "Specifies the identifier or the name of the rule to explain")
+	explainCmd.PersistentFlags().StringVarP(&explainEvents, "events", "e", "-", "Specifies the path of the JSON event log. Events are read from stdin by default")
+	explainCmd.PersistentFlags().StringVarP(&explainOutput, "output", "o", "text", "Specifies the output format of explanations. Possible values are text and json")
+	Command.AddCommand(explainCmd)
 }
 
 func validate(cmd *cobra.Command, args []string) error {
 	return validateRules()
 }
 
+func lint(cmd *cobra.Command, args []string) error {
+	switch lintOutput {
+	case "text", "json", "sarif":
+	default:
+		return fmt.Errorf("invalid output format: %s. Possible values are text, json, and sarif", lintOutput)
+	}
+	return lintRules()
+}
+
+func test(cmd *cobra.Command, args []string) error {
+	return testRules()
+}
+
+func importSigma(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("at least one Sigma rule path is required")
+	}
+	return importSigmaRules(args)
+}
+
+func simulate(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("the path of the event log is required. Use - to read events from stdin")
+	}
+	return simulateRules(args[0])
+}
+
+func explain(cmd *cobra.Command, args []string) error {
+	if explainRule == "" {
+		return fmt.Errorf("the rule identifier or name is required")
+	}
+	switch explainOutput {
+	case "text", "json":
+	default:
+		return fmt.Errorf("invalid output format: %s. Possible values are text and json", explainOutput)
+	}
+	return explainRules(explainRule, explainEvents)
+}
+
 func list(cmd *cobra.Command, args []string) error {
+	switch exportFormat {
+	case "", "navigator", "markdown", "html":
+	default:
+		return fmt.Errorf("invalid export format: %s. Possible values are navigator, markdown, and html", exportFormat)
+	}
 	return listRules()
 }
 
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rules
+
+import (
+	"fmt"
+	"github.com/enescakir/emoji"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/rabbitstack/fibratus/internal/bootstrap"
+	"github.com/rabbitstack/fibratus/pkg/filter/ruletest"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+func simulateRules(path string) error {
+	if err := bootstrap.InitConfigAndLogger(cfg); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("%v %v", emoji.DisappointedFace, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	report, err := ruletest.NewSimulator(cfg.Filters, samples).Run(r)
+	if err != nil {
+		return fmt.Errorf("%v %v", emoji.DisappointedFace, err)
+	}
+
+	emo("%v Replayed %d events through %d rules in %v\n", emoji.Rocket, report.Events, report.Rules, report.Duration.Round(time.Millisecond))
+	if len(report.Hits) == 0 {
+		emo("%v No rules matched\n", emoji.CheckMarkButton)
+	} else {
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.SetStyle(table.StyleLight)
+		t.AppendHeader(table.Row{"Rule", "Hits", "First", "Last"})
+		var hits int
+		for _, h := range report.Hits {
+			t.AppendRow(table.Row{h.Rule, h.Count, h.First.Format(time.RFC3339), h.Last.Format(time.RFC3339)})
+			hits += h.Count
+		}
+		t.AppendFooter(table.Row{"TOTAL", hits})
+		t.Render()
+
+		for _, h := range report.Hits {
+			emo("\n%v %s\n", emoji.MagnifyingGlassTiltedLeft, h.Rule)
+			for i, evts := range h.Samples {
+				fmt.Printf("  sample #%d\n", i+1)
+				for _, e := range evts {
+					fmt.Printf("    %s\n", sample(e))
+				}
+			}
+		}
+	}
+
+	if len(report.Pending) > 0 {
+		emo("\n%v Sequences with pending partials or absences\n", emoji.HourglassNotDone)
+		for _, p := range report.Pending {
+			fmt.Printf("  %s\n", p.Rule)
+			slots := make([]int, 0, len(p.Partials))
+			for slot := range p.Partials {
+				slots = append(slots, int(slot))
+			}
+			sort.Ints(slots)
+			for _, slot := range slots {
+				evts := p.Partials[uint16(slot)]
+				fmt.Printf("    slot %d: %d partial(s), last %s\n", slot, len(evts), sample(evts[len(evts)-1]))
+			}
+			if len(p.Absences) > 0 {
+				evts := p.Absences[len(p.Absences)-1]
+				fmt.Printf("    awaiting time window: %d absence(s), last %s\n", len(p.Absences), sample(evts[len(evts)-1]))
+			}
+		}
+	}
+
+	return nil
+}
+
+// sample renders the brief description of the matched event.
+func sample(e *kevent.Kevent) string {
+	proc := fmt.Sprintf("pid %d", e.PID)
+	if e.PS != nil && e.PS.Name != "" {
+		proc = fmt.Sprintf("%s (%d)", e.PS.Name, e.PID)
+	}
+	return fmt.Sprintf("#%d %s %s %s", e.Seq, e.Timestamp.Format(time.RFC3339Nano), e.Name, proc)
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rules
+
+import (
+	"fmt"
+	"github.com/enescakir/emoji"
+	"github.com/rabbitstack/fibratus/internal/bootstrap"
+	"github.com/rabbitstack/fibratus/pkg/filter/ruletest"
+	"strings"
+)
+
+func testRules() error {
+	if err := bootstrap.InitConfigAndLogger(cfg); err != nil {
+		return err
+	}
+	tests, err := ruletest.Discover(cfg.Filters.Rules.FromPaths)
+	if err != nil {
+		return err
+	}
+	if len(tests) == 0 {
+		return fmt.Errorf("%v no rule tests found in %s", emoji.DisappointedFace, strings.Join(cfg.Filters.Rules.FromPaths, ","))
+	}
+
+	runner := ruletest.NewRunner(cfg)
+	var passed, failed int
+	for _, test := range tests {
+		results, err := runner.Run(test)
+		if err != nil {
+			return fmt.Errorf("%v %v", emoji.DisappointedFace, err)
+		}
+		for _, res := range results {
+			if res.Passed() {
+				passed++
+				emo("%v %s: %s\n", emoji.CheckMarkButton, res.Rule, res.Case)
+				continue
+			}
+			failed++
+			rule := res.Rule
+			if rule == "" {
+				rule = res.File
+			}
+			emo("%v %s: %s: %v\n", emoji.CrossMark, rule, res.Case, res.Err)
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%v %d rule test(s) failed", emoji.DisappointedFace, failed)
+	}
+	emo("%v All rule tests passed!", emoji.Rocket)
+	return nil
+}
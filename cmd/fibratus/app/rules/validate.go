@@ -22,8 +22,10 @@ import (
 	"fmt"
 	"github.com/enescakir/emoji"
 	"github.com/rabbitstack/fibratus/internal/bootstrap"
+	"github.com/rabbitstack/fibratus/pkg/config"
 	"github.com/rabbitstack/fibratus/pkg/filter"
 	"github.com/rabbitstack/fibratus/pkg/filter/fields"
+	"github.com/rabbitstack/fibratus/pkg/filter/lists"
 	"path/filepath"
 	"strings"
 )
@@ -59,15 +61,22 @@ func validateRules() error {
 			return err
 		}
 		for _, path := range paths {
-			if !isValidExt(path) {
+			if !isValidExt(path) || config.IsRuleTestFile(path) {
 				continue
 			}
 			emo("%v Loading rule %s\n", emoji.Package, path)
 		}
 	}
+	if err := cfg.Filters.LoadExceptions(); err != nil {
+		return fmt.Errorf("%v %v", emoji.DisappointedFace, err)
+	}
 	if err := cfg.Filters.LoadFilters(); err != nil {
 		return fmt.Errorf("%v %v", emoji.DisappointedFace, err)
 	}
+	reg := lists.NewRegistry()
+	if err := reg.Load(cfg.Filters.Lists); err != nil {
+		return fmt.Errorf("%v %v", emoji.DisappointedFace, err)
+	}
 	if len(cfg.GetFilters()) == 0 {
 		return fmt.Errorf("%v no rules found in %s", emoji.DisappointedFace, strings.Join(cfg.Filters.Rules.FromPaths, ","))
 	}
@@ -75,7 +84,7 @@ func validateRules() error {
 	warnings := make([]string, 0)
 	// validate rules
 	for _, rule := range cfg.GetFilters() {
-		f := filter.New(rule.Condition, cfg)
+		f := filter.New(rule.Condition, cfg, filter.WithExceptions(cfg.Filters.GetExceptions(rule)...), filter.WithLists(reg))
 		err := f.Compile()
 		if err != nil {
 			return fmt.Errorf("%v %v", emoji.DisappointedFace, filter.ErrInvalidFilter(rule.Name, err))
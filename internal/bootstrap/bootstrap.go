@@ -27,9 +27,12 @@ import (
 	"github.com/rabbitstack/fibratus/pkg/config"
 	"github.com/rabbitstack/fibratus/pkg/filament"
 	"github.com/rabbitstack/fibratus/pkg/filter"
+	"github.com/rabbitstack/fibratus/pkg/filter/lists"
 	"github.com/rabbitstack/fibratus/pkg/handle"
 	"github.com/rabbitstack/fibratus/pkg/kcap"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
 	"github.com/rabbitstack/fibratus/pkg/kstream"
+	"github.com/rabbitstack/fibratus/pkg/outputs"
 	"github.com/rabbitstack/fibratus/pkg/ps"
 	"github.com/rabbitstack/fibratus/pkg/symbolize"
 	"github.com/rabbitstack/fibratus/pkg/sys"
@@ -52,6 +55,8 @@ type App struct {
 	controller *kstream.Controller
 	symbolizer *symbolize.Symbolizer
 	rules      *filter.Rules
+	reloader   *filter.Reloader
+	watcher    *lists.Watcher
 	hsnap      handle.Snapshotter
 	psnap      ps.Snapshotter
 	consumer   kstream.Consumer
@@ -246,6 +251,21 @@ func (f *App) Run(args []string) error {
 		// register rule engine
 		if f.rules != nil {
 			f.consumer.RegisterEventListener(f.rules)
+			// watch rule resources for changes
+			if cfg.Filters.Rules.Reload {
+				f.reloader, err = filter.NewReloader(f.rules, cfg)
+				if err != nil {
+					return err
+				}
+				f.reloader.Run()
+			}
+			// watch lookup lists for changes. Lists declared
+			// on rules reload are watched once they're loaded
+			f.watcher, err = lists.NewWatcher(f.rules.Lists())
+			if err != nil {
+				return err
+			}
+			f.watcher.Run()
 		}
 		// register YARA scanner
 		if cfg.Yara.Enabled {
@@ -265,15 +285,20 @@ func (f *App) Run(args []string) error {
 			f.consumer.Events(),
 			f.consumer.Errors(),
 			cfg.Aggregator,
-			cfg.Output,
+			cfg.Outputs,
 			cfg.Transformers,
 			cfg.Alertsenders,
+			aggregator.WithFilterCompiler(compileOutputFilter(cfg)),
+			aggregator.WithFieldResolver(resolveOutputField),
 		)
 		if err != nil {
 			return err
 		}
 	}
 	// start the HTTP server
+	if f.rules != nil {
+		return api.StartServer(cfg, api.WithExplainer(f.rules))
+	}
 	return api.StartServer(cfg)
 }
 
@@ -364,9 +389,11 @@ func (f *App) ReadCapture(ctx context.Context, args []string) error {
 			evts,
 			errs,
 			f.config.Aggregator,
-			f.config.Output,
+			f.config.Outputs,
 			f.config.Transformers,
 			f.config.Alertsenders,
+			aggregator.WithFilterCompiler(compileOutputFilter(f.config)),
+			aggregator.WithFieldResolver(resolveOutputField),
 		)
 		if err != nil {
 			return err
@@ -375,6 +402,28 @@ func (f *App) ReadCapture(ctx context.Context, args []string) error {
 	return api.StartServer(f.config)
 }
 
+// compileOutputFilter returns the compiler that builds
+// the filters for routing events to outputs.
+func compileOutputFilter(cfg *config.Config) aggregator.FilterCompiler {
+	return func(expr string) (aggregator.Filter, error) {
+		f := filter.New(expr, cfg)
+		if err := f.Compile(); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+}
+
+// resolveOutputField returns the valuer that extracts
+// the event field value, e.g. for deriving message keys.
+func resolveOutputField(field string) (outputs.FieldValuer, error) {
+	valuer, err := filter.NewFieldValuer(field)
+	if err != nil {
+		return nil, err
+	}
+	return func(kevt *kevent.Kevent) (any, error) { return valuer(kevt) }, nil
+}
+
 // Wait waits for the app to receive the termination signal.
 func (f *App) Wait() {
 	if f.signals != nil {
@@ -393,6 +442,19 @@ func (f *App) Shutdown() error {
 	if f.symbolizer != nil {
 		f.symbolizer.Close()
 	}
+	if f.reloader != nil {
+		if err := f.reloader.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if f.watcher != nil {
+		if err := f.watcher.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if f.rules != nil {
+		f.rules.Close()
+	}
 	if f.consumer != nil {
 		if err := f.consumer.Close(); err != nil {
 			errs = append(errs, err)
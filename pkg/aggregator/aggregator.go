@@ -19,14 +19,15 @@
 package aggregator
 
 import (
-	"errors"
 	"expvar"
+	"fmt"
 	"time"
 
 	"github.com/rabbitstack/fibratus/pkg/aggregator/transformers"
 	"github.com/rabbitstack/fibratus/pkg/alertsender"
 	"github.com/rabbitstack/fibratus/pkg/kevent"
 	"github.com/rabbitstack/fibratus/pkg/outputs"
+	"github.com/rabbitstack/fibratus/pkg/util/multierror"
 	log "github.com/sirupsen/logrus"
 
 	// initialize outputs
@@ -34,8 +35,11 @@ import (
 	_ "github.com/rabbitstack/fibratus/pkg/outputs/console"
 	_ "github.com/rabbitstack/fibratus/pkg/outputs/elasticsearch"
 	_ "github.com/rabbitstack/fibratus/pkg/outputs/eventlog"
+	_ "github.com/rabbitstack/fibratus/pkg/outputs/file"
 	_ "github.com/rabbitstack/fibratus/pkg/outputs/http"
+	_ "github.com/rabbitstack/fibratus/pkg/outputs/kafka"
 	_ "github.com/rabbitstack/fibratus/pkg/outputs/null"
+	_ "github.com/rabbitstack/fibratus/pkg/outputs/syslog"
 
 	// initialize alert senders
 	_ "github.com/rabbitstack/fibratus/pkg/alertsender/mail"
@@ -63,18 +67,55 @@ var (
 	keventErrors = expvar.NewInt("aggregator.kevent.errors")
 )
 
+// Filter determines whether the event is routed to the output.
+type Filter interface {
+	// Run evaluates the filter against the given event.
+	Run(kevt *kevent.Kevent) bool
+}
+
+// FilterCompiler compiles the output filter expression.
+type FilterCompiler func(expr string) (Filter, error)
+
+// ErrNoFilterCompiler is raised when the output declares the filter expression, but there is no compiler to build the filter
+var ErrNoFilterCompiler = func(typ outputs.Type) error {
+	return fmt.Errorf("%s output declares the filter, but no filter compiler is set", typ)
+}
+
+// Option represents the option for the aggregator.
+type Option func(o *opts)
+
+type opts struct {
+	compiler FilterCompiler
+	resolver outputs.FieldResolver
+}
+
+// WithFilterCompiler sets the compiler that builds the output filters.
+func WithFilterCompiler(compiler FilterCompiler) Option {
+	return func(o *opts) {
+		o.compiler = compiler
+	}
+}
+
+// WithFieldResolver sets the resolver that outputs use to extract event field values.
+func WithFieldResolver(resolver outputs.FieldResolver) Option {
+	return func(o *opts) {
+		o.resolver = resolver
+	}
+}
+
 // BufferedAggregator collects events from the inbound channel and produces batches on regular intervals. The batches
-// are pushed to the work queue from which load-balanced configured workers consume the batches and publish to the outputs.
+// are dispatched to the submitters of all configured outputs. Each submitter routes the batch through the output
+// filter and transformers, and pushes it to the work queue from which load-balanced workers publish to the output.
 type BufferedAggregator struct {
 	kevtsc  <-chan *kevent.Kevent
 	errsc   <-chan error
 	stop    chan struct{}
+	done    chan struct{}
 	flusher *time.Ticker
 	// queue of inbound kernel events
 	kevts []*kevent.Kevent
-	// work queue that forwarder passes to outputs
-	wq         queue
-	submitter  *submitter
+	// submitters route batches to outputs
+	submitters []*submitter
 	transforms []transformers.Transformer
 	c          Config
 }
@@ -84,10 +125,15 @@ func NewBuffered(
 	evts <-chan *kevent.Kevent,
 	errs <-chan error,
 	aggConfig Config,
-	outputConfig outputs.Config,
+	outputConfigs []outputs.Config,
 	transformerConfigs []transformers.Config,
 	alertsenderConfigs []alertsender.Config,
+	options ...Option,
 ) (*BufferedAggregator, error) {
+	var opts opts
+	for _, opt := range options {
+		opt(&opts)
+	}
 	flushInterval := aggConfig.FlushPeriod
 	if flushInterval < time.Millisecond*250 {
 		flushInterval = time.Millisecond * 250
@@ -97,15 +143,35 @@ func NewBuffered(
 		kevts:   make([]*kevent.Kevent, 0),
 		errsc:   errs,
 		stop:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
 		flusher: time.NewTicker(flushInterval),
-		wq:      make(chan *kevent.Batch),
 		c:       aggConfig,
 	}
 
+	// compile output filters before the submitters are started
+	filters := make([]Filter, len(outputConfigs))
+	for i, outputConfig := range outputConfigs {
+		if outputConfig.Filter == "" {
+			continue
+		}
+		if opts.compiler == nil {
+			return nil, ErrNoFilterCompiler(outputConfig.Type)
+		}
+		filter, err := opts.compiler(outputConfig.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s output filter: %v", outputConfig.Type, err)
+		}
+		filters[i] = filter
+	}
+
 	var err error
-	agg.submitter, err = newSubmitter(agg.wq, outputConfig)
-	if err != nil {
-		return nil, err
+	agg.submitters = make([]*submitter, len(outputConfigs))
+	for i, outputConfig := range outputConfigs {
+		outputConfig.Resolver = opts.resolver
+		agg.submitters[i], err = newSubmitter(outputConfig, filters[i], aggConfig.Spool)
+		if err != nil {
+			return nil, err
+		}
 	}
 	agg.transforms, err = transformers.LoadAll(transformerConfigs)
 	if err != nil {
@@ -125,38 +191,33 @@ func NewBuffered(
 // Stop flushes pending event batches and instructs the aggregator to stop processing events.
 func (agg *BufferedAggregator) Stop() error {
 	agg.stop <- struct{}{}
+	<-agg.done
 
 	// flush enqueued events
 	b := kevent.NewBatch(agg.kevts...)
+	errs := make([]error, 0)
 	if b.Len() > 0 {
-		done := make(chan struct{}, 1)
-		go func() {
-			agg.wq <- b
-			done <- struct{}{}
-		}()
-
-		select {
-		case <-done:
-			close(agg.wq)
-		case <-time.After(agg.c.FlushTimeout):
-			return errors.New("fail to flush events after stop timed out")
+		for _, s := range agg.submitters {
+			if err := s.flush(b, agg.c.FlushTimeout); err != nil {
+				errs = append(errs, err)
+			}
 		}
 	}
 
-	// sleep a bit before closing the clients
-	time.Sleep(time.Millisecond * 150)
-
-	err := agg.submitter.shutdown()
-	if err != nil {
-		return err
+	// wait for workers to publish pending batches and close the clients
+	for _, s := range agg.submitters {
+		if err := s.shutdown(agg.c.FlushTimeout); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	return nil
+	return multierror.Wrap(errs...)
 }
 
 // run starts the aggregator loop. The aggregator receives event stream from the upstream channel, buffers
-// them to intermediate queue and dispatches batches to downstream worker queue.
+// them to intermediate queue and dispatches batches to output submitters.
 func (agg *BufferedAggregator) run() {
+	defer close(agg.done)
 	for {
 		select {
 		case <-agg.stop:
@@ -169,9 +230,11 @@ func (agg *BufferedAggregator) run() {
 			b := kevent.NewBatch(agg.kevts...)
 			l := b.Len()
 			batchEvents.Add(l)
-			// push the batch to the work queue
+			// dispatch the batch to all outputs
 			if l > 0 {
-				agg.wq <- b
+				for _, s := range agg.submitters {
+					s.submit(b)
+				}
 			}
 			flushesCount.Add(1)
 			// clear the queue
@@ -24,6 +24,7 @@ import (
 	"github.com/rabbitstack/fibratus/pkg/kevent/ktypes"
 	"github.com/rabbitstack/fibratus/pkg/outputs"
 	"github.com/rabbitstack/fibratus/pkg/outputs/console"
+	"github.com/rabbitstack/fibratus/pkg/outputs/null"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"net"
@@ -38,7 +39,7 @@ func TestNewBufferedAggregator(t *testing.T) {
 		keventsc,
 		errsc,
 		Config{FlushPeriod: time.Millisecond * 200},
-		outputs.Config{Type: outputs.Console, Output: console.Config{Format: "pretty"}},
+		[]outputs.Config{{Type: outputs.Console, Output: console.Config{Format: "pretty"}}},
 		nil,
 		nil,
 	)
@@ -81,3 +82,26 @@ func TestNewBufferedAggregator(t *testing.T) {
 	assert.Equal(t, int64(6), batchEvents.Value())
 	assert.Equal(t, int64(2), flushesCount.Value())
 }
+
+func TestNewBufferedAggregatorOutputFilter(t *testing.T) {
+	outputConfigs := []outputs.Config{
+		{Type: outputs.Console, Output: console.Config{Format: "pretty"}},
+		{Type: outputs.Null, Output: null.Config{}, Filter: "kevt.meta[rule.name] != ''"},
+	}
+
+	_, err := NewBuffered(make(chan *kevent.Kevent), make(chan error), Config{}, outputConfigs, nil, nil)
+	require.EqualError(t, err, ErrNoFilterCompiler(outputs.Null).Error())
+
+	var exprs []string
+	compiler := func(expr string) (Filter, error) {
+		exprs = append(exprs, expr)
+		return filterFunc(func(kevt *kevent.Kevent) bool { return kevt.ContainsMeta(kevent.RuleNameKey) }), nil
+	}
+	agg, err := NewBuffered(make(chan *kevent.Kevent), make(chan error), Config{FlushTimeout: time.Second}, outputConfigs, nil, nil, WithFilterCompiler(compiler))
+	require.NoError(t, err)
+	require.Len(t, agg.submitters, 2)
+	assert.Nil(t, agg.submitters[0].filter)
+	assert.NotNil(t, agg.submitters[1].filter)
+	assert.Equal(t, []string{"kevt.meta[rule.name] != ''"}, exprs)
+	require.NoError(t, agg.Stop())
+}
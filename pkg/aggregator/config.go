@@ -19,14 +19,21 @@
 package aggregator
 
 import (
+	"os"
+	"path/filepath"
+	"time"
+
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
-	"time"
 )
 
 const (
-	flushPeriod  = "aggregator.flush-period"
-	flushTimeout = "aggregator.flush-timeout"
+	flushPeriod      = "aggregator.flush-period"
+	flushTimeout     = "aggregator.flush-timeout"
+	spoolEnabled     = "aggregator.spool.enabled"
+	spoolDir         = "aggregator.spool.dir"
+	spoolMaxSize     = "aggregator.spool.max-size"
+	spoolSegmentSize = "aggregator.spool.segment-size"
 )
 
 // Config contains aggregator-specific configuration tweaks.
@@ -35,16 +42,51 @@ type Config struct {
 	FlushPeriod time.Duration `json:"aggregator.flush-period" yaml:"aggregator.flush-period"`
 	// FlushTimeout represents the max time to wait before announcing failed flushing of enqueued events
 	FlushTimeout time.Duration `json:"aggregator.flush-timeout" yaml:"aggregator.flush-timeout"`
+	// Spool contains the settings of the disk spool for batches that failed to publish.
+	Spool SpoolConfig `json:"aggregator.spool" yaml:"aggregator.spool"`
+}
+
+// SpoolConfig contains the settings of the disk spool.
+type SpoolConfig struct {
+	// Enabled indicates if batches that failed to publish are spooled to disk and replayed later.
+	Enabled bool `json:"aggregator.spool.enabled" yaml:"aggregator.spool.enabled"`
+	// Dir is the directory where spool segment files are stored.
+	Dir string `json:"aggregator.spool.dir" yaml:"aggregator.spool.dir"`
+	// MaxSize is the maximum size in megabytes of all segment files of the output spool.
+	MaxSize int `json:"aggregator.spool.max-size" yaml:"aggregator.spool.max-size"`
+	// SegmentSize is the maximum size in megabytes of the segment file.
+	SegmentSize int `json:"aggregator.spool.segment-size" yaml:"aggregator.spool.segment-size"`
+}
+
+// Path returns the spool directory. If the directory is not
+// given, the spool directory is located in the installation path.
+func (c SpoolConfig) Path() string {
+	if c.Dir != "" {
+		return c.Dir
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return filepath.Join(os.Getenv("PROGRAMFILES"), "Fibratus", "Spool")
+	}
+	return filepath.Join(filepath.Dir(exe), "..", "Spool")
 }
 
 // AddFlags registers persistent aggregator flags.
 func AddFlags(flags *pflag.FlagSet) {
 	flags.Duration(flushPeriod, time.Millisecond*200, "Determines the period for flushing batches to outputs")
 	flags.Duration(flushTimeout, time.Second*4, "Represents the max time to wait before announcing failed flushing of enqueued events on aggregator shutdown")
+	flags.Bool(spoolEnabled, false, "Indicates if batches that failed to publish are spooled to disk and replayed when the output recovers")
+	flags.String(spoolDir, "", "Specifies the directory where spooled batches are stored")
+	flags.Int(spoolMaxSize, 1024, "Specifies the maximum size in megabytes of spooled batches per output. The oldest batches are evicted when the size is exceeded")
+	flags.Int(spoolSegmentSize, 16, "Specifies the maximum size in megabytes of the spool segment file")
 }
 
 // InitFromViper initializes aggregator flags from viper.
 func (c *Config) InitFromViper(v *viper.Viper) {
 	c.FlushPeriod = v.GetDuration(flushPeriod)
 	c.FlushTimeout = v.GetDuration(flushTimeout)
+	c.Spool.Enabled = v.GetBool(spoolEnabled)
+	c.Spool.Dir = v.GetString(spoolDir)
+	c.Spool.MaxSize = v.GetInt(spoolMaxSize)
+	c.Spool.SegmentSize = v.GetInt(spoolSegmentSize)
 }
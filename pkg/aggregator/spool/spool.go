@@ -0,0 +1,540 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package spool implements the disk-backed queue that persists the
+// records which couldn't be delivered, so they can be replayed later.
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"expvar"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// segmentExt is the extension of the segment files
+	segmentExt = ".seg"
+	// cursorFile is the name of the file that stores the read position
+	cursorFile = "cursor"
+	// headerSize is the size of the record header. The header contains
+	// the record length followed by the CRC32 checksum of the record
+	headerSize = 8
+)
+
+var (
+	// spoolDepth represents the number of pending records per spool
+	spoolDepth = expvar.NewMap("aggregator.spool.depth")
+	// spoolBytes represents the size in bytes of segment files per spool
+	spoolBytes = expvar.NewMap("aggregator.spool.bytes")
+	// spoolEvictions counts the number of records evicted per spool to keep the size under the cap
+	spoolEvictions = expvar.NewMap("aggregator.spool.evictions")
+)
+
+var (
+	// ErrClosed is returned when the spool is accessed after it was closed
+	ErrClosed = errors.New("spool is closed")
+	// ErrRecordTooLarge is returned when the record can't fit in the spool
+	ErrRecordTooLarge = func(size int, max int64) error {
+		return fmt.Errorf("record of %d bytes exceeds the maximum spool size of %d bytes", size, max)
+	}
+)
+
+// segment describes the segment file.
+type segment struct {
+	id      uint64
+	size    int64
+	records int
+}
+
+// Spool is the write-ahead queue backed by segment files. Records are
+// appended to the active segment until it reaches the segment size, and
+// then a new segment is started. Records are read in the same order they
+// were appended. The read position is persisted, so the pending records
+// survive restarts. When the size of all segments exceeds the cap, the
+// oldest segments are evicted to make room for new records.
+type Spool struct {
+	mu          sync.Mutex
+	name        string
+	dir         string
+	maxSize     int64
+	segmentSize int64
+
+	// segments are ordered from the oldest to the newest segment.
+	// The last segment is the active segment to which records are
+	// appended, and the first segment is the head segment from
+	// which records are read
+	segments []*segment
+	w        *os.File
+	r        *os.File
+	// nextID is the identifier of the next segment
+	nextID uint64
+
+	// rpos is the read offset in the head segment
+	rpos int64
+	// consumed is the number of records read from the head segment
+	consumed int
+	// peeked is the size of the last record returned by Peek
+	peeked int64
+
+	size   int64
+	depth  int
+	closed bool
+
+	depthVar *expvar.Int
+	bytesVar *expvar.Int
+}
+
+// Open opens the spool in the given directory. The directory is created
+// if it doesn't exist. The name identifies the spool in metrics and log
+// messages. Segments which were written by the previous instance of the
+// spool are recovered, and the records that were not read are replayed.
+func Open(name, dir string, maxSize, segmentSize int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("unable to create %s spool directory: %v", dir, err)
+	}
+	s := &Spool{
+		name:        name,
+		dir:         dir,
+		maxSize:     maxSize,
+		segmentSize: segmentSize,
+		segments:    make([]*segment, 0),
+		depthVar:    new(expvar.Int),
+		bytesVar:    new(expvar.Int),
+		nextID:      1,
+	}
+	spoolDepth.Set(name, s.depthVar)
+	spoolBytes.Set(name, s.bytesVar)
+
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+	var err error
+	switch {
+	case s.w != nil:
+	case len(s.segments) == 0 || s.segments[len(s.segments)-1].size >= segmentSize:
+		err = s.rotate()
+	default:
+		err = s.openActive()
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.updateMetrics()
+	if s.depth > 0 {
+		log.Infof("%s spool has %d pending records", name, s.depth)
+	}
+	return s, nil
+}
+
+// Append appends the record to the spool. If there is no room for
+// the record, the oldest segments are evicted. The record is synced
+// to disk before the method returns.
+func (s *Spool) Append(rec []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	n := int64(headerSize + len(rec))
+	if n > s.maxSize {
+		return ErrRecordTooLarge(len(rec), s.maxSize)
+	}
+	if err := s.evict(n); err != nil {
+		return err
+	}
+	active := s.segments[len(s.segments)-1]
+	if active.size > 0 && active.size+n > s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+		if err := s.compact(); err != nil {
+			return err
+		}
+		active = s.segments[len(s.segments)-1]
+	}
+
+	buf := make([]byte, n)
+	binary.LittleEndian.PutUint32(buf, uint32(len(rec)))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(rec))
+	copy(buf[headerSize:], rec)
+	if _, err := s.w.Write(buf); err != nil {
+		return fmt.Errorf("unable to write record to %s spool: %v", s.name, err)
+	}
+	if err := s.w.Sync(); err != nil {
+		return fmt.Errorf("unable to sync %s spool segment: %v", s.name, err)
+	}
+
+	active.size += n
+	active.records++
+	s.size += n
+	s.depth++
+	s.updateMetrics()
+
+	return nil
+}
+
+// Peek returns the oldest pending record without removing it from the
+// spool. The record is removed by calling Ack once it is processed. If
+// there are no pending records, io.EOF is returned.
+func (s *Spool) Peek() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	for s.depth > 0 {
+		head := s.segments[0]
+		if s.rpos >= head.size {
+			if err := s.removeHead(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if s.r == nil {
+			f, err := os.Open(s.segmentPath(head.id))
+			if err != nil {
+				return nil, fmt.Errorf("unable to open %s spool segment: %v", s.name, err)
+			}
+			s.r = f
+		}
+		rec, err := readRecord(s.r, s.rpos, head.size)
+		if err != nil {
+			// the rest of the segment can't be read, so
+			// the remaining records in the segment are lost
+			log.Warnf("discarding %d records from corrupted %s spool segment: %v", head.records-s.consumed, s.name, err)
+			s.depth -= head.records - s.consumed
+			s.rpos, s.consumed = head.size, head.records
+			s.updateMetrics()
+			continue
+		}
+		s.peeked = int64(headerSize + len(rec))
+		return rec, nil
+	}
+	return nil, io.EOF
+}
+
+// Ack removes the record returned by the last Peek call. The read
+// position is persisted, so the record is not replayed after restart.
+func (s *Spool) Ack() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if s.peeked == 0 {
+		return nil
+	}
+	s.rpos += s.peeked
+	s.consumed++
+	s.depth--
+	s.peeked = 0
+	if err := s.compact(); err != nil {
+		return err
+	}
+	s.updateMetrics()
+	return s.writeCursor()
+}
+
+// Len returns the number of pending records.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.depth
+}
+
+// Size returns the size in bytes of all segment files.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Close syncs the active segment and closes the spool.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.r != nil {
+		_ = s.r.Close()
+	}
+	if err := s.writeCursor(); err != nil {
+		return err
+	}
+	if err := s.w.Sync(); err != nil {
+		return err
+	}
+	return s.w.Close()
+}
+
+// recover loads the segments and the read position from the spool directory.
+func (s *Spool) recover() error {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("unable to read %s spool directory: %v", s.dir, err)
+	}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != segmentExt {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, &segment{id: id})
+		if id >= s.nextID {
+			s.nextID = id + 1
+		}
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].id < s.segments[j].id })
+
+	for _, seg := range s.segments {
+		if err := s.scan(seg); err != nil {
+			return err
+		}
+		s.size += seg.size
+		s.depth += seg.records
+	}
+
+	id, offset, err := s.readCursor()
+	if err != nil {
+		return err
+	}
+	if id >= s.nextID {
+		s.nextID = id + 1
+	}
+	// drop segments that were read entirely
+	for len(s.segments) > 0 && s.segments[0].id < id {
+		if err := s.removeHead(); err != nil {
+			return err
+		}
+	}
+	if len(s.segments) == 0 || s.segments[0].id != id {
+		return nil
+	}
+	// skip records preceding the read offset in the head segment
+	f, err := os.Open(s.segmentPath(id))
+	if err != nil {
+		return fmt.Errorf("unable to open %s spool segment: %v", s.name, err)
+	}
+	defer f.Close()
+	for s.rpos < offset && s.rpos < s.segments[0].size {
+		rec, err := readRecord(f, s.rpos, s.segments[0].size)
+		if err != nil {
+			break
+		}
+		s.rpos += int64(headerSize + len(rec))
+		s.consumed++
+		s.depth--
+	}
+	return nil
+}
+
+// scan counts the records in the segment. The segment is
+// truncated at the first record that is incomplete or has
+// an invalid checksum, e.g. due to torn writes.
+func (s *Spool) scan(seg *segment) error {
+	path := s.segmentPath(seg.id)
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("unable to open %s spool segment: %v", s.name, err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	var off int64
+	for off < fi.Size() {
+		rec, err := readRecord(f, off, fi.Size())
+		if err != nil {
+			log.Warnf("truncating %s spool segment %s at offset %d: %v", s.name, path, off, err)
+			if err := f.Truncate(off); err != nil {
+				return fmt.Errorf("unable to truncate %s spool segment: %v", s.name, err)
+			}
+			break
+		}
+		off += int64(headerSize + len(rec))
+		seg.records++
+	}
+	seg.size = off
+	return nil
+}
+
+// evict removes the oldest segments until there is room
+// for n bytes. If the active segment is the only segment,
+// a new active segment is started before evicting it.
+func (s *Spool) evict(n int64) error {
+	for s.size+n > s.maxSize && len(s.segments) > 0 {
+		if len(s.segments) == 1 {
+			if s.segments[0].size == 0 {
+				break
+			}
+			if err := s.rotate(); err != nil {
+				return err
+			}
+		}
+		evicted := s.segments[0].records - s.consumed
+		if evicted > 0 {
+			spoolEvictions.Add(s.name, int64(evicted))
+			log.Warnf("%s spool exceeded %d bytes. Evicting %d oldest records", s.name, s.maxSize, evicted)
+		}
+		s.depth -= evicted
+		s.peeked = 0
+		if err := s.removeHead(); err != nil {
+			return err
+		}
+		if err := s.writeCursor(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compact removes the segments preceding the active
+// segment whose records were read entirely.
+func (s *Spool) compact() error {
+	for len(s.segments) > 1 && s.rpos >= s.segments[0].size {
+		if err := s.removeHead(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotate starts a new active segment.
+func (s *Spool) rotate() error {
+	if s.w != nil {
+		if err := s.w.Close(); err != nil {
+			return err
+		}
+		s.w = nil
+	}
+	s.segments = append(s.segments, &segment{id: s.nextID})
+	s.nextID++
+	return s.openActive()
+}
+
+func (s *Spool) openActive() error {
+	active := s.segments[len(s.segments)-1]
+	f, err := os.OpenFile(s.segmentPath(active.id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to open %s spool segment: %v", s.name, err)
+	}
+	s.w = f
+	return nil
+}
+
+// removeHead removes the head segment and moves
+// the read position to the start of the next segment.
+func (s *Spool) removeHead() error {
+	head := s.segments[0]
+	if s.r != nil {
+		_ = s.r.Close()
+		s.r = nil
+	}
+	// the open segment can't be removed on Windows
+	if len(s.segments) == 1 && s.w != nil {
+		if err := s.w.Close(); err != nil {
+			return err
+		}
+		s.w = nil
+	}
+	if err := os.Remove(s.segmentPath(head.id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove %s spool segment: %v", s.name, err)
+	}
+	s.size -= head.size
+	s.segments = s.segments[1:]
+	s.rpos, s.consumed = 0, 0
+	if len(s.segments) == 0 {
+		return s.rotate()
+	}
+	return nil
+}
+
+func (s *Spool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+func (s *Spool) readCursor() (uint64, int64, error) {
+	b, err := os.ReadFile(filepath.Join(s.dir, cursorFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, fmt.Errorf("unable to read %s spool cursor: %v", s.name, err)
+	}
+	if len(b) != 16 {
+		log.Warnf("ignoring invalid %s spool cursor", s.name)
+		return 0, 0, nil
+	}
+	return binary.LittleEndian.Uint64(b), int64(binary.LittleEndian.Uint64(b[8:])), nil
+}
+
+func (s *Spool) writeCursor() error {
+	b := make([]byte, 16)
+	if len(s.segments) > 0 {
+		binary.LittleEndian.PutUint64(b, s.segments[0].id)
+		binary.LittleEndian.PutUint64(b[8:], uint64(s.rpos))
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, cursorFile), b, 0o644); err != nil {
+		return fmt.Errorf("unable to write %s spool cursor: %v", s.name, err)
+	}
+	return nil
+}
+
+func (s *Spool) updateMetrics() {
+	s.depthVar.Set(int64(s.depth))
+	s.bytesVar.Set(s.size)
+}
+
+// readRecord reads the record at the given offset and verifies its checksum.
+func readRecord(r io.ReaderAt, off, size int64) ([]byte, error) {
+	if off+headerSize > size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	var hdr [headerSize]byte
+	if _, err := r.ReadAt(hdr[:], off); err != nil {
+		return nil, err
+	}
+	n := int64(binary.LittleEndian.Uint32(hdr[:]))
+	if off+headerSize+n > size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	rec := make([]byte, n)
+	if _, err := r.ReadAt(rec, off+headerSize); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(rec) != binary.LittleEndian.Uint32(hdr[4:]) {
+		return nil, errors.New("record checksum mismatch")
+	}
+	return rec, nil
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spool
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func record(i int) []byte { return []byte(fmt.Sprintf("batch-%03d", i)) }
+
+// recordSize is the on-disk size of the test record
+var recordSize = int64(headerSize + len(record(0)))
+
+func segments(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	require.NoError(t, err)
+	return files
+}
+
+func TestSpoolAppendPeekAck(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open("test", dir, 1024*1024, recordSize*4)
+	require.NoError(t, err)
+	defer s.Close()
+
+	_, err = s.Peek()
+	require.ErrorIs(t, err, io.EOF)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, s.Append(record(i)))
+	}
+	assert.Equal(t, 10, s.Len())
+	assert.Equal(t, recordSize*10, s.Size())
+	assert.Len(t, segments(t, dir), 3)
+	assert.Equal(t, "10", spoolDepth.Get("test").String())
+
+	for i := 0; i < 10; i++ {
+		rec, err := s.Peek()
+		require.NoError(t, err)
+		// peeking again yields the same record
+		rec1, err := s.Peek()
+		require.NoError(t, err)
+		assert.Equal(t, rec, rec1)
+		assert.Equal(t, record(i), rec)
+		require.NoError(t, s.Ack())
+	}
+	assert.Equal(t, 0, s.Len())
+	_, err = s.Peek()
+	require.ErrorIs(t, err, io.EOF)
+	// segments read entirely are removed
+	assert.Len(t, segments(t, dir), 1)
+}
+
+func TestSpoolRecover(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open("test", dir, 1024*1024, recordSize*4)
+	require.NoError(t, err)
+
+	for i := 0; i < 6; i++ {
+		require.NoError(t, s.Append(record(i)))
+	}
+	for i := 0; i < 5; i++ {
+		_, err := s.Peek()
+		require.NoError(t, err)
+		require.NoError(t, s.Ack())
+	}
+	// the peeked record is not acknowledged,
+	// so it is replayed after reopening
+	_, err = s.Peek()
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	s, err = Open("test", dir, 1024*1024, recordSize*4)
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.Len())
+	require.NoError(t, s.Append(record(6)))
+
+	for i := 5; i < 7; i++ {
+		rec, err := s.Peek()
+		require.NoError(t, err)
+		assert.Equal(t, record(i), rec)
+		require.NoError(t, s.Ack())
+	}
+	require.NoError(t, s.Close())
+}
+
+func TestSpoolRecoverTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open("test", dir, 1024*1024, 1024)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.Append(record(i)))
+	}
+	require.NoError(t, s.Close())
+
+	// simulate the partially written record
+	files := segments(t, dir)
+	require.Len(t, files, 1)
+	f, err := os.OpenFile(files[0], os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0xff, 0, 0, 0, 1, 2})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = Open("test", dir, 1024*1024, 1024)
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, 3, s.Len())
+	assert.Equal(t, recordSize*3, s.Size())
+
+	require.NoError(t, s.Append(record(3)))
+	for i := 0; i < 4; i++ {
+		rec, err := s.Peek()
+		require.NoError(t, err)
+		assert.Equal(t, record(i), rec)
+		require.NoError(t, s.Ack())
+	}
+}
+
+func TestSpoolEviction(t *testing.T) {
+	var evictions int64
+	if v, ok := spoolEvictions.Get("evict").(*expvar.Int); ok {
+		evictions = v.Value()
+	}
+
+	dir := t.TempDir()
+	s, err := Open("evict", dir, recordSize*8, recordSize*4)
+	require.NoError(t, err)
+	defer s.Close()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, s.Append(record(i)))
+	}
+	// the oldest segment is evicted to keep the size under the cap
+	assert.Equal(t, 6, s.Len())
+	assert.True(t, s.Size() <= recordSize*8)
+	assert.Equal(t, evictions+4, spoolEvictions.Get("evict").(*expvar.Int).Value())
+
+	rec, err := s.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, record(4), rec)
+
+	require.ErrorContains(t, s.Append(make([]byte, recordSize*8)), "exceeds the maximum spool size")
+}
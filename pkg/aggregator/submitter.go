@@ -19,39 +19,188 @@
 package aggregator
 
 import (
+	"expvar"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/rabbitstack/fibratus/pkg/aggregator/spool"
+	"github.com/rabbitstack/fibratus/pkg/aggregator/transformers"
 	"github.com/rabbitstack/fibratus/pkg/kevent"
 	"github.com/rabbitstack/fibratus/pkg/outputs"
+	log "github.com/sirupsen/logrus"
+)
+
+// submitterQueueSize designates the number of batches that can be
+// pending in the submitter before the aggregator starts dropping
+// batches destined to the output.
+const submitterQueueSize = 64
+
+var (
+	// batchesDropped counts the number of batches dropped per output due to the output lagging behind
+	batchesDropped = expvar.NewMap("aggregator.output.batches.dropped")
+	// eventsRouted counts the number of events routed to each output
+	eventsRouted = expvar.NewMap("aggregator.output.events.routed")
 )
 
 // queue defines the type alias for the batch worker queue
 type queue chan *kevent.Batch
 
-// submitter initializes a group of load balanced output producers.
+// submitter routes event batches to a single output. Batches are
+// narrowed down by the output filter, the output transformers are
+// applied, and the resulting batch is pushed to the work queue from
+// which a group of load balanced output producers consume.
 type submitter struct {
-	wq      queue
-	workers []*worker
+	typ        outputs.Type
+	in         queue
+	wq         queue
+	filter     Filter
+	transforms []transformers.Transformer
+	workers    []*worker
+	spools     []*spool.Spool
 }
 
-func newSubmitter(wq queue, outputConfig outputs.Config) (*submitter, error) {
+func newSubmitter(outputConfig outputs.Config, filter Filter, spoolConfig SpoolConfig) (*submitter, error) {
 	output, err := outputs.Load(outputConfig.Type, outputConfig)
 	if err != nil {
 		return nil, err
 	}
+	transforms, err := transformers.LoadAll(outputConfig.Transformers)
+	if err != nil {
+		return nil, err
+	}
 	clients := output.Clients
-	workers := make([]*worker, len(clients))
+	var spools []*spool.Spool
+	if spoolConfig.Enabled && len(clients) > 0 {
+		// each client gets its own spool, so the batches
+		// are replayed in the order they were published
+		spools = make([]*spool.Spool, len(clients))
+		maxSize := int64(spoolConfig.MaxSize) * 1024 * 1024 / int64(len(clients))
+		segmentSize := int64(spoolConfig.SegmentSize) * 1024 * 1024
+		for i := range clients {
+			name := fmt.Sprintf("%s.%d", outputConfig.Type, i)
+			dir := filepath.Join(spoolConfig.Path(), outputConfig.Type.String(), strconv.Itoa(i))
+			spools[i], err = spool.Open(name, dir, maxSize, segmentSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return initSubmitter(outputConfig.Type, clients, spools, filter, transforms), nil
+}
 
+func initSubmitter(
+	typ outputs.Type,
+	clients []outputs.Client,
+	spools []*spool.Spool,
+	filter Filter,
+	transforms []transformers.Transformer,
+) *submitter {
+	s := &submitter{
+		typ:        typ,
+		in:         make(queue, submitterQueueSize),
+		wq:         make(queue),
+		filter:     filter,
+		transforms: transforms,
+		workers:    make([]*worker, len(clients)),
+		spools:     spools,
+	}
 	for i, client := range clients {
-		workers[i] = initWorker(wq, client)
+		var sp *spool.Spool
+		if i < len(spools) {
+			sp = spools[i]
+		}
+		s.workers[i] = initWorker(s.wq, client, sp)
 	}
 
-	return &submitter{wq: wq, workers: workers}, nil
+	go s.run()
+
+	return s
 }
 
-func (s *submitter) shutdown() error {
+// submit enqueues the batch without blocking the caller. If
+// the output can't keep up with the incoming batches, the batch
+// is dropped, so the rest of outputs are not held back.
+func (s *submitter) submit(b *kevent.Batch) {
+	select {
+	case s.in <- b:
+	default:
+		batchesDropped.Add(s.typ.String(), 1)
+		log.Warnf("%s output is lagging behind. Dropping batch of %d events", s.typ, b.Len())
+	}
+}
+
+// flush enqueues the batch by blocking the caller until the
+// batch is accepted or the timeout expires.
+func (s *submitter) flush(b *kevent.Batch, timeout time.Duration) error {
+	select {
+	case s.in <- b:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("fail to flush events to %s output after stop timed out", s.typ)
+	}
+}
+
+func (s *submitter) run() {
+	defer close(s.wq)
+	for b := range s.in {
+		b = s.route(b)
+		if b.Len() == 0 {
+			continue
+		}
+		eventsRouted.Add(s.typ.String(), b.Len())
+		s.wq <- b
+	}
+}
+
+// route produces the batch with events that satisfy the output filter.
+// The events are cloned before applying the output transformers to
+// avoid interfering with the events routed to other outputs.
+func (s *submitter) route(b *kevent.Batch) *kevent.Batch {
+	if s.filter == nil && len(s.transforms) == 0 {
+		return b
+	}
+	evts := make([]*kevent.Kevent, 0, len(b.Events))
+	for _, evt := range b.Events {
+		if s.filter != nil && !s.filter.Run(evt) {
+			continue
+		}
+		if len(s.transforms) > 0 {
+			evt = evt.Clone()
+			for _, transform := range s.transforms {
+				if err := transform.Transform(evt); err != nil {
+					transformerErrors.Add(err.Error(), 1)
+				}
+			}
+		}
+		evts = append(evts, evt)
+	}
+	return kevent.NewBatch(evts...)
+}
+
+// shutdown waits for workers to publish pending batches and closes the clients.
+func (s *submitter) shutdown(timeout time.Duration) error {
+	close(s.in)
+	deadline := time.After(timeout)
+loop:
+	for _, w := range s.workers {
+		select {
+		case <-w.done:
+		case <-deadline:
+			log.Warnf("%s output didn't publish pending batches after stop timed out", s.typ)
+			break loop
+		}
+	}
 	for _, w := range s.workers {
 		if err := w.close(); err != nil {
 			return err
 		}
 	}
+	for _, sp := range s.spools {
+		if err := sp.Close(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aggregator
+
+import (
+	"expvar"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rabbitstack/fibratus/pkg/aggregator/transformers"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"github.com/rabbitstack/fibratus/pkg/outputs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type filterFunc func(kevt *kevent.Kevent) bool
+
+func (f filterFunc) Run(kevt *kevent.Kevent) bool { return f(kevt) }
+
+type renameTransformer struct{}
+
+func (renameTransformer) Transform(kevt *kevent.Kevent) error {
+	kevt.Name = "Renamed"
+	return nil
+}
+
+type memClient struct {
+	sync.Mutex
+	evts  []*kevent.Kevent
+	block chan struct{}
+}
+
+func (c *memClient) Connect() error { return nil }
+func (c *memClient) Close() error   { return nil }
+
+func (c *memClient) Publish(b *kevent.Batch) error {
+	if c.block != nil {
+		<-c.block
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.evts = append(c.evts, b.Events...)
+	return nil
+}
+
+func (c *memClient) events() []*kevent.Kevent {
+	c.Lock()
+	defer c.Unlock()
+	return c.evts
+}
+
+func TestSubmitterRouting(t *testing.T) {
+	all := &memClient{}
+	matches := &memClient{}
+
+	s1 := initSubmitter(outputs.Console, []outputs.Client{all}, nil, nil, nil)
+	s2 := initSubmitter(
+		outputs.AMQP,
+		[]outputs.Client{matches},
+		nil,
+		filterFunc(func(kevt *kevent.Kevent) bool { return kevt.Name == "CreateFile" }),
+		[]transformers.Transformer{renameTransformer{}},
+	)
+
+	b := kevent.NewBatch(&kevent.Kevent{Seq: 1, Name: "CreateFile"}, &kevent.Kevent{Seq: 2, Name: "RegSetValue"})
+	s1.submit(b)
+	s2.submit(b)
+
+	require.NoError(t, s1.shutdown(time.Second))
+	require.NoError(t, s2.shutdown(time.Second))
+
+	require.Len(t, all.events(), 2)
+	require.Len(t, matches.events(), 1)
+	assert.Equal(t, uint64(1), matches.events()[0].Seq)
+	assert.Equal(t, "Renamed", matches.events()[0].Name)
+	// output transformers don't alter events routed to other outputs
+	assert.Equal(t, "CreateFile", all.events()[0].Name)
+	assert.Equal(t, "CreateFile", b.Events[0].Name)
+}
+
+func TestSubmitterSlowOutput(t *testing.T) {
+	dropped := func(typ outputs.Type) int64 {
+		if v, ok := batchesDropped.Get(typ.String()).(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+	slowDropped, fastDropped := dropped(outputs.Elasticsearch), dropped(outputs.HTTP)
+
+	slow := &memClient{block: make(chan struct{})}
+	fast := &memClient{}
+
+	s1 := initSubmitter(outputs.Elasticsearch, []outputs.Client{slow}, nil, nil, nil)
+	s2 := initSubmitter(outputs.HTTP, []outputs.Client{fast}, nil, nil, nil)
+
+	// the fast output receives all batches while the
+	// slow output drops batches exceeding the queue
+	n := submitterQueueSize + 10
+	for i := 0; i < n; i++ {
+		b := kevent.NewBatch(&kevent.Kevent{Seq: uint64(i)})
+		s1.submit(b)
+		s2.submit(b)
+		require.Eventually(t, func() bool { return len(fast.events()) == i+1 }, time.Second*5, time.Millisecond)
+	}
+	slowDropped = dropped(outputs.Elasticsearch) - slowDropped
+	assert.True(t, slowDropped > 0)
+	assert.Equal(t, fastDropped, dropped(outputs.HTTP))
+
+	close(slow.block)
+	require.NoError(t, s1.shutdown(time.Second*5))
+	require.NoError(t, s2.shutdown(time.Second*5))
+	assert.Equal(t, int64(n), int64(len(slow.events()))+slowDropped)
+}
@@ -19,30 +19,55 @@
 package aggregator
 
 import (
+	"bytes"
 	"expvar"
+	"io"
+	"time"
+
+	"github.com/rabbitstack/fibratus/pkg/aggregator/spool"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
 	"github.com/rabbitstack/fibratus/pkg/outputs"
 	log "github.com/sirupsen/logrus"
-	"time"
 )
 
 // maxBackoff determines the maximum exponential backoff wait time before reconnecting the client
 const maxBackoff = time.Minute
 
-var clientPublishErrors = expvar.NewInt("aggregator.worker.client.publish.errors")
+// replayBatchSize is the max number of spooled batches replayed before the worker
+// gets a chance to consume the work queue
+const replayBatchSize = 32
+
+var (
+	clientPublishErrors = expvar.NewInt("aggregator.worker.client.publish.errors")
+	// spooledBatches counts the number of batches written to the spool
+	spooledBatches = expvar.NewInt("aggregator.worker.spooled.batches")
+	// replayedBatches counts the number of spooled batches published to the output
+	replayedBatches = expvar.NewInt("aggregator.worker.replayed.batches")
+	// spoolErrors counts the number of batches that couldn't be spooled or replayed
+	spoolErrors = expvar.NewInt("aggregator.worker.spool.errors")
+)
 
 type worker struct {
 	qu      queue
 	client  outputs.Client
 	backoff time.Duration
+	// spool stores batches that failed to publish. Spooled
+	// batches are replayed in order once the client recovers
+	spool *spool.Spool
+	// retry is the exponential backoff wait time before replaying spooled batches
+	retry time.Duration
+	// done is closed when the worker drains the queue
+	done chan struct{}
 }
 
-func initWorker(q queue, client outputs.Client) *worker {
-	w := &worker{qu: q, client: client, backoff: time.Second * 2}
+func initWorker(q queue, client outputs.Client, sp *spool.Spool) *worker {
+	w := &worker{qu: q, client: client, backoff: time.Second * 2, spool: sp, retry: time.Second, done: make(chan struct{})}
 	go w.run()
 	return w
 }
 
 func (w *worker) run() {
+	defer close(w.done)
 	for {
 		err := w.client.Connect()
 		if err != nil {
@@ -52,17 +77,152 @@ func (w *worker) run() {
 			if w.backoff > maxBackoff {
 				w.backoff = maxBackoff
 			}
-			<-time.After(w.backoff)
+			if !w.wait(w.backoff) {
+				return
+			}
 			continue
 		}
 		break
 	}
-	for batch := range w.qu {
+	if w.spool == nil {
+		for batch := range w.qu {
+			if err := w.client.Publish(batch); err != nil {
+				clientPublishErrors.Add(1)
+				log.Warnf("couldn't publish batch to client: %v", err)
+			}
+		}
+		return
+	}
+
+	var replay <-chan time.Time
+	if w.spool.Len() > 0 {
+		replay = time.After(0)
+	}
+	for {
+		select {
+		case batch, ok := <-w.qu:
+			if !ok {
+				return
+			}
+			// preserve the order of batches
+			// while there are spooled batches
+			if w.spool.Len() > 0 {
+				w.spill(batch)
+				continue
+			}
+			if err := w.client.Publish(batch); err != nil {
+				clientPublishErrors.Add(1)
+				log.Warnf("couldn't publish batch to client: %v. Spooling batch and retrying in %v...", err, w.retry)
+				w.spill(batch)
+				replay = w.backoffReplay()
+			}
+		case <-replay:
+			replay = w.replay()
+		}
+	}
+}
+
+// wait waits for the specified duration. Batches arriving to the work queue
+// in the meantime are spooled if the spool is enabled. It returns false if
+// the work queue was closed while waiting.
+func (w *worker) wait(d time.Duration) bool {
+	if w.spool == nil {
+		<-time.After(d)
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return true
+		case batch, ok := <-w.qu:
+			if !ok {
+				return false
+			}
+			w.spill(batch)
+		}
+	}
+}
+
+// spill writes the batch to the spool.
+func (w *worker) spill(batch *kevent.Batch) {
+	if err := w.spool.Append(batch.MarshalJSON()); err != nil {
+		spoolErrors.Add(1)
+		log.Warnf("couldn't spool batch: %v", err)
+		return
+	}
+	spooledBatches.Add(1)
+}
+
+// replay publishes spooled batches in order. If the client fails to publish
+// the batch, the replay is rescheduled with exponential backoff. It returns
+// the channel that fires when the next replay is due, or nil if all spooled
+// batches were published.
+func (w *worker) replay() <-chan time.Time {
+	for i := 0; i < replayBatchSize; i++ {
+		rec, err := w.spool.Peek()
+		if err == io.EOF {
+			w.retry = time.Second
+			return nil
+		}
+		if err != nil {
+			spoolErrors.Add(1)
+			log.Warnf("couldn't read spooled batch: %v", err)
+			return w.backoffReplay()
+		}
+		batch, err := decodeBatch(rec)
+		if err != nil {
+			// the batch can't be recovered, so skip it
+			spoolErrors.Add(1)
+			log.Warnf("discarding invalid spooled batch: %v", err)
+			if err := w.spool.Ack(); err != nil {
+				log.Warnf("couldn't acknowledge spooled batch: %v", err)
+				return w.backoffReplay()
+			}
+			continue
+		}
 		if err := w.client.Publish(batch); err != nil {
 			clientPublishErrors.Add(1)
-			log.Warnf("couldn't publish batch to client: %v", err)
+			log.Warnf("couldn't replay spooled batch: %v. Retrying in %v...", err, w.retry)
+			return w.backoffReplay()
+		}
+		replayedBatches.Add(1)
+		w.retry = time.Second
+		if err := w.spool.Ack(); err != nil {
+			log.Warnf("couldn't acknowledge spooled batch: %v", err)
+			return w.backoffReplay()
+		}
+	}
+	// give the worker a chance to consume the
+	// work queue before replaying the next batches
+	return time.After(0)
+}
+
+func (w *worker) backoffReplay() <-chan time.Time {
+	c := time.After(w.retry)
+	w.retry *= 2
+	if w.retry > maxBackoff {
+		w.retry = maxBackoff
+	}
+	return c
+}
+
+// decodeBatch recovers the batch of events from the spooled record.
+func decodeBatch(rec []byte) (*kevent.Batch, error) {
+	dec := kevent.NewDecoder(bytes.NewReader(rec))
+	evts := make([]*kevent.Kevent, 0)
+	for {
+		evt, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
 		}
+		evts = append(evts, evt)
 	}
+	return kevent.NewBatch(evts...), nil
 }
 
 func (w *worker) close() error {
@@ -19,10 +19,15 @@
 package aggregator
 
 import (
+	"errors"
+	"github.com/rabbitstack/fibratus/pkg/aggregator/spool"
 	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"github.com/rabbitstack/fibratus/pkg/kevent/ktypes"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 )
@@ -82,7 +87,7 @@ func TestRunWorker(t *testing.T) {
 
 	client := &httpClient{url: srv.URL, wait: make(chan struct{}, 1), expectedPublished: 2}
 
-	w := initWorker(q, client)
+	w := initWorker(q, client, nil)
 	defer w.close()
 
 	<-client.wait
@@ -118,10 +123,96 @@ func TestConnectClientBackoff(t *testing.T) {
 		fail = false
 	})
 
-	w := initWorker(q, client)
+	w := initWorker(q, client, nil)
 	defer w.close()
 
 	<-client.wait
 
 	assert.Equal(t, 2, client.published)
 }
+
+type flakyClient struct {
+	sync.Mutex
+	fail bool
+	seqs []uint64
+}
+
+func (c *flakyClient) Connect() error { return nil }
+func (c *flakyClient) Close() error   { return nil }
+
+func (c *flakyClient) Publish(b *kevent.Batch) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.fail {
+		return errors.New("connection refused")
+	}
+	for _, evt := range b.Events {
+		c.seqs = append(c.seqs, evt.Seq)
+	}
+	return nil
+}
+
+func (c *flakyClient) setFail(fail bool) {
+	c.Lock()
+	defer c.Unlock()
+	c.fail = fail
+}
+
+func (c *flakyClient) published() []uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.seqs
+}
+
+func newBatch(seq uint64) *kevent.Batch {
+	return kevent.NewBatch(&kevent.Kevent{
+		Seq:       seq,
+		Type:      ktypes.CreateFile,
+		Name:      "CreateFile",
+		Category:  ktypes.File,
+		Timestamp: time.Now(),
+		Kparams:   kevent.Kparams{},
+		Metadata:  make(map[kevent.MetadataKey]any),
+	})
+}
+
+func TestWorkerSpool(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := spool.Open("worker", dir, 1024*1024, 1024)
+	require.NoError(t, err)
+
+	client := &flakyClient{fail: true}
+	q := make(queue)
+	w := initWorker(q, client, sp)
+
+	for i := 1; i <= 3; i++ {
+		q <- newBatch(uint64(i))
+	}
+	require.Eventually(t, func() bool { return sp.Len() == 3 }, time.Second*5, time.Millisecond*10)
+	assert.Empty(t, client.published())
+
+	// spooled batches are replayed in order once the client recovers
+	client.setFail(false)
+	require.Eventually(t, func() bool { return len(client.published()) == 3 }, time.Second*5, time.Millisecond*50)
+	assert.Equal(t, []uint64{1, 2, 3}, client.published())
+	assert.Equal(t, 0, sp.Len())
+
+	// batches that can't be published on shutdown are kept in the spool
+	client.setFail(true)
+	q <- newBatch(4)
+	close(q)
+	<-w.done
+	require.NoError(t, sp.Close())
+
+	sp, err = spool.Open("worker", dir, 1024*1024, 1024)
+	require.NoError(t, err)
+	defer sp.Close()
+	require.Equal(t, 1, sp.Len())
+	rec, err := sp.Peek()
+	require.NoError(t, err)
+	b, err := decodeBatch(rec)
+	require.NoError(t, err)
+	require.Len(t, b.Events, 1)
+	assert.Equal(t, uint64(4), b.Events[0].Seq)
+	assert.Equal(t, "CreateFile", b.Events[0].Name)
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019-2020 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handler
+
+import (
+	"encoding/json"
+	"github.com/rabbitstack/fibratus/pkg/filter"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"io"
+	"net/http"
+)
+
+// maxEventSize is the maximum size of the event payload
+const maxEventSize = 1 << 20
+
+// Explainer explains the evaluation of the rule against the event.
+type Explainer interface {
+	Explain(rule string, kevt *kevent.Kevent) (*filter.Explanation, error)
+}
+
+// Explain is the handler that evaluates the rule given in the rule query parameter
+// against the JSON event posted in the request body. The response contains the
+// evaluation trace along with the current state of sequence and threshold rules.
+func Explain(e Explainer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		rule := r.URL.Query().Get("rule")
+		if rule == "" {
+			http.Error(w, "rule query parameter is required", http.StatusBadRequest)
+			return
+		}
+		b, err := io.ReadAll(io.LimitReader(r.Body, maxEventSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		kevt, err := kevent.NewFromJSON(b)
+		if err != nil {
+			http.Error(w, "invalid event: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		exp, err := e.Explain(rule, kevt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(exp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
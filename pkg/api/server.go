@@ -30,9 +30,32 @@ import (
 	"strings"
 )
 
-func setupServer(lis net.Listener, c *config.Config) {
+// Option enables exposing additional API endpoints.
+type Option func(o *opts)
+
+type opts struct {
+	explainer handler.Explainer
+}
+
+// WithExplainer exposes the endpoint for explaining the
+// evaluation of rules against events in the running engine.
+func WithExplainer(e handler.Explainer) Option {
+	return func(o *opts) {
+		o.explainer = e
+	}
+}
+
+func setupServer(lis net.Listener, c *config.Config, options ...Option) {
+	var opts opts
+	for _, opt := range options {
+		opt(&opts)
+	}
+
 	mux := http.NewServeMux()
 	mux.Handle("/config", handler.Config(c))
+	if opts.explainer != nil {
+		mux.Handle("/rules/explain", handler.Explain(opts.explainer))
+	}
 	mux.Handle("/debug/vars", expvar.Handler())
 
 	mux.HandleFunc("/debug/pprof/", pprof.Index)
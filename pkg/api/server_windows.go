@@ -29,7 +29,7 @@ import (
 var listener net.Listener
 
 // StartServer starts the HTTP server with the specified configuration.
-func StartServer(c *config.Config) error {
+func StartServer(c *config.Config, options ...Option) error {
 	var err error
 	apiConfig := c.API
 	if strings.HasPrefix(apiConfig.Transport, `npipe:///`) {
@@ -54,7 +54,7 @@ func StartServer(c *config.Config) error {
 		return err
 	}
 
-	setupServer(listener, c)
+	setupServer(listener, c, options...)
 
 	return nil
 }
@@ -0,0 +1,201 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/rabbitstack/fibratus/pkg/util/bundle"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	u "net/url"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// maxBundleSize is the maximum size of the bundle archive or signature download
+const maxBundleSize = 64 * 1024 * 1024
+
+// RuleBundle describes the signed rule bundle.
+type RuleBundle struct {
+	// URL is the location of the bundle archive
+	URL string `json:"url" yaml:"url" mapstructure:"url"`
+	// SignatureURL is the location of the detached bundle signature.
+	// If not given, the signature is fetched from the bundle URL with
+	// the .sig suffix
+	SignatureURL string `json:"signature-url" yaml:"signature-url" mapstructure:"signature-url"`
+	// Version pins the bundle version. If given, the bundle
+	// is refused unless its manifest declares this version
+	Version string `json:"version" yaml:"version" mapstructure:"version"`
+}
+
+// GetSignatureURL returns the location of the detached bundle signature.
+func (b RuleBundle) GetSignatureURL() string {
+	if b.SignatureURL != "" {
+		return b.SignatureURL
+	}
+	return b.URL + ".sig"
+}
+
+// cacheName returns the base name of the cached bundle files.
+func (b RuleBundle) cacheName() string {
+	h := sha256.Sum256([]byte(b.URL))
+	return hex.EncodeToString(h[:8])
+}
+
+// loadBundle fetches the rule bundle and its signature, verifies the
+// signature against trusted keys, and decodes bundle rules. If the
+// bundle can't be fetched, the bundle is loaded from the cache. The
+// cached bundle is verified in the same way as the downloaded bundle.
+// Rules are never decoded from the bundle that fails verification.
+func (f *Filters) loadBundle(b RuleBundle, keys []*bundle.PublicKey) ([]*FilterConfig, error) {
+	log.Infof("loading rule bundle from URL %s", b.URL)
+	archive, sig, err := fetchBundle(b)
+	cached := false
+	if err != nil {
+		if f.Rules.BundleCacheDir == "" {
+			return nil, err
+		}
+		log.Warnf("%v. Loading the cached rule bundle", err)
+		archive, sig, err = f.readCachedBundle(b)
+		if err != nil {
+			return nil, fmt.Errorf("cannot fetch rule bundle from %q and no cached bundle is available: %v", b.URL, err)
+		}
+		cached = true
+	}
+
+	if err := bundle.Verify(archive, sig, keys); err != nil {
+		return nil, fmt.Errorf("refusing to load rule bundle from %q: signature verification failed: %v", b.URL, err)
+	}
+	bdl, err := bundle.Open(b.URL, archive)
+	if err != nil {
+		return nil, fmt.Errorf("refusing to load rule bundle from %q: %v", b.URL, err)
+	}
+	if b.Version != "" && bdl.Manifest.Version != b.Version {
+		return nil, fmt.Errorf("refusing to load rule bundle from %q: bundle version %s doesn't match the pinned version %s",
+			b.URL, bdl.Manifest.Version, b.Version)
+	}
+	log.Infof("verified rule bundle %s %s", bdl.Manifest.Name, bdl.Manifest.Version)
+
+	if !cached && f.Rules.BundleCacheDir != "" {
+		if err := f.writeCachedBundle(b, archive, sig); err != nil {
+			log.Warnf("unable to cache rule bundle from %q: %v", b.URL, err)
+		}
+	}
+
+	filters := make([]*FilterConfig, 0)
+	for _, file := range bdl.Files {
+		if !isValidExt(file.Path) || IsRuleTestFile(file.Path) {
+			continue
+		}
+		flt, err := decodeFilter(b.URL+"!"+file.Path, file.Data)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, flt)
+	}
+	return filters, nil
+}
+
+// parseTrustedKeys parses public keys used to verify rule bundles.
+func (f *Filters) parseTrustedKeys() ([]*bundle.PublicKey, error) {
+	keys := make([]*bundle.PublicKey, 0, len(f.Rules.TrustedKeys))
+	for _, k := range f.Rules.TrustedKeys {
+		key, err := bundle.ParsePublicKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted key %q: %v", k, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func fetchBundle(b RuleBundle) ([]byte, []byte, error) {
+	url, err := u.Parse(b.URL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%q is an invalid URL", b.URL)
+	}
+	if !bundle.IsBundle(path.Base(url.Path)) {
+		return nil, nil, fmt.Errorf("%q: %v", b.URL, bundle.ErrUnsupportedFormat)
+	}
+	archive, err := fetch(b.URL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot fetch rule bundle from %q: %v", b.URL, err)
+	}
+	sig, err := fetch(b.GetSignatureURL())
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot fetch rule bundle signature from %q: %v", b.GetSignatureURL(), err)
+	}
+	return archive, sig, nil
+}
+
+func fetch(url string) ([]byte, error) {
+	//nolint:noctx
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got non-ok status code: %s", http.StatusText(resp.StatusCode))
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxBundleSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxBundleSize {
+		return nil, fmt.Errorf("resource exceeds %d bytes", maxBundleSize)
+	}
+	return b, nil
+}
+
+func (f *Filters) readCachedBundle(b RuleBundle) ([]byte, []byte, error) {
+	name := filepath.Join(f.Rules.BundleCacheDir, b.cacheName())
+	archive, err := os.ReadFile(name + ".bundle")
+	if err != nil {
+		return nil, nil, err
+	}
+	sig, err := os.ReadFile(name + ".sig")
+	if err != nil {
+		return nil, nil, err
+	}
+	return archive, sig, nil
+}
+
+// writeCachedBundle stores the verified bundle and its signature. Files
+// are written to temporary files first and then renamed, so the partially
+// written bundle never replaces the previous cached bundle.
+func (f *Filters) writeCachedBundle(b RuleBundle, archive, sig []byte) error {
+	if err := os.MkdirAll(f.Rules.BundleCacheDir, 0o700); err != nil {
+		return err
+	}
+	name := filepath.Join(f.Rules.BundleCacheDir, b.cacheName())
+	for ext, data := range map[string][]byte{".bundle": archive, ".sig": sig} {
+		if err := os.WriteFile(name+ext+".tmp", data, 0o600); err != nil {
+			return err
+		}
+		if err := os.Rename(name+ext+".tmp", name+ext); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -27,6 +27,8 @@ import (
 	"github.com/rabbitstack/fibratus/pkg/outputs/eventlog"
 
 	"github.com/rabbitstack/fibratus/pkg/outputs/http"
+	"github.com/rabbitstack/fibratus/pkg/outputs/kafka"
+	"github.com/rabbitstack/fibratus/pkg/outputs/syslog"
 
 	"github.com/rabbitstack/fibratus/pkg/aggregator"
 	"github.com/rabbitstack/fibratus/pkg/aggregator/transformers"
@@ -36,6 +38,7 @@ import (
 	"github.com/rabbitstack/fibratus/pkg/kevent"
 	"github.com/rabbitstack/fibratus/pkg/outputs/amqp"
 	"github.com/rabbitstack/fibratus/pkg/outputs/elasticsearch"
+	"github.com/rabbitstack/fibratus/pkg/outputs/file"
 	"github.com/rabbitstack/fibratus/pkg/util/log"
 	"github.com/rabbitstack/fibratus/pkg/util/multierror"
 	yara "github.com/rabbitstack/fibratus/pkg/yara/config"
@@ -85,8 +88,8 @@ type Config struct {
 	Filament FilamentConfig `json:"filament" yaml:"filament"`
 	// PE contains the settings that influences the behaviour of the PE (Portable Executable) reader.
 	PE pe.Config `json:"pe" yaml:"pe"`
-	// Output stores the currently active output config
-	Output outputs.Config
+	// Outputs stores the configuration of all active outputs
+	Outputs []outputs.Config
 	// InitHandleSnapshot indicates whether initial handle snapshot is built
 	InitHandleSnapshot bool `json:"init-handle-snapshot" yaml:"init-handle-snapshot"`
 	// EnumerateHandles indicates if process handles are collected during startup or
@@ -219,6 +222,9 @@ func NewWithOpts(options ...Option) *Config {
 		elasticsearch.AddFlags(flagSet)
 		http.AddFlags(flagSet)
 		eventlog.AddFlags(flagSet)
+		syslog.AddFlags(flagSet)
+		file.AddFlags(flagSet)
+		kafka.AddFlags(flagSet)
 		removet.AddFlags(flagSet)
 		replacet.AddFlags(flagSet)
 		renamet.AddFlags(flagSet)
@@ -377,7 +383,17 @@ func (c *Config) addFlags() {
 		c.flags.Bool(rulesEnabled, true, "Indicates if the rule engine is enabled and rules loaded")
 		c.flags.StringSlice(rulesFromPaths, []string{filepath.Join(dir, "*")}, "Comma-separated list of rules files")
 		c.flags.StringSlice(macrosFromPaths, []string{filepath.Join(dir, "Macros", "*")}, "Comma-separated list of macro files")
+		c.flags.StringSlice(exceptsFromPaths, []string{filepath.Join(dir, "Exceptions", "*")}, "Comma-separated list of global rule exception files")
 		c.flags.StringSlice(rulesFromURLs, []string{}, "Comma-separated list of rules URL resources")
+		c.flags.Bool(rulesReload, false, "Indicates if rules and macros are reloaded when rule files or URL resources change")
+		c.flags.Duration(rulesReloadIval, time.Minute, "Specifies how often rule URL resources are polled for changes")
+		c.flags.StringSlice(rulesTrustedKeys, []string{}, "Comma-separated list of ed25519 or minisign public keys trusted to sign rule bundles")
+		c.flags.String(rulesBundleCache, filepath.Join(filepath.Dir(exe), "..", "Cache", "Bundles"), "Specifies the directory where verified rule bundles are cached")
+		c.flags.Bool(rulesRequireSig, false, "Indicates if loading unsigned rules from URL resources is refused")
+		c.flags.Bool(riskEnabled, false, "Indicates if the risk engine accumulating risk scores of rule matches per process tree is enabled")
+		c.flags.Float64(riskThreshold, 100, "Specifies the accumulated risk score that triggers the meta-alert")
+		c.flags.Duration(riskHalfLife, time.Hour, "Specifies the time after which the risk score contributed by the rule match is halved")
+		c.flags.String(riskSeverity, "high", "Specifies the severity of the risk meta-alert")
 	}
 	if c.opts.capture {
 		c.flags.StringP(kcapFile, "o", "", "The path of the output kcap file")
@@ -37,6 +37,7 @@ import (
 	"slices"
 	"strings"
 	"text/template"
+	"time"
 )
 
 // FilterConfig is the descriptor of a single filter.
@@ -48,6 +49,7 @@ type FilterConfig struct {
 	Condition        string            `json:"condition" yaml:"condition"`
 	Action           []FilterAction    `json:"action" yaml:"action"`
 	Output           string            `json:"output" yaml:"output"`
+	OutputFormat     string            `json:"output-format" yaml:"output-format"`
 	Severity         string            `json:"severity" yaml:"severity"`
 	Labels           map[string]string `json:"labels" yaml:"labels"`
 	Tags             []string          `json:"tags" yaml:"tags"`
@@ -55,6 +57,63 @@ type FilterConfig struct {
 	Notes            string            `json:"notes" yaml:"notes"`
 	MinEngineVersion string            `json:"min-engine-version" yaml:"min-engine-version"`
 	Enabled          *bool             `json:"enabled" yaml:"enabled"`
+	Suppress         *FilterSuppress   `json:"suppress" yaml:"suppress"`
+	Exceptions       []FilterException `json:"exceptions" yaml:"exceptions"`
+	// Risk is the score the rule match contributes to the risk of the process tree
+	Risk int `json:"risk" yaml:"risk"`
+	// Source is the path or URL the rule was loaded from
+	Source string `json:"-" yaml:"-"`
+}
+
+const (
+	// OutputFormatFields designates the rule output with field modifiers, e.g. %ps.exe
+	OutputFormatFields = "fields"
+	// OutputFormatTemplate designates the rule output rendered as the Go template
+	OutputFormatTemplate = "template"
+)
+
+// FilterSuppress defines the alert suppression settings. Alerts
+// produced by the rule are deduplicated by the values of the given
+// fields. Only the first alert is sent for each distinct tuple of
+// field values within the time window.
+type FilterSuppress struct {
+	// By contains the fields whose values identify duplicate alerts
+	By []string `json:"by" yaml:"by"`
+	// Window is the time frame in which duplicate alerts are suppressed
+	Window time.Duration `json:"window" yaml:"window"`
+}
+
+// FilterException describes the events that must not trigger the
+// rule. Exceptions declared in the rule apply to that rule only,
+// while exceptions from the global exceptions files are scoped to
+// rules by rule identifier, tactic identifier, or tag.
+type FilterException struct {
+	// Name describes the reason for the exception
+	Name string `json:"name" yaml:"name"`
+	// Expr is the filter expression matching the excluded events
+	Expr string `json:"expr" yaml:"expr"`
+	// Rules contains the identifiers of the rules the exception applies to
+	Rules []string `json:"rules" yaml:"rules"`
+	// Tactics contains the tactic identifiers of the rules the exception applies to
+	Tactics []string `json:"tactics" yaml:"tactics"`
+	// Tags contains the tags of the rules the exception applies to
+	Tags []string `json:"tags" yaml:"tags"`
+}
+
+// appliesTo determines if the global exception is scoped to the filter.
+func (e FilterException) appliesTo(f *FilterConfig) bool {
+	if slices.Contains(e.Rules, f.ID) {
+		return true
+	}
+	if tactic := f.Labels["tactic.id"]; tactic != "" && slices.Contains(e.Tactics, tactic) {
+		return true
+	}
+	for _, tag := range f.Tags {
+		if slices.Contains(e.Tags, tag) {
+			return true
+		}
+	}
+	return false
 }
 
 // FilterAction wraps all possible filter actions.
@@ -94,15 +153,30 @@ func (f FilterConfig) DecodeActions() ([]any, error) {
 	return actions, nil
 }
 
+// IsSuppressed determines if the alert suppression is enabled for this filter.
+func (f FilterConfig) IsSuppressed() bool {
+	return f.Suppress != nil && len(f.Suppress.By) > 0 && f.Suppress.Window > 0
+}
+
+// IsOutputTemplate determines if the rule output is the Go template.
+func (f FilterConfig) IsOutputTemplate() bool { return f.OutputFormat == OutputFormatTemplate }
+
 // IsDisabled determines if this filter is disabled.
 func (f FilterConfig) IsDisabled() bool { return f.Enabled != nil && !*f.Enabled }
 
-// Filters contains references to rule and macro definitions.
+// HasRisk determines if the filter contributes to risk scores.
+func (f FilterConfig) HasRisk() bool { return f.Risk > 0 }
+
+// Filters contains references to rule, macro, and exception definitions.
 type Filters struct {
-	Rules   Rules  `json:"rules" yaml:"rules"`
-	Macros  Macros `json:"macros" yaml:"macros"`
-	macros  map[string]*Macro
-	filters []*FilterConfig
+	Rules      Rules      `json:"rules" yaml:"rules"`
+	Macros     Macros     `json:"macros" yaml:"macros"`
+	Exceptions Exceptions `json:"exceptions" yaml:"exceptions"`
+	Lists      []List     `json:"lists" yaml:"lists"`
+	Risk       Risk       `json:"risk" yaml:"risk"`
+	macros     map[string]*Macro
+	filters    []*FilterConfig
+	exceptions []FilterException
 }
 
 // FiltersWithMacros builds the filter config with the map of
@@ -117,6 +191,35 @@ type Rules struct {
 	Enabled   bool     `json:"enabled" yaml:"enabled"`
 	FromPaths []string `json:"from-paths" yaml:"from-paths"`
 	FromURLs  []string `json:"from-urls" yaml:"from-urls"`
+	// Reload indicates if rules and macros are reloaded when
+	// rule files are modified or remote rule resources change
+	Reload bool `json:"reload" yaml:"reload"`
+	// ReloadInterval specifies how often rule URLs are polled for changes
+	ReloadInterval time.Duration `json:"reload-interval" yaml:"reload-interval"`
+	// Bundles contains signed rule bundles fetched from URL addresses
+	Bundles []RuleBundle `json:"bundles" yaml:"bundles"`
+	// TrustedKeys contains ed25519 or minisign public keys used to verify rule bundles
+	TrustedKeys []string `json:"trusted-keys" yaml:"trusted-keys"`
+	// BundleCacheDir is the directory where verified rule bundles are
+	// cached, so they can be loaded when the bundle URL is unreachable
+	BundleCacheDir string `json:"bundle-cache-dir" yaml:"bundle-cache-dir"`
+	// RequireSigned indicates if loading unsigned rules from URL addresses is refused
+	RequireSigned bool `json:"require-signed" yaml:"require-signed"`
+}
+
+// Risk contains the settings of the risk engine. The risk engine
+// accumulates scores of rules matching the same process tree, and
+// emits the meta-alert when the accumulated score of the process
+// reaches the threshold.
+type Risk struct {
+	// Enabled indicates if the risk engine is enabled
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Threshold is the accumulated risk score that triggers the meta-alert
+	Threshold float64 `json:"threshold" yaml:"threshold"`
+	// HalfLife is the time after which the score contributed by the rule match is halved
+	HalfLife time.Duration `json:"half-life" yaml:"half-life"`
+	// Severity is the severity of the meta-alert
+	Severity string `json:"severity" yaml:"severity"`
 }
 
 // Macros contains attributes that describe the location of
@@ -125,6 +228,31 @@ type Macros struct {
 	FromPaths []string `json:"from-paths" yaml:"from-paths"`
 }
 
+// Exceptions contains attributes that describe the
+// location of global exception resources.
+type Exceptions struct {
+	FromPaths []string `json:"from-paths" yaml:"from-paths"`
+}
+
+// List describes the lookup list. Lookup lists are loaded from
+// the local file and can be referenced in rule conditions by name.
+type List struct {
+	// Name is the list name used in rule conditions
+	Name string `json:"name" yaml:"name" mapstructure:"name"`
+	// Path is the location of the list file
+	Path string `json:"path" yaml:"path" mapstructure:"path"`
+	// Format designates the file format. If not given, the
+	// format is inferred from the file extension
+	Format string `json:"format" yaml:"format" mapstructure:"format"`
+	// Column is the zero-based index of the column holding list
+	// values in CSV files
+	Column int `json:"column" yaml:"column" mapstructure:"column"`
+	// SkipHeader indicates if the first row of the CSV file is ignored
+	SkipHeader bool `json:"skip-header" yaml:"skip-header" mapstructure:"skip-header"`
+	// IgnoreCase indicates if list values are matched case-insensitively
+	IgnoreCase bool `json:"ignore-case" yaml:"ignore-case" mapstructure:"ignore-case"`
+}
+
 // Macro represents the state of the rule macro. Macros
 // either expand to expressions or lists.
 type Macro struct {
@@ -144,6 +272,11 @@ type ActionContext struct {
 	Events []*kevent.Kevent
 	// Filter represents the filter that matched the event
 	Filter *FilterConfig
+	// Suppressed indicates how many alerts were suppressed
+	// by the rule since the last alert was sent
+	Suppressed uint64
+	// Output is the alert text rendered from the rule output
+	Output string
 }
 
 // UniquePids returns a set of process identifiers
@@ -231,17 +364,49 @@ func (r RulesCompileResult) String() string {
 }
 
 const (
-	rulesEnabled    = "filters.rules.enabled"
-	rulesFromPaths  = "filters.rules.from-paths"
-	rulesFromURLs   = "filters.rules.from-urls"
-	macrosFromPaths = "filters.macros.from-paths"
+	rulesEnabled     = "filters.rules.enabled"
+	rulesFromPaths   = "filters.rules.from-paths"
+	rulesFromURLs    = "filters.rules.from-urls"
+	rulesReload      = "filters.rules.reload"
+	rulesReloadIval  = "filters.rules.reload-interval"
+	rulesBundles     = "filters.rules.bundles"
+	rulesTrustedKeys = "filters.rules.trusted-keys"
+	rulesBundleCache = "filters.rules.bundle-cache-dir"
+	rulesRequireSig  = "filters.rules.require-signed"
+	macrosFromPaths  = "filters.macros.from-paths"
+	exceptsFromPaths = "filters.exceptions.from-paths"
+	lookupLists      = "filters.lists"
+	riskEnabled      = "filters.risk.enabled"
+	riskThreshold    = "filters.risk.threshold"
+	riskHalfLife     = "filters.risk.half-life"
+	riskSeverity     = "filters.risk.severity"
 )
 
 func (f *Filters) initFromViper(v *viper.Viper) {
 	f.Rules.Enabled = v.GetBool(rulesEnabled)
 	f.Rules.FromPaths = v.GetStringSlice(rulesFromPaths)
 	f.Rules.FromURLs = v.GetStringSlice(rulesFromURLs)
+	f.Rules.Reload = v.GetBool(rulesReload)
+	f.Rules.ReloadInterval = v.GetDuration(rulesReloadIval)
+	f.Rules.TrustedKeys = v.GetStringSlice(rulesTrustedKeys)
+	f.Rules.BundleCacheDir = v.GetString(rulesBundleCache)
+	f.Rules.RequireSigned = v.GetBool(rulesRequireSig)
+	if bundles := v.Get(rulesBundles); bundles != nil {
+		if err := decode(bundles, &f.Rules.Bundles); err != nil {
+			log.Warnf("unable to decode rule bundles: %v", err)
+		}
+	}
 	f.Macros.FromPaths = v.GetStringSlice(macrosFromPaths)
+	f.Exceptions.FromPaths = v.GetStringSlice(exceptsFromPaths)
+	f.Risk.Enabled = v.GetBool(riskEnabled)
+	f.Risk.Threshold = v.GetFloat64(riskThreshold)
+	f.Risk.HalfLife = v.GetDuration(riskHalfLife)
+	f.Risk.Severity = v.GetString(riskSeverity)
+	if lists := v.Get(lookupLists); lists != nil {
+		if err := decode(lists, &f.Lists); err != nil {
+			log.Warnf("unable to decode lookup lists: %v", err)
+		}
+	}
 }
 
 func (f Filters) HasMacros() bool           { return len(f.macros) > 0 }
@@ -254,6 +419,9 @@ func (f Filters) IsMacroList(id string) bool {
 	return macro.List != nil
 }
 
+// GetMacros returns all loaded macros keyed by macro identifier.
+func (f Filters) GetMacros() map[string]*Macro { return f.macros }
+
 // LoadMacros from the macro library. The Go templates are applied
 // on each macro file before running the YAML decoder on them.
 func (f *Filters) LoadMacros() error {
@@ -309,10 +477,74 @@ func (f *Filters) LoadMacros() error {
 	return nil
 }
 
+// LoadExceptions loads global exceptions from exception files.
+func (f *Filters) LoadExceptions() error {
+	f.exceptions = make([]FilterException, 0)
+	for _, p := range f.Exceptions.FromPaths {
+		paths, err := filepath.Glob(p)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			if !isValidExt(path) {
+				continue
+			}
+			log.Infof("loading exceptions from file %s", path)
+			buf, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("couldn't load exceptions from file: %v", err)
+			}
+			// validate exceptions yaml structure
+			var out interface{}
+			err = yaml.Unmarshal(buf, &out)
+			if err != nil {
+				return fmt.Errorf("%q is invalid exceptions yaml file: %v", path, err)
+			}
+			valid, errs := validate(exceptionsSchema, out)
+			if !valid || len(errs) > 0 {
+				b, err := yaml.Marshal(&out)
+				if err == nil {
+					out = string(b)
+				}
+				return fmt.Errorf("invalid exception definition: \n\n"+
+					"%v in %s: %v", out, path, multierror.Wrap(errs...))
+			}
+			var exceptions []FilterException
+			if err := yaml.Unmarshal(buf, &exceptions); err != nil {
+				return err
+			}
+			f.exceptions = append(f.exceptions, exceptions...)
+		}
+	}
+	return nil
+}
+
+// GetExceptions returns all exceptions that apply to the filter.
+// These are the exceptions declared in the filter followed by
+// the global exceptions scoped to the filter.
+func (f Filters) GetExceptions(flt *FilterConfig) []FilterException {
+	exceptions := make([]FilterException, 0, len(flt.Exceptions))
+	exceptions = append(exceptions, flt.Exceptions...)
+	for _, e := range f.exceptions {
+		if e.appliesTo(flt) {
+			exceptions = append(exceptions, e)
+		}
+	}
+	return exceptions
+}
+
 func isValidExt(path string) bool {
 	return filepath.Ext(path) == ".yml" || filepath.Ext(path) == ".yaml"
 }
 
+// IsRuleTestFile determines if the file contains rule test
+// cases. Test files are located next to the rule file and
+// have the .test suffix before the file extension, e.g.
+// credential_access_lsass_dump.test.yml.
+func IsRuleTestFile(path string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(path, filepath.Ext(path)), ".test")
+}
+
 // LoadFilters loads rules from YAML files or URL addresses.
 func (f *Filters) LoadFilters() error {
 	f.filters = make([]*FilterConfig, 0)
@@ -324,7 +556,7 @@ func (f *Filters) LoadFilters() error {
 			return err
 		}
 		for _, path := range paths {
-			if !isValidExt(path) {
+			if !isValidExt(path) || IsRuleTestFile(path) {
 				continue
 			}
 			log.Infof("loading rule from %s", path)
@@ -344,6 +576,10 @@ func (f *Filters) LoadFilters() error {
 			f.filters = append(f.filters, flt)
 		}
 	}
+	if f.Rules.RequireSigned && len(f.Rules.FromURLs) > 0 {
+		return fmt.Errorf("refusing to load unsigned rules from [%s] URL(s). Use signed rule bundles instead",
+			strings.Join(f.Rules.FromURLs, ","))
+	}
 	for _, url := range f.Rules.FromURLs {
 		log.Infof("loading rule from URL %s", url)
 		if _, err := u.Parse(url); err != nil {
@@ -377,6 +613,30 @@ func (f *Filters) LoadFilters() error {
 		f.filters = append(f.filters, flt)
 	}
 
+	if len(f.Rules.Bundles) > 0 {
+		// all bundles are verified before
+		// any of the bundle rules is used
+		keys, err := f.parseTrustedKeys()
+		if err != nil {
+			return err
+		}
+		filters := make([]*FilterConfig, 0)
+		for _, b := range f.Rules.Bundles {
+			flts, err := f.loadBundle(b, keys)
+			if err != nil {
+				return err
+			}
+			filters = append(filters, flts...)
+		}
+		for _, flt := range filters {
+			if ids[flt.ID] {
+				return fmt.Errorf("%q rule uses duplicate id %s", flt.Name, flt.ID)
+			}
+			ids[flt.ID] = true
+			f.filters = append(f.filters, flt)
+		}
+	}
+
 	if len(f.filters) == 0 {
 		log.Warnf("no rules were loaded from [%s] path(s)", strings.Join(f.Rules.FromPaths, ","))
 	}
@@ -411,6 +671,7 @@ func decodeFilter(resource string, b []byte) (*FilterConfig, error) {
 	if err := yaml.Unmarshal(b, &flt); err != nil {
 		return nil, err
 	}
+	flt.Source = resource
 	return &flt, nil
 }
 
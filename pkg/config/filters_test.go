@@ -19,26 +19,34 @@
 package config
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestLoadRulesFromPaths(t *testing.T) {
 	filters := Filters{
-		Rules{
+		Rules: Rules{
 			FromPaths: []string{
 				"_fixtures/filters/default.yml",
 				"_fixtures/filters/default1.yml",
 			},
 		},
-		Macros{FromPaths: nil},
-		map[string]*Macro{},
-		[]*FilterConfig{},
+		Macros:  Macros{FromPaths: nil},
+		macros:  map[string]*Macro{},
+		filters: []*FilterConfig{},
 	}
 	err := filters.LoadFilters()
 	require.NoError(t, err)
@@ -68,18 +76,25 @@ func TestLoadRulesFromPaths(t *testing.T) {
 	assert.False(t, f2.IsDisabled())
 	assert.Equal(t, "suspicious network ACTIVITY", f2.Name)
 	assert.Equal(t, "kevt.category = 'net' and ps.name in ('at.exe', 'java.exe')", f2.Condition)
+	assert.True(t, f2.IsSuppressed())
+	assert.Equal(t, []string{"ps.exe", "net.dip"}, f2.Suppress.By)
+	assert.Equal(t, time.Hour, f2.Suppress.Window)
+	assert.False(t, f1.IsSuppressed())
+	require.Len(t, f2.Exceptions, 1)
+	assert.Equal(t, "Java updater", f2.Exceptions[0].Name)
+	assert.Equal(t, "ps.exe imatches 'C:\\\\Program Files\\\\Java\\\\*\\\\jucheck.exe'", f2.Exceptions[0].Expr)
 }
 
 func TestLoadRulesFromPathsWithTemplate(t *testing.T) {
 	filters := Filters{
-		Rules{
+		Rules: Rules{
 			FromPaths: []string{
 				"_fixtures/filters/default-with-template.yml",
 			},
 		},
-		Macros{FromPaths: nil},
-		map[string]*Macro{},
-		[]*FilterConfig{},
+		Macros:  Macros{FromPaths: nil},
+		macros:  map[string]*Macro{},
+		filters: []*FilterConfig{},
 	}
 	err := filters.LoadFilters()
 	require.NoError(t, err)
@@ -110,14 +125,14 @@ func TestLoadGroupsFromURLs(t *testing.T) {
 	defer srv.Close()
 
 	filters := Filters{
-		Rules{
+		Rules: Rules{
 			FromURLs: []string{
 				"http://localhost:3231/default.yml",
 			},
 		},
-		Macros{FromPaths: nil},
-		map[string]*Macro{},
-		[]*FilterConfig{},
+		Macros:  Macros{FromPaths: nil},
+		macros:  map[string]*Macro{},
+		filters: []*FilterConfig{},
 	}
 	err = filters.LoadFilters()
 	require.NoError(t, err)
@@ -139,3 +154,148 @@ func TestLoadGroupsFromURLs(t *testing.T) {
 
 	assert.Equal(t, "2.0.0", f1.MinEngineVersion)
 }
+
+func TestLoadExceptions(t *testing.T) {
+	filters := Filters{
+		Rules:      Rules{FromPaths: []string{"_fixtures/filters/default.yml", "_fixtures/filters/default1.yml"}},
+		Exceptions: Exceptions{FromPaths: []string{"_fixtures/exceptions/*.yml"}},
+	}
+	require.NoError(t, filters.LoadExceptions())
+	require.NoError(t, filters.LoadFilters())
+	require.Len(t, filters.exceptions, 3)
+
+	// scoped by tag
+	excs := filters.GetExceptions(filters.filters[0])
+	require.Len(t, excs, 1)
+	assert.Equal(t, "Lab hosts", excs[0].Name)
+
+	// rule exceptions come first, followed
+	// by exceptions scoped by rule identifier
+	excs = filters.GetExceptions(filters.filters[1])
+	require.Len(t, excs, 2)
+	assert.Equal(t, "Java updater", excs[0].Name)
+	assert.Equal(t, "Backup agent", excs[1].Name)
+
+	// scoped by tactic
+	f := &FilterConfig{ID: "8b2fe1c3-4f0e-4f79-b3c6-1d5b5b2c1d9a", Labels: map[string]string{"tactic.id": "TA0007"}}
+	excs = filters.GetExceptions(f)
+	require.Len(t, excs, 1)
+	assert.Equal(t, "Internal scanner", excs[0].Name)
+}
+
+func TestLoadExceptionsInvalidScope(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exceptions.yml")
+	require.NoError(t, os.WriteFile(path, []byte("- name: Unscoped\n  expr: ps.name = 'cmd.exe'\n"), os.ModePerm))
+	filters := Filters{Exceptions: Exceptions{FromPaths: []string{path}}}
+	require.Error(t, filters.LoadExceptions())
+}
+
+func TestIsRuleTestFile(t *testing.T) {
+	assert.True(t, IsRuleTestFile("rules/credential_access_lsass_dump.test.yml"))
+	assert.True(t, IsRuleTestFile("rules/credential_access_lsass_dump.test.json"))
+	assert.False(t, IsRuleTestFile("rules/credential_access_lsass_dump.yml"))
+	assert.False(t, IsRuleTestFile("rules/test.yml"))
+}
+
+func makeRuleBundle(t *testing.T, version string) []byte {
+	rule, err := os.ReadFile("_fixtures/filters/default.yml")
+	require.NoError(t, err)
+	files := map[string][]byte{
+		"bundle.yml":             []byte("name: fibratus-rules\nversion: " + version + "\n"),
+		"rules/network.yml":      rule,
+		"rules/network.test.yml": []byte("tests: []"),
+		"rules/README.md":        []byte("# Rules"),
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestLoadRuleBundles(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, untrusted, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	archive := makeRuleBundle(t, "2.1.0")
+	sig := ed25519.Sign(priv, archive)
+	online := true
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rules.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		if !online {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(archive)
+	})
+	mux.HandleFunc("/rules.tar.gz.sig", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString(sig)))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	newFilters := func(bundle RuleBundle) *Filters {
+		return &Filters{
+			Rules: Rules{
+				Bundles:        []RuleBundle{bundle},
+				TrustedKeys:    []string{base64.StdEncoding.EncodeToString(pub)},
+				BundleCacheDir: t.TempDir(),
+			},
+			macros:  map[string]*Macro{},
+			filters: []*FilterConfig{},
+		}
+	}
+
+	filters := newFilters(RuleBundle{URL: srv.URL + "/rules.tar.gz", Version: "2.1.0"})
+	require.NoError(t, filters.LoadFilters())
+	require.Len(t, filters.filters, 1)
+	assert.Equal(t, "only network category", filters.filters[0].Name)
+	assert.Equal(t, srv.URL+"/rules.tar.gz!rules/network.yml", filters.filters[0].Source)
+
+	// the cached bundle is loaded when the bundle URL is unreachable
+	online = false
+	require.NoError(t, filters.LoadFilters())
+	require.Len(t, filters.filters, 1)
+	online = true
+
+	// version pinning
+	filters = newFilters(RuleBundle{URL: srv.URL + "/rules.tar.gz", Version: "2.0.0"})
+	require.ErrorContains(t, filters.LoadFilters(), "bundle version 2.1.0 doesn't match the pinned version 2.0.0")
+	assert.Empty(t, filters.filters)
+
+	// signature made by the untrusted key
+	sig = ed25519.Sign(untrusted, archive)
+	filters = newFilters(RuleBundle{URL: srv.URL + "/rules.tar.gz"})
+	require.ErrorContains(t, filters.LoadFilters(), "signature verification failed")
+	assert.Empty(t, filters.filters)
+
+	// tampered bundle
+	sig = ed25519.Sign(priv, archive)
+	archive = makeRuleBundle(t, "2.1.1")
+	require.ErrorContains(t, filters.LoadFilters(), "signature verification failed")
+
+	// no trusted keys
+	filters.Rules.TrustedKeys = nil
+	require.ErrorContains(t, filters.LoadFilters(), "no trusted public keys configured")
+}
+
+func TestLoadUnsignedRulesRefused(t *testing.T) {
+	filters := Filters{
+		Rules: Rules{
+			FromURLs:      []string{"http://localhost:3231/default.yml"},
+			RequireSigned: true,
+		},
+		macros:  map[string]*Macro{},
+		filters: []*FilterConfig{},
+	}
+	require.ErrorContains(t, filters.LoadFilters(), "refusing to load unsigned rules")
+}
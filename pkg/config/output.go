@@ -22,7 +22,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
-	"strconv"
+	"sort"
 
 	"github.com/rabbitstack/fibratus/pkg/outputs/eventlog"
 
@@ -30,8 +30,11 @@ import (
 	"github.com/rabbitstack/fibratus/pkg/outputs/amqp"
 	"github.com/rabbitstack/fibratus/pkg/outputs/console"
 	"github.com/rabbitstack/fibratus/pkg/outputs/elasticsearch"
+	"github.com/rabbitstack/fibratus/pkg/outputs/file"
 	"github.com/rabbitstack/fibratus/pkg/outputs/http"
+	"github.com/rabbitstack/fibratus/pkg/outputs/kafka"
 	"github.com/rabbitstack/fibratus/pkg/outputs/null"
+	"github.com/rabbitstack/fibratus/pkg/outputs/syslog"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/sys/windows/svc"
 )
@@ -50,113 +53,127 @@ func (c *Config) tryLoadOutput() error {
 		return fmt.Errorf("expected map[string]interface{} type for output but found %s", reflect.TypeOf(output))
 	}
 
-	humNum := func(n int) string {
-		switch n {
-		case 2:
-			return "two"
-		case 3:
-			return "three"
-		case 4:
-			return "four"
-		case 5:
-			return "five"
-		case 6:
-			return "six"
-		case 7:
-			return "seven"
-		default:
-			return strconv.Itoa(n)
-		}
-	}
-	// don't permit if there are various outputs enabled at a time
-	activeOutputs := findActiveOutputs(mapping)
-	if len(activeOutputs) > 1 {
-		return fmt.Errorf("expected one but found %s active outputs: %s", humNum(len(activeOutputs)), activeOutputs)
-	}
+	c.Outputs = make([]outputs.Config, 0)
 
 	for typ, config := range mapping {
+		var (
+			enabled bool
+			out     interface{}
+		)
 		switch outputs.TypeFromString(typ) {
 		case outputs.Console:
 			var consoleConfig console.Config
 			if err := decode(config, &consoleConfig); err != nil {
 				return errOutputConfig(typ, err)
 			}
-			if !consoleConfig.Enabled {
-				continue
-			}
-			c.Output.Type, c.Output.Output = outputs.Console, consoleConfig
+			enabled, out = consoleConfig.Enabled, consoleConfig
 
 		case outputs.AMQP:
 			var amqpConfig amqp.Config
 			if err := decode(config, &amqpConfig); err != nil {
 				return errOutputConfig(typ, err)
 			}
-			if !amqpConfig.Enabled {
-				continue
-			}
-			c.Output.Type, c.Output.Output = outputs.AMQP, amqpConfig
+			enabled, out = amqpConfig.Enabled, amqpConfig
 
 		case outputs.Elasticsearch:
 			var esConfig elasticsearch.Config
 			if err := decode(config, &esConfig); err != nil {
 				return errOutputConfig(typ, err)
 			}
-			if !esConfig.Enabled {
-				continue
-			}
-			c.Output.Type, c.Output.Output = outputs.Elasticsearch, esConfig
+			enabled, out = esConfig.Enabled, esConfig
 
 		case outputs.HTTP:
 			var httpConfig http.Config
 			if err := decode(config, &httpConfig); err != nil {
 				return errOutputConfig(typ, err)
 			}
-			if !httpConfig.Enabled {
-				continue
-			}
-			c.Output.Type, c.Output.Output = outputs.HTTP, httpConfig
+			enabled, out = httpConfig.Enabled, httpConfig
 
 		case outputs.Eventlog:
 			var eventlogConfig eventlog.Config
 			if err := decode(config, &eventlogConfig); err != nil {
 				return errOutputConfig(typ, err)
 			}
-			if !eventlogConfig.Enabled {
-				continue
+			enabled, out = eventlogConfig.Enabled, eventlogConfig
+
+		case outputs.Syslog:
+			var syslogConfig syslog.Config
+			if err := decode(config, &syslogConfig); err != nil {
+				return errOutputConfig(typ, err)
+			}
+			enabled, out = syslogConfig.Enabled, syslogConfig
+
+		case outputs.File:
+			var fileConfig file.Config
+			if err := decode(config, &fileConfig); err != nil {
+				return errOutputConfig(typ, err)
+			}
+			enabled, out = fileConfig.Enabled, fileConfig
+
+		case outputs.Kafka:
+			var kafkaConfig kafka.Config
+			if err := decode(config, &kafkaConfig); err != nil {
+				return errOutputConfig(typ, err)
 			}
-			c.Output.Type, c.Output.Output = outputs.Eventlog, eventlogConfig
+			enabled, out = kafkaConfig.Enabled, kafkaConfig
+		}
+		if !enabled {
+			continue
 		}
-	}
 
-	// if it is not an interactive session but the console output is enabled
-	// we default to null output and warn about that
-	if isWindowsService() && c.Output.Output != nil {
-		if c.Output.Type == outputs.Console {
+		// if it is not an interactive session but the console
+		// output is enabled, we skip it and warn about that
+		if outputs.TypeFromString(typ) == outputs.Console && isWindowsService() {
 			log.Warn("running in non-interactive session with console output. " +
-				"Please configure a different output type. Defaulting to null output")
-			c.Output.Type, c.Output.Output = outputs.Null, &null.Config{}
-			return nil
+				"Please configure a different output type. Skipping console output")
+			continue
 		}
+
+		outputConfig := outputs.Config{Type: outputs.TypeFromString(typ), Output: out}
+		if err := parseOutputRouting(typ, config, &outputConfig); err != nil {
+			return err
+		}
+		c.Outputs = append(c.Outputs, outputConfig)
 	}
 
+	// keep the outputs in a stable order
+	sort.Slice(c.Outputs, func(i, j int) bool { return c.Outputs[i].Type < c.Outputs[j].Type })
+
 	// default to null output
-	if c.Output.Output == nil {
+	if len(c.Outputs) == 0 {
 		log.Warn("all outputs disabled. Defaulting to null output")
-		c.Output.Type, c.Output.Output = outputs.Null, &null.Config{}
+		c.Outputs = append(c.Outputs, outputs.Config{Type: outputs.Null, Output: &null.Config{}})
 	}
 
 	return nil
 }
 
-func findActiveOutputs(outputs map[string]interface{}) []string {
-	outputTypes := make([]string, 0)
-	for typ, rawConfig := range outputs {
-		enabled, ok := rawConfig.(map[string]interface{})["enabled"].(bool)
-		if ok && enabled {
-			outputTypes = append(outputTypes, typ)
+// parseOutputRouting decodes the filter expression and the
+// transformers that only apply to the given output.
+func parseOutputRouting(typ string, config interface{}, outputConfig *outputs.Config) error {
+	m, ok := config.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if filter, ok := m["filter"]; ok && filter != nil {
+		expr, ok := filter.(string)
+		if !ok {
+			return errOutputConfig(typ, fmt.Errorf("expected string filter but found %s", reflect.TypeOf(filter)))
+		}
+		outputConfig.Filter = expr
+	}
+	if transforms, ok := m["transformers"]; ok && transforms != nil {
+		mapping, ok := transforms.(map[string]interface{})
+		if !ok {
+			return errOutputConfig(typ, fmt.Errorf("expected map[string]interface{} type for transformers but found %s", reflect.TypeOf(transforms)))
+		}
+		configs, err := parseTransformers(mapping)
+		if err != nil {
+			return errOutputConfig(typ, err)
 		}
+		outputConfig.Transformers = configs
 	}
-	return outputTypes
+	return nil
 }
 
 // isWindowsService returns true if the process is running inside Windows Service.
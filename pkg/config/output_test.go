@@ -22,9 +22,11 @@ import (
 	"testing"
 	"time"
 
-	"github.com/rabbitstack/fibratus/pkg/outputs/eventlog"
-
+	"github.com/rabbitstack/fibratus/pkg/aggregator/transformers"
+	"github.com/rabbitstack/fibratus/pkg/outputs"
 	"github.com/rabbitstack/fibratus/pkg/outputs/amqp"
+	"github.com/rabbitstack/fibratus/pkg/outputs/elasticsearch"
+	"github.com/rabbitstack/fibratus/pkg/outputs/eventlog"
 	"github.com/rabbitstack/fibratus/pkg/outputs/http"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -40,10 +42,10 @@ func TestAMQPOutput(t *testing.T) {
 
 	require.NoError(t, c.Init())
 
-	require.NotNil(t, c.Output)
-	require.IsType(t, amqp.Config{}, c.Output.Output)
+	require.Len(t, c.Outputs, 1)
+	require.IsType(t, amqp.Config{}, c.Outputs[0].Output)
 
-	amqpConfig := c.Output.Output.(amqp.Config)
+	amqpConfig := c.Outputs[0].Output.(amqp.Config)
 	assert.Equal(t, "amqp://localhost:5672", amqpConfig.URL)
 	assert.Equal(t, time.Second*5, amqpConfig.Timeout)
 	assert.Equal(t, "fibratus", amqpConfig.Exchange)
@@ -62,10 +64,10 @@ func TestHTTPOutput(t *testing.T) {
 
 	require.NoError(t, c.Init())
 
-	require.NotNil(t, c.Output)
-	require.IsType(t, http.Config{}, c.Output.Output)
+	require.Len(t, c.Outputs, 1)
+	require.IsType(t, http.Config{}, c.Outputs[0].Output)
 
-	httpConfig := c.Output.Output.(http.Config)
+	httpConfig := c.Outputs[0].Output.(http.Config)
 	assert.True(t, httpConfig.Enabled)
 	assert.Len(t, httpConfig.Endpoints, 2)
 	assert.Contains(t, httpConfig.Endpoints, "http://localhost:8081")
@@ -90,10 +92,34 @@ func TestEventlogOutput(t *testing.T) {
 
 	require.NoError(t, c.Init())
 
-	require.NotNil(t, c.Output)
-	require.IsType(t, eventlog.Config{}, c.Output.Output)
+	require.Len(t, c.Outputs, 1)
+	require.IsType(t, eventlog.Config{}, c.Outputs[0].Output)
 
-	eventlogConfig := c.Output.Output.(eventlog.Config)
+	eventlogConfig := c.Outputs[0].Output.(eventlog.Config)
 	assert.True(t, eventlogConfig.Enabled)
 	assert.Equal(t, "INFO", eventlogConfig.Level)
 }
+
+func TestMultipleOutputs(t *testing.T) {
+	c := NewWithOpts(WithRun())
+
+	err := c.flags.Parse([]string{"--config-file=_fixtures/multi-output.yml"})
+	require.NoError(t, c.viper.BindPFlags(c.flags))
+	require.NoError(t, err)
+	require.NoError(t, c.TryLoadFile(c.GetConfigFile()))
+
+	require.NoError(t, c.Init())
+
+	require.Len(t, c.Outputs, 2)
+
+	require.Equal(t, outputs.AMQP, c.Outputs[0].Type)
+	require.IsType(t, amqp.Config{}, c.Outputs[0].Output)
+	assert.Equal(t, "kevt.meta[rule.name] != ''", c.Outputs[0].Filter)
+	require.Len(t, c.Outputs[0].Transformers, 1)
+	assert.Equal(t, transformers.Remove, c.Outputs[0].Transformers[0].Type)
+
+	require.Equal(t, outputs.Elasticsearch, c.Outputs[1].Type)
+	require.IsType(t, elasticsearch.Config{}, c.Outputs[1].Output)
+	assert.Empty(t, c.Outputs[1].Filter)
+	assert.Empty(t, c.Outputs[1].Transformers)
+}
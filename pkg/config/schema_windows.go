@@ -34,7 +34,17 @@ var schema = `
 			"type": "object",
 			"properties": {
 				"flush-period":		{"type": "string", "minLength": 2, "pattern": "[0-9]+ms|s"},
-				"flush-timeout":	{"type": "string", "minLength": 2, "pattern": "[0-9]+s"}
+				"flush-timeout":	{"type": "string", "minLength": 2, "pattern": "[0-9]+s"},
+				"spool": {
+					"type": "object",
+					"properties": {
+						"enabled":		{"type": "boolean"},
+						"dir":			{"type": "string"},
+						"max-size":		{"type": "integer", "minimum": 1},
+						"segment-size":	{"type": "integer", "minimum": 1}
+					},
+					"additionalProperties": false
+				}
 			},
 			"additionalProperties": false
 		},
@@ -141,7 +151,25 @@ var schema = `
 					"properties": {
 						"enabled": 		{"type": "boolean"},
 						"from-paths": 	{"type": ["array", "null"], "items": [{"type": "string", "minLength": 4}]},
-						"from-urls":	{"type": ["array", "null"], "items": [{"type": "string", "minLength": 8}]}
+						"from-urls":	{"type": ["array", "null"], "items": [{"type": "string", "minLength": 8}]},
+						"reload":		{"type": "boolean"},
+						"reload-interval":	{"type": "string", "minLength": 2, "pattern": "^[0-9]+(ms|s|m|h)$"},
+						"bundles": {
+							"type": ["array", "null"],
+							"items": {
+								"type": "object",
+								"properties": {
+									"url":				{"type": "string", "minLength": 8},
+									"signature-url":	{"type": "string", "minLength": 8},
+									"version":			{"type": "string", "minLength": 1}
+								},
+								"required": ["url"],
+								"additionalProperties": false
+							}
+						},
+						"trusted-keys":		{"type": ["array", "null"], "items": [{"type": "string", "minLength": 44}]},
+						"bundle-cache-dir":	{"type": "string"},
+						"require-signed":	{"type": "boolean"}
 					},
 					"additionalProperties": false
 				},
@@ -151,7 +179,40 @@ var schema = `
                         "from-paths": 	{"type": ["array", "null"], "items": [{"type": "string", "minLength": 4}]}
                     },
                     "additionalProperties": false
-                }
+                },
+				"exceptions": {
+					"type": "object",
+                    "properties": {
+                        "from-paths": 	{"type": ["array", "null"], "items": [{"type": "string", "minLength": 4}]}
+                    },
+                    "additionalProperties": false
+                },
+				"risk": {
+					"type": "object",
+					"properties": {
+						"enabled":		{"type": "boolean"},
+						"threshold":	{"type": "number", "exclusiveMinimum": 0},
+						"half-life":	{"type": "string", "minLength": 2, "pattern": "^[0-9]+(ms|s|m|h)$"},
+						"severity":		{"type": "string", "enum": ["low", "medium", "high", "critical"]}
+					},
+					"additionalProperties": false
+				},
+				"lists": {
+					"type": ["array", "null"],
+					"items": {
+						"type": "object",
+						"properties": {
+							"name":			{"type": "string", "minLength": 1},
+							"path":			{"type": "string", "minLength": 1},
+							"format":		{"type": "string", "enum": ["", "text", "csv", "json"]},
+							"column":		{"type": "integer", "minimum": 0},
+							"skip-header":	{"type": "boolean"},
+							"ignore-case":	{"type": "boolean"}
+						},
+						"required": ["name", "path"],
+						"additionalProperties": false
+					}
+				}
 			},
 			"additionalProperties": false
 		},
@@ -216,6 +277,8 @@ var schema = `
 							"type": "object",
 							"properties": {
 								"enabled":		{"type": "boolean"},
+								"filter":					{"type": "string"},
+								"transformers":				{"$ref": "#/properties/transformers"},
 								"format": 		{"type": "string", "enum": ["json", "pretty"]},
 								"template": 	{"type": "string"},
 								"kv-delimiter": {"type": "string"}
@@ -226,6 +289,8 @@ var schema = `
 							"type": "object",
 							"properties": {
 								"enabled":					{"type": "boolean"},
+								"filter":					{"type": "string"},
+								"transformers":				{"$ref": "#/properties/transformers"},
 								"servers": 					{"type": "array", "items": [{"type": "string", "minItems": 1, "format": "uri", "minLength": 1, "maxLength": 255, "pattern": "^(https?|http?)://"}]},
 								"timeout": 					{"type": "string"},
 								"index-name":				{"type": "string", "minLength": 1},
@@ -252,6 +317,8 @@ var schema = `
 							"type": "object",
 							"properties": {
 								"enabled":					{"type": "boolean"},
+								"filter":					{"type": "string"},
+								"transformers":				{"$ref": "#/properties/transformers"},
 								"url": 						{"type": "string", "format": "uri", "minLength": 1, "maxLength": 255, "pattern": "^(amqps?|amqp?)://"},
 								"timeout": 					{"type": "string", "minLength": 2, "pattern": "[0-9]+s|m}"},
 								"exchange": 				{"type": "string", "minLength": 1},
@@ -275,6 +342,8 @@ var schema = `
 							"type": "object",
 							"properties": {
 								"enabled":					{"type": "boolean"},
+								"filter":					{"type": "string"},
+								"transformers":				{"$ref": "#/properties/transformers"},
 								"endpoints": 				{"type": "array", "items": [{"type": "string", "minItems": 1, "format": "uri", "minLength": 1, "maxLength": 255, "pattern": "^(https?|http?)://"}]},
 								"timeout": 					{"type": "string", "minLength": 2, "pattern": "[0-9]+s|m}"},
 								"method": 					{"type": "string", "enum": ["POST", "PUT"]},
@@ -297,11 +366,85 @@ var schema = `
 							"type": "object",
 							"properties": {
 								"enabled":					{"type": "boolean"},
+								"filter":					{"type": "string"},
+								"transformers":				{"$ref": "#/properties/transformers"},
 								"level": 					{"type": "string", "enum": ["INFO", "info", "warn", "warning", "WARN", "WARNING", "error", "erro", "ERROR", "ERRO"]},
 								"remote-host": 				{"type": "string"},
 								"template": 				{"type": "string"}
 							},
 							"additionalProperties": false
+						},
+						"syslog": {
+							"type": "object",
+							"properties": {
+								"enabled":					{"type": "boolean"},
+								"filter":					{"type": "string"},
+								"transformers":				{"$ref": "#/properties/transformers"},
+								"network": 					{"type": "string", "enum": ["udp", "tcp", "tls"]},
+								"address": 					{"type": "string", "minLength": 1},
+								"timeout": 					{"type": "string", "minLength": 2, "pattern": "[0-9]+s"},
+								"format": 					{"type": "string", "enum": ["rfc5424", "rfc3164"]},
+								"framing": 					{"type": "string", "enum": ["octet-counting", "non-transparent"]},
+								"facility": 				{"type": "string"},
+								"severity": 				{"type": "string"},
+								"app-name": 				{"type": "string"},
+								"body": 					{"type": "string", "enum": ["json", "template"]},
+								"template": 				{"type": "string"},
+								"tls-key": 					{"type": "string"},
+								"tls-cert": 				{"type": "string"},
+								"tls-ca": 					{"type": "string"},
+								"tls-insecure-skip-verify": {"type": "boolean"}
+							},
+							"additionalProperties": false
+						},
+						"file": {
+							"type": "object",
+							"properties": {
+								"enabled":					{"type": "boolean"},
+								"filter":					{"type": "string"},
+								"transformers":				{"$ref": "#/properties/transformers"},
+								"path": 					{"type": "string"},
+								"format": 					{"type": "string", "enum": ["json", "pretty"]},
+								"template": 				{"type": "string"},
+								"max-size": 				{"type": "integer", "minimum": 0},
+								"max-age": 					{"type": "string"},
+								"max-backups": 				{"type": "integer", "minimum": 0},
+								"compress": 				{"type": "string", "enum": ["none", "gzip", "zstd"]},
+								"fsync": 					{"type": "string", "enum": ["none", "batch", "interval"]},
+								"fsync-interval": 			{"type": "string"}
+							},
+							"additionalProperties": false
+						},
+						"kafka": {
+							"type": "object",
+							"properties": {
+								"enabled":					{"type": "boolean"},
+								"filter":					{"type": "string"},
+								"transformers":				{"$ref": "#/properties/transformers"},
+								"brokers": 					{"type": "array", "items": [{"type": "string", "minLength": 1}]},
+								"topic": 					{"type": "string", "minLength": 1},
+								"partition-key": 			{"type": "string"},
+								"acks": 					{"type": "string", "enum": ["none", "leader", "all"]},
+								"compression": 				{"type": "string", "enum": ["none", "gzip", "snappy", "lz4", "zstd"]},
+								"max-message-bytes": 		{"type": "integer", "minimum": 1},
+								"timeout": 					{"type": "string", "minLength": 2, "pattern": "[0-9]+s"},
+								"client-id": 				{"type": "string"},
+								"enable-tls": 				{"type": "boolean"},
+								"sasl-mechanism": 			{"type": "string", "enum": ["", "plain", "scram-sha-256", "scram-sha-512"]},
+								"sasl-username": 			{"type": "string"},
+								"sasl-password": 			{"type": "string"},
+								"tls-key": 					{"type": "string"},
+								"tls-cert": 				{"type": "string"},
+								"tls-ca": 					{"type": "string"},
+								"tls-insecure-skip-verify": {"type": "boolean"}
+							},
+							"if": {
+								"properties": {"enabled": { "const": true }}
+							},
+							"then": {
+								"properties": {"brokers": {"type": "array", "minItems": 1, "items": [{"type": "string", "minLength": 1}]}}
+							},
+							"additionalProperties": false
 						}
 					},
 					"additionalProperties": false
@@ -506,8 +649,10 @@ var rulesSchema = `
 		"name": 				{"type": "string", "minLength": 3},
         "description":  		{"type": "string"},
 		"output": 				{"type": "string", "minLength": 5},
+		"output-format": 		{"type": "string", "enum": ["fields", "template"]},
 		"notes": 				{"type": "string"},
 		"severity":  			{"type": "string", "enum": ["low", "medium", "high", "critical"]},
+		"risk":  				{"type": "integer", "minimum": 0},
 		"min-engine-version":  	{"type": "string", "minLength": 5, "pattern": "^([0-9]+.)([0-9]+.)([0-9]+)$"},
 		"enabled":  			{"type": "boolean"},
 		"condition": 			{"type": "string", "minLength": 3},
@@ -517,6 +662,27 @@ var rulesSchema = `
 		},
 		"tags":					{"type": "array", "items": [{"type": "string", "minLength": 1}]},
 		"references":			{"type": "array", "items": [{"type": "string", "minLength": 1}]},
+		"suppress":				{
+			"type": "object",
+			"properties": {
+				"by": 		{"type": "array", "minItems": 1, "items": {"type": "string", "minLength": 3}},
+				"window": 	{"type": "string", "minLength": 2, "pattern": "^[0-9]+(ms|s|m|h)$"}
+			},
+			"required": ["by", "window"],
+			"additionalProperties": false
+		},
+		"exceptions":			{
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"name": 	{"type": "string"},
+					"expr": 	{"type": "string", "minLength": 3}
+				},
+				"required": ["expr"],
+				"additionalProperties": false
+			}
+		},
 		"action": 				{
 			"type": "array",
 			"items": {
@@ -558,6 +724,31 @@ var macrosSchema = `
 }
 `
 
+var exceptionsSchema = `
+{
+    "$schema": "http://json-schema.org/draft-07/schema#",
+    "type": "array",
+    "items":
+    {
+        "type": "object",
+        "properties": {
+            "name": 		{"type": "string"},
+            "expr":  		{"type": "string", "minLength": 3},
+            "rules":		{"type": "array", "items": {"type": "string", "minLength": 1}},
+            "tactics":		{"type": "array", "items": {"type": "string", "pattern": "^TA[0-9]{4}$"}},
+            "tags":			{"type": "array", "items": {"type": "string", "minLength": 1}}
+        },
+		"required":     ["expr"],
+		"anyOf": [
+            {"required": ["rules"]},
+            {"required": ["tactics"]},
+            {"required": ["tags"]}
+        ],
+        "additionalProperties": false
+    }
+}
+`
+
 type schemaConfig struct {
 	MaxBuffers    uint32
 	MinBuffers    uint32
@@ -40,7 +40,17 @@ func (c *Config) tryLoadTransformers() error {
 	if !ok {
 		return fmt.Errorf("expected map[string]interface{} type for transformers but found %s", reflect.TypeOf(transforms))
 	}
+	configs, err := parseTransformers(mapping)
+	if err != nil {
+		return err
+	}
+	c.Transformers = configs
+	return nil
+}
 
+// parseTransformers decodes the configuration of all
+// enabled transformers from the given mapping.
+func parseTransformers(mapping map[string]interface{}) ([]transformers.Config, error) {
 	configs := make([]transformers.Config, 0)
 
 	for typ, config := range mapping {
@@ -48,7 +58,7 @@ func (c *Config) tryLoadTransformers() error {
 		case "remove":
 			var removeConfig remove.Config
 			if err := decode(config, &removeConfig); err != nil {
-				return errTransformerConfig(typ, err)
+				return nil, errTransformerConfig(typ, err)
 			}
 			if !removeConfig.Enabled {
 				continue
@@ -62,7 +72,7 @@ func (c *Config) tryLoadTransformers() error {
 		case "rename":
 			var renameConfig rename.Config
 			if err := decode(config, &renameConfig); err != nil {
-				return errTransformerConfig(typ, err)
+				return nil, errTransformerConfig(typ, err)
 			}
 			if !renameConfig.Enabled {
 				continue
@@ -76,7 +86,7 @@ func (c *Config) tryLoadTransformers() error {
 		case "replace":
 			var replaceConfig replace.Config
 			if err := decode(config, &replaceConfig); err != nil {
-				return errTransformerConfig(typ, err)
+				return nil, errTransformerConfig(typ, err)
 			}
 			if !replaceConfig.Enabled {
 				continue
@@ -90,7 +100,7 @@ func (c *Config) tryLoadTransformers() error {
 		case "trim":
 			var trimConfig trim.Config
 			if err := decode(config, &trimConfig); err != nil {
-				return errTransformerConfig(typ, err)
+				return nil, errTransformerConfig(typ, err)
 			}
 			if !trimConfig.Enabled {
 				continue
@@ -104,7 +114,7 @@ func (c *Config) tryLoadTransformers() error {
 		case "tags":
 			var tagsConfig tags.Config
 			if err := decode(config, &tagsConfig); err != nil {
-				return errTransformerConfig(typ, err)
+				return nil, errTransformerConfig(typ, err)
 			}
 			if !tagsConfig.Enabled {
 				continue
@@ -117,7 +127,5 @@ func (c *Config) tryLoadTransformers() error {
 		}
 	}
 
-	c.Transformers = configs
-
-	return nil
+	return configs, nil
 }
@@ -20,6 +20,8 @@ package filter
 
 import (
 	"errors"
+	"fmt"
+	kerrors "github.com/rabbitstack/fibratus/pkg/errors"
 	"github.com/rabbitstack/fibratus/pkg/filter/fields"
 	"github.com/rabbitstack/fibratus/pkg/kevent"
 	"github.com/rabbitstack/fibratus/pkg/kevent/kparams"
@@ -46,6 +48,38 @@ type Accessor interface {
 	IsFieldAccessible(kevt *kevent.Kevent) bool
 }
 
+// NewFieldValuer returns the function that extracts the value of
+// the given filter field from the event. This allows components
+// that can't depend on the filter package, such as outputs, to
+// derive values from arbitrary event fields.
+func NewFieldValuer(name string) (func(kevt *kevent.Kevent) (kparams.Value, error), error) {
+	field := fields.Lookup(name)
+	if field == "" {
+		return nil, fmt.Errorf("%q is not a valid field", name)
+	}
+	accessors := GetAccessors()
+	for _, accessor := range accessors {
+		accessor.SetFields([]fields.Field{field})
+	}
+	return func(kevt *kevent.Kevent) (kparams.Value, error) {
+		var err error
+		for _, accessor := range accessors {
+			if !accessor.IsFieldAccessible(kevt) {
+				continue
+			}
+			v, aerr := accessor.Get(field, kevt)
+			if aerr != nil && !kerrors.IsKparamNotFound(aerr) {
+				err = aerr
+				continue
+			}
+			if v != nil {
+				return v, nil
+			}
+		}
+		return nil, err
+	}, nil
+}
+
 // kevtAccessor extracts generic event values.
 type kevtAccessor struct{}
 
@@ -127,6 +161,10 @@ func (k *kevtAccessor) Get(f fields.Field, kevt *kevent.Kevent) (kparams.Value,
 				return kevt.GetParamAsString(name), nil
 			}
 		}
+		if f.IsKevtMetaMap() {
+			key, _ := captureInBrackets(f.String())
+			return kevt.GetMetaAsString(kevent.MetadataKey(key)), nil
+		}
 		return nil, nil
 	}
 }
@@ -0,0 +1,217 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package attack computes the MITRE ATT&CK coverage of the rule set from
+// the tactic, technique, and subtechnique labels of the rules. The coverage
+// can be exported as the ATT&CK Navigator layer or rendered as the Markdown
+// or HTML coverage matrix.
+package attack
+
+import (
+	"fmt"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Tactic describes the MITRE ATT&CK enterprise tactic.
+type Tactic struct {
+	// ID is the tactic identifier, e.g. TA0006
+	ID string
+	// Name is the tactic name, e.g. Credential Access
+	Name string
+}
+
+// Shortname returns the tactic name as used by the ATT&CK Navigator, e.g. credential-access.
+func (t Tactic) Shortname() string {
+	return strings.ReplaceAll(strings.ToLower(t.Name), " ", "-")
+}
+
+// Tactics contains all enterprise tactics in the kill chain order.
+var Tactics = []Tactic{
+	{"TA0043", "Reconnaissance"},
+	{"TA0042", "Resource Development"},
+	{"TA0001", "Initial Access"},
+	{"TA0002", "Execution"},
+	{"TA0003", "Persistence"},
+	{"TA0004", "Privilege Escalation"},
+	{"TA0005", "Defense Evasion"},
+	{"TA0006", "Credential Access"},
+	{"TA0007", "Discovery"},
+	{"TA0008", "Lateral Movement"},
+	{"TA0009", "Collection"},
+	{"TA0011", "Command and Control"},
+	{"TA0010", "Exfiltration"},
+	{"TA0040", "Impact"},
+}
+
+// FindTactic returns the tactic with the given identifier.
+func FindTactic(id string) (Tactic, bool) {
+	for _, t := range Tactics {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return Tactic{}, false
+}
+
+var (
+	techniqueIDRegexp    = regexp.MustCompile(`^T\d{4}$`)
+	subtechniqueIDRegexp = regexp.MustCompile(`^T\d{4}\.\d{3}$`)
+)
+
+// Technique represents the technique or subtechnique covered by the rule set.
+type Technique struct {
+	// ID is the technique identifier, e.g. T1003 or T1003.001 for subtechniques
+	ID string
+	// Name is the technique name
+	Name string
+	// Tactic is the tactic the technique is detected under. The zero
+	// value indicates the rule doesn't declare a valid tactic
+	Tactic Tactic
+	// Rules contains the names of enabled rules detecting the technique
+	Rules []string
+}
+
+// IsSubtechnique determines if this is a subtechnique.
+func (t *Technique) IsSubtechnique() bool { return strings.Contains(t.ID, ".") }
+
+// Issue describes the rule with missing or malformed ATT&CK labels.
+type Issue struct {
+	// Rule is the rule name
+	Rule string
+	// Message describes the problem
+	Message string
+}
+
+// String returns the issue description.
+func (i Issue) String() string { return fmt.Sprintf("%s: %s", i.Rule, i.Message) }
+
+// Coverage is the ATT&CK coverage of the rule set.
+type Coverage struct {
+	// Techniques contains covered techniques and subtechniques
+	// sorted by the tactic kill chain order and identifier
+	Techniques []*Technique
+	// Issues contains rules with missing or malformed labels
+	Issues []Issue
+	// Rules is the number of enabled rules
+	Rules int
+}
+
+// NewCoverage computes the ATT&CK coverage of enabled rules.
+// Rules with missing or malformed technique identifiers don't
+// contribute to the coverage and are reported as issues.
+func NewCoverage(filters []*config.FilterConfig) *Coverage {
+	c := &Coverage{Techniques: make([]*Technique, 0), Issues: make([]Issue, 0)}
+	techniques := make(map[string]*Technique)
+
+	add := func(id, name string, tactic Tactic, rule string) {
+		key := id + "/" + tactic.ID
+		t, ok := techniques[key]
+		if !ok {
+			t = &Technique{ID: id, Name: name, Tactic: tactic, Rules: make([]string, 0)}
+			techniques[key] = t
+			c.Techniques = append(c.Techniques, t)
+		}
+		if t.Name == "" {
+			t.Name = name
+		}
+		t.Rules = append(t.Rules, rule)
+	}
+
+	for _, f := range filters {
+		if f.IsDisabled() {
+			continue
+		}
+		c.Rules++
+
+		tacticID := f.Labels["tactic.id"]
+		tactic, ok := FindTactic(tacticID)
+		switch {
+		case tacticID == "":
+			c.Issues = append(c.Issues, Issue{f.Name, "missing tactic.id label"})
+		case !ok:
+			c.Issues = append(c.Issues, Issue{f.Name, fmt.Sprintf("unknown tactic.id label %q", tacticID)})
+		}
+
+		techniqueID := f.Labels["technique.id"]
+		switch {
+		case techniqueID == "":
+			c.Issues = append(c.Issues, Issue{f.Name, "missing technique.id label"})
+			continue
+		case !techniqueIDRegexp.MatchString(techniqueID):
+			c.Issues = append(c.Issues, Issue{f.Name, fmt.Sprintf("malformed technique.id label %q. Expected the T#### format", techniqueID)})
+			continue
+		}
+		add(techniqueID, f.Labels["technique.name"], tactic, f.Name)
+
+		subtechniqueID := f.Labels["subtechnique.id"]
+		switch {
+		case subtechniqueID == "":
+		case !subtechniqueIDRegexp.MatchString(subtechniqueID):
+			c.Issues = append(c.Issues, Issue{f.Name, fmt.Sprintf("malformed subtechnique.id label %q. Expected the T####.### format", subtechniqueID)})
+		case !strings.HasPrefix(subtechniqueID, techniqueID+"."):
+			c.Issues = append(c.Issues, Issue{f.Name, fmt.Sprintf("subtechnique.id label %q is not a subtechnique of %s", subtechniqueID, techniqueID)})
+		default:
+			add(subtechniqueID, f.Labels["subtechnique.name"], tactic, f.Name)
+		}
+	}
+
+	order := make(map[string]int, len(Tactics))
+	for i, t := range Tactics {
+		order[t.ID] = i
+	}
+	rank := func(t Tactic) int {
+		if n, ok := order[t.ID]; ok {
+			return n
+		}
+		return len(Tactics)
+	}
+	sort.SliceStable(c.Techniques, func(i, j int) bool {
+		ti, tj := c.Techniques[i], c.Techniques[j]
+		if rank(ti.Tactic) != rank(tj.Tactic) {
+			return rank(ti.Tactic) < rank(tj.Tactic)
+		}
+		return ti.ID < tj.ID
+	})
+
+	return c
+}
+
+// TacticTechniques returns covered techniques and subtechniques of the tactic.
+func (c *Coverage) TacticTechniques(tactic Tactic) []*Technique {
+	techniques := make([]*Technique, 0)
+	for _, t := range c.Techniques {
+		if t.Tactic.ID == tactic.ID {
+			techniques = append(techniques, t)
+		}
+	}
+	return techniques
+}
+
+// Gaps returns tactics without any covered technique.
+func (c *Coverage) Gaps() []Tactic {
+	gaps := make([]Tactic, 0)
+	for _, tactic := range Tactics {
+		if len(c.TacticTechniques(tactic)) == 0 {
+			gaps = append(gaps, tactic)
+		}
+	}
+	return gaps
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package attack
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func newRule(name string, labels map[string]string) *config.FilterConfig {
+	return &config.FilterConfig{Name: name, Labels: labels}
+}
+
+func newRules() []*config.FilterConfig {
+	disabled := false
+	return []*config.FilterConfig{
+		newRule("LSASS memory dumping", map[string]string{
+			"tactic.id":         "TA0006",
+			"technique.id":      "T1003",
+			"technique.name":    "OS Credential Dumping",
+			"subtechnique.id":   "T1003.001",
+			"subtechnique.name": "LSASS Memory",
+		}),
+		newRule("SAM hive dumping", map[string]string{
+			"tactic.id":         "TA0006",
+			"technique.id":      "T1003",
+			"technique.name":    "OS Credential Dumping",
+			"subtechnique.id":   "T1003.002",
+			"subtechnique.name": "Security Account Manager",
+		}),
+		newRule("Suspicious DLL loaded by Office", map[string]string{
+			"tactic.id":      "TA0002",
+			"technique.id":   "T1204",
+			"technique.name": "User Execution",
+		}),
+		{Name: "Disabled rule", Enabled: &disabled, Labels: map[string]string{"tactic.id": "TA0040", "technique.id": "T1485"}},
+		newRule("Rule without technique", map[string]string{"tactic.id": "TA0005"}),
+		newRule("Rule with malformed technique", map[string]string{"tactic.id": "TA0005", "technique.id": "T1003.001"}),
+		newRule("Rule with mismatched subtechnique", map[string]string{"tactic.id": "TA0003", "technique.id": "T1547", "subtechnique.id": "T1053.005"}),
+		newRule("Rule with unknown tactic", map[string]string{"tactic.id": "TA9999", "technique.id": "T1059"}),
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	c := NewCoverage(newRules())
+
+	assert.Equal(t, 7, c.Rules)
+	require.Len(t, c.Techniques, 6)
+
+	// techniques are sorted by the kill chain order
+	assert.Equal(t, "T1204", c.Techniques[0].ID)
+	assert.Equal(t, "Execution", c.Techniques[0].Tactic.Name)
+	assert.Equal(t, "T1547", c.Techniques[1].ID)
+
+	tech := c.Techniques[2]
+	assert.Equal(t, "T1003", tech.ID)
+	assert.Equal(t, "OS Credential Dumping", tech.Name)
+	assert.Equal(t, []string{"LSASS memory dumping", "SAM hive dumping"}, tech.Rules)
+	assert.False(t, tech.IsSubtechnique())
+	assert.Equal(t, "T1003.001", c.Techniques[3].ID)
+	assert.True(t, c.Techniques[3].IsSubtechnique())
+	assert.Equal(t, []string{"LSASS memory dumping"}, c.Techniques[3].Rules)
+
+	// techniques of rules with unknown tactic come last
+	assert.Equal(t, "T1059", c.Techniques[5].ID)
+	assert.Empty(t, c.Techniques[5].Tactic.ID)
+
+	issues := make(map[string]string)
+	for _, issue := range c.Issues {
+		issues[issue.Rule] = issue.Message
+	}
+	assert.Len(t, issues, 4)
+	assert.Equal(t, "missing technique.id label", issues["Rule without technique"])
+	assert.Contains(t, issues["Rule with malformed technique"], `malformed technique.id label "T1003.001"`)
+	assert.Contains(t, issues["Rule with mismatched subtechnique"], "is not a subtechnique of T1547")
+	assert.Contains(t, issues["Rule with unknown tactic"], `unknown tactic.id label "TA9999"`)
+	assert.NotContains(t, issues, "Disabled rule")
+
+	gaps := c.Gaps()
+	assert.Len(t, gaps, len(Tactics)-3)
+	assert.NotContains(t, gaps, Tactic{"TA0006", "Credential Access"})
+	assert.Contains(t, gaps, Tactic{"TA0040", "Impact"})
+}
+
+func TestLayer(t *testing.T) {
+	layer := NewCoverage(newRules()).Layer("Fibratus rules")
+
+	b, err := json.Marshal(layer)
+	require.NoError(t, err)
+
+	var m map[string]any
+	require.NoError(t, json.Unmarshal(b, &m))
+	assert.Equal(t, "enterprise-attack", m["domain"])
+	assert.Equal(t, "Fibratus rules", m["name"])
+	assert.Contains(t, m, "versions")
+
+	require.Len(t, layer.Techniques, 6)
+	tech := layer.Techniques[2]
+	assert.Equal(t, "T1003", tech.TechniqueID)
+	assert.Equal(t, "credential-access", tech.Tactic)
+	assert.Equal(t, 2, tech.Score)
+	assert.True(t, tech.ShowSubtechniques)
+	assert.Equal(t, "LSASS memory dumping, SAM hive dumping", tech.Comment)
+	assert.Equal(t, []Metadata{{"rule", "LSASS memory dumping"}, {"rule", "SAM hive dumping"}}, tech.Metadata)
+	assert.Equal(t, "command-and-control", Tactic{"TA0011", "Command and Control"}.Shortname())
+
+	assert.Empty(t, layer.Techniques[5].Tactic)
+	assert.Equal(t, 2, layer.Gradient.MaxValue)
+}
+
+func TestMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewCoverage(newRules()).Markdown(&buf, "Coverage"))
+	md := buf.String()
+
+	assert.Contains(t, md, "# Coverage")
+	assert.Contains(t, md, "7 enabled rule(s) cover 4 technique(s) across 3 of 14 tactics.")
+	assert.Contains(t, md, "| Credential Access (TA0006) | 3 | 2 |")
+	assert.Contains(t, md, "| Impact (TA0040) | 0 | 0 |")
+	assert.Contains(t, md, "| T1003 | OS Credential Dumping | 2 | LSASS memory dumping<br>SAM hive dumping |")
+	assert.Contains(t, md, "## Unknown tactic")
+	assert.Contains(t, md, "- Impact (TA0040)")
+	assert.Contains(t, md, "- **Rule without technique**: missing technique.id label")
+}
+
+func TestHTML(t *testing.T) {
+	rules := append(newRules(), newRule("Rule <script>", map[string]string{"tactic.id": "TA0040", "technique.id": "T1485"}))
+
+	var buf bytes.Buffer
+	require.NoError(t, NewCoverage(rules).HTML(&buf, "Coverage"))
+	html := buf.String()
+
+	assert.Contains(t, html, "<title>Coverage</title>")
+	assert.Contains(t, html, "Credential Access (TA0006)<br>3 technique(s), 2 rule(s)")
+	assert.Contains(t, html, `<td class="gap">No coverage</td>`)
+	assert.Contains(t, html, "<li>LSASS memory dumping</li>")
+	assert.Contains(t, html, "Rule &lt;script&gt;")
+	assert.Contains(t, html, "<b>Rule without technique</b>: missing technique.id label")
+}
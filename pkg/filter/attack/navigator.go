@@ -0,0 +1,145 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package attack
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	navigatorVersion = "4.9.1"
+	layerVersion     = "4.5"
+	attackVersion    = "14"
+	domain           = "enterprise-attack"
+)
+
+// Layer is the ATT&CK Navigator layer.
+type Layer struct {
+	Name        string           `json:"name"`
+	Versions    Versions         `json:"versions"`
+	Domain      string           `json:"domain"`
+	Description string           `json:"description"`
+	Techniques  []LayerTechnique `json:"techniques"`
+	Gradient    Gradient         `json:"gradient"`
+	LegendItems []LegendItem     `json:"legendItems"`
+}
+
+// Versions contains the ATT&CK, Navigator, and layer format versions.
+type Versions struct {
+	Attack    string `json:"attack"`
+	Navigator string `json:"navigator"`
+	Layer     string `json:"layer"`
+}
+
+// LayerTechnique is the scored technique of the layer.
+type LayerTechnique struct {
+	TechniqueID       string     `json:"techniqueID"`
+	Tactic            string     `json:"tactic,omitempty"`
+	Score             int        `json:"score"`
+	Comment           string     `json:"comment,omitempty"`
+	Enabled           bool       `json:"enabled"`
+	ShowSubtechniques bool       `json:"showSubtechniques,omitempty"`
+	Metadata          []Metadata `json:"metadata,omitempty"`
+}
+
+// Metadata is the name/value pair attached to the technique.
+type Metadata struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Gradient describes the color gradient of technique scores.
+type Gradient struct {
+	Colors   []string `json:"colors"`
+	MinValue int      `json:"minValue"`
+	MaxValue int      `json:"maxValue"`
+}
+
+// LegendItem is the entry of the layer legend.
+type LegendItem struct {
+	Label string `json:"label"`
+	Color string `json:"color"`
+}
+
+// Layer produces the ATT&CK Navigator layer where each technique is
+// scored by the number of enabled rules detecting it and annotated
+// with rule names.
+func (c *Coverage) Layer(name string) *Layer {
+	layer := &Layer{
+		Name: name,
+		Versions: Versions{
+			Attack:    attackVersion,
+			Navigator: navigatorVersion,
+			Layer:     layerVersion,
+		},
+		Domain:      domain,
+		Description: fmt.Sprintf("%d enabled rule(s) covering %d technique(s)", c.Rules, c.techniques()),
+		Techniques:  make([]LayerTechnique, 0, len(c.Techniques)),
+		Gradient: Gradient{
+			Colors:   []string{"#ffe766", "#8ec843"},
+			MinValue: 1,
+			MaxValue: 1,
+		},
+		LegendItems: []LegendItem{
+			{Label: "Covered by rules", Color: "#8ec843"},
+		},
+	}
+
+	subtechniques := make(map[string]bool)
+	for _, t := range c.Techniques {
+		if t.IsSubtechnique() {
+			subtechniques[t.ID[:strings.Index(t.ID, ".")]+"/"+t.Tactic.ID] = true
+		}
+	}
+
+	for _, t := range c.Techniques {
+		tech := LayerTechnique{
+			TechniqueID:       t.ID,
+			Score:             len(t.Rules),
+			Comment:           strings.Join(t.Rules, ", "),
+			Enabled:           true,
+			ShowSubtechniques: subtechniques[t.ID+"/"+t.Tactic.ID],
+			Metadata:          make([]Metadata, 0, len(t.Rules)),
+		}
+		if t.Tactic.ID != "" {
+			tech.Tactic = t.Tactic.Shortname()
+		}
+		for _, rule := range t.Rules {
+			tech.Metadata = append(tech.Metadata, Metadata{Name: "rule", Value: rule})
+		}
+		if tech.Score > layer.Gradient.MaxValue {
+			layer.Gradient.MaxValue = tech.Score
+		}
+		layer.Techniques = append(layer.Techniques, tech)
+	}
+
+	return layer
+}
+
+// techniques returns the number of distinct covered techniques excluding subtechniques.
+func (c *Coverage) techniques() int {
+	ids := make(map[string]bool)
+	for _, t := range c.Techniques {
+		if !t.IsSubtechnique() {
+			ids[t.ID] = true
+		}
+	}
+	return len(ids)
+}
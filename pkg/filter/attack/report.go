@@ -0,0 +1,162 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package attack
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// matrixRow is the tactic row of the coverage matrix.
+type matrixRow struct {
+	Tactic     Tactic
+	Techniques []*Technique
+	Rules      int
+}
+
+// matrix groups covered techniques by tactics in the kill chain order.
+// Techniques of rules without a valid tactic are grouped in the last row.
+func (c *Coverage) matrix() []matrixRow {
+	rows := make([]matrixRow, 0, len(Tactics)+1)
+	tactics := append(append([]Tactic{}, Tactics...), Tactic{Name: "Unknown tactic"})
+	for _, tactic := range tactics {
+		row := matrixRow{Tactic: tactic, Techniques: c.TacticTechniques(tactic)}
+		if tactic.ID == "" && len(row.Techniques) == 0 {
+			continue
+		}
+		rules := make(map[string]bool)
+		for _, t := range row.Techniques {
+			for _, rule := range t.Rules {
+				rules[rule] = true
+			}
+		}
+		row.Rules = len(rules)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// escapeMarkdown escapes characters that break Markdown table cells.
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
+
+// Markdown renders the coverage matrix as the Markdown document.
+func (c *Coverage) Markdown(w io.Writer, title string) error {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# %s\n\n", title))
+	sb.WriteString(fmt.Sprintf("%d enabled rule(s) cover %d technique(s) across %d of %d tactics.\n\n",
+		c.Rules, c.techniques(), len(Tactics)-len(c.Gaps()), len(Tactics)))
+
+	rows := c.matrix()
+	sb.WriteString("| Tactic | Techniques | Rules |\n")
+	sb.WriteString("|--------|-----------:|------:|\n")
+	for _, row := range rows {
+		sb.WriteString(fmt.Sprintf("| %s | %d | %d |\n", tacticLabel(row.Tactic), len(row.Techniques), row.Rules))
+	}
+
+	for _, row := range rows {
+		if len(row.Techniques) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\n## %s\n\n", tacticLabel(row.Tactic)))
+		sb.WriteString("| Technique | Name | # Rules | Rules |\n")
+		sb.WriteString("|-----------|------|--------:|-------|\n")
+		for _, t := range row.Techniques {
+			sb.WriteString(fmt.Sprintf("| %s | %s | %d | %s |\n", t.ID, escapeMarkdown(t.Name), len(t.Rules), escapeMarkdown(strings.Join(t.Rules, "<br>"))))
+		}
+	}
+
+	if gaps := c.Gaps(); len(gaps) > 0 {
+		sb.WriteString("\n## Gaps\n\nTactics without any detection rule:\n\n")
+		for _, tactic := range gaps {
+			sb.WriteString(fmt.Sprintf("- %s\n", tacticLabel(tactic)))
+		}
+	}
+
+	if len(c.Issues) > 0 {
+		sb.WriteString("\n## Issues\n\nRules with missing or malformed ATT&CK labels:\n\n")
+		for _, issue := range c.Issues {
+			sb.WriteString(fmt.Sprintf("- **%s**: %s\n", escapeMarkdown(issue.Rule), issue.Message))
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+var htmlReport = template.Must(template.New("coverage").Funcs(template.FuncMap{"tactic": tacticLabel}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f2f2f2; }
+td.gap { background: #f8d7da; }
+td.covered { background: #d4edda; }
+ul.rules { margin: 0; padding-left: 1.2em; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+<p>{{ .Coverage.Rules }} enabled rule(s) cover {{ .Techniques }} technique(s) across {{ .Covered }} of {{ .Total }} tactics.</p>
+<table>
+<tr>{{ range .Rows }}<th>{{ tactic .Tactic }}<br>{{ len .Techniques }} technique(s), {{ .Rules }} rule(s)</th>{{ end }}</tr>
+<tr>{{ range .Rows }}{{ if .Techniques }}<td class="covered">{{ range .Techniques }}<p><b>{{ .ID }}</b> {{ .Name }} ({{ len .Rules }})</p><ul class="rules">{{ range .Rules }}<li>{{ . }}</li>{{ end }}</ul>{{ end }}</td>{{ else }}<td class="gap">No coverage</td>{{ end }}{{ end }}</tr>
+</table>
+{{ if .Coverage.Issues }}<h2>Issues</h2>
+<p>Rules with missing or malformed ATT&amp;CK labels:</p>
+<ul>{{ range .Coverage.Issues }}<li><b>{{ .Rule }}</b>: {{ .Message }}</li>{{ end }}</ul>
+{{ end }}</body>
+</html>
+`))
+
+// HTML renders the coverage matrix as the HTML document.
+// Tactics are laid out as columns in the kill chain order
+// and tactics without coverage are highlighted.
+func (c *Coverage) HTML(w io.Writer, title string) error {
+	data := struct {
+		Title      string
+		Coverage   *Coverage
+		Rows       []matrixRow
+		Techniques int
+		Covered    int
+		Total      int
+	}{
+		Title:      title,
+		Coverage:   c,
+		Rows:       c.matrix(),
+		Techniques: c.techniques(),
+		Covered:    len(Tactics) - len(c.Gaps()),
+		Total:      len(Tactics),
+	}
+	return htmlReport.Execute(w, data)
+}
+
+func tacticLabel(t Tactic) string {
+	if t.ID == "" {
+		return t.Name
+	}
+	return fmt.Sprintf("%s (%s)", t.Name, t.ID)
+}
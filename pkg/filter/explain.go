@@ -0,0 +1,227 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"fmt"
+	"github.com/rabbitstack/fibratus/pkg/filter/ql"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"time"
+)
+
+// Explanation describes how the rule evaluates against the event.
+type Explanation struct {
+	// Rule is the rule name
+	Rule string `json:"rule"`
+	// ID is the rule identifier
+	ID string `json:"id"`
+	// Evaluated indicates the engine evaluates the rule for the event.
+	// Rules are only evaluated for events whose name or category is
+	// referenced in the rule condition
+	Evaluated bool `json:"evaluated"`
+	// Match indicates the event satisfies the rule condition. For
+	// sequences, it indicates the event matches any of the sequence
+	// expressions awaiting the event
+	Match bool `json:"match"`
+	// Trace is the evaluation trace of the rule condition
+	Trace *ql.Trace `json:"trace,omitempty"`
+	// Threshold describes the threshold state
+	Threshold *ThresholdExplanation `json:"threshold,omitempty"`
+	// Sequence describes the sequence state and the evaluation of each sequence expression
+	Sequence *SequenceExplanation `json:"sequence,omitempty"`
+}
+
+// ThresholdExplanation describes the sliding window of the threshold rule.
+type ThresholdExplanation struct {
+	// Key is the value of the field the events are grouped by
+	Key any `json:"key,omitempty"`
+	// Count is the number of events in the window of the group key
+	Count int `json:"count"`
+	// Required is the number of events that fire the rule
+	Required uint64 `json:"required"`
+	// Window is the time frame of the threshold
+	Window time.Duration `json:"window"`
+}
+
+// SequenceExplanation describes the state of the sequence rule.
+type SequenceExplanation struct {
+	// State is the current state of the sequence state machine
+	State string `json:"state"`
+	// MaxSpan is the time frame in which all sequence events must occur
+	MaxSpan time.Duration `json:"max_span,omitempty"`
+	// Steps contains the explanation of each sequence expression
+	Steps []*StepExplanation `json:"steps"`
+}
+
+// StepExplanation describes the evaluation of the sequence expression.
+type StepExplanation struct {
+	// Slot is the sequence slot of the expression. Slots start at 1
+	Slot uint16 `json:"slot"`
+	// Expr is the sequence expression
+	Expr string `json:"expr"`
+	// Negated indicates the expression describes the absence of the event
+	Negated bool `json:"negated,omitempty"`
+	// Evaluable indicates the expression references the event name or category
+	Evaluable bool `json:"evaluable"`
+	// Reachable indicates all upstream expressions have matched,
+	// so the expression is evaluated against incoming events
+	Reachable bool `json:"reachable"`
+	// Matched indicates the expression has already matched one or more events
+	Matched bool `json:"matched"`
+	// Match indicates the event satisfies the expression and joins with
+	// upstream partials. Bound fields are resolved from the latest partial
+	// of the aliased expression
+	Match bool `json:"match"`
+	// By is the field the sequence events are joined by
+	By string `json:"by,omitempty"`
+	// JoinKey is the value of the join field in the event
+	JoinKey any `json:"join_key,omitempty"`
+	// Trace is the evaluation trace of the expression
+	Trace *ql.Trace `json:"trace,omitempty"`
+	// Partials contains the events that matched the expression
+	Partials []Partial `json:"partials,omitempty"`
+}
+
+// Partial describes the event stored in the sequence slot.
+type Partial struct {
+	Seq       uint64    `json:"seq"`
+	Name      string    `json:"name"`
+	Timestamp time.Time `json:"timestamp"`
+	// JoinKey is the value by which the partial is joined with other partials
+	JoinKey any `json:"join_key,omitempty"`
+}
+
+// Explain evaluates the rule identified by the rule identifier or name
+// against the event and describes the outcome along with the state of
+// sequence and threshold rules. The rule state is left intact, so the
+// event can be subsequently processed by the engine.
+func (r *Rules) Explain(rule string, kevt *kevent.Kevent) (*Explanation, error) {
+	r.rmu.RLock()
+	defer r.rmu.RUnlock()
+
+	f := r.findFilter(rule)
+	if f == nil {
+		return nil, fmt.Errorf("rule %q not found", rule)
+	}
+	e := &Explanation{Rule: f.config.Name, ID: f.config.ID}
+	for _, cf := range r.findFilters(kevt) {
+		if cf == f {
+			e.Evaluated = true
+			break
+		}
+	}
+
+	switch {
+	case f.filter.IsSequence():
+		e.Sequence = f.explainSequence(kevt)
+		for _, step := range e.Sequence.Steps {
+			if step.Match && step.Reachable && !step.Negated {
+				e.Match = true
+			}
+		}
+	case f.ts != nil:
+		e.Trace = f.filter.Explain(kevt)
+		e.Match = e.Trace.Matched()
+		e.Threshold = &ThresholdExplanation{Required: f.ts.count, Window: f.ts.window}
+		if match, key := f.filter.RunThreshold(kevt); match {
+			e.Threshold.Key = key
+			f.ts.mu.Lock()
+			e.Threshold.Count = len(f.ts.windows[thresholdKey(key)])
+			f.ts.mu.Unlock()
+		}
+	default:
+		e.Trace = f.filter.Explain(kevt)
+		e.Match = e.Trace.Matched()
+	}
+
+	return e, nil
+}
+
+// findFilter returns the compiled filter of the rule
+// with the given identifier or name.
+func (r *Rules) findFilter(rule string) *compiledFilter {
+	for _, fltrs := range r.filters {
+		for _, f := range fltrs {
+			if f.config.ID == rule || f.config.Name == rule {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+func (f *compiledFilter) explainSequence(kevt *kevent.Kevent) *SequenceExplanation {
+	seq := f.filter.GetSequence()
+	e := &SequenceExplanation{MaxSpan: seq.MaxSpan, Steps: make([]*StepExplanation, 0, len(seq.Expressions))}
+
+	partials := make(map[uint16][]*kevent.Kevent)
+	if f.ss != nil {
+		e.State = fmt.Sprintf("%v", f.ss.currentState())
+		f.ss.mu.RLock()
+		for idx, evts := range f.ss.partials {
+			partials[idx] = append([]*kevent.Kevent(nil), evts...)
+		}
+		f.ss.mu.RUnlock()
+	}
+
+	for i, expr := range seq.Expressions {
+		slot := uint16(i + 1)
+		by := seq.By
+		if by.IsEmpty() {
+			by = expr.By
+		}
+		step := &StepExplanation{
+			Slot:      slot,
+			Expr:      expr.Expr.String(),
+			Negated:   expr.IsNegated,
+			Evaluable: expr.IsEvaluable(kevt),
+			By:        by.String(),
+		}
+		if f.ss != nil {
+			step.Reachable = f.ss.next(i)
+			f.ss.mrm.RLock()
+			step.Matched = f.ss.matchedRules[slot]
+			f.ss.mrm.RUnlock()
+		}
+		step.Trace, step.JoinKey = f.filter.ExplainSequence(kevt, uint16(i), partials)
+		step.Match = step.Trace.Matched()
+		// the event must join with partials of all upstream slots
+		if step.Match && i > 0 && !by.IsEmpty() {
+			for n := uint16(1); n < slot; n++ {
+				var joins bool
+				for _, p := range partials[n] {
+					if compareSeqJoin(step.JoinKey, p.SequenceBy()) {
+						joins = true
+						break
+					}
+				}
+				if !joins {
+					step.Match = false
+					break
+				}
+			}
+		}
+		for _, p := range partials[slot] {
+			step.Partials = append(step.Partials, Partial{Seq: p.Seq, Name: p.Name, Timestamp: p.Timestamp, JoinKey: p.SequenceBy()})
+		}
+		e.Steps = append(e.Steps, step)
+	}
+
+	return e
+}
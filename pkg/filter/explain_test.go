@@ -0,0 +1,210 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"github.com/rabbitstack/fibratus/pkg/kevent/kparams"
+	"github.com/rabbitstack/fibratus/pkg/kevent/ktypes"
+	"github.com/rabbitstack/fibratus/pkg/ps"
+	"github.com/rabbitstack/fibratus/pkg/ps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestExplainRule(t *testing.T) {
+	psnap := new(ps.SnapshotterMock)
+	c := newConfig("_fixtures/exceptions_rule.yml")
+	rules := NewRules(psnap, c)
+	compileRules(t, rules)
+
+	e := &kevent.Kevent{
+		Type:      ktypes.CreateFile,
+		Timestamp: time.Now(),
+		Name:      "CreateFile",
+		Tid:       2484,
+		PID:       859,
+		Category:  ktypes.File,
+		PS: &types.PS{
+			Name: "msiexec.exe",
+		},
+		Kparams: kevent.Kparams{
+			kparams.FileName: {Name: kparams.FileName, Type: kparams.UnicodeString, Value: "C:\\Temp\\dropper.exe"},
+		},
+		Metadata: make(map[kevent.MetadataKey]any),
+	}
+
+	_, err := rules.Explain("Unknown rule", e)
+	require.Error(t, err)
+
+	exp, err := rules.Explain("6e2b9f4c-0d3a-4b8e-a5c1-7f9d2e8b4a60", e)
+	require.NoError(t, err)
+	assert.Equal(t, "Temp file created by unusual process", exp.Rule)
+	assert.True(t, exp.Evaluated)
+	// excluded by the rule exception
+	assert.False(t, exp.Match)
+	require.NotNil(t, exp.Trace)
+	assert.Contains(t, exp.Trace.String(), "NOT (ps.name = msiexec.exe) => false")
+	assert.Contains(t, exp.Trace.String(), "ps.name = msiexec.exe => true [ps.name=msiexec.exe]")
+	assert.Nil(t, exp.Sequence)
+
+	e.PS.Name = "cmd.exe"
+	exp, err = rules.Explain("Temp file created by unusual process", e)
+	require.NoError(t, err)
+	assert.True(t, exp.Match)
+	assert.Equal(t, exp.Match, wrapProcessEvent(e, rules.ProcessEvent))
+
+	// the rule is not evaluated for registry events
+	e.Type, e.Name, e.Category = ktypes.RegSetValue, "RegSetValue", ktypes.Registry
+	exp, err = rules.Explain("Temp file created by unusual process", e)
+	require.NoError(t, err)
+	assert.False(t, exp.Evaluated)
+}
+
+func TestExplainSequenceRule(t *testing.T) {
+	psnap := new(ps.SnapshotterMock)
+	rules := NewRules(psnap, newConfig("_fixtures/sequence_rule_simple.yml"))
+	compileRules(t, rules)
+
+	e1 := &kevent.Kevent{
+		Type:      ktypes.CreateProcess,
+		Timestamp: time.Now(),
+		Name:      "CreateProcess",
+		Tid:       2484,
+		PID:       859,
+		Category:  ktypes.Process,
+		PS: &types.PS{
+			Name: "cmd.exe",
+			Exe:  "C:\\Windows\\system32\\svchost-temp.exe",
+		},
+		Kparams: kevent.Kparams{
+			kparams.ProcessID: {Name: kparams.ProcessID, Type: kparams.Uint32, Value: uint32(4143)},
+		},
+		Metadata: make(map[kevent.MetadataKey]any),
+	}
+
+	newEvent := func(filename string) *kevent.Kevent {
+		return &kevent.Kevent{
+			Type:      ktypes.CreateFile,
+			Timestamp: time.Now(),
+			Name:      "CreateFile",
+			Tid:       2484,
+			PID:       859,
+			Category:  ktypes.File,
+			PS: &types.PS{
+				Name: "cmd.exe",
+				Exe:  "C:\\Windows\\system32\\svchost.exe",
+			},
+			Kparams: kevent.Kparams{
+				kparams.FileName: {Name: kparams.FileName, Type: kparams.UnicodeString, Value: filename},
+			},
+			Metadata: make(map[kevent.MetadataKey]any),
+		}
+	}
+
+	exp, err := rules.Explain("Command shell created a temp file", e1)
+	require.NoError(t, err)
+	require.NotNil(t, exp.Sequence)
+	assert.True(t, exp.Match)
+	assert.Nil(t, exp.Trace)
+
+	seq := exp.Sequence
+	require.Len(t, seq.Steps, 2)
+	assert.Equal(t, seq.Steps[0].Expr, seq.State)
+	assert.Equal(t, 100*time.Millisecond, seq.MaxSpan)
+
+	s1, s2 := seq.Steps[0], seq.Steps[1]
+	assert.Equal(t, uint16(1), s1.Slot)
+	assert.True(t, s1.Evaluable)
+	assert.True(t, s1.Reachable)
+	assert.True(t, s1.Match)
+	assert.False(t, s1.Matched)
+	assert.Equal(t, "ps.exe", s1.By)
+	assert.Equal(t, "C:\\Windows\\system32\\svchost-temp.exe", s1.JoinKey)
+	assert.False(t, s2.Evaluable)
+	assert.False(t, s2.Reachable)
+
+	// explaining doesn't alter the sequence state
+	require.Empty(t, rules.Partials())
+	require.False(t, wrapProcessEvent(e1, rules.ProcessEvent))
+
+	// the file name doesn't join with the process executable
+	exp, err = rules.Explain("Command shell created a temp file", newEvent("C:\\Temp\\dropper.exe"))
+	require.NoError(t, err)
+	seq = exp.Sequence
+	assert.Equal(t, seq.Steps[1].Expr, seq.State)
+	assert.False(t, exp.Match)
+
+	s1, s2 = seq.Steps[0], seq.Steps[1]
+	assert.True(t, s1.Matched)
+	require.Len(t, s1.Partials, 1)
+	assert.Equal(t, "CreateProcess", s1.Partials[0].Name)
+	assert.Equal(t, "C:\\Windows\\system32\\svchost-temp.exe", s1.Partials[0].JoinKey)
+	assert.True(t, s2.Reachable)
+	assert.True(t, s2.Trace.Matched())
+	assert.False(t, s2.Match)
+	assert.Equal(t, "C:\\Temp\\dropper.exe", s2.JoinKey)
+
+	e2 := newEvent("C:\\Windows\\system32\\svchost-temp.exe")
+	exp, err = rules.Explain("Command shell created a temp file", e2)
+	require.NoError(t, err)
+	assert.True(t, exp.Match)
+	assert.True(t, exp.Sequence.Steps[1].Match)
+	require.True(t, wrapProcessEvent(e2, rules.ProcessEvent))
+}
+
+func TestExplainThresholdRule(t *testing.T) {
+	psnap := new(ps.SnapshotterMock)
+	rules := NewRules(psnap, newConfig("_fixtures/threshold_rule.yml"))
+	compileRules(t, rules)
+
+	newEvent := func(ts time.Time) *kevent.Kevent {
+		return &kevent.Kevent{
+			Type:      ktypes.CreateFile,
+			Timestamp: ts,
+			Name:      "CreateFile",
+			Tid:       2484,
+			PID:       859,
+			Category:  ktypes.File,
+			PS: &types.PS{
+				Name: "cmd.exe",
+				Exe:  "C:\\Windows\\system32\\cmd.exe",
+			},
+			Kparams: kevent.Kparams{
+				kparams.FileName: {Name: kparams.FileName, Type: kparams.UnicodeString, Value: "C:\\Temp\\dropper"},
+			},
+			Metadata: make(map[kevent.MetadataKey]any),
+		}
+	}
+
+	now := time.Now()
+	require.False(t, wrapProcessEvent(newEvent(now), rules.ProcessEvent))
+	require.False(t, wrapProcessEvent(newEvent(now.Add(time.Millisecond*100)), rules.ProcessEvent))
+
+	exp, err := rules.Explain("Burst of temp files created by the same process", newEvent(now.Add(time.Millisecond*200)))
+	require.NoError(t, err)
+	assert.True(t, exp.Match)
+	require.NotNil(t, exp.Threshold)
+	assert.Equal(t, uint32(859), exp.Threshold.Key)
+	assert.Equal(t, 2, exp.Threshold.Count)
+	assert.Equal(t, uint64(3), exp.Threshold.Required)
+	assert.Equal(t, time.Second, exp.Threshold.Window)
+}
@@ -67,3 +67,8 @@ func IsDeprecated(f Field) (bool, *Deprecation) {
 func IsBoolean(f Field) bool {
 	return fields[f].Type == kparams.Bool
 }
+
+// IsAddress determines if the given field has the address type.
+func IsAddress(f Field) bool {
+	return fields[f].Type == kparams.Address
+}
@@ -27,7 +27,7 @@ import (
 
 // pathRegexp splits the provided path into different components. The first capture
 // contains the indexed field name. Next is the indexed key and, finally the segment.
-var pathRegexp = regexp.MustCompile(`(pe.sections|pe.resources|ps.envs|ps.modules|ps.ancestor|kevt.arg|thread.callstack)\[(.+\s*)].?(.*)`)
+var pathRegexp = regexp.MustCompile(`(pe.sections|pe.resources|ps.envs|ps.modules|ps.ancestor|kevt.arg|kevt.meta|thread.callstack)\[(.+\s*)].?(.*)`)
 
 // Field represents the type alias for the field
 type Field string
@@ -575,6 +575,7 @@ func (f Field) IsAncestorMap() bool    { return strings.HasPrefix(f.String(), "p
 func (f Field) IsPeSectionsMap() bool  { return strings.HasPrefix(f.String(), "pe.sections[") }
 func (f Field) IsPeResourcesMap() bool { return strings.HasPrefix(f.String(), "pe.resources[") }
 func (f Field) IsKevtArgMap() bool     { return strings.HasPrefix(f.String(), "kevt.arg[") }
+func (f Field) IsKevtMetaMap() bool    { return strings.HasPrefix(f.String(), "kevt.meta[") }
 func (f Field) IsCallstackMap() bool   { return strings.HasPrefix(f.String(), "thread.callstack[") }
 
 var fields = map[Field]FieldInfo{
@@ -841,7 +842,7 @@ func Lookup(name string) Field {
 		if key != "" && segment == "" {
 			return Field(name)
 		}
-	case PsEnvs, KevtArg:
+	case PsEnvs, KevtArg, KevtMeta:
 		if key != "" {
 			return Field(name)
 		}
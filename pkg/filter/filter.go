@@ -54,6 +54,18 @@ type Filter interface {
 	// on the state machine transitions and partial matches to decide whether the
 	// rule is fired.
 	RunSequence(kevt *kevent.Kevent, seqID uint16, partials map[uint16][]*kevent.Kevent, rawMatch bool) bool
+	// RunThreshold runs a filter with the threshold expression. If the event
+	// matches the expression, this method returns true along with the value
+	// of the field by which the events are grouped.
+	RunThreshold(kevt *kevent.Kevent) (bool, any)
+	// Explain evaluates the filter expression against the event and returns
+	// the evaluation trace with the resolved field values.
+	Explain(kevt *kevent.Kevent) *ql.Trace
+	// ExplainSequence evaluates the sequence expression at the given slot and
+	// returns the evaluation trace along with the value of the field by which
+	// the sequence events are joined. Contrary to RunSequence, joins are not
+	// evaluated and neither the event nor partials are altered.
+	ExplainSequence(kevt *kevent.Kevent, seqID uint16, partials map[uint16][]*kevent.Kevent) (*ql.Trace, any)
 	// GetStringFields returns field names mapped to their string values.
 	GetStringFields() map[fields.Field][]string
 	// GetFields returns all field used in the filter expression.
@@ -62,12 +74,18 @@ type Filter interface {
 	GetSequence() *ql.Sequence
 	// IsSequence determines if this filter is a sequence.
 	IsSequence() bool
+	// GetThreshold returns the threshold descriptor or nil if this filter is not a threshold.
+	GetThreshold() *ql.Threshold
+	// IsThreshold determines if this filter is a threshold.
+	IsThreshold() bool
 }
 
 type filter struct {
 	expr        ql.Expr
 	seq         *ql.Sequence
+	thresh      *ql.Threshold
 	parser      *ql.Parser
+	exceptions  []exception
 	accessors   []Accessor
 	fields      []fields.Field
 	boundFields []*ql.BoundFieldLiteral
@@ -86,60 +104,32 @@ type filter struct {
 // until all nodes are visited.
 func (f *filter) Compile() error {
 	var err error
-	if f.parser.IsSequence() {
+	switch {
+	case f.parser.IsSequence():
 		f.seq, err = f.parser.ParseSequence()
-	} else {
+	case f.parser.IsThreshold():
+		f.thresh, err = f.parser.ParseThreshold()
+		if err == nil {
+			f.expr = f.thresh.Expr
+		}
+	default:
 		f.expr, err = f.parser.ParseExpr()
 	}
 	if err != nil {
 		return err
 	}
 
-	// traverse the expression tree
-	walk := func(n ql.Node) {
-		switch expr := n.(type) {
-		case *ql.BinaryExpr:
-			if lhs, ok := expr.LHS.(*ql.FieldLiteral); ok {
-				field := fields.Field(lhs.Value)
-				f.addField(field)
-				f.addStringFields(field, expr.RHS)
-			}
-			if rhs, ok := expr.RHS.(*ql.FieldLiteral); ok {
-				field := fields.Field(rhs.Value)
-				f.addField(field)
-				f.addStringFields(field, expr.LHS)
-			}
-			if lhs, ok := expr.LHS.(*ql.BoundFieldLiteral); ok {
-				f.addBoundField(lhs)
-			}
-			if rhs, ok := expr.RHS.(*ql.BoundFieldLiteral); ok {
-				f.addBoundField(rhs)
-			}
-		case *ql.Function:
-			f.hasFunctions = true
-			for _, arg := range expr.Args {
-				if field, ok := arg.(*ql.FieldLiteral); ok {
-					f.addField(fields.Field(field.Value))
-				}
-				if field, ok := arg.(*ql.BoundFieldLiteral); ok {
-					f.addBoundField(field)
-				}
-			}
-		case *ql.FieldLiteral:
-			field := fields.Field(expr.Value)
-			if fields.IsBoolean(field) {
-				f.addField(field)
-			}
-		}
-	}
 	if f.expr != nil {
-		ql.WalkFunc(f.expr, walk)
+		ql.WalkFunc(f.expr, f.walk)
+		if f.thresh != nil && !f.thresh.By.IsEmpty() {
+			f.addField(f.thresh.By)
+		}
 	} else {
 		if !f.seq.By.IsEmpty() {
 			f.addField(f.seq.By)
 		}
 		for _, expr := range f.seq.Expressions {
-			ql.WalkFunc(expr.Expr, walk)
+			ql.WalkFunc(expr.Expr, f.walk)
 			if !expr.By.IsEmpty() {
 				f.addField(expr.By)
 			}
@@ -148,11 +138,141 @@ func (f *filter) Compile() error {
 	if len(f.fields) == 0 && !f.hasFunctions {
 		return ErrNoFields
 	}
+	if err := f.applyExceptions(); err != nil {
+		return err
+	}
+	f.optimize()
 	// only retain accessors for declared filter fields
 	f.narrowAccessors()
 	return f.checkBoundRefs()
 }
 
+// walk collects the fields, bound fields and string values referenced
+// by the expression node and flags the filter if it calls functions.
+func (f *filter) walk(n ql.Node) { f.collect(n, true) }
+
+// walkException is like walk, but it omits the event name and category
+// values, since excluded events must not widen the scope of the rule.
+func (f *filter) walkException(n ql.Node) { f.collect(n, false) }
+
+func (f *filter) collect(n ql.Node, scoping bool) {
+	addStringFields := func(field fields.Field, expr ql.Expr) {
+		if !scoping && (field == fields.KevtName || field == fields.KevtCategory) {
+			return
+		}
+		f.addStringFields(field, expr)
+	}
+	switch expr := n.(type) {
+	case *ql.BinaryExpr:
+		if lhs, ok := expr.LHS.(*ql.FieldLiteral); ok {
+			field := fields.Field(lhs.Value)
+			f.addField(field)
+			addStringFields(field, expr.RHS)
+		}
+		if rhs, ok := expr.RHS.(*ql.FieldLiteral); ok {
+			field := fields.Field(rhs.Value)
+			f.addField(field)
+			addStringFields(field, expr.LHS)
+		}
+		if lhs, ok := expr.LHS.(*ql.BoundFieldLiteral); ok {
+			f.addBoundField(lhs)
+		}
+		if rhs, ok := expr.RHS.(*ql.BoundFieldLiteral); ok {
+			f.addBoundField(rhs)
+		}
+	case *ql.Function:
+		f.hasFunctions = true
+		for _, arg := range expr.Args {
+			if field, ok := arg.(*ql.FieldLiteral); ok {
+				f.addField(fields.Field(field.Value))
+			}
+			if field, ok := arg.(*ql.BoundFieldLiteral); ok {
+				f.addBoundField(field)
+			}
+		}
+	case *ql.FieldLiteral:
+		field := fields.Field(expr.Value)
+		if fields.IsBoolean(field) {
+			f.addField(field)
+		}
+	}
+}
+
+// exception contains the parser of the rule exception expression
+type exception struct {
+	name   string
+	parser *ql.Parser
+}
+
+// applyExceptions parses the exception expressions and excludes
+// the events matching any of the exceptions by combining the negated
+// exceptions with the filter expression. Exceptions are applied to
+// every sequence expression, except the negated one, because events
+// matching the absence expression don't trigger the rule.
+func (f *filter) applyExceptions() error {
+	var exc ql.Expr
+	for _, e := range f.exceptions {
+		expr, err := e.parser.ParseExpr()
+		if err != nil {
+			return fmt.Errorf("invalid %q exception: %v", e.name, err)
+		}
+		var boundRef bool
+		ql.WalkFunc(expr, func(n ql.Node) {
+			if _, ok := n.(*ql.BoundFieldLiteral); ok {
+				boundRef = true
+			}
+		})
+		if boundRef {
+			return fmt.Errorf("invalid %q exception: bound fields are not allowed in exceptions", e.name)
+		}
+		ql.WalkFunc(expr, f.walkException)
+		if exc == nil {
+			exc = &ql.ParenExpr{Expr: expr}
+			continue
+		}
+		exc = &ql.BinaryExpr{Op: ql.Or, LHS: exc, RHS: &ql.ParenExpr{Expr: expr}}
+	}
+	if exc == nil {
+		return nil
+	}
+
+	exclude := func(expr ql.Expr) ql.Expr {
+		return &ql.BinaryExpr{Op: ql.And, LHS: &ql.ParenExpr{Expr: expr}, RHS: &ql.NotExpr{Expr: exc}}
+	}
+	switch {
+	case f.seq != nil:
+		for i, e := range f.seq.Expressions {
+			if !e.IsNegated {
+				f.seq.Expressions[i].Expr = exclude(e.Expr)
+			}
+		}
+	case f.thresh != nil:
+		f.thresh.Expr = exclude(f.thresh.Expr)
+		f.expr = f.thresh.Expr
+	default:
+		f.expr = exclude(f.expr)
+	}
+	return nil
+}
+
+// optimize rewrites the filter expressions, so the cheap conditions
+// are evaluated before the expensive ones. Fields and string values
+// are collected from the original expressions, since the optimizer
+// may fold some conditions away.
+func (f *filter) optimize() {
+	switch {
+	case f.seq != nil:
+		for i, e := range f.seq.Expressions {
+			f.seq.Expressions[i].Expr = ql.Optimize(e.Expr)
+		}
+	case f.thresh != nil:
+		f.thresh.Expr = ql.Optimize(f.thresh.Expr)
+		f.expr = f.thresh.Expr
+	default:
+		f.expr = ql.Optimize(f.expr)
+	}
+}
+
 func (f *filter) Run(kevt *kevent.Kevent) bool {
 	if f.expr == nil {
 		return false
@@ -160,6 +280,27 @@ func (f *filter) Run(kevt *kevent.Kevent) bool {
 	return ql.Eval(f.expr, f.mapValuer(kevt), f.hasFunctions)
 }
 
+func (f *filter) RunThreshold(kevt *kevent.Kevent) (bool, any) {
+	if f.thresh == nil {
+		return false, nil
+	}
+	valuer := f.mapValuer(kevt)
+	if !ql.Eval(f.expr, valuer, f.hasFunctions) {
+		return false, nil
+	}
+	if f.thresh.By.IsEmpty() {
+		return true, nil
+	}
+	v := valuer[f.thresh.By.String()]
+	if v == nil {
+		// the event can't be grouped
+		// if the field is not present
+		thresholdUngrouped.Add(1)
+		return false, nil
+	}
+	return true, v
+}
+
 func (f *filter) RunSequence(kevt *kevent.Kevent, seqID uint16, partials map[uint16][]*kevent.Kevent, rawMatch bool) bool {
 	if f.seq == nil {
 		return false
@@ -289,6 +430,60 @@ func (f *filter) RunSequence(kevt *kevent.Kevent, seqID uint16, partials map[uin
 	return match
 }
 
+func (f *filter) Explain(kevt *kevent.Kevent) *ql.Trace {
+	if f.expr == nil {
+		return nil
+	}
+	return ql.Explain(f.expr, f.mapValuer(kevt), f.hasFunctions)
+}
+
+func (f *filter) ExplainSequence(kevt *kevent.Kevent, seqID uint16, partials map[uint16][]*kevent.Kevent) (*ql.Trace, any) {
+	if f.seq == nil || seqID > uint16(len(f.seq.Expressions))-1 {
+		return nil, nil
+	}
+	valuer := f.mapValuer(kevt)
+	expr := f.seq.Expressions[seqID]
+
+	// bound fields are resolved from the
+	// latest partial of the aliased slot
+	for _, field := range expr.BoundFields {
+		var evts []*kevent.Kevent
+		for i := uint16(0); i < seqID; i++ {
+			if f.seq.Expressions[i].Alias == field.Alias() {
+				evts = partials[i+1]
+				break
+			}
+		}
+		if len(evts) == 0 {
+			continue
+		}
+		evt := evts[len(evts)-1]
+		for _, accessor := range f.accessors {
+			if !accessor.IsFieldAccessible(evt) {
+				continue
+			}
+			v, err := accessor.Get(field.Field(), evt)
+			if err != nil {
+				continue
+			}
+			if v != nil {
+				valuer[field.String()] = v
+				break
+			}
+		}
+	}
+
+	by := f.seq.By
+	if by.IsEmpty() {
+		by = expr.By
+	}
+	var joinID any
+	if !by.IsEmpty() {
+		joinID = valuer[by.String()]
+	}
+	return ql.Explain(expr.Expr, valuer, f.hasFunctions), joinID
+}
+
 func joinsEqual(joins []bool) bool {
 	for _, j := range joins {
 		if !j {
@@ -301,8 +496,10 @@ func joinsEqual(joins []bool) bool {
 func (f *filter) GetStringFields() map[fields.Field][]string { return f.stringFields }
 func (f *filter) GetFields() []fields.Field                  { return f.fields }
 
-func (f *filter) IsSequence() bool          { return f.seq != nil }
-func (f *filter) GetSequence() *ql.Sequence { return f.seq }
+func (f *filter) IsSequence() bool            { return f.seq != nil }
+func (f *filter) GetSequence() *ql.Sequence   { return f.seq }
+func (f *filter) IsThreshold() bool           { return f.thresh != nil }
+func (f *filter) GetThreshold() *ql.Threshold { return f.thresh }
 
 // InterpolateFields replaces all occurrences of field modifiers in the given string
 // with values extracted from the event. Field modifiers may contain a leading ordinal
@@ -478,6 +478,8 @@ func TestKeventFilter(t *testing.T) {
 		{`kevt.arg[file_name] = '\\Device\\HarddiskVolume2\\Windows\\system32\\user32.dll'`, true},
 		{`kevt.arg[type] = 'file'`, true},
 		{`kevt.arg[pid] = 3434`, true},
+		{`kevt.meta[foo] = 'bar'`, true},
+		{`kevt.meta[rule.name] = ''`, true},
 
 		{`kevt.desc contains 'Creates or opens a new file'`, true},
 
@@ -868,6 +870,10 @@ func TestMemFilter(t *testing.T) {
 		{`mem.alloc = 'COMMIT|RESERVE'`, true},
 		{`mem.protection = 'EXECUTE_READWRITE'`, true},
 		{`mem.protection.mask = 'RWX'`, true},
+		{`mem.size * 2 = 16384`, true},
+		{`mem.size / 4096 > 2`, false},
+		{`mem.address & 0xfff = 0`, true},
+		{`mem.address + mem.size > mem.address`, true},
 	}
 
 	for i, tt := range tests {
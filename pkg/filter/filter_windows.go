@@ -22,13 +22,16 @@ import (
 	"fmt"
 	"github.com/rabbitstack/fibratus/pkg/config"
 	"github.com/rabbitstack/fibratus/pkg/filter/fields"
+	"github.com/rabbitstack/fibratus/pkg/filter/lists"
 	"github.com/rabbitstack/fibratus/pkg/filter/ql"
 	"github.com/rabbitstack/fibratus/pkg/ps"
 	"strings"
 )
 
 type opts struct {
-	psnap ps.Snapshotter
+	psnap      ps.Snapshotter
+	exceptions []config.FilterException
+	lists      *lists.Registry
 }
 
 // Option defines the option supplied to the filter
@@ -41,6 +44,22 @@ func WithPSnapshotter(psnap ps.Snapshotter) Option {
 	}
 }
 
+// WithExceptions passes rule exceptions to the filter. Events
+// matching any of the exceptions are excluded from the filter.
+func WithExceptions(exceptions ...config.FilterException) Option {
+	return func(o *opts) {
+		o.exceptions = append(o.exceptions, exceptions...)
+	}
+}
+
+// WithLists passes the registry from which the lookup
+// lists referenced in the filter expression are resolved.
+func WithLists(reg *lists.Registry) Option {
+	return func(o *opts) {
+		o.lists = reg
+	}
+}
+
 // New creates a new filter with the specified filter expression. The consumers must ensure
 // the expression is correctly parsed before executing the filter. This is achieved by calling the
 // `Compile` method after constructing the filter.
@@ -85,15 +104,22 @@ func New(expr string, config *config.Config, options ...Option) Filter {
 		accessors = append(accessors, newDNSAccessor())
 	}
 
-	var parser *ql.Parser
-	if fconfig.HasMacros() {
-		parser = ql.NewParserWithConfig(expr, fconfig)
-	} else {
-		parser = ql.NewParser(expr)
+	newParser := func(expr string) *ql.Parser {
+		p := ql.NewParser(expr)
+		if fconfig.HasMacros() {
+			p = ql.NewParserWithConfig(expr, fconfig)
+		}
+		p.SetLists(opts.lists)
+		return p
+	}
+	exceptions := make([]exception, len(opts.exceptions))
+	for i, e := range opts.exceptions {
+		exceptions[i] = exception{name: e.Name, parser: newParser(e.Expr)}
 	}
 
 	return &filter{
-		parser:       parser,
+		parser:       newParser(expr),
+		exceptions:   exceptions,
 		accessors:    accessors,
 		fields:       make([]fields.Field, 0),
 		stringFields: make(map[fields.Field][]string),
@@ -107,7 +133,11 @@ func NewFromCLI(args []string, config *config.Config) (Filter, error) {
 	if expr == "" {
 		return nil, nil
 	}
-	filter := New(expr, config)
+	reg := lists.NewRegistry()
+	if err := reg.Load(config.Filters.Lists); err != nil {
+		return nil, err
+	}
+	filter := New(expr, config, WithLists(reg))
 	if err := filter.Compile(); err != nil {
 		return nil, fmt.Errorf("bad filter:\n%v", err)
 	}
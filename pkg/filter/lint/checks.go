@@ -0,0 +1,427 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lint
+
+import (
+	"github.com/rabbitstack/fibratus/pkg/filter/fields"
+	"github.com/rabbitstack/fibratus/pkg/filter/ql"
+	"github.com/rabbitstack/fibratus/pkg/kevent/kparams"
+	"github.com/rabbitstack/fibratus/pkg/kevent/ktypes"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	tacticID       = regexp.MustCompile(`^TA\d{4}$`)
+	techniqueID    = regexp.MustCompile(`^T\d{4}$`)
+	subtechniqueID = regexp.MustCompile(`^T\d{4}\.\d{3}$`)
+)
+
+// pathFields contains fields holding file system or registry paths.
+// Windows paths are case-insensitive, so case-sensitive operators
+// silently miss events when the path casing differs.
+var pathFields = map[fields.Field]bool{
+	fields.PsExe:           true,
+	fields.PsCwd:           true,
+	fields.PsParentExe:     true,
+	fields.PsParentCwd:     true,
+	fields.PsSiblingExe:    true,
+	fields.PsChildExe:      true,
+	fields.FileName:        true,
+	fields.ImageName:       true,
+	fields.RegistryKeyName: true,
+}
+
+// insensitiveOps maps case-sensitive string operators
+// to their case-insensitive counterparts.
+var insensitiveOps = map[string]string{
+	"=":              "~=",
+	"!=":             "not ~=",
+	"in":             "iin",
+	"contains":       "icontains",
+	"startswith":     "istartswith",
+	"endswith":       "iendswith",
+	"matches":        "imatches",
+	"fuzzy":          "ifuzzy",
+	"fuzzynorm":      "ifuzzynorm",
+	"not in":         "not iin",
+	"not contains":   "not icontains",
+	"not startswith": "not istartswith",
+	"not endswith":   "not iendswith",
+	"not matches":    "not imatches",
+}
+
+// checkMitre ensures the rule is labeled with the MITRE ATT&CK
+// tactic and technique identifiers in the canonical format.
+func (r *ruleLinter) checkMitre() {
+	labels := []struct {
+		name     string
+		required bool
+		format   *regexp.Regexp
+	}{
+		{"tactic.id", true, tacticID},
+		{"technique.id", true, techniqueID},
+		{"subtechnique.id", false, subtechniqueID},
+	}
+	for _, label := range labels {
+		v, ok := r.rule.Labels[label.name]
+		switch {
+		case !ok && label.required:
+			r.report(MissingMitreCheck, "missing %s label", label.name)
+		case ok && !label.format.MatchString(v):
+			r.report(MissingMitreCheck, "%s label %q is not a valid MITRE ATT&CK identifier", label.name, v)
+		}
+	}
+}
+
+// checkPredicates examines individual predicates of the expression.
+func (r *ruleLinter) checkPredicates(expr ql.Expr) {
+	ql.WalkFunc(expr, func(n ql.Node) {
+		e, ok := n.(*ql.BinaryExpr)
+		if !ok {
+			return
+		}
+		field, op, rhs, ok := predicate(e)
+		if !ok {
+			return
+		}
+		r.checkType(field, op, rhs)
+		r.checkCase(field, op, rhs)
+	})
+}
+
+// checkType reports numeric fields compared against strings that
+// don't represent numbers. Such comparisons are accepted by the
+// parser, but never match.
+func (r *ruleLinter) checkType(field fields.Field, op string, rhs ql.Expr) {
+	if typ, ok := r.types[field]; !ok || !isNumeric(typ) {
+		return
+	}
+	var values []string
+	switch v := rhs.(type) {
+	case *ql.StringLiteral:
+		values = []string{v.Value}
+	case *ql.ListLiteral:
+		values = v.Values
+	}
+	for _, v := range values {
+		if !isNumber(v) {
+			r.report(TypeMismatchCheck, "numeric field %s is compared against string '%s' with %s operator", field, v, op)
+		}
+	}
+}
+
+// checkCase reports case-sensitive operators applied on path
+// fields with the pattern containing letters.
+func (r *ruleLinter) checkCase(field fields.Field, op string, rhs ql.Expr) {
+	if !pathFields[field] {
+		return
+	}
+	iop, ok := insensitiveOps[op]
+	if !ok {
+		return
+	}
+	var values []string
+	switch v := rhs.(type) {
+	case *ql.StringLiteral:
+		values = []string{v.Value}
+	case *ql.ListLiteral:
+		values = v.Values
+	}
+	for _, v := range values {
+		if hasCasedLetter(v) {
+			r.report(CaseSensitivePathCheck, "path field %s is matched with case-sensitive %s operator. Use %s instead", field, op, iop)
+			return
+		}
+	}
+}
+
+// checkConditions examines the predicates that must be satisfied
+// at the same time. Each operand of the top-level or operator is
+// analyzed separately.
+func (r *ruleLinter) checkConditions(expr ql.Expr) {
+	for _, disjunct := range disjuncts(expr) {
+		r.checkContradictions(disjunct)
+		names, ok := r.eventNames(disjunct)
+		if !ok || len(names) == 0 {
+			continue
+		}
+		ql.WalkFunc(disjunct, func(n ql.Node) {
+			if f, ok := n.(*ql.FieldLiteral); ok {
+				r.checkPopulated(fields.Field(f.Value), names)
+			}
+		})
+	}
+}
+
+// checkContradictions reports equality predicates on the same
+// single-valued field with disjoint values, and conditions on
+// event names and categories that no event satisfies.
+func (r *ruleLinter) checkContradictions(expr ql.Expr) {
+	values := make(map[fields.Field]map[string]bool)
+	for _, e := range conjuncts(expr) {
+		field, op, rhs, ok := predicate(e)
+		if !ok {
+			continue
+		}
+		vals, ok := r.equalities(field, op, rhs)
+		if !ok {
+			continue
+		}
+		prev, ok := values[field]
+		if !ok {
+			values[field] = vals
+			continue
+		}
+		common := intersect(prev, vals)
+		if len(common) == 0 {
+			r.report(ContradictionCheck, "%s can't be equal to %s and %s at the same time", field, setString(prev), setString(vals))
+			return
+		}
+		values[field] = common
+	}
+
+	names, ok := r.eventNames(expr)
+	if ok && len(names) == 0 {
+		r.report(ContradictionCheck, "no event satisfies the %s and %s conditions at the same time", fields.KevtName, fields.KevtCategory)
+	}
+}
+
+// equalities returns the normalized set of values the field must be
+// equal to for the predicate to match. Multivalued fields are skipped
+// because they can be equal to different values at the same time.
+func (r *ruleLinter) equalities(field fields.Field, op string, rhs ql.Expr) (map[string]bool, bool) {
+	typ, ok := r.types[field]
+	if !ok || typ == kparams.Slice || typ == kparams.Map {
+		return nil, false
+	}
+	switch op {
+	case "=", "~=", "in", "iin":
+	default:
+		return nil, false
+	}
+	var values []string
+	switch v := rhs.(type) {
+	case *ql.StringLiteral:
+		values = []string{v.Value}
+	case *ql.ListLiteral:
+		values = v.Values
+	case *ql.IntegerLiteral:
+		values = []string{strconv.FormatInt(v.Value, 10)}
+	case *ql.UnsignedLiteral:
+		values = []string{strconv.FormatUint(v.Value, 10)}
+	default:
+		return nil, false
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		if isNumeric(typ) {
+			n, err := strconv.ParseInt(v, 0, 64)
+			if err != nil {
+				return nil, false
+			}
+			v = strconv.FormatInt(n, 10)
+		}
+		set[strings.ToLower(v)] = true
+	}
+	return set, true
+}
+
+// eventNames returns the names of events the expression can
+// match as restricted by the kevt.name and kevt.category
+// predicates. The boolean return value is false if the
+// expression doesn't restrict the event types.
+func (r *ruleLinter) eventNames(expr ql.Expr) (map[string]bool, bool) {
+	switch e := expr.(type) {
+	case *ql.ParenExpr:
+		return r.eventNames(e.Expr)
+	case *ql.BinaryExpr:
+		switch e.Op {
+		case ql.And:
+			lhs, lok := r.eventNames(e.LHS)
+			rhs, rok := r.eventNames(e.RHS)
+			switch {
+			case !lok:
+				return rhs, rok
+			case !rok:
+				return lhs, lok
+			}
+			return intersect(lhs, rhs), true
+		case ql.Or:
+			lhs, lok := r.eventNames(e.LHS)
+			rhs, rok := r.eventNames(e.RHS)
+			if !lok || !rok {
+				return nil, false
+			}
+			for name := range rhs {
+				lhs[name] = true
+			}
+			return lhs, true
+		}
+	}
+
+	field, op, rhs, ok := predicate(expr)
+	if !ok || (field != fields.KevtName && field != fields.KevtCategory) {
+		return nil, false
+	}
+	values, ok := r.equalities(field, op, rhs)
+	if !ok {
+		return nil, false
+	}
+	names := make(map[string]bool)
+	if field == fields.KevtName {
+		for v := range values {
+			names[v] = true
+		}
+		return names, true
+	}
+	for name, e := range r.events {
+		if values[string(e.Category)] {
+			names[name] = true
+		}
+	}
+	return names, true
+}
+
+// checkPopulated reports the field that is not populated
+// for any of the events the rule can match. The fields
+// are populated by the same rules as applied by field
+// accessors.
+func (r *ruleLinter) checkPopulated(field fields.Field, names map[string]bool) {
+	for name := range names {
+		if r.isPopulated(field, name) {
+			return
+		}
+	}
+	r.report(UnpopulatedFieldCheck, "%s is never populated for %s events", field, r.eventsString(names))
+}
+
+// checkSequenceBy reports the sequence step that can't join
+// events by the field because its events don't populate it.
+func (r *ruleLinter) checkSequenceBy(step int, by fields.Field, expr ql.Expr) {
+	names, ok := r.eventNames(expr)
+	if !ok || len(names) == 0 {
+		return
+	}
+	for name := range names {
+		if r.isPopulated(by, name) {
+			return
+		}
+	}
+	r.report(SequenceByCheck, "sequence step %d joins by %s, but the field is never populated for %s events", step, by, r.eventsString(names))
+}
+
+func (r *ruleLinter) isPopulated(field fields.Field, name string) bool {
+	e, ok := r.events[name]
+	if !ok {
+		// unknown events are reported elsewhere
+		return true
+	}
+	switch {
+	case field.IsFileField():
+		return e.Category == ktypes.File
+	case field.IsImageField():
+		return e.Category == ktypes.Image
+	case field.IsRegistryField():
+		return e.Category == ktypes.Registry
+	case field.IsNetworkField():
+		return e.Category == ktypes.Net
+	case field.IsHandleField():
+		return e.Category == ktypes.Handle
+	case field.IsMemField():
+		return e.Category == ktypes.Mem
+	case field.IsDNSField():
+		return ktypes.KeventNameToKtype(e.Name).Subcategory() == ktypes.DNS
+	}
+	// process, PE, and event fields are available for all events,
+	// while thread fields depend on the presence of the callstack
+	return true
+}
+
+// eventsString formats event names for the finding message.
+func (r *ruleLinter) eventsString(names map[string]bool) string {
+	s := make([]string, 0, len(names))
+	for name := range names {
+		if e, ok := r.events[name]; ok {
+			name = e.Name
+		}
+		s = append(s, name)
+	}
+	sort.Strings(s)
+	const maxNames = 3
+	if len(s) > maxNames {
+		return strings.Join(s[:maxNames], ", ") + " and other"
+	}
+	return strings.Join(s, ", ")
+}
+
+func intersect(a, b map[string]bool) map[string]bool {
+	common := make(map[string]bool)
+	for v := range a {
+		if b[v] {
+			common[v] = true
+		}
+	}
+	return common
+}
+
+func setString(set map[string]bool) string {
+	s := make([]string, 0, len(set))
+	for v := range set {
+		s = append(s, "'"+v+"'")
+	}
+	sort.Strings(s)
+	if len(s) == 1 {
+		return s[0]
+	}
+	return "(" + strings.Join(s, ", ") + ")"
+}
+
+func isNumeric(typ kparams.Type) bool {
+	switch typ {
+	case kparams.Int8, kparams.Uint8, kparams.Int16, kparams.Uint16,
+		kparams.Int32, kparams.Uint32, kparams.Int64, kparams.Uint64,
+		kparams.Float, kparams.Double, kparams.PID, kparams.TID, kparams.Port:
+		return true
+	}
+	return false
+}
+
+func isNumber(s string) bool {
+	if _, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return true
+	}
+	if _, err := strconv.ParseUint(s, 0, 64); err == nil {
+		return true
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+func hasCasedLetter(s string) bool {
+	for _, c := range s {
+		if unicode.ToLower(c) != unicode.ToUpper(c) {
+			return true
+		}
+	}
+	return false
+}
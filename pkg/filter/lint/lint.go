@@ -0,0 +1,357 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package lint implements the static analysis of rule conditions. Unlike
+// the compilation of the rule, which only rejects malformed conditions,
+// the linter reports syntactically valid conditions that are unlikely to
+// do what the rule author intended, for example, predicates that can
+// never be satisfied at the same time.
+package lint
+
+import (
+	"fmt"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/rabbitstack/fibratus/pkg/filter/fields"
+	"github.com/rabbitstack/fibratus/pkg/filter/lists"
+	"github.com/rabbitstack/fibratus/pkg/filter/ql"
+	"github.com/rabbitstack/fibratus/pkg/kevent/kparams"
+	"github.com/rabbitstack/fibratus/pkg/kevent/ktypes"
+	"sort"
+	"strings"
+)
+
+// Severity designates the impact of the finding on the rule.
+type Severity uint8
+
+const (
+	// Note is the severity of findings that don't affect rule matching
+	Note Severity = iota
+	// Warning is the severity of findings that likely cause missed detections
+	Warning
+	// Error is the severity of findings that prevent the rule from matching
+	Error
+)
+
+// String returns the severity name.
+func (s Severity) String() string {
+	switch s {
+	case Note:
+		return "note"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the severity as its name.
+func (s Severity) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// ParseSeverity converts the severity name to the severity value.
+func ParseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(s) {
+	case "note":
+		return Note, nil
+	case "warning":
+		return Warning, nil
+	case "error":
+		return Error, nil
+	}
+	return Note, fmt.Errorf("unknown severity %q", s)
+}
+
+const (
+	// SyntaxCheck reports conditions that fail to parse
+	SyntaxCheck = "syntax"
+	// TypeMismatchCheck reports fields compared against literals of incompatible type
+	TypeMismatchCheck = "type-mismatch"
+	// UnpopulatedFieldCheck reports fields that are never set for the events the rule matches
+	UnpopulatedFieldCheck = "unpopulated-field"
+	// ContradictionCheck reports predicates that can't be satisfied at the same time
+	ContradictionCheck = "contradiction"
+	// SequenceByCheck reports sequence steps that don't set the join field
+	SequenceByCheck = "sequence-by"
+	// CaseSensitivePathCheck reports case-sensitive operators applied on path fields
+	CaseSensitivePathCheck = "case-sensitive-path"
+	// MissingMitreCheck reports rules without valid MITRE ATT&CK labels
+	MissingMitreCheck = "missing-mitre"
+	// UnusedMacroCheck reports macros that are not referenced by any rule
+	UnusedMacroCheck = "unused-macro"
+)
+
+// Check describes the single lint check.
+type Check struct {
+	// ID is the check identifier
+	ID string
+	// Severity is the severity of findings produced by the check
+	Severity Severity
+	// Description briefly explains what the check reports
+	Description string
+}
+
+// Checks contains all lint checks.
+var Checks = []Check{
+	{SyntaxCheck, Error, "Rule condition or exception can't be parsed"},
+	{TypeMismatchCheck, Error, "Field is compared against a literal of incompatible type"},
+	{UnpopulatedFieldCheck, Error, "Field is never populated for the events the rule matches"},
+	{ContradictionCheck, Error, "Predicates can't be satisfied at the same time"},
+	{SequenceByCheck, Error, "Sequence join field is not populated by every sequence step"},
+	{CaseSensitivePathCheck, Warning, "Case-sensitive operator is applied on the case-insensitive path"},
+	{MissingMitreCheck, Warning, "Rule is missing MITRE ATT&CK tactic or technique labels"},
+	{UnusedMacroCheck, Note, "Macro is not referenced by any rule"},
+}
+
+func severityOf(check string) Severity {
+	for _, c := range Checks {
+		if c.ID == check {
+			return c.Severity
+		}
+	}
+	return Note
+}
+
+// Finding describes the issue detected in the rule or macro.
+type Finding struct {
+	// Check is the identifier of the check that produced the finding
+	Check string `json:"check"`
+	// Severity is the finding severity
+	Severity Severity `json:"severity"`
+	// Rule is the name of the offending rule
+	Rule string `json:"rule,omitempty"`
+	// RuleID is the identifier of the offending rule
+	RuleID string `json:"rule_id,omitempty"`
+	// Macro is the identifier of the offending macro
+	Macro string `json:"macro,omitempty"`
+	// Source is the path or URL of the rule file
+	Source string `json:"source,omitempty"`
+	// Message describes the finding
+	Message string `json:"message"`
+}
+
+// String returns the human-readable representation of the finding.
+func (f Finding) String() string {
+	return fmt.Sprintf("%s [%s] %s", f.Severity, f.Check, f.summary())
+}
+
+func (f Finding) summary() string {
+	if f.Macro != "" {
+		return fmt.Sprintf("macro %q: %s", f.Macro, f.Message)
+	}
+	return fmt.Sprintf("rule %q: %s", f.Rule, f.Message)
+}
+
+// Linter analyzes rule conditions and macros.
+type Linter struct {
+	filters *config.Filters
+	// types contains field types keyed by field name
+	types map[fields.Field]kparams.Type
+	// events contains event metadata keyed by lowercase event name
+	events map[string]ktypes.KeventInfo
+	// lists resolves lookup lists referenced in conditions
+	lists *lists.Registry
+}
+
+// New creates the linter for rules and macros from the given filters config.
+func New(filters *config.Filters) *Linter {
+	l := &Linter{
+		filters: filters,
+		types:   make(map[fields.Field]kparams.Type),
+		events:  make(map[string]ktypes.KeventInfo),
+	}
+	for _, f := range fields.Get() {
+		l.types[f.Field] = f.Type
+	}
+	for _, e := range ktypes.GetKtypesMeta() {
+		l.events[strings.ToLower(e.Name)] = e
+	}
+	return l
+}
+
+// SetLists sets the registry from which lookup lists are resolved.
+func (l *Linter) SetLists(reg *lists.Registry) {
+	l.lists = reg
+}
+
+// Lint analyzes the given rules and returns all findings. Macros
+// are reported as unused if none of the rules, or exceptions
+// applied to rules, reference them.
+func (l *Linter) Lint(rules []*config.FilterConfig) []Finding {
+	findings := make([]Finding, 0)
+	used := make(map[string]bool)
+	for _, rule := range rules {
+		findings = append(findings, l.lintRule(rule, used)...)
+	}
+	macros := make([]string, 0)
+	for id := range l.filters.GetMacros() {
+		if !used[id] {
+			macros = append(macros, id)
+		}
+	}
+	sort.Strings(macros)
+	for _, id := range macros {
+		findings = append(findings, Finding{
+			Check:    UnusedMacroCheck,
+			Severity: severityOf(UnusedMacroCheck),
+			Macro:    id,
+			Message:  "macro is not referenced by any rule or exception",
+		})
+	}
+	return findings
+}
+
+// ruleLinter accumulates findings of the single rule.
+type ruleLinter struct {
+	*Linter
+	rule     *config.FilterConfig
+	findings []Finding
+	seen     map[string]bool
+}
+
+func (l *Linter) lintRule(rule *config.FilterConfig, used map[string]bool) []Finding {
+	r := &ruleLinter{Linter: l, rule: rule, seen: make(map[string]bool)}
+	r.checkMitre()
+
+	p := ql.NewParserWithConfig(rule.Condition, l.filters)
+	p.SetLists(l.lists)
+	switch {
+	case p.IsSequence():
+		seq, err := p.ParseSequence()
+		if err != nil {
+			r.report(SyntaxCheck, "%v", err)
+			break
+		}
+		for i, e := range seq.Expressions {
+			r.checkPredicates(e.Expr)
+			r.checkConditions(e.Expr)
+			by := e.By
+			if by.IsEmpty() {
+				by = seq.By
+			}
+			if !by.IsEmpty() {
+				r.checkSequenceBy(i+1, by, e.Expr)
+			}
+		}
+	case p.IsThreshold():
+		thresh, err := p.ParseThreshold()
+		if err != nil {
+			r.report(SyntaxCheck, "%v", err)
+			break
+		}
+		r.checkPredicates(thresh.Expr)
+		r.checkConditions(thresh.Expr)
+	default:
+		expr, err := p.ParseExpr()
+		if err != nil {
+			r.report(SyntaxCheck, "%v", err)
+			break
+		}
+		r.checkPredicates(expr)
+		r.checkConditions(expr)
+	}
+	for _, m := range p.Macros() {
+		used[m] = true
+	}
+
+	// exceptions only narrow down the matched events, so
+	// they are only examined for individual predicates
+	for _, e := range l.filters.GetExceptions(rule) {
+		p := ql.NewParserWithConfig(e.Expr, l.filters)
+		p.SetLists(l.lists)
+		expr, err := p.ParseExpr()
+		if err != nil {
+			r.report(SyntaxCheck, "invalid %q exception: %v", e.Name, err)
+			continue
+		}
+		r.checkPredicates(expr)
+		for _, m := range p.Macros() {
+			used[m] = true
+		}
+	}
+	return r.findings
+}
+
+// report appends the finding unless the same finding was already
+// reported for the rule. Macros expanded multiple times within the
+// condition would otherwise yield duplicate findings.
+func (r *ruleLinter) report(check string, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if r.seen[check+msg] {
+		return
+	}
+	r.seen[check+msg] = true
+	r.findings = append(r.findings, Finding{
+		Check:    check,
+		Severity: severityOf(check),
+		Rule:     r.rule.Name,
+		RuleID:   r.rule.ID,
+		Source:   r.rule.Source,
+		Message:  msg,
+	})
+}
+
+// conjuncts collects the operands of the chain of and operators.
+func conjuncts(expr ql.Expr) []ql.Expr {
+	return flatten(expr, func(e *ql.BinaryExpr) bool { return e.Op == ql.And }, nil)
+}
+
+// disjuncts collects the operands of the chain of or operators.
+func disjuncts(expr ql.Expr) []ql.Expr {
+	return flatten(expr, func(e *ql.BinaryExpr) bool { return e.Op == ql.Or }, nil)
+}
+
+func flatten(expr ql.Expr, chained func(*ql.BinaryExpr) bool, operands []ql.Expr) []ql.Expr {
+	switch e := expr.(type) {
+	case *ql.ParenExpr:
+		return flatten(e.Expr, chained, operands)
+	case *ql.BinaryExpr:
+		if chained(e) {
+			operands = flatten(e.LHS, chained, operands)
+			return flatten(e.RHS, chained, operands)
+		}
+	}
+	return append(operands, expr)
+}
+
+// predicate unwraps the comparison of the field against the literal.
+// The negated operators, such as `not in`, yield the negated operator.
+func predicate(expr ql.Expr) (field fields.Field, op string, rhs ql.Expr, ok bool) {
+	for {
+		p, isParen := expr.(*ql.ParenExpr)
+		if !isParen {
+			break
+		}
+		expr = p.Expr
+	}
+	e, isBinary := expr.(*ql.BinaryExpr)
+	if !isBinary {
+		return "", "", nil, false
+	}
+	lhs, isField := e.LHS.(*ql.FieldLiteral)
+	if !isField {
+		return "", "", nil, false
+	}
+	if e.Op == ql.Not {
+		neg, isBinary := e.RHS.(*ql.BinaryExpr)
+		if !isBinary {
+			return "", "", nil, false
+		}
+		return fields.Field(lhs.Value), "not " + strings.ToLower(neg.Op.String()), neg.RHS, true
+	}
+	return fields.Field(lhs.Value), strings.ToLower(e.Op.String()), e.RHS, true
+}
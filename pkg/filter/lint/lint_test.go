@@ -0,0 +1,164 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+var mitre = map[string]string{"tactic.id": "TA0002", "technique.id": "T1059", "subtechnique.id": "T1059.003"}
+
+func checks(findings []Finding) []string {
+	ids := make([]string, 0, len(findings))
+	for _, f := range findings {
+		ids = append(ids, f.Check)
+	}
+	return ids
+}
+
+func TestLintConditions(t *testing.T) {
+	filters := config.FiltersWithMacros(map[string]*config.Macro{
+		"create_file":     {Expr: "kevt.name = 'CreateFile'"},
+		"spawn_process":   {Expr: "kevt.name = 'CreateProcess'"},
+		"office_binaries": {List: []string{"winword.exe", "excel.exe"}},
+	})
+
+	var tests = []struct {
+		cond   string
+		checks []string
+	}{
+		{`spawn_process and ps.child.name iin office_binaries`, []string{}},
+		{`spawn_process and ps.pid = 'System'`, []string{TypeMismatchCheck}},
+		{`spawn_process and ps.pid in ('4', '0x10')`, []string{}},
+		{`spawn_process and ps.child.pid not in ('4', 'idle')`, []string{TypeMismatchCheck}},
+		{`create_file and registry.key.name ~= 'HKEY_LOCAL_MACHINE\\SOFTWARE'`, []string{UnpopulatedFieldCheck}},
+		{`kevt.name in ('CreateFile', 'RegSetValue') and (file.name iendswith '.dll' or registry.value ~= 'Run')`, []string{}},
+		{`kevt.category = 'file' and get_reg_value(registry.key.name) = 'x'`, []string{UnpopulatedFieldCheck}},
+		{`kevt.name = 'QueryDns' and dns.name ~= 'example.org'`, []string{}},
+		{`create_file and dns.name ~= 'example.org'`, []string{UnpopulatedFieldCheck}},
+		{`create_file and kevt.name = 'DeleteFile'`, []string{ContradictionCheck}},
+		{`create_file and kevt.name in ('CreateFile', 'DeleteFile')`, []string{}},
+		{`create_file or kevt.name = 'DeleteFile'`, []string{}},
+		{`create_file and (kevt.name = 'DeleteFile' or kevt.name = 'RenameFile')`, []string{ContradictionCheck}},
+		{`kevt.category = 'registry' and create_file`, []string{ContradictionCheck}},
+		{`spawn_process and ps.name ~= 'cmd.exe' and ps.name = 'CMD.EXE'`, []string{}},
+		{`spawn_process and ps.name = 'cmd.exe' and ps.name = 'powershell.exe'`, []string{ContradictionCheck}},
+		{`spawn_process and ps.args = 'a' and ps.args = 'b'`, []string{}},
+		{`create_file and file.name endswith '.exe'`, []string{CaseSensitivePathCheck}},
+		{`create_file and file.name endswith '\\'`, []string{}},
+		{`create_file and file.name not in ('C:\\Windows\\notepad.exe')`, []string{CaseSensitivePathCheck}},
+		{`create_file and file.name imatches '?:\\Windows\\*'`, []string{}},
+		{`sequence maxspan 1m by ps.uuid |spawn_process| |create_file|`, []string{}},
+		{`sequence maxspan 1m by file.name |spawn_process| |create_file|`, []string{SequenceByCheck}},
+		{`sequence maxspan 1m |spawn_process| by ps.child.uuid |create_file| by ps.uuid`, []string{}},
+		{`create_file and ps.name =`, []string{SyntaxCheck}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			rule := &config.FilterConfig{Name: "test", Condition: tt.cond, Labels: mitre}
+			findings := New(filters).lintRule(rule, make(map[string]bool))
+			assert.Equal(t, tt.checks, checks(findings))
+		})
+	}
+}
+
+func TestLintMitre(t *testing.T) {
+	var tests = []struct {
+		labels   map[string]string
+		findings int
+	}{
+		{mitre, 0},
+		{map[string]string{"tactic.id": "TA0002", "technique.id": "T1059"}, 0},
+		{map[string]string{"tactic.id": "TA0002"}, 1},
+		{map[string]string{"tactic.id": "Execution", "technique.id": "T1059.003"}, 2},
+		{nil, 2},
+	}
+
+	for _, tt := range tests {
+		rule := &config.FilterConfig{Name: "test", Condition: "kevt.name = 'CreateProcess'", Labels: tt.labels}
+		findings := New(config.FiltersWithMacros(nil)).Lint([]*config.FilterConfig{rule})
+		require.Len(t, findings, tt.findings, tt.labels)
+		for _, f := range findings {
+			assert.Equal(t, MissingMitreCheck, f.Check)
+			assert.Equal(t, Warning, f.Severity)
+		}
+	}
+}
+
+func TestLintUnusedMacros(t *testing.T) {
+	filters := config.FiltersWithMacros(map[string]*config.Macro{
+		"create_file":   {Expr: "kevt.name = 'CreateFile'"},
+		"write_file":    {Expr: "kevt.name = 'WriteFile'"},
+		"create_dll":    {Expr: "create_file and file.name iendswith '.dll'"},
+		"spawn_process": {Expr: "kevt.name = 'CreateProcess'"},
+		"shells":        {List: []string{"cmd.exe", "powershell.exe"}},
+		"unused_shells": {List: []string{"bash.exe"}},
+	})
+	rules := []*config.FilterConfig{
+		{Name: "dll", Condition: "create_dll", Labels: mitre},
+		{
+			Name:      "shell",
+			Condition: "spawn_process and ps.child.name iin shells",
+			Labels:    mitre,
+			// macros referenced by exceptions are used
+			Exceptions: []config.FilterException{{Name: "writer", Expr: "write_file"}},
+		},
+	}
+
+	findings := New(filters).Lint(rules)
+	require.Len(t, findings, 1)
+	assert.Equal(t, UnusedMacroCheck, findings[0].Check)
+	assert.Equal(t, "unused_shells", findings[0].Macro)
+	assert.Equal(t, Note, findings[0].Severity)
+}
+
+func TestWriteSARIF(t *testing.T) {
+	findings := []Finding{
+		{Check: ContradictionCheck, Severity: Error, Rule: "test", Source: "rules/test.yml", Message: "contradiction"},
+		{Check: UnusedMacroCheck, Severity: Note, Macro: "unused", Message: "unused"},
+	}
+	var b bytes.Buffer
+	require.NoError(t, WriteSARIF(&b, findings, "2.0.0"))
+
+	var log sarifLog
+	require.NoError(t, json.Unmarshal(b.Bytes(), &log))
+	assert.Equal(t, "2.1.0", log.Version)
+	require.Len(t, log.Runs, 1)
+	run := log.Runs[0]
+	assert.Equal(t, "fibratus", run.Tool.Driver.Name)
+	assert.Len(t, run.Tool.Driver.Rules, len(Checks))
+	require.Len(t, run.Results, 2)
+	assert.Equal(t, ContradictionCheck, run.Results[0].RuleID)
+	assert.Equal(t, "error", run.Results[0].Level)
+	assert.Equal(t, `rule "test": contradiction`, run.Results[0].Message.Text)
+	require.Len(t, run.Results[0].Locations, 1)
+	assert.Equal(t, "rules/test.yml", run.Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Equal(t, "note", run.Results[1].Level)
+	assert.Empty(t, run.Results[1].Locations)
+
+	b.Reset()
+	require.NoError(t, WriteJSON(&b, findings))
+	assert.Contains(t, b.String(), `"severity": "error"`)
+}
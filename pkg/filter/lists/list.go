@@ -0,0 +1,283 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lists
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Format designates the format of the list file.
+type Format string
+
+const (
+	// Text is the plain text file with one value per line.
+	// Lines starting with the # character are ignored
+	Text Format = "text"
+	// CSV is the comma-separated file with values in the given column
+	CSV Format = "csv"
+	// JSON is the file containing the array of strings or numbers
+	JSON Format = "json"
+)
+
+// List is the named collection of values, such as file hashes, domain
+// names, or IP addresses, that rule conditions can test membership
+// against. String values are stored in hash sets, while IP addresses
+// and CIDR ranges are stored in the prefix trie. The list content is
+// swapped atomically when the list file is reloaded, so rules always
+// see a consistent snapshot of the list.
+type List struct {
+	config config.List
+	set    atomic.Pointer[set]
+}
+
+type set struct {
+	values map[string]struct{}
+	folded map[string]struct{}
+	ips    *prefixTrie
+	size   int
+}
+
+// New creates the list from the config and loads its values from the list file.
+func New(c config.List) (*List, error) {
+	l := &List{config: c}
+	s, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+	l.set.Store(s)
+	return l, nil
+}
+
+// Name returns the list name.
+func (l *List) Name() string { return l.config.Name }
+
+// Path returns the location of the list file.
+func (l *List) Path() string { return l.config.Path }
+
+// Size returns the number of values in the list.
+func (l *List) Size() int { return l.set.Load().size }
+
+// Reload reads the list file and replaces the list values. If the
+// list file can't be read, the current list values are kept.
+func (l *List) Reload() error {
+	s, err := l.read()
+	if err != nil {
+		return err
+	}
+	l.set.Store(s)
+	return nil
+}
+
+// Contains determines if the value is a member of the list. The value
+// can be a string, a slice of strings, an IP address, or a number. IP
+// addresses are matched against both single addresses and CIDR ranges.
+// For string slices, any of the slice elements must be in the list.
+// The ignoreCase argument forces case-insensitive matching regardless
+// of the list settings.
+func (l *List) Contains(v any, ignoreCase bool) bool {
+	s := l.set.Load()
+	if s == nil {
+		return false
+	}
+	ignoreCase = ignoreCase || l.config.IgnoreCase
+	switch val := v.(type) {
+	case string:
+		return s.contains(val, ignoreCase)
+	case []string:
+		for _, e := range val {
+			if s.contains(e, ignoreCase) {
+				return true
+			}
+		}
+		return false
+	case net.IP:
+		return s.ips.contains(val)
+	case uint8:
+		return s.contains(strconv.FormatUint(uint64(val), 10), false)
+	case uint16:
+		return s.contains(strconv.FormatUint(uint64(val), 10), false)
+	case uint32:
+		return s.contains(strconv.FormatUint(uint64(val), 10), false)
+	case uint64:
+		return s.contains(strconv.FormatUint(val, 10), false)
+	case int:
+		return s.contains(strconv.Itoa(val), false)
+	case int32:
+		return s.contains(strconv.FormatInt(int64(val), 10), false)
+	case int64:
+		return s.contains(strconv.FormatInt(val, 10), false)
+	}
+	return false
+}
+
+func (s *set) contains(v string, ignoreCase bool) bool {
+	if ignoreCase || s.values == nil {
+		if _, ok := s.folded[strings.ToLower(v)]; ok {
+			return true
+		}
+	} else if _, ok := s.values[v]; ok {
+		return true
+	}
+	if s.ips.size > 0 {
+		if ip := net.ParseIP(v); ip != nil {
+			return s.ips.contains(ip)
+		}
+	}
+	return false
+}
+
+func (s *set) add(v string, ignoreCase bool) {
+	if strings.Contains(v, "/") {
+		if _, ipnet, err := net.ParseCIDR(v); err == nil {
+			s.ips.insert(ipnet)
+			return
+		}
+	}
+	if ip := net.ParseIP(v); ip != nil {
+		s.ips.insert(hostNet(ip))
+		return
+	}
+	s.folded[strings.ToLower(v)] = struct{}{}
+	if !ignoreCase {
+		s.values[v] = struct{}{}
+	}
+}
+
+// format returns the list file format. If the format is
+// not given explicitly, it is derived from the file extension.
+func (l *List) format() Format {
+	if l.config.Format != "" {
+		return Format(strings.ToLower(l.config.Format))
+	}
+	switch strings.ToLower(filepath.Ext(l.config.Path)) {
+	case ".csv":
+		return CSV
+	case ".json":
+		return JSON
+	default:
+		return Text
+	}
+}
+
+// read parses the list file and builds the new set of list values.
+func (l *List) read() (*set, error) {
+	f, err := os.Open(l.config.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %q list: %v", l.config.Name, err)
+	}
+	defer f.Close()
+
+	s := &set{
+		folded: make(map[string]struct{}),
+		ips:    &prefixTrie{},
+	}
+	if !l.config.IgnoreCase {
+		s.values = make(map[string]struct{})
+	}
+	add := func(v string) {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return
+		}
+		s.add(v, l.config.IgnoreCase)
+	}
+
+	switch l.format() {
+	case Text:
+		err = readText(f, add)
+	case CSV:
+		err = readCSV(f, l.config.Column, l.config.SkipHeader, add)
+	case JSON:
+		err = readJSON(f, add)
+	default:
+		err = fmt.Errorf("unsupported format %q", l.config.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %q list: %v", l.config.Name, err)
+	}
+	s.size = len(s.folded) + s.ips.size
+	return s, nil
+}
+
+func readText(r io.Reader, add func(string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		add(line)
+	}
+	return scanner.Err()
+}
+
+func readCSV(r io.Reader, column int, skipHeader bool, add func(string)) error {
+	rd := csv.NewReader(r)
+	rd.Comment = '#'
+	rd.FieldsPerRecord = -1
+	rd.ReuseRecord = true
+	for n := 1; ; n++ {
+		record, err := rd.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if n == 1 && skipHeader {
+			continue
+		}
+		if column >= len(record) {
+			return fmt.Errorf("row %d has no column %d", n, column)
+		}
+		add(record[column])
+	}
+}
+
+func readJSON(r io.Reader, add func(string)) error {
+	var values []any
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return err
+	}
+	for i, v := range values {
+		switch val := v.(type) {
+		case string:
+			add(val)
+		case json.Number:
+			add(val.String())
+		default:
+			return fmt.Errorf("element %d is not a string or number", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lists
+
+import (
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTextList(t *testing.T) {
+	l, err := New(config.List{Name: "bad_domains", Path: "_fixtures/domains.txt"})
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, l.Size())
+	assert.True(t, l.Contains("evil.example.com", false))
+	assert.True(t, l.Contains("phishing.example.org", false))
+	assert.False(t, l.Contains("# known C2 domains", false))
+	assert.False(t, l.Contains("malware.example.net", false))
+	assert.True(t, l.Contains("malware.example.net", true))
+	assert.True(t, l.Contains([]string{"example.com", "evil.example.com"}, false))
+	assert.False(t, l.Contains([]string{"example.com"}, false))
+	assert.False(t, l.Contains(nil, false))
+
+	l, err = New(config.List{Name: "bad_domains", Path: "_fixtures/domains.txt", IgnoreCase: true})
+	require.NoError(t, err)
+	assert.True(t, l.Contains("malware.example.net", false))
+	assert.True(t, l.Contains("EVIL.example.com", false))
+}
+
+func TestCSVList(t *testing.T) {
+	l, err := New(config.List{Name: "hashes", Path: "_fixtures/hashes.csv", SkipHeader: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, l.Size())
+	assert.True(t, l.Contains("275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f", false))
+	assert.True(t, l.Contains("ed01ebfbc9eb5bbea545af4d01bf5f1071661840480439c6e5babe8e080e41aa", false))
+	assert.False(t, l.Contains("sha256", false))
+
+	l, err = New(config.List{Name: "families", Path: "_fixtures/hashes.csv", Column: 1, SkipHeader: true})
+	require.NoError(t, err)
+	assert.True(t, l.Contains("wannacry", false))
+	assert.False(t, l.Contains("family", false))
+
+	_, err = New(config.List{Name: "hashes", Path: "_fixtures/hashes.csv", Column: 5})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "row 1 has no column 5")
+}
+
+func TestJSONList(t *testing.T) {
+	l, err := New(config.List{Name: "tor_exits", Path: "_fixtures/tor_exits.json"})
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, l.Size())
+	assert.True(t, l.Contains(net.ParseIP("185.220.101.47"), false))
+	assert.True(t, l.Contains(net.ParseIP("104.244.72.115"), false))
+	assert.False(t, l.Contains(net.ParseIP("104.244.72.116"), false))
+	assert.True(t, l.Contains(net.ParseIP("2a0b:f4c2:2::1"), false))
+	assert.False(t, l.Contains(net.ParseIP("2a0b:f4c3::1"), false))
+	assert.True(t, l.Contains("185.220.101.1", false))
+	assert.True(t, l.Contains(uint16(443), false))
+	assert.False(t, l.Contains(uint16(80), false))
+
+	_, err = New(config.List{Name: "tor_exits", Path: "_fixtures/domains.txt", Format: "json"})
+	require.Error(t, err)
+}
+
+func TestPrefixTrie(t *testing.T) {
+	var trie prefixTrie
+	for _, cidr := range []string{"10.1.0.0/16", "10.0.0.0/8", "192.168.1.1/32", "fe80::/10"} {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+		trie.insert(ipnet)
+	}
+
+	var tests = []struct {
+		ip      string
+		matches bool
+	}{
+		{"10.1.2.3", true},
+		{"10.200.0.1", true},
+		{"11.0.0.1", false},
+		{"192.168.1.1", true},
+		{"192.168.1.2", false},
+		{"fe80::1", true},
+		{"fec0::1", false},
+		{"::ffff:10.0.0.1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			assert.Equal(t, tt.matches, trie.contains(net.ParseIP(tt.ip)))
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "domains.txt")
+	require.NoError(t, os.WriteFile(path, []byte("evil.example.com"), os.ModePerm))
+
+	reg := NewRegistry()
+	c := config.List{Name: "bad_domains", Path: path}
+	require.NoError(t, reg.Load([]config.List{c}))
+	l := reg.Get("bad_domains")
+	require.NotNil(t, l)
+	assert.Equal(t, "1", listEntries.Get("bad_domains").String())
+
+	// lists are not shared across registries
+	assert.Nil(t, NewRegistry().Get("bad_domains"))
+
+	// unchanged lists are kept intact
+	require.NoError(t, reg.Load([]config.List{c}))
+	assert.Same(t, l, reg.Get("bad_domains"))
+
+	require.NoError(t, os.WriteFile(path, []byte("evil.example.com\nbad.example.com"), os.ModePerm))
+	require.NoError(t, reload(l))
+	assert.True(t, l.Contains("bad.example.com", false))
+	assert.Equal(t, "2", listEntries.Get("bad_domains").String())
+	assert.Equal(t, "1", listReloads.Get("bad_domains").String())
+
+	// the failed reload keeps the current values
+	require.NoError(t, os.Remove(path))
+	require.Error(t, reload(l))
+	assert.True(t, l.Contains("bad.example.com", false))
+	assert.Equal(t, "1", listReloadFailures.Get("bad_domains").String())
+
+	// the failed load keeps the current lists
+	require.Error(t, reg.Load([]config.List{{Name: "missing", Path: filepath.Join(dir, "missing.txt")}}))
+	assert.Same(t, l, reg.Get("bad_domains"))
+	assert.Nil(t, reg.Get("missing"))
+
+	// staged lists are not visible until committed
+	staged, err := reg.Stage(nil)
+	require.NoError(t, err)
+	assert.Len(t, reg.All(), 1)
+	reg.Commit(staged)
+
+	// lists no longer declared are removed
+	assert.Nil(t, reg.Get("bad_domains"))
+	assert.Len(t, reg.All(), 0)
+	assert.Nil(t, listEntries.Get("bad_domains"))
+}
+
+func TestWatcher(t *testing.T) {
+	reloadDebounce = time.Millisecond * 50
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tor_exits.txt")
+	require.NoError(t, os.WriteFile(path, []byte("185.220.101.0/24"), os.ModePerm))
+	reg := NewRegistry()
+	require.NoError(t, reg.Load([]config.List{{Name: "tor_exits", Path: path}}))
+
+	w, err := NewWatcher(reg)
+	require.NoError(t, err)
+	defer w.Close()
+	w.Run()
+
+	l := reg.Get("tor_exits")
+	require.NotNil(t, l)
+	assert.False(t, l.Contains(net.ParseIP("104.244.72.115"), false))
+
+	require.NoError(t, os.WriteFile(path, []byte("185.220.101.0/24\n104.244.72.115"), os.ModePerm))
+	require.Eventually(t, func() bool {
+		return l.Contains(net.ParseIP("104.244.72.115"), false)
+	}, time.Second*5, time.Millisecond*50)
+	assert.True(t, l.Contains(net.ParseIP("185.220.101.10"), false))
+
+	// lists declared after the watcher is started are watched too
+	dir1 := t.TempDir()
+	path1 := filepath.Join(dir1, "hashes.txt")
+	require.NoError(t, os.WriteFile(path1, []byte("ed01ebfbc9eb5bbea545af4d01bf5f10"), os.ModePerm))
+	require.NoError(t, reg.Load([]config.List{{Name: "tor_exits", Path: path}, {Name: "hashes", Path: path1}}))
+	h := reg.Get("hashes")
+	require.NotNil(t, h)
+
+	require.Eventually(t, func() bool {
+		_ = os.WriteFile(path1, []byte("ed01ebfbc9eb5bbea545af4d01bf5f10\n275a021bbfb6489e54d471899f7db9d1"), os.ModePerm)
+		return h.Contains("275a021bbfb6489e54d471899f7db9d1", false)
+	}, time.Second*5, time.Millisecond*200)
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lists
+
+import (
+	"expvar"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/rabbitstack/fibratus/pkg/util/multierror"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"sync"
+)
+
+var (
+	// listEntries reports the number of values in each list
+	listEntries = expvar.NewMap("filter.lists.entries")
+	// listReloads counts successful reloads of each list
+	listReloads = expvar.NewMap("filter.lists.reloads")
+	// listReloadFailures counts failed reloads of each list
+	listReloadFailures = expvar.NewMap("filter.lists.reload.failures")
+)
+
+// Registry holds the lookup lists available to rule conditions.
+// Each rule engine owns its registry, so lists declared by one
+// set of rules are never visible to another.
+type Registry struct {
+	mu    sync.RWMutex
+	lists map[string]*List
+	// changed is signaled when the set of lists is replaced
+	changed chan struct{}
+}
+
+// NewRegistry creates an empty lookup list registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		lists:   make(map[string]*List),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// Load loads all lookup lists declared in the config and makes them
+// available to rule conditions. If any of the lists can't be loaded,
+// the registry is left intact and the error is returned.
+func (r *Registry) Load(configs []config.List) error {
+	staged, err := r.Stage(configs)
+	if err != nil {
+		return err
+	}
+	r.Commit(staged)
+	return nil
+}
+
+// Stage loads the lists declared in the config into a new registry
+// without touching the current lists. Lists that were already loaded
+// with the identical settings are reused. The staged registry becomes
+// effective once it is committed.
+func (r *Registry) Stage(configs []config.List) (*Registry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	errs := make([]error, 0)
+	staged := NewRegistry()
+	for _, c := range configs {
+		if l, ok := r.lists[c.Name]; ok && l.config == c {
+			staged.lists[c.Name] = l
+			continue
+		}
+		l, err := New(c)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Infof("loaded %q lookup list with %d entries", l.Name(), l.Size())
+		staged.lists[c.Name] = l
+	}
+	if len(errs) > 0 {
+		return nil, multierror.Wrap(errs...)
+	}
+	return staged, nil
+}
+
+// Commit replaces the current lists with the lists of the staged
+// registry. Lists that are no longer declared are removed.
+func (r *Registry) Commit(staged *Registry) {
+	r.mu.Lock()
+	for name := range r.lists {
+		if _, ok := staged.lists[name]; !ok {
+			listEntries.Delete(name)
+		}
+	}
+	for name, l := range staged.lists {
+		listEntries.Set(name, intVar(l.Size()))
+	}
+	r.lists = staged.lists
+	r.mu.Unlock()
+	select {
+	case r.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Get returns the lookup list by name or nil if the list doesn't exist.
+func (r *Registry) Get(name string) *List {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lists[name]
+}
+
+// All returns all loaded lookup lists ordered by name.
+func (r *Registry) All() []*List {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	all := make([]*List, 0, len(r.lists))
+	for _, l := range r.lists {
+		all = append(all, l)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name() < all[j].Name() })
+	return all
+}
+
+// reload reloads the list and records the outcome in metrics. If the
+// list file can't be read, the current list values are kept.
+func reload(l *List) error {
+	if err := l.Reload(); err != nil {
+		listReloadFailures.Add(l.Name(), 1)
+		log.Errorf("unable to reload lookup list. Keeping the current values: %v", err)
+		return err
+	}
+	listReloads.Add(l.Name(), 1)
+	listEntries.Set(l.Name(), intVar(l.Size()))
+	log.Infof("reloaded %q lookup list with %d entries", l.Name(), l.Size())
+	return nil
+}
+
+func intVar(n int) *expvar.Int {
+	v := new(expvar.Int)
+	v.Set(int64(n))
+	return v
+}
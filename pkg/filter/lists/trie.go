@@ -0,0 +1,120 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lists
+
+import (
+	"net"
+)
+
+// prefixTrie is the binary radix tree of IP network prefixes. Each
+// level of the tree represents a single bit of the address, and the
+// node terminating the prefix marks the whole subtree as a member.
+// IPv4 and IPv6 prefixes are kept in separate trees.
+type prefixTrie struct {
+	v4   *node
+	v6   *node
+	size int
+}
+
+type node struct {
+	children [2]*node
+	terminal bool
+}
+
+// hostNet returns the single address network for the given IP.
+func hostNet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip.To16(), Mask: net.CIDRMask(128, 128)}
+}
+
+// insert adds the network prefix to the tree.
+func (t *prefixTrie) insert(ipnet *net.IPNet) {
+	ip, root := t.root(ipnet.IP, true)
+	if ip == nil {
+		return
+	}
+	ones, _ := ipnet.Mask.Size()
+	if ones > len(ip)*8 {
+		return
+	}
+	n := *root
+	for i := 0; i < ones; i++ {
+		if n.terminal {
+			// the prefix is already covered by the shorter prefix
+			return
+		}
+		b := bit(ip, i)
+		if n.children[b] == nil {
+			n.children[b] = &node{}
+		}
+		n = n.children[b]
+	}
+	if !n.terminal {
+		t.size++
+	}
+	n.terminal = true
+	// longer prefixes are covered by this prefix
+	n.children = [2]*node{}
+}
+
+// contains determines if the IP address falls within any of the prefixes.
+func (t *prefixTrie) contains(addr net.IP) bool {
+	ip, root := t.root(addr, false)
+	if ip == nil || *root == nil {
+		return false
+	}
+	n := *root
+	for i := 0; i < len(ip)*8; i++ {
+		if n.terminal {
+			return true
+		}
+		n = n.children[bit(ip, i)]
+		if n == nil {
+			return false
+		}
+	}
+	return n.terminal
+}
+
+// root returns the normalized address and the root node of the tree
+// for the address family. The root node is allocated if requested.
+func (t *prefixTrie) root(addr net.IP, alloc bool) (net.IP, **node) {
+	var (
+		ip   net.IP
+		root **node
+	)
+	if ip4 := addr.To4(); ip4 != nil {
+		ip, root = ip4, &t.v4
+	} else if ip6 := addr.To16(); ip6 != nil {
+		ip, root = ip6, &t.v6
+	} else {
+		return nil, nil
+	}
+	if *root == nil && alloc {
+		*root = &node{}
+	}
+	return ip, root
+}
+
+// bit returns the i-th most significant bit of the address.
+func bit(ip net.IP, i int) byte {
+	return (ip[i/8] >> (7 - uint(i%8))) & 1
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lists
+
+import (
+	"github.com/rabbitstack/fibratus/pkg/util/fswatch"
+	log "github.com/sirupsen/logrus"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// reloadDebounce specifies the quiet period after the last file
+// system change that must elapse before the list is reloaded
+var reloadDebounce = time.Second * 2
+
+// Watcher reloads lookup lists when list files are modified. Only
+// the list values are replaced, so rules referencing the lists pick
+// up the new values without being recompiled. Lists declared after
+// the watcher is started are watched as soon as they are committed
+// to the registry.
+type Watcher struct {
+	reg     *Registry
+	watcher *fswatch.Watcher
+	quit    chan struct{}
+}
+
+// NewWatcher creates a new lookup list watcher. It starts
+// watching the directories of all the lists in the registry.
+func NewWatcher(reg *Registry) (*Watcher, error) {
+	w := &Watcher{
+		reg:  reg,
+		quit: make(chan struct{}),
+	}
+	watcher, err := fswatch.New("lookup list", reloadDebounce, func(path string) bool { return w.lookup(path) != nil })
+	if err != nil {
+		return nil, err
+	}
+	w.watcher = watcher
+	if err := w.sync(); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Run starts the watcher loop in a separate goroutine.
+func (w *Watcher) Run() {
+	w.watcher.Run()
+	go w.run()
+}
+
+// Close stops watching the list files.
+func (w *Watcher) Close() error {
+	close(w.quit)
+	return w.watcher.Close()
+}
+
+func (w *Watcher) run() {
+	for {
+		select {
+		case paths := <-w.watcher.C():
+			for _, path := range paths {
+				if l := w.lookup(path); l != nil {
+					_ = reload(l)
+				}
+			}
+		case <-w.reg.changed:
+			if err := w.sync(); err != nil {
+				log.Warnf("lookup list watcher error: %v", err)
+			}
+		case <-w.quit:
+			return
+		}
+	}
+}
+
+// sync starts watching the directories of the lists
+// in the registry that are not watched yet.
+func (w *Watcher) sync() error {
+	for _, l := range w.reg.All() {
+		if err := w.watcher.Add(filepath.Dir(l.Path())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup returns the list backed by the given file
+// or nil if the file doesn't belong to any list.
+func (w *Watcher) lookup(path string) *List {
+	for _, l := range w.reg.All() {
+		if strings.EqualFold(filepath.Clean(l.Path()), filepath.Clean(path)) {
+			return l
+		}
+	}
+	return nil
+}
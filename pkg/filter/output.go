@@ -0,0 +1,216 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"bytes"
+	"github.com/Masterminds/sprig/v3"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/rabbitstack/fibratus/pkg/filter/fields"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"github.com/rabbitstack/fibratus/pkg/pe"
+	pstypes "github.com/rabbitstack/fibratus/pkg/ps/types"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// Rule files are rendered as Go templates when loaded, so output
+// templates use distinct delimiters to survive the rule rendering
+const (
+	outputLeftDelim  = "[["
+	outputRightDelim = "]]"
+)
+
+// OutputContext is the data passed to the rule output template.
+type OutputContext struct {
+	// Events contains all events that triggered the rule. Events
+	// are ordered by timestamp. In sequence rules, this is the order
+	// of sequence slots, except the slots of negated expressions that
+	// never produce an event
+	Events []*kevent.Kevent
+	// Event is the first event that triggered the rule
+	Event *kevent.Kevent
+	// Rule is the rule that matched
+	Rule *config.FilterConfig
+	// Labels are the rule labels
+	Labels map[string]string
+}
+
+// outputTemplate is the compiled rule output template.
+type outputTemplate struct {
+	tmpl *template.Template
+}
+
+// outputFuncs returns sprig functions along with helpers
+// for accessing filter fields, event parameters, and the
+// process tree.
+func outputFuncs() template.FuncMap {
+	funcs := sprig.TxtFuncMap()
+	// field resolves the filter field value from the event
+	funcs["field"] = func(name string, e *kevent.Kevent) any {
+		if e == nil {
+			return nil
+		}
+		for _, accessor := range GetAccessors() {
+			v, err := accessor.Get(fields.Field(name), e)
+			if err != nil || v == nil {
+				continue
+			}
+			return v
+		}
+		return nil
+	}
+	// param returns the event parameter value as string or
+	// an empty string if the parameter is not present
+	funcs["param"] = func(name string, e *kevent.Kevent) string {
+		if e == nil || !e.Kparams.Contains(name) {
+			return ""
+		}
+		return e.GetParamAsString(name)
+	}
+	// basename returns the last element of the Windows or Unix path
+	funcs["basename"] = func(path string) string {
+		if i := strings.LastIndexAny(path, `\/`); i >= 0 {
+			return path[i+1:]
+		}
+		return path
+	}
+	// truncate shortens the string to n characters and
+	// appends the ellipsis if the string is truncated
+	funcs["truncate"] = func(n int, s string) string {
+		r := []rune(s)
+		if n < 0 || len(r) <= n {
+			return s
+		}
+		return string(r[:n]) + "..."
+	}
+	// ancestors returns parent processes starting from the immediate parent
+	funcs["ancestors"] = func(ps *pstypes.PS) []*pstypes.PS {
+		parents := make([]*pstypes.PS, 0)
+		pstypes.Walk(func(p *pstypes.PS) { parents = append(parents, p) }, ps)
+		return parents
+	}
+	// hasKey accepts any map with string keys, such as rule
+	// labels or event metadata, in addition to sprig dicts
+	dictHasKey := funcs["hasKey"].(func(map[string]any, string) bool)
+	funcs["hasKey"] = func(m any, key string) bool {
+		switch d := m.(type) {
+		case map[string]any:
+			return dictHasKey(d, key)
+		case map[string]string:
+			_, ok := d[key]
+			return ok
+		}
+		v := reflect.ValueOf(m)
+		if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+			return false
+		}
+		return v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())).IsValid()
+	}
+	return funcs
+}
+
+// compileOutput parses the output template of the rule. The template
+// is executed against stub events to catch references to unknown event
+// or process attributes when the rule is compiled. The slots parameter
+// is the number of events produced by the rule match.
+func compileOutput(f *config.FilterConfig, slots int) (*outputTemplate, error) {
+	tmpl, err := template.New(f.Name).
+		Delims(outputLeftDelim, outputRightDelim).
+		Funcs(outputFuncs()).
+		Option("missingkey=zero").
+		Parse(f.Output)
+	if err != nil {
+		return nil, err
+	}
+	o := &outputTemplate{tmpl: tmpl}
+
+	if slots < 1 {
+		slots = 1
+	}
+	evts := make([]*kevent.Kevent, slots)
+	for i := range evts {
+		evts[i] = stubEvent()
+	}
+	if _, err := o.render(f, evts); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// maxStubAncestors is the depth of the
+// process tree in stub events
+const maxStubAncestors = 10
+
+// stubEvent returns the event with all pointer attributes
+// populated, so the template dereferencing the process, its
+// ancestors, or the PE metadata is executed without errors.
+func stubEvent() *kevent.Kevent {
+	var ps *pstypes.PS
+	for i := 0; i <= maxStubAncestors; i++ {
+		ps = &pstypes.PS{
+			Envs:    make(map[string]string),
+			Threads: make(map[uint32]pstypes.Thread),
+			PE:      &pe.PE{},
+			Parent:  ps,
+		}
+	}
+	return &kevent.Kevent{
+		Kparams:   make(kevent.Kparams),
+		Metadata:  make(map[kevent.MetadataKey]any),
+		PS:        ps,
+		Callstack: kevent.Callstack{kevent.Frame{}},
+	}
+}
+
+// maxThresholdSlots caps the number of synthetic events
+// used to validate output templates of threshold rules
+const maxThresholdSlots = 1000
+
+// matchSize returns the number of events produced by the rule match.
+func matchSize(f Filter) int {
+	switch {
+	case f.IsSequence() && f.GetSequence() != nil:
+		seq := f.GetSequence()
+		if seq.IsNegated() {
+			return len(seq.Expressions) - 1
+		}
+		return len(seq.Expressions)
+	case f.IsThreshold() && f.GetThreshold() != nil:
+		if n := f.GetThreshold().Count; n < maxThresholdSlots {
+			return int(n)
+		}
+		return maxThresholdSlots
+	}
+	return 1
+}
+
+// render executes the output template with the events that triggered the rule.
+func (o *outputTemplate) render(f *config.FilterConfig, evts []*kevent.Kevent) (string, error) {
+	ctx := OutputContext{Events: evts, Rule: f, Labels: f.Labels}
+	if len(evts) > 0 {
+		ctx.Event = evts[0]
+	}
+	var b bytes.Buffer
+	if err := o.tmpl.Execute(&b, ctx); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"github.com/rabbitstack/fibratus/pkg/alertsender"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"github.com/rabbitstack/fibratus/pkg/kevent/kparams"
+	"github.com/rabbitstack/fibratus/pkg/kevent/ktypes"
+	"github.com/rabbitstack/fibratus/pkg/ps"
+	pstypes "github.com/rabbitstack/fibratus/pkg/ps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRenderOutputTemplate(t *testing.T) {
+	explorer := &pstypes.PS{PID: 2340, Name: "explorer.exe"}
+	cmd := &pstypes.PS{PID: 4143, Name: "cmd.exe", Exe: "C:\\Windows\\System32\\cmd.exe", Parent: explorer}
+
+	evts := []*kevent.Kevent{
+		{
+			Type:     ktypes.CreateProcess,
+			Name:     "CreateProcess",
+			PID:      explorer.PID,
+			Category: ktypes.Process,
+			PS:       cmd,
+			Kparams:  kevent.Kparams{},
+			Metadata: make(map[kevent.MetadataKey]any),
+		},
+		{
+			Type:     ktypes.CreateFile,
+			Name:     "CreateFile",
+			PID:      cmd.PID,
+			Category: ktypes.File,
+			PS:       cmd,
+			Kparams: kevent.Kparams{
+				kparams.FileName: {Name: kparams.FileName, Type: kparams.UnicodeString, Value: "C:\\Temp\\dropper.exe"},
+			},
+			Metadata: make(map[kevent.MetadataKey]any),
+		},
+	}
+
+	var tests = []struct {
+		output string
+		want   string
+	}{
+		{`[[ .Event.PS.Name ]] created [[ basename (param "file_name" (index .Events 1)) ]]`, "cmd.exe created dropper.exe"},
+		{`[[ range ancestors .Event.PS ]][[ .Name ]] [[ end ]]`, "explorer.exe"},
+		{`[[ field "file.name" (index .Events 1) ]]`, "C:\\Temp\\dropper.exe"},
+		{`[[ truncate 3 .Event.PS.Name ]]`, "cmd..."},
+		{`[[ if eq .Rule.Severity "high" ]]high[[ else ]]other[[ end ]]`, "high"},
+		{`[[ .Labels.tactic | upper ]]`, "EXECUTION"},
+		{`[[ len .Events ]] [[ param "unknown" .Event ]]`, "2"},
+		{`[[ if hasKey .Labels "technique" ]][[ .Labels.technique ]][[ end ]]`, ""},
+		{`[[ hasKey (dict "a" 1) "a" ]] [[ hasKey .Event.Metadata "env" ]]`, "true false"},
+	}
+
+	for i, tt := range tests {
+		f := &config.FilterConfig{
+			Name:         "Command shell created a temp file",
+			Output:       tt.output,
+			OutputFormat: config.OutputFormatTemplate,
+			Severity:     "high",
+			Labels:       map[string]string{"tactic": "Execution"},
+		}
+		o, err := compileOutput(f, len(evts))
+		require.NoError(t, err, i)
+		out, err := o.render(f, evts)
+		require.NoError(t, err, i)
+		assert.Equal(t, tt.want, out, i)
+	}
+
+	// field modifiers are interpolated unless the template format is set
+	m := &ruleMatch{ctx: &config.ActionContext{
+		Filter: &config.FilterConfig{Output: "%2.ps.name created %2.file.name"},
+		Events: evts,
+	}}
+	out, err := m.renderOutput()
+	require.NoError(t, err)
+	assert.Equal(t, "cmd.exe created C:\\Temp\\dropper.exe", out)
+}
+
+func TestCompileOutputTemplate(t *testing.T) {
+	var tests = []struct {
+		output string
+		slots  int
+		err    bool
+	}{
+		{`[[ .Event.PS.Name ]] process`, 1, false},
+		{`[[ (index .Events 1).PS.Exe ]]`, 2, false},
+		{`[[ with .Event.PS.Parent ]][[ .Name ]][[ end ]]`, 1, false},
+		{`[[ .Event.PS.Parent.Parent.Name ]] [[ index .Event.PS.PE.VersionResources "CompanyName" ]]`, 1, false},
+		{`[[ (index .Event.Callstack 0).Symbol ]]`, 1, false},
+		{`[[ .Event.PS.Name `, 1, true},
+		{`[[ .Event.PS.Nmae ]]`, 1, true},
+		{`[[ (index .Events 2).PS.Exe ]]`, 2, true},
+		{`[[ unknownfunc .Event ]]`, 1, true},
+		// the output of rules is rendered as the Go
+		// template when rule files are loaded, so the
+		// regular delimiters don't denote template actions
+		{`{{ .Event.PS.Name }}`, 1, false},
+	}
+
+	for i, tt := range tests {
+		f := &config.FilterConfig{Name: "rule", Output: tt.output, OutputFormat: config.OutputFormatTemplate}
+		_, err := compileOutput(f, tt.slots)
+		if tt.err {
+			require.Error(t, err, i)
+		} else {
+			require.NoError(t, err, i)
+		}
+	}
+}
+
+func TestRulesCompileInvalidOutputTemplate(t *testing.T) {
+	psnap := new(ps.SnapshotterMock)
+	rules := NewRules(psnap, newConfig("_fixtures/output_template_invalid.yml"))
+	_, err := rules.Compile()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid output template in rule \"match https connections with invalid template output\"")
+}
+
+func TestFilterActionEmitAlertWithOutputTemplate(t *testing.T) {
+	psnap := new(ps.SnapshotterMock)
+	require.NoError(t, alertsender.LoadAll([]alertsender.Config{{Type: alertsender.Noop}}))
+	rules := NewRules(psnap, newConfig("_fixtures/output_template.yml"))
+	compileRules(t, rules)
+
+	kevt := &kevent.Kevent{
+		Type:     ktypes.RecvTCPv4,
+		Name:     "Recv",
+		Tid:      2484,
+		PID:      859,
+		Category: ktypes.Net,
+		PS: &pstypes.PS{
+			Name:   "cmd.exe",
+			Parent: &pstypes.PS{Name: "explorer.exe"},
+		},
+		Kparams: kevent.Kparams{
+			kparams.NetDport: {Name: kparams.NetDport, Type: kparams.Uint16, Value: uint16(443)},
+			kparams.NetSport: {Name: kparams.NetSport, Type: kparams.Uint16, Value: uint16(43123)},
+			kparams.NetSIP:   {Name: kparams.NetSIP, Type: kparams.IPv4, Value: net.ParseIP("127.0.0.1")},
+			kparams.NetDIP:   {Name: kparams.NetDIP, Type: kparams.IPv4, Value: net.ParseIP("216.58.201.174")},
+		},
+		Metadata: make(map[kevent.MetadataKey]any),
+	}
+
+	require.True(t, wrapProcessEvent(kevt, rules.ProcessEvent))
+	time.Sleep(time.Millisecond * 25)
+	require.NotNil(t, emitAlert)
+	assert.Equal(t, "match https connections with template output", emitAlert.Title)
+	assert.Equal(t, "cmd.exe process spawned by explorer.exe received data on port 443 (Command and Control)", emitAlert.Text)
+	emitAlert = nil
+}
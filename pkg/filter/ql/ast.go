@@ -22,7 +22,12 @@ package ql
 
 import (
 	fuzzysearch "github.com/lithammer/fuzzysearch/fuzzy"
+	"github.com/rabbitstack/fibratus/pkg/filter/fields"
+	"github.com/rabbitstack/fibratus/pkg/filter/lists"
+	"github.com/rabbitstack/fibratus/pkg/filter/ql/functions"
 	"github.com/rabbitstack/fibratus/pkg/util/wildcard"
+	"math"
+	"math/bits"
 	"net"
 	"strconv"
 	"strings"
@@ -101,10 +106,24 @@ type ValuerEval struct {
 	// IntegerFloatDivision will set the eval system to treat
 	// a division between two integers as a floating point division.
 	IntegerFloatDivision bool
+
+	// tracer records the evaluation tree if the expression is explained
+	tracer *tracer
 }
 
 // Eval evaluates an expression and returns a value.
 func (v *ValuerEval) Eval(expr Expr) interface{} {
+	if v.tracer != nil {
+		switch expr.(type) {
+		case *BinaryExpr, *NotExpr, *Function:
+			_, val := v.tracer.trace(expr, func() interface{} { return v.eval(expr) })
+			return val
+		}
+	}
+	return v.eval(expr)
+}
+
+func (v *ValuerEval) eval(expr Expr) interface{} {
 	if expr == nil {
 		return nil
 	}
@@ -124,19 +143,8 @@ func (v *ValuerEval) Eval(expr Expr) interface{} {
 			}
 			return nil
 		case *Function:
-			if valuer, ok := v.Valuer.(CallValuer); ok {
-				var args []interface{}
-				if len(expr1.Args) > 0 {
-					args = make([]interface{}, len(expr1.Args))
-					for i := range expr1.Args {
-						args[i] = v.Eval(expr1.Args[i])
-					}
-				}
-				v, _ := valuer.Call(expr1.Name, args)
-				if val, ok := v.(bool); ok {
-					return !val
-				}
-				return nil
+			if val, ok := v.evalFunction(expr1).(bool); ok {
+				return !val
 			}
 			return nil
 		case *ParenExpr:
@@ -163,40 +171,80 @@ func (v *ValuerEval) Eval(expr Expr) interface{} {
 		return expr.Value
 	case *ListLiteral:
 		return expr.Values
+	case *LookupListLiteral:
+		return expr.List
 	case *BoolLiteral:
 		return expr.Value
 	case *FieldLiteral:
 		val, ok := v.Valuer.Value(expr.Value)
+		if v.tracer != nil {
+			v.tracer.field(expr.Value, val)
+		}
 		if !ok {
 			return nil
 		}
 		return val
 	case *BoundFieldLiteral:
 		val, ok := v.Valuer.Value(expr.Value)
+		if v.tracer != nil {
+			v.tracer.field(expr.Value, val)
+		}
 		if !ok {
 			return nil
 		}
 		return val
+	case *IteratorLiteral:
+		val, _ := v.Valuer.Value(iterator)
+		return val
 	case *IPLiteral:
 		return expr.Value
 	case *Function:
-		if valuer, ok := v.Valuer.(CallValuer); ok {
-			var args []interface{}
-			if len(expr.Args) > 0 {
-				args = make([]interface{}, len(expr.Args))
-				for i := range expr.Args {
-					args[i] = v.Eval(expr.Args[i])
-				}
-			}
-			val, _ := valuer.Call(expr.Name, args)
-			return val
-		}
-		return nil
+		return v.evalFunction(expr)
 	default:
 		return nil
 	}
 }
 
+// evalFunction evaluates the function arguments and calls the function.
+// Predicate arguments are not evaluated upfront. Instead, the function
+// receives the predicate that evaluates the argument expression with
+// the $it reference bound to the given slice element.
+func (v *ValuerEval) evalFunction(expr *Function) interface{} {
+	valuer, ok := v.Valuer.(CallValuer)
+	if !ok {
+		return nil
+	}
+	var args []interface{}
+	if len(expr.Args) > 0 {
+		args = make([]interface{}, len(expr.Args))
+		for i := range expr.Args {
+			if expr.isPredicate(i) {
+				args[i] = v.predicate(expr.Args[i])
+				continue
+			}
+			args[i] = v.Eval(expr.Args[i])
+		}
+	}
+	val, _ := valuer.Call(expr.Name, args)
+	return val
+}
+
+// predicate returns the predicate that evaluates the expression
+// with the valuer scoped to the slice element. The scoped valuer
+// resolves the $it reference to the element, and delegates to the
+// enclosing valuer for event fields and function calls. Nested
+// quantifiers shadow the $it reference of the enclosing quantifier.
+func (v *ValuerEval) predicate(expr Expr) functions.PredicateFunc {
+	return func(it interface{}) bool {
+		eval := ValuerEval{
+			Valuer:               MultiValuer(MapValuer{iterator: it}, v.Valuer),
+			IntegerFloatDivision: v.IntegerFloatDivision,
+		}
+		val, ok := eval.Eval(expr).(bool)
+		return ok && val
+	}
+}
+
 func (v *ValuerEval) evalBinaryExpr(expr *BinaryExpr) interface{} {
 	lhs := v.Eval(expr.LHS)
 	// lazy evaluation for the AND/OR operators
@@ -211,6 +259,37 @@ func (v *ValuerEval) evalBinaryExpr(expr *BinaryExpr) interface{} {
 		}
 	}
 	rhs := v.Eval(expr.RHS)
+	if list, ok := rhs.(*lists.List); ok {
+		switch expr.Op {
+		case In:
+			return list.Contains(lhs, false)
+		case IIn:
+			return list.Contains(lhs, true)
+		}
+		return false
+	}
+	// precompiled lists are evaluated against all values at once
+	if list, ok := expr.RHS.(*ListLiteral); ok && list.matcher != nil {
+		if matches, ok := list.matcher.match(lhs); ok {
+			return matches
+		}
+	}
+	if expr.Op.isArithmetic() {
+		return v.evalArithmeticExpr(expr, lhs, rhs)
+	}
+	// the arithmetic expression yields the int64, uint64, or float64
+	// value, so the other side of the comparison is widened accordingly
+	switch expr.Op {
+	case Eq, Neq, Lt, Lte, Gt, Gte:
+		if isArithmeticExpr(expr.LHS) || isArithmeticExpr(expr.RHS) {
+			if n, ok := toOperand(expr.LHS, lhs); ok {
+				lhs = n
+			}
+			if n, ok := toOperand(expr.RHS, rhs); ok {
+				rhs = n
+			}
+		}
+	}
 	if lhs == nil && rhs != nil {
 		// when the LHS is nil and the RHS is a boolean, implicitly cast the
 		// nil to false.
@@ -1163,3 +1242,270 @@ func (v *ValuerEval) evalBinaryExpr(expr *BinaryExpr) interface{} {
 	}
 	return nil
 }
+
+// evalArithmeticExpr evaluates arithmetic and bitwise operators. Both
+// operands are converted to numbers beforehand. If any of the operands
+// is a floating point number, the floating point arithmetic is used,
+// and bitwise operators are not applicable. Subtracting the larger
+// unsigned number yields the negative difference. Division by zero
+// and integer overflows yield no value.
+func (v *ValuerEval) evalArithmeticExpr(expr *BinaryExpr, lhs, rhs interface{}) interface{} {
+	op := expr.Op
+	l, ok := toOperand(expr.LHS, lhs)
+	if !ok {
+		return nil
+	}
+	r, ok := toOperand(expr.RHS, rhs)
+	if !ok {
+		return nil
+	}
+	switch l := l.(type) {
+	case float64:
+		switch r := r.(type) {
+		case float64:
+			return evalFloat(op, l, r)
+		case int64:
+			return evalFloat(op, l, float64(r))
+		case uint64:
+			return evalFloat(op, l, float64(r))
+		}
+	case int64:
+		switch r := r.(type) {
+		case float64:
+			return evalFloat(op, float64(l), r)
+		case int64:
+			// the sum or product of non-negative integers
+			// may still fit into the unsigned integer
+			if n := evalInt(op, l, r, v.IntegerFloatDivision); n != nil || l < 0 || r < 0 {
+				return n
+			}
+			return evalUint(op, uint64(l), uint64(r), v.IntegerFloatDivision)
+		case uint64:
+			if l >= 0 {
+				return evalUint(op, uint64(l), r, v.IntegerFloatDivision)
+			}
+			if r <= math.MaxInt64 {
+				return evalInt(op, l, int64(r), v.IntegerFloatDivision)
+			}
+		}
+	case uint64:
+		switch r := r.(type) {
+		case float64:
+			return evalFloat(op, float64(l), r)
+		case int64:
+			if r >= 0 {
+				return evalUint(op, l, uint64(r), v.IntegerFloatDivision)
+			}
+			if l <= math.MaxInt64 {
+				return evalInt(op, int64(l), r, v.IntegerFloatDivision)
+			}
+		case uint64:
+			return evalUint(op, l, r, v.IntegerFloatDivision)
+		}
+	}
+	return nil
+}
+
+func evalFloat(op token, lhs, rhs float64) interface{} {
+	switch op {
+	case Add:
+		return lhs + rhs
+	case Sub:
+		return lhs - rhs
+	case Mul:
+		return lhs * rhs
+	case Div:
+		if rhs == 0 {
+			return nil
+		}
+		return lhs / rhs
+	case Mod:
+		if rhs == 0 {
+			return nil
+		}
+		return math.Mod(lhs, rhs)
+	}
+	return nil
+}
+
+func evalInt(op token, lhs, rhs int64, floatDivision bool) interface{} {
+	switch op {
+	case Add:
+		n := lhs + rhs
+		if (rhs > 0 && n < lhs) || (rhs < 0 && n > lhs) {
+			return nil
+		}
+		return n
+	case Sub:
+		n := lhs - rhs
+		if (rhs > 0 && n > lhs) || (rhs < 0 && n < lhs) {
+			return nil
+		}
+		return n
+	case Mul:
+		if lhs == 0 || rhs == 0 {
+			return int64(0)
+		}
+		n := lhs * rhs
+		if n/rhs != lhs || (lhs == -1 && rhs == math.MinInt64) || (rhs == -1 && lhs == math.MinInt64) {
+			return nil
+		}
+		return n
+	case Div:
+		if rhs == 0 {
+			return nil
+		}
+		if floatDivision {
+			return float64(lhs) / float64(rhs)
+		}
+		return lhs / rhs
+	case Mod:
+		if rhs == 0 {
+			return nil
+		}
+		return lhs % rhs
+	case BitAnd:
+		return lhs & rhs
+	case BitOr:
+		return lhs | rhs
+	case BitXor:
+		return lhs ^ rhs
+	}
+	return nil
+}
+
+func evalUint(op token, lhs, rhs uint64, floatDivision bool) interface{} {
+	switch op {
+	case Add:
+		n, carry := bits.Add64(lhs, rhs, 0)
+		if carry != 0 {
+			return nil
+		}
+		return n
+	case Sub:
+		// the subtraction doesn't wrap around
+		// but yields the negative difference
+		if lhs < rhs {
+			if rhs-lhs > math.MaxInt64 {
+				return nil
+			}
+			return -int64(rhs - lhs)
+		}
+		return lhs - rhs
+	case Mul:
+		hi, n := bits.Mul64(lhs, rhs)
+		if hi != 0 {
+			return nil
+		}
+		return n
+	case Div:
+		if rhs == 0 {
+			return nil
+		}
+		if floatDivision {
+			return float64(lhs) / float64(rhs)
+		}
+		return lhs / rhs
+	case Mod:
+		if rhs == 0 {
+			return nil
+		}
+		return lhs % rhs
+	case BitAnd:
+		return lhs & rhs
+	case BitOr:
+		return lhs | rhs
+	case BitXor:
+		return lhs ^ rhs
+	}
+	return nil
+}
+
+// toOperand converts the value of the arithmetic operand to a number.
+// Address fields are rendered in hexadecimal notation without the
+// prefix, so their values are always interpreted as hexadecimal numbers.
+func toOperand(expr Expr, v interface{}) (interface{}, bool) {
+	if s, ok := v.(string); ok && isAddressField(expr) {
+		u, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"), 16, 64)
+		if err != nil {
+			return nil, false
+		}
+		return u, true
+	}
+	return toNumber(v)
+}
+
+// isAddressField determines if the expression is the field of the address type.
+func isAddressField(expr Expr) bool {
+	switch e := expr.(type) {
+	case *ParenExpr:
+		return isAddressField(e.Expr)
+	case *FieldLiteral:
+		return fields.IsAddress(fields.Field(e.Value))
+	case *BoundFieldLiteral:
+		return fields.IsAddress(e.Field())
+	}
+	return false
+}
+
+// toNumber converts the value to int64, uint64, or float64. Unsigned
+// integers narrower than 64 bits are converted to int64. Strings with
+// the 0x prefix, such as access masks, are interpreted as hexadecimal
+// numbers, while the rest of strings are parsed as decimal numbers.
+func toNumber(v interface{}) (interface{}, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint:
+		return uint64(n), true
+	case uint64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		if strings.HasPrefix(n, "0x") || strings.HasPrefix(n, "0X") {
+			u, err := strconv.ParseUint(n[2:], 16, 64)
+			if err != nil {
+				return nil, false
+			}
+			return u, true
+		}
+		if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+			return i, true
+		}
+		u, err := strconv.ParseUint(n, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		return u, true
+	}
+	return nil, false
+}
+
+// isArithmeticExpr determines if the expression is the
+// arithmetic or bitwise operation.
+func isArithmeticExpr(expr Expr) bool {
+	switch e := expr.(type) {
+	case *ParenExpr:
+		return isArithmeticExpr(e.Expr)
+	case *BinaryExpr:
+		return e.Op.isArithmetic()
+	}
+	return false
+}
@@ -0,0 +1,302 @@
+/*
+ * Copyright 2020-2021 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ql
+
+import (
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/rabbitstack/fibratus/pkg/filter/lists"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEvalArithmetic(t *testing.T) {
+	m := map[string]interface{}{
+		"file.io.size":               uint32(4096),
+		"mem.size":                   uint64(8192),
+		"kevt.pid":                   uint32(1234),
+		"ps.parent.pid":              uint32(1234),
+		"thread.entrypoint":          "7ffe1010",
+		"image.base.address":         "7ffe0000",
+		"image.size":                 uint64(0x2000),
+		"ps.access.mask":             "0x1410",
+		"pe.sections[.text].entropy": float64(2.5),
+		"registry.value":             "10",
+		"kevt.arg[size]":             "ff",
+	}
+
+	var tests = []struct {
+		expr    string
+		matches bool
+	}{
+		{`file.io.size * 2 = mem.size`, true},
+		{`file.io.size * 2 > mem.size`, false},
+		{`kevt.pid = ps.parent.pid + 0`, true},
+		{`kevt.pid != ps.parent.pid + 0`, false},
+		{`ps.parent.pid + 1 > kevt.pid`, true},
+		{`thread.entrypoint - image.base.address < image.size`, true},
+		{`thread.entrypoint - image.base.address >= 0 and thread.entrypoint - image.base.address < image.size`, true},
+		{`image.base.address - thread.entrypoint < 0`, true},
+		{`ps.access.mask & 0x10 != 0`, true},
+		{`ps.access.mask & 0x20 != 0`, false},
+		{`ps.access.mask & 0x1400 = 0x1400`, true},
+		{`ps.access.mask ^ 0x10 = 0x1400`, true},
+		{`mem.size | 1 = 8193`, true},
+		{`1 + 2 * 3 = 7`, true},
+		{`(1 + 2) * 3 = 9`, true},
+		{`10 - 4 - 3 = 3`, true},
+		{`7 % 4 = 3`, true},
+		{`7 / 2 = 3`, true},
+		{`0 - 5 < 0`, true},
+		{`1 | 6 & 3 = 3`, true},
+		{`pe.sections[.text].entropy * 2 = 5`, true},
+		{`pe.sections[.text].entropy + 1 > 3.4`, true},
+		{`pe.sections[.text].entropy & 1 = 0`, false},
+		{`mem.size / 0 = 0`, false},
+		{`mem.size % 0 = 0`, false},
+		{`mem.size - 10000 < 0`, true},
+		{`mem.size - 10000 + 1808 = 0`, true},
+		{`image.base.address + 0x10 = 0x7ffe0010`, true},
+		{`registry.value * 2 = 20`, true},
+		{`kevt.arg[size] + 1 > 0`, false},
+		{`18446744073709551615 + 1 > 0`, false},
+		{`mem.size * 0x4000000000000000 > 0`, false},
+		{`9223372036854775807 + 1 > 0`, true},
+		{`0 - 9223372036854775807 - 2 < 0`, false},
+		{`-5 < 0`, true},
+		{`-5 + 10 = 5`, true},
+		{`-(1 + 2) = 0 - 3`, true},
+		{`mem.size + -8192 = 0`, true},
+		{`-pe.sections[.text].entropy < -2`, true},
+	}
+
+	for i, tt := range tests {
+		p := NewParser(tt.expr)
+		expr, err := p.ParseExpr()
+		require.NoError(t, err)
+		if matches := Eval(expr, m, false); matches != tt.matches {
+			t.Errorf("%d. %q arithmetic mismatch: exp=%t got=%t", i, tt.expr, tt.matches, matches)
+		}
+	}
+}
+
+func TestEvalIntegerFloatDivision(t *testing.T) {
+	expr, err := NewParser(`7 / 2`).ParseExpr()
+	require.NoError(t, err)
+
+	eval := ValuerEval{Valuer: MapValuer{}}
+	assert.Equal(t, int64(3), eval.Eval(expr))
+	eval.IntegerFloatDivision = true
+	assert.Equal(t, 3.5, eval.Eval(expr))
+}
+
+func TestEvalLookupList(t *testing.T) {
+	dir := t.TempDir()
+	domains := filepath.Join(dir, "domains.txt")
+	require.NoError(t, os.WriteFile(domains, []byte("evil.example.com\nMalware.example.net"), os.ModePerm))
+	exits := filepath.Join(dir, "tor_exits.json")
+	require.NoError(t, os.WriteFile(exits, []byte(`["185.220.101.0/24", "104.244.72.115"]`), os.ModePerm))
+	reg := lists.NewRegistry()
+	require.NoError(t, reg.Load([]config.List{
+		{Name: "bad_domains", Path: domains},
+		{Name: "tor_exits", Path: exits},
+	}))
+	parse := func(expr string) (Expr, error) {
+		p := NewParser(expr)
+		p.SetLists(reg)
+		return p.ParseExpr()
+	}
+
+	m := map[string]interface{}{
+		"dns.name":  "evil.example.com",
+		"dns.rr":    "malware.example.net",
+		"net.dip":   net.ParseIP("185.220.101.47"),
+		"net.sip":   net.ParseIP("10.0.0.1"),
+		"ps.args":   []string{"-c", "evil.example.com"},
+		"net.dport": uint16(443),
+	}
+
+	var tests = []struct {
+		expr    string
+		matches bool
+	}{
+		{`dns.name in $list('bad_domains')`, true},
+		{`dns.rr in $list('bad_domains')`, false},
+		{`dns.rr iin $list('bad_domains')`, true},
+		{`dns.rr not in $list('bad_domains')`, true},
+		{`net.dip in $list('tor_exits')`, true},
+		{`net.sip in $list('tor_exits')`, false},
+		{`ps.args in $list('bad_domains')`, true},
+		{`net.dport in $list('bad_domains')`, false},
+		{`net.dip in $list('tor_exits') and dns.name in $list( 'bad_domains' )`, true},
+	}
+
+	for i, tt := range tests {
+		expr, err := parse(tt.expr)
+		require.NoError(t, err)
+		if matches := Eval(expr, m, false); matches != tt.matches {
+			t.Errorf("%d. %q lookup list mismatch: exp=%t got=%t", i, tt.expr, tt.matches, matches)
+		}
+	}
+
+	// the reloaded list is visible to the parsed expression
+	expr, err := parse(`dns.rr in $list('bad_domains')`)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(domains, []byte("malware.example.net"), os.ModePerm))
+	require.NoError(t, reg.Get("bad_domains").Reload())
+	assert.True(t, Eval(expr, m, false))
+
+	var errs = []struct {
+		expr string
+		err  string
+	}{
+		{`dns.name in $list('unknown')`, `"unknown" lookup list is not defined`},
+		{`dns.name = $list('bad_domains')`, `lookup lists are only allowed in the 'in' and 'iin' operators`},
+		{`dns.name in $list(bad_domains)`, `expected list name`},
+	}
+
+	for _, tt := range errs {
+		_, err := parse(tt.expr)
+		require.Error(t, err, tt.expr)
+		assert.Contains(t, err.Error(), tt.err)
+	}
+
+	// lists are only resolved from the parser's registry
+	_, err = NewParser(`dns.name in $list('bad_domains')`).ParseExpr()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"bad_domains" lookup list is not defined`)
+}
+
+func TestEvalListMatcher(t *testing.T) {
+	m := map[string]interface{}{
+		"ps.name":                  "PowerShell.exe",
+		"ps.exe":                   "C:\\Windows\\System32\\WindowsPowerShell\\v1.0\\powershell.exe",
+		"ps.args":                  []string{"-nop", "-enc", "JABzAD0ATgBlAHcALQBPAGIAagBlAGMAdAA="},
+		"file.name":                "C:\\Users\\admin\\AppData\\Roaming\\Microsoft\\Protect\\CREDHIST",
+		"thread.callstack.symbols": []string{"ntdll.dll!ZwCreateFile", "kernelbase.dll!CopyFileExW", "unbacked"},
+		"registry.key.name":        "HKEY_CURRENT_USER\\Software\\Microsoft\\Windows\\CurrentVersion\\Run\\updater",
+		"image.name":               "C:\\Windows\\System32\\vaultcli.dll",
+		"ps.child.sid":             "S-1-5-18",
+		"ps.cmdline":               "cmd.exe /c whoami",
+		"net.dip":                  net.ParseIP("10.0.0.1"),
+	}
+
+	var tests = []struct {
+		expr    string
+		matches bool
+	}{
+		{`ps.name in ('cmd.exe', 'powershell.exe', 'pwsh.exe', 'wscript.exe')`, false},
+		{`ps.name iin ('cmd.exe', 'powershell.exe', 'pwsh.exe', 'wscript.exe')`, true},
+		{`ps.name not iin ('cmd.exe', 'powershell.exe', 'pwsh.exe', 'wscript.exe')`, false},
+		{`ps.args in ('-enc', '-e', '-encodedcommand', '-ec')`, true},
+		{`ps.args iin ('-NOP', '-W', '-WindowStyle', '-Hidden')`, true},
+		{`ps.exe contains ('POWERSHELL.EXE', 'cscript', 'wscript', 'mshta')`, false},
+		{`ps.exe icontains ('POWERSHELL.EXE', 'cscript', 'wscript', 'mshta')`, true},
+		{`ps.exe startswith ('C:\\Windows\\System32', 'C:\\Windows\\SysWOW64', 'D:\\', 'E:\\')`, true},
+		{`ps.exe istartswith ('c:\\windows\\system32', 'c:\\windows\\syswow64', 'd:\\', 'e:\\')`, true},
+		{`ps.exe endswith ('PowerShell.exe', 'cscript.exe', 'wscript.exe', 'mshta.exe')`, false},
+		{`ps.exe iendswith ('PowerShell.exe', 'cscript.exe', 'wscript.exe', 'mshta.exe')`, true},
+		{`file.name matches ('?:\\Users\\*\\AppData\\*\\Microsoft\\Protect\\CREDHIST', '*.vcrd', '*.vpol', '?:\\Windows\\*')`, true},
+		{`file.name imatches ('?:\\users\\*\\appdata\\*\\credhist', '*.vcrd', '*.vpol', '?:\\windows\\*')`, true},
+		{`file.name imatches ('*.vcrd', '*.vpol', '?:\\windows\\*', '?:\\programdata\\*')`, false},
+		{`thread.callstack.symbols imatches ('*CopyFile*', '*MoveFile*', '*DeleteFile*', '*WriteFile*')`, true},
+		{`registry.key.name imatches ('HKEY_CURRENT_USER\\*\\Run\\*', 'HKEY_LOCAL_MACHINE\\*\\Run\\*', 'HKEY_USERS\\*\\Run\\*', 'HKEY_CURRENT_USER\\*\\RunOnce\\*')`, true},
+		{`image.name iendswith ('.exe', '.com', '.scr', '.cpl')`, false},
+		{`image.name iendswith ('.exe', '.dll', '.scr', '.cpl')`, true},
+		{`ps.child.sid in ('S-1-5-18', 'S-1-5-19', 'S-1-5-20', 'S-1-5-32-544')`, true},
+		{`ps.cmdline icontains ('whoami', 'net user', 'nltest', 'systeminfo') and ps.name iin ('cmd.exe', 'powershell.exe', 'pwsh.exe', 'wscript.exe')`, true},
+		{`net.dip in ('10.0.0.1', '10.0.0.2', '10.0.0.3', '10.0.0.4')`, true},
+	}
+
+	defer func(threshold int) { ListMatcherThreshold = threshold }(ListMatcherThreshold)
+
+	for i, tt := range tests {
+		for _, threshold := range []int{4, math.MaxInt} {
+			ListMatcherThreshold = threshold
+			p := NewParser(tt.expr)
+			expr, err := p.ParseExpr()
+			require.NoError(t, err)
+			if matches := Eval(expr, m, false); matches != tt.matches {
+				t.Errorf("%d. %q list matcher mismatch (threshold=%d): exp=%t got=%t", i, tt.expr, threshold, tt.matches, matches)
+			}
+		}
+	}
+}
+
+func TestEvalQuantifiers(t *testing.T) {
+	m := map[string]interface{}{
+		"ps.name":                  "rundll32.exe",
+		"ps.args":                  []string{"-nop", "-enc", "JABzAD0ATgBlAHcALQBPAGIAagBlAGMAdAA="},
+		"ps.modules":               []string{"ntdll.dll", "kernel32.dll", "vaultcli.dll"},
+		"ps.envs":                  []string{},
+		"thread.callstack.modules": []string{"C:\\Users\\admin\\evil.dll", "C:\\Windows\\System32\\ntdll.dll", "C:\\Users\\admin\\loader.dll", "C:\\Users\\admin\\stage.dll"},
+	}
+
+	var tests = []struct {
+		expr    string
+		matches bool
+	}{
+		{`any(ps.modules, $it iendswith 'vaultcli.dll')`, true},
+		{`any(ps.modules, $it = 'wininet.dll')`, false},
+		{`ps.name = 'rundll32.exe' and not any(ps.modules, $it = 'wininet.dll')`, true},
+		{`all(ps.modules, $it iendswith '.dll')`, true},
+		{`all(ps.modules, $it istartswith 'ntdll')`, false},
+		{`all(ps.envs, $it = 'PATH')`, false},
+		{`any(ps.envs, $it = 'PATH')`, false},
+		{`any(ps.cmdline, $it = 'PATH')`, false},
+		{`count(thread.callstack.modules, $it imatches '?:\\Users\\*') > 2`, true},
+		{`count(thread.callstack.modules, $it imatches '?:\\Users\\*') = 3`, true},
+		{`count(thread.callstack.modules, $it imatches '?:\\Windows\\*') > 2`, false},
+		{`count(ps.envs, $it = 'PATH') = 0`, true},
+		{`any(ps.args, $it in ('-enc', '-encodedcommand') and length($it) = 4)`, true},
+		{`any(ps.args, length($it) > 30)`, true},
+		{`any(('-nop', '-w'), $it in ps.args)`, true},
+		{`any(ps.modules, ($it = 'ntdll.dll' or $it = 'wininet.dll'))`, true},
+		{`any(ps.modules, $it = concat(substr(ps.name, 0, 5), '.dll'))`, false},
+		{`all(ps.modules, any(thread.callstack.modules, $it iendswith '.dll'))`, true},
+		{`any(thread.callstack.modules, count(ps.modules, $it = lower($it)) = 3)`, true},
+		{`any(ps.modules, any(thread.callstack.modules, $it = 'ntdll.dll'))`, false},
+	}
+
+	for i, tt := range tests {
+		p := NewParser(tt.expr)
+		expr, err := p.ParseExpr()
+		require.NoError(t, err, tt.expr)
+		if matches := Eval(expr, m, true); matches != tt.matches {
+			t.Errorf("%d. %q quantifier mismatch: exp=%t got=%t", i, tt.expr, tt.matches, matches)
+		}
+		// the optimized expression yields the same outcome
+		if matches := Eval(Optimize(expr), m, true); matches != tt.matches {
+			t.Errorf("%d. %q optimized quantifier mismatch: exp=%t got=%t", i, tt.expr, tt.matches, matches)
+		}
+	}
+}
+
+func TestParseNegation(t *testing.T) {
+	expr, err := NewParser(`-9223372036854775808`).ParseExpr()
+	require.NoError(t, err)
+	assert.Equal(t, &IntegerLiteral{Value: math.MinInt64}, expr)
+
+	_, err = NewParser(`-9223372036854775809`).ParseExpr()
+	require.Error(t, err)
+}
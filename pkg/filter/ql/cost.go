@@ -0,0 +1,158 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ql
+
+import (
+	"github.com/rabbitstack/fibratus/pkg/filter/fields"
+	"github.com/rabbitstack/fibratus/pkg/filter/ql/functions"
+	"strings"
+)
+
+// fieldCosts contains the relative cost of fetching the field values
+// that are more expensive than event parameters or process state.
+var fieldCosts = map[fields.Field]int{
+	fields.PsEnvs:                    4,
+	fields.PsModules:                 4,
+	fields.PsHandles:                 4,
+	fields.PsParentEnvs:              4,
+	fields.PsParentHandles:           4,
+	fields.PsAncestor:                8,
+	fields.FileIsDriverVulnerable:    20,
+	fields.FileIsDriverMalicious:     20,
+	fields.ImageIsDriverVulnerable:   20,
+	fields.ImageIsDriverMalicious:    20,
+	fields.ImageSignatureType:        100,
+	fields.ImageSignatureLevel:       100,
+	fields.PeIsSigned:                100,
+	fields.PeIsTrusted:               100,
+	fields.ThreadCallstackSummary:    8,
+	fields.ThreadCallstackDetail:     8,
+	fields.ThreadCallstackModules:    8,
+	fields.ThreadCallstackSymbols:    8,
+	fields.ThreadCallstackIsUnbacked: 8,
+}
+
+// funcCosts contains the relative cost of function calls. Functions
+// that access the file system, registry, or scan memory are the most
+// expensive ones.
+var funcCosts = map[functions.Fn]int{
+	functions.YaraFn:        1000,
+	functions.GetRegValueFn: 100,
+	functions.IsMinidumpFn:  100,
+	functions.GlobFn:        100,
+	functions.SymlinkFn:     100,
+	functions.RegexFn:       10,
+	functions.AnyFn:         10,
+	functions.AllFn:         10,
+	functions.CountFn:       10,
+	functions.EntropyFn:     10,
+	functions.MD5Fn:         10,
+}
+
+// boolFuncs contains functions that return the boolean value.
+var boolFuncs = map[functions.Fn]bool{
+	functions.CIDRContainsFn: true,
+	functions.RegexFn:        true,
+	functions.IsMinidumpFn:   true,
+	functions.IsAbsFn:        true,
+	functions.YaraFn:         true,
+	functions.AnyFn:          true,
+	functions.AllFn:          true,
+}
+
+// cost estimates the relative cost of evaluating the expression. The
+// cost accounts for fetching field values, calling functions, and
+// applying operators. Event fields are the cheapest ones, while PE,
+// signature, and callstack fields, along with functions that perform
+// I/O are the most expensive.
+func cost(expr Expr) int {
+	switch e := expr.(type) {
+	case *FieldLiteral:
+		return fieldCost(fields.Field(e.Value))
+	case *BoundFieldLiteral:
+		return fieldCost(e.Field())
+	case *Function:
+		c := 2
+		if fn, ok := funcs[strings.ToUpper(e.Name)]; ok {
+			if n, ok := funcCosts[fn.Name()]; ok {
+				c = n
+			}
+		}
+		for _, arg := range e.Args {
+			c += cost(arg)
+		}
+		return c
+	case *BinaryExpr:
+		return cost(e.LHS) + cost(e.RHS) + opCost(e)
+	case *NotExpr:
+		return cost(e.Expr)
+	case *ParenExpr:
+		return cost(e.Expr)
+	}
+	return 0
+}
+
+func fieldCost(f fields.Field) int {
+	if c, ok := fieldCosts[f]; ok {
+		return c
+	}
+	switch {
+	case f.IsKevtField():
+		return 1
+	case f.IsPeIsSigned(), f.IsPeIsTrusted(), f.IsPeCert(), f.IsImageCert():
+		// verifying the signature
+		return 100
+	case f.IsPeField():
+		// parsing the PE file
+		return 50
+	case f.IsModsMap(), f.IsEnvsMap(), f.IsAncestorMap():
+		return 8
+	}
+	return 2
+}
+
+// opCost estimates the cost of applying the operator. List operands
+// are evaluated value by value, unless they are precompiled into the
+// multi-pattern matcher.
+func opCost(e *BinaryExpr) int {
+	n := 1
+	if list, ok := e.RHS.(*ListLiteral); ok && list.matcher == nil {
+		n = len(list.Values)
+	}
+	switch e.Op {
+	case And, Or:
+		return 0
+	case Contains, IContains, Startswith, IStartswith, Endswith, IEndswith:
+		return 2 * n
+	case Matches, IMatches:
+		return 4 * n
+	case Fuzzy, IFuzzy, Fuzzynorm, IFuzzynorm:
+		return 20 * n
+	}
+	return n
+}
+
+func fieldIsBoolean(name string) bool {
+	return fields.IsBoolean(fields.Field(name))
+}
+
+func funcIsBoolean(name string) bool {
+	fn, ok := funcs[strings.ToUpper(name)]
+	return ok && boolFuncs[fn.Name()]
+}
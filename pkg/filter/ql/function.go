@@ -70,6 +70,9 @@ var funcs = map[string]FunctionDef{
 	functions.VolumeFn.String():       &functions.Volume{},
 	functions.GetRegValueFn.String():  &functions.GetRegValue{},
 	functions.YaraFn.String():         &functions.Yara{},
+	functions.AnyFn.String():          &functions.Any{},
+	functions.AllFn.String():          &functions.All{},
+	functions.CountFn.String():        &functions.Count{},
 }
 
 // FunctionDef is the interface that all function definitions have to satisfy.
@@ -44,6 +44,14 @@ func TestParseFunction(t *testing.T) {
 		{expr: "replace('hello world', 'hello', 'hell', 'world', 'war', 'hello', 'warld', 'old', 'new', 'one')", err: errors.New("old/new replacements mismatch")},
 		{expr: "indexof('hello', 'h', 'frst')", err: errors.New("frst is not a valid index search order")},
 		{expr: "base('C:\\\\Windows\\\\cmd.exe', false)"},
+		{expr: "any(ps.modules, $it iendswith 'vaultcli.dll')"},
+		{expr: "all(ps.args, $it != '-enc' and length($it) < 100)"},
+		{expr: "count(thread.callstack.modules, any(ps.modules, $it = base($it))) > 2"},
+		{expr: "any(ps.modules)", err: errors.New("ANY function requires 2 argument(s) but 1 argument(s) given")},
+		{expr: "any(ps.modules, 'vaultcli.dll')", err: errors.New("argument #2 (predicate) in function ANY should be one of: predicate|func")},
+		{expr: "count(ps.name = 'cmd.exe', $it = 'cmd.exe')", err: errors.New("argument #1 (slice) in function COUNT should be one of: field|slice|func")},
+		{expr: "ps.name = $it", err: errors.New("$it reference is only allowed in quantifier predicates")},
+		{expr: "any($it, $it = 'cmd.exe')", err: errors.New("$it reference is only allowed in quantifier predicates")},
 	}
 
 	for i, tt := range tests {
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package functions
+
+import "reflect"
+
+// PredicateFunc is the function argument that is evaluated for each
+// element of the slice. The element is bound to the $it reference.
+type PredicateFunc func(it interface{}) bool
+
+// Any returns true if the predicate is satisfied by any element of the slice.
+type Any struct{}
+
+func (f Any) Call(args []interface{}) (interface{}, bool) {
+	pred, ok := predicate(args)
+	if !ok {
+		return false, false
+	}
+	var matches bool
+	iterate(args[0], func(it interface{}) bool {
+		matches = pred(it)
+		return !matches
+	})
+	return matches, true
+}
+
+func (f Any) Desc() FunctionDesc { return quantifierDesc(AnyFn) }
+
+func (f Any) Name() Fn { return AnyFn }
+
+// All returns true if the predicate is satisfied by all elements of the slice.
+// Empty slices never satisfy the predicate.
+type All struct{}
+
+func (f All) Call(args []interface{}) (interface{}, bool) {
+	pred, ok := predicate(args)
+	if !ok {
+		return false, false
+	}
+	var n int
+	matches := true
+	iterate(args[0], func(it interface{}) bool {
+		n++
+		matches = pred(it)
+		return matches
+	})
+	return n > 0 && matches, true
+}
+
+func (f All) Desc() FunctionDesc { return quantifierDesc(AllFn) }
+
+func (f All) Name() Fn { return AllFn }
+
+// Count returns the number of slice elements satisfying the predicate.
+type Count struct{}
+
+func (f Count) Call(args []interface{}) (interface{}, bool) {
+	pred, ok := predicate(args)
+	if !ok {
+		return 0, false
+	}
+	var n int
+	iterate(args[0], func(it interface{}) bool {
+		if pred(it) {
+			n++
+		}
+		return true
+	})
+	return n, true
+}
+
+func (f Count) Desc() FunctionDesc { return quantifierDesc(CountFn) }
+
+func (f Count) Name() Fn { return CountFn }
+
+func quantifierDesc(fn Fn) FunctionDesc {
+	return FunctionDesc{
+		Name: fn,
+		Args: []FunctionArgDesc{
+			{Keyword: "slice", Types: []ArgType{Field, Slice, Func}, Required: true},
+			{Keyword: "predicate", Types: []ArgType{Predicate, Func}, Required: true},
+		},
+	}
+}
+
+func predicate(args []interface{}) (PredicateFunc, bool) {
+	if len(args) < 2 {
+		return nil, false
+	}
+	pred, ok := args[1].(PredicateFunc)
+	return pred, ok
+}
+
+// iterate invokes the function for each element of the slice
+// until the function returns false. Scalar values are treated
+// as single element slices.
+func iterate(v interface{}, fn func(it interface{}) bool) {
+	switch s := v.(type) {
+	case nil:
+	case []string:
+		for _, it := range s {
+			if !fn(it) {
+				return
+			}
+		}
+	case []interface{}:
+		for _, it := range s {
+			if !fn(it) {
+				return
+			}
+		}
+	default:
+		val := reflect.ValueOf(v)
+		if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+			fn(v)
+			return
+		}
+		for i := 0; i < val.Len(); i++ {
+			if !fn(val.Index(i).Interface()) {
+				return
+			}
+		}
+	}
+}
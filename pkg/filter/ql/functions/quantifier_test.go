@@ -0,0 +1,59 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package functions
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuantifiers(t *testing.T) {
+	dll := PredicateFunc(func(it interface{}) bool {
+		s, ok := it.(string)
+		return ok && strings.HasSuffix(s, ".dll")
+	})
+
+	var tests = []struct {
+		fn interface {
+			Call([]interface{}) (interface{}, bool)
+			Name() Fn
+		}
+		args     []interface{}
+		expected interface{}
+	}{
+		{Any{}, []interface{}{[]string{"cmd.exe", "ntdll.dll"}, dll}, true},
+		{Any{}, []interface{}{[]string{"cmd.exe"}, dll}, false},
+		{Any{}, []interface{}{nil, dll}, false},
+		{Any{}, []interface{}{"ntdll.dll", dll}, true},
+		{All{}, []interface{}{[]string{"kernel32.dll", "ntdll.dll"}, dll}, true},
+		{All{}, []interface{}{[]interface{}{"kernel32.dll", 1}, dll}, false},
+		{All{}, []interface{}{[]string{}, dll}, false},
+		{Count{}, []interface{}{[]string{"kernel32.dll", "cmd.exe", "ntdll.dll"}, dll}, 2},
+		{Count{}, []interface{}{[]uint32{1, 2}, dll}, 0},
+		{Count{}, []interface{}{[]string{"ntdll.dll"}, "ntdll.dll"}, 0},
+	}
+
+	for i, tt := range tests {
+		res, _ := tt.fn.Call(tt.args)
+		assert.Equal(t, tt.expected, res, fmt.Sprintf("%d. %s result mismatch: exp=%v got=%v", i, tt.fn.Name(), tt.expected, res))
+	}
+}
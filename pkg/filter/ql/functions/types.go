@@ -72,6 +72,12 @@ const (
 	GetRegValueFn
 	// YaraFn represents the YARA function
 	YaraFn
+	// AnyFn represents the ANY function
+	AnyFn
+	// AllFn represents the ALL function
+	AllFn
+	// CountFn represents the COUNT function
+	CountFn
 )
 
 // ArgType is the type alias for the argument value type.
@@ -98,6 +104,10 @@ const (
 	Slice
 	// Bool represents the boolean argument type.
 	Bool
+	// Predicate represents the argument type that is
+	// derived from the boolean expression evaluated
+	// lazily by the function.
+	Predicate
 	// Unknown is the unknown argument type.
 	Unknown
 )
@@ -119,6 +129,8 @@ func (typ ArgType) String() string {
 		return "slice"
 	case Bool:
 		return "bool"
+	case Predicate:
+		return "predicate"
 	}
 	return "unknown"
 }
@@ -208,6 +220,12 @@ func (f Fn) String() string {
 		return "GET_REG_VALUE"
 	case YaraFn:
 		return "YARA"
+	case AnyFn:
+		return "ANY"
+	case AllFn:
+		return "ALL"
+	case CountFn:
+		return "COUNT"
 	default:
 		return "UNDEFINED"
 	}
@@ -87,6 +87,7 @@ func (s *scanner) scan() (tok token, pos int, lit string) {
 			return Neq, pos, ""
 		}
 		s.r.unread()
+		return Bang, pos, ""
 	case '>':
 		if ch1, _ := s.r.read(); ch1 == '=' {
 			return Gte, pos, ""
@@ -107,6 +108,20 @@ func (s *scanner) scan() (tok token, pos int, lit string) {
 		return Rparen, pos, ""
 	case '|':
 		return Pipe, pos, ""
+	case '+':
+		return Add, pos, ""
+	case '-':
+		return Sub, pos, ""
+	case '*':
+		return Mul, pos, ""
+	case '/':
+		return Div, pos, ""
+	case '%':
+		return Mod, pos, ""
+	case '&':
+		return BitAnd, pos, ""
+	case '^':
+		return BitXor, pos, ""
 	case ',':
 		return Comma, pos, ""
 	case '$':
@@ -197,6 +212,24 @@ func (s *scanner) scanNumber() (tok token, pos int, lit string) {
 	// Read as many digits as possible.
 	_, _ = buf.WriteString(s.scanDigits())
 
+	// Hexadecimal integers are converted to their
+	// decimal representation, e.g. 0x10 becomes 16
+	if buf.String() == "0" {
+		if ch0, _ := s.r.read(); ch0 == 'x' || ch0 == 'X' {
+			if ch1, _ := s.r.read(); isHexDigit(ch1) {
+				s.r.unread()
+				hex := s.scanHexDigits()
+				n, err := strconv.ParseUint(hex, 16, 64)
+				if err != nil {
+					return Illegal, pos, "0x" + hex
+				}
+				return Integer, pos, strconv.FormatUint(n, 10)
+			}
+			s.r.unread()
+		}
+		s.r.unread()
+	}
+
 	// If next code points are a full stop and digit then consume them.
 	isDecimal := false
 	if ch0, _ := s.r.read(); ch0 == '.' {
@@ -297,6 +330,20 @@ func (s *scanner) scanDigits() string {
 	return buf.String()
 }
 
+// scanHexDigits consumes a contiguous series of hexadecimal digits.
+func (s *scanner) scanHexDigits() string {
+	var buf bytes.Buffer
+	for {
+		ch, _ := s.r.read()
+		if !isHexDigit(ch) {
+			s.r.unread()
+			break
+		}
+		_, _ = buf.WriteRune(ch)
+	}
+	return buf.String()
+}
+
 // scanBareIdent reads bare identifier from a rune reader.
 func scanBareIdent(r io.RuneScanner) string {
 	// Read every ident character into the buffer.
@@ -513,6 +560,11 @@ func isLetter(ch rune) bool {
 // isDigit returns true if the rune is a digit.
 func isDigit(ch rune) bool { return ch >= '0' && ch <= '9' }
 
+// isHexDigit returns true if the rune is a hexadecimal digit.
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
+
 // isIdentChar returns true if the rune can be used in an unquoted identifier. $ rune is for special PE section names (e.g. .debug$ | .tls$)
 func isIdentChar(ch rune) bool {
 	return isLetter(ch) || isDigit(ch) || ch == '_' || ch == '.' || ch == '[' || ch == ']' || ch == '$'
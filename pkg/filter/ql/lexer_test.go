@@ -45,7 +45,7 @@ func TestScanner(t *testing.T) {
 		{s: `=`, tok: Eq},
 		{s: `~=`, tok: IEq},
 		{s: `<>`, tok: Neq},
-		{s: `! `, tok: Illegal, lit: "!"},
+		{s: `! `, tok: Bang},
 		{s: `<`, tok: Lt},
 		{s: `<=`, tok: Lte},
 		{s: `>`, tok: Gt},
@@ -53,6 +53,15 @@ func TestScanner(t *testing.T) {
 		{s: `IN`, tok: In},
 		{s: `in`, tok: In},
 
+		// arithmetic and bitwise operators
+		{s: `+`, tok: Add},
+		{s: `-`, tok: Sub},
+		{s: `*`, tok: Mul},
+		{s: `/`, tok: Div},
+		{s: `%`, tok: Mod},
+		{s: `&`, tok: BitAnd},
+		{s: `^`, tok: BitXor},
+
 		// misc tokens
 		{s: `(`, tok: Lparen},
 		{s: `)`, tok: Rparen},
@@ -84,6 +93,12 @@ func TestScanner(t *testing.T) {
 
 		// numbers
 		{s: "6.2323", tok: Decimal, lit: "6.2323"},
+		{s: "100", tok: Integer, lit: "100"},
+		{s: "0x10", tok: Integer, lit: "16"},
+		{s: "0X1fffff", tok: Integer, lit: "2097151"},
+		{s: "0xffffffffffffffff", tok: Integer, lit: "18446744073709551615"},
+		{s: "0x1ffffffffffffffff", tok: Illegal, lit: "0x1ffffffffffffffff"},
+		{s: "5m", tok: Duration, lit: "5m"},
 	}
 
 	for i, tt := range tests {
@@ -20,8 +20,10 @@ package ql
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/rabbitstack/fibratus/pkg/filter/fields"
+	"github.com/rabbitstack/fibratus/pkg/filter/lists"
 	"github.com/rabbitstack/fibratus/pkg/kevent"
 	"github.com/rabbitstack/fibratus/pkg/kevent/ktypes"
 	"github.com/rabbitstack/fibratus/pkg/util/hashers"
@@ -74,6 +76,13 @@ type BoundFieldLiteral struct {
 	Value string
 }
 
+// IteratorLiteral represents the $it reference to the slice element
+// the predicate of the quantifier function is evaluated against.
+type IteratorLiteral struct{}
+
+// iterator is the valuer key of the current slice element
+const iterator = "$it"
+
 func (i IPLiteral) String() string {
 	return i.Value.String()
 }
@@ -106,6 +115,10 @@ func (b BoundFieldLiteral) String() string {
 	return b.Value
 }
 
+func (IteratorLiteral) String() string {
+	return iterator
+}
+
 func (b BoundFieldLiteral) Field() fields.Field {
 	n := strings.Index(b.Value, ".")
 	if n > 0 {
@@ -125,6 +138,8 @@ func (b BoundFieldLiteral) Alias() string {
 // ListLiteral represents a list of tag key literals.
 type ListLiteral struct {
 	Values []string
+	// matcher evaluates the operator against all list values at once
+	matcher *listMatcher
 }
 
 // String returns a string representation of the literal.
@@ -141,10 +156,26 @@ func (s *ListLiteral) String() string {
 	return buf.String()
 }
 
+// LookupListLiteral represents the reference to the external
+// lookup list. The list values are resolved at evaluation time,
+// so the list can be reloaded without recompiling the expression.
+type LookupListLiteral struct {
+	Name string
+	List *lists.List
+}
+
+// String returns a string representation of the literal.
+func (l *LookupListLiteral) String() string {
+	return "$list('" + l.Name + "')"
+}
+
 // Function represents a function call.
 type Function struct {
 	Name string
 	Args []Expr
+	// predicates indicates which arguments are predicates
+	// evaluated by the function for each slice element
+	predicates []bool
 }
 
 // ArgsSlice returns arguments as a slice of strings.
@@ -195,7 +226,7 @@ func (f *Function) validate() error {
 		arg := fn.Desc().Args[i]
 		typ := functions.Unknown
 		switch reflect.TypeOf(expr) {
-		case reflect.TypeOf(&FieldLiteral{}), reflect.TypeOf(&BoundFieldLiteral{}):
+		case reflect.TypeOf(&FieldLiteral{}), reflect.TypeOf(&BoundFieldLiteral{}), reflect.TypeOf(&IteratorLiteral{}):
 			typ = functions.Field
 		case reflect.TypeOf(&IPLiteral{}):
 			typ = functions.IP
@@ -209,20 +240,39 @@ func (f *Function) validate() error {
 			typ = functions.Slice
 		case reflect.TypeOf(&BoolLiteral{}):
 			typ = functions.Bool
+		case reflect.TypeOf(&BinaryExpr{}), reflect.TypeOf(&NotExpr{}), reflect.TypeOf(&ParenExpr{}):
+			typ = functions.Predicate
 		}
 		if !arg.ContainsType(typ) {
 			return ErrArgumentTypeMismatch(i, arg.Keyword, fn.Name(), arg.Types)
 		}
+		if arg.ContainsType(functions.Predicate) {
+			if f.predicates == nil {
+				f.predicates = make([]bool, len(f.Args))
+			}
+			f.predicates[i] = true
+		}
 	}
 	return nil
 }
 
+// isPredicate determines if the argument at the given
+// index is the predicate evaluated by the function.
+func (f *Function) isPredicate(i int) bool {
+	return i < len(f.predicates) && f.predicates[i]
+}
+
 // SequenceExpr represents a single binary expression within the sequence.
 type SequenceExpr struct {
 	Expr        Expr
 	By          fields.Field
 	BoundFields []*BoundFieldLiteral
 	Alias       string
+	// IsNegated indicates the expression describes the
+	// absence of the event. The sequence matches if the
+	// event satisfying the negated expression doesn't
+	// occur within the max span.
+	IsNegated bool
 
 	buckets map[uint32]bool
 	ktypes  []ktypes.Ktype
@@ -317,6 +367,20 @@ func (s Sequence) IsConstrained() bool {
 	return !s.By.IsEmpty() || !s.Expressions[0].By.IsEmpty()
 }
 
+// IsNegated determines if the sequence is terminated by the negated expression.
+func (s Sequence) IsNegated() bool {
+	return len(s.Expressions) > 0 && s.Expressions[len(s.Expressions)-1].IsNegated
+}
+
+// NegatedExpr returns the trailing negated expression or nil
+// if the sequence doesn't contain the negated expression.
+func (s *Sequence) NegatedExpr() *SequenceExpr {
+	if !s.IsNegated() {
+		return nil
+	}
+	return &s.Expressions[len(s.Expressions)-1]
+}
+
 func (s *Sequence) init() {
 	// determine if the sequence references
 	// an event type that can arrive out-of-order.
@@ -359,3 +423,37 @@ func (s Sequence) incompatibleConstraints() bool {
 	}
 	return false
 }
+
+// Threshold represents the expression that matches when the
+// number of events satisfying the expression reaches the count
+// within the time window. If the `By` field is given, events are
+// counted separately for each distinct field value.
+type Threshold struct {
+	Count  uint64
+	Window time.Duration
+	By     fields.Field
+	Expr   Expr
+}
+
+// checkNegated ensures the negated expression is correctly placed
+// within the sequence. Only the last expression can be negated, and
+// it must be preceded by at least one regular expression. The
+// absence of the event can only be asserted in a bounded time
+// window, so the max span is mandatory for negated sequences.
+func (s Sequence) checkNegated() error {
+	for i, expr := range s.Expressions {
+		if !expr.IsNegated {
+			continue
+		}
+		if i == 0 {
+			return errors.New("the first sequence expression can't be negated")
+		}
+		if i != len(s.Expressions)-1 {
+			return errors.New("only the last sequence expression can be negated")
+		}
+		if s.MaxSpan == 0 {
+			return errors.New("negated sequence expressions require the 'maxspan' statement")
+		}
+	}
+	return nil
+}
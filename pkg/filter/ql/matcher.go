@@ -0,0 +1,115 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ql
+
+import (
+	"github.com/rabbitstack/fibratus/pkg/util/ahocorasick"
+	"github.com/rabbitstack/fibratus/pkg/util/wildcard"
+	"strings"
+)
+
+// ListMatcherThreshold is the minimum number of list values for
+// which the list is precompiled into the multi-pattern matcher.
+// Smaller lists are evaluated value by value.
+var ListMatcherThreshold = 4
+
+// listMatcher evaluates the string operator against all values of the
+// list literal at once. Membership operators are backed by hash sets,
+// contains, startswith, and endswith operators by the Aho-Corasick
+// automaton, and matches operators by the combined wildcard matcher.
+// For case-insensitive operators, the list values are lowercased at
+// compile time, so only the field value is lowercased on evaluation.
+type listMatcher struct {
+	op       token
+	fold     bool
+	set      map[string]struct{}
+	ac       *ahocorasick.Matcher
+	wildcard *wildcard.Matcher
+}
+
+// newListMatcher builds the matcher for the list values and the operator.
+// Returns nil if the operator is not eligible for precompilation or the
+// list is too small to benefit from it.
+func newListMatcher(op token, values []string) *listMatcher {
+	if len(values) < ListMatcherThreshold {
+		return nil
+	}
+	m := &listMatcher{op: op}
+	switch op {
+	case IIn, IContains, IStartswith, IEndswith, IMatches:
+		m.fold = true
+		lowered := make([]string, len(values))
+		for i, v := range values {
+			lowered[i] = strings.ToLower(v)
+		}
+		values = lowered
+	}
+	switch op {
+	case In, IIn:
+		m.set = make(map[string]struct{}, len(values))
+		for _, v := range values {
+			m.set[v] = struct{}{}
+		}
+	case Contains, IContains, Startswith, IStartswith, Endswith, IEndswith:
+		m.ac = ahocorasick.New(values)
+	case Matches, IMatches:
+		m.wildcard = wildcard.NewMatcher(values)
+	default:
+		return nil
+	}
+	return m
+}
+
+// match evaluates the field value against the list. The second return
+// value is false if the value type is not supported by the matcher, in
+// which case the expression is evaluated by the generic path.
+func (m *listMatcher) match(v interface{}) (bool, bool) {
+	switch val := v.(type) {
+	case string:
+		return m.matchString(val), true
+	case []string:
+		for _, s := range val {
+			if m.matchString(s) {
+				return true, true
+			}
+		}
+		return false, true
+	}
+	return false, false
+}
+
+func (m *listMatcher) matchString(s string) bool {
+	if m.fold {
+		s = strings.ToLower(s)
+	}
+	switch m.op {
+	case In, IIn:
+		_, ok := m.set[s]
+		return ok
+	case Contains, IContains:
+		return m.ac.Contains(s)
+	case Startswith, IStartswith:
+		return m.ac.HasPrefix(s)
+	case Endswith, IEndswith:
+		return m.ac.HasSuffix(s)
+	case Matches, IMatches:
+		return m.wildcard.Match(s)
+	}
+	return false
+}
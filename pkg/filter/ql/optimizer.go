@@ -0,0 +1,325 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ql
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Optimize rewrites the expression into the equivalent expression that
+// is cheaper to evaluate. The optimizer folds constant subexpressions,
+// removes duplicate operands of the logical operators that are usually
+// the result of macro expansion, and reorders operands of and/or chains
+// by their estimated cost, so the lazy evaluation skips the expensive
+// operands whenever the cheap operands decide the outcome.
+//
+// The evaluator yields true, false, or no value for logical operators.
+// The and/or operators are commutative and associative on these values,
+// so operands are only reordered if all of them are known to yield one
+// of these values. The original expression is left intact.
+func Optimize(expr Expr) Expr {
+	return optimize(expr, false)
+}
+
+// optimize rewrites the expression. The widen flag indicates the
+// expression is the operand of the comparison operator, where the
+// arithmetic expressions are evaluated differently than literals.
+func optimize(expr Expr, widen bool) Expr {
+	if isConstant(expr) {
+		return fold(expr, widen)
+	}
+	switch e := expr.(type) {
+	case *ParenExpr:
+		return &ParenExpr{Expr: optimize(e.Expr, widen)}
+	case *NotExpr:
+		return negate(e.Expr, optimize(e.Expr, false))
+	case *BinaryExpr:
+		if e.Op == And || e.Op == Or {
+			return optimizeLogical(e)
+		}
+		widen := e.Op.isComparison()
+		return &BinaryExpr{Op: e.Op, LHS: optimize(e.LHS, widen), RHS: optimize(e.RHS, widen)}
+	case *Function:
+		args := make([]Expr, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = optimize(arg, false)
+		}
+		return &Function{Name: e.Name, Args: args, predicates: e.predicates}
+	}
+	return expr
+}
+
+// optimizeLogical flattens the chain of and/or operators, simplifies
+// and deduplicates the operands, and rebuilds the chain with operands
+// sorted by their cost.
+func optimizeLogical(expr *BinaryExpr) Expr {
+	operands := flatten(expr.Op, expr, nil)
+	for _, o := range operands {
+		if !isBoolean(o) {
+			return &BinaryExpr{Op: expr.Op, LHS: optimize(expr.LHS, false), RHS: optimize(expr.RHS, false)}
+		}
+	}
+
+	// the absorbing literal decides the outcome of the chain,
+	// while the identity literal doesn't affect the outcome
+	// unless all other operands yield no value
+	absorbing := expr.Op == Or
+	var (
+		kept       = make([]Expr, 0, len(operands))
+		seen       = make(map[string]bool)
+		strict     bool
+		identities bool
+	)
+	for _, o := range operands {
+		o = optimize(o, false)
+		if lit, ok := unparen(o).(*BoolLiteral); ok {
+			if lit.Value == absorbing {
+				return &BoolLiteral{Value: absorbing}
+			}
+			identities = true
+			continue
+		}
+		k := key(o)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if isStrict(o) {
+			strict = true
+		}
+		kept = append(kept, o)
+	}
+	if len(kept) == 0 {
+		return &BoolLiteral{Value: !absorbing}
+	}
+	if identities && !strict {
+		kept = append(kept, &BoolLiteral{Value: !absorbing})
+	}
+
+	costs := make(map[Expr]int, len(kept))
+	for _, o := range kept {
+		costs[o] = cost(o)
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return costs[kept[i]] < costs[kept[j]] })
+
+	chain := group(expr.Op, kept[0])
+	for _, o := range kept[1:] {
+		chain = &BinaryExpr{Op: expr.Op, LHS: chain, RHS: group(expr.Op, o)}
+	}
+	return chain
+}
+
+// flatten collects the operands of the chain of the same logical operator.
+func flatten(op token, expr Expr, operands []Expr) []Expr {
+	switch e := expr.(type) {
+	case *ParenExpr:
+		if b, ok := e.Expr.(*BinaryExpr); ok && b.Op == op {
+			return flatten(op, b, operands)
+		}
+	case *BinaryExpr:
+		if e.Op == op {
+			operands = flatten(op, e.LHS, operands)
+			return flatten(op, e.RHS, operands)
+		}
+	}
+	return append(operands, expr)
+}
+
+// group parenthesizes the chain operand combined by the other logical operator.
+func group(op token, expr Expr) Expr {
+	if b, ok := expr.(*BinaryExpr); ok && b.Op != op && (b.Op == And || b.Op == Or) {
+		return &ParenExpr{Expr: expr}
+	}
+	return expr
+}
+
+// negate builds the not expression from the optimized operand. The
+// evaluator only negates binary expressions, function calls, and
+// parenthesized expressions, so the operand is parenthesized if the
+// original operand was one of them.
+func negate(orig, expr Expr) Expr {
+	switch orig.(type) {
+	case *BinaryExpr, *Function, *ParenExpr:
+	default:
+		return &NotExpr{Expr: expr}
+	}
+	if lit, ok := unparen(expr).(*BoolLiteral); ok {
+		return &BoolLiteral{Value: !lit.Value}
+	}
+	switch expr.(type) {
+	case *BinaryExpr, *Function, *ParenExpr:
+		return &NotExpr{Expr: expr}
+	}
+	return &NotExpr{Expr: &ParenExpr{Expr: expr}}
+}
+
+// fold evaluates the constant expression and replaces it with the
+// literal. Arithmetic expressions compared with other values are
+// not folded, since their operands are widened on comparison.
+func fold(expr Expr, widen bool) Expr {
+	switch expr.(type) {
+	case *BinaryExpr, *NotExpr, *ParenExpr:
+	default:
+		return expr
+	}
+	eval := ValuerEval{Valuer: MapValuer(nil)}
+	switch v := eval.Eval(expr).(type) {
+	case bool:
+		return &BoolLiteral{Value: v}
+	case int64:
+		if !widen {
+			return &IntegerLiteral{Value: v}
+		}
+	case uint64:
+		if !widen {
+			return &UnsignedLiteral{Value: v}
+		}
+	case float64:
+		if !widen {
+			return &DecimalLiteral{Value: v}
+		}
+	}
+	return expr
+}
+
+// isConstant determines if the expression doesn't
+// depend on event fields or function calls.
+func isConstant(expr Expr) bool {
+	constant := true
+	WalkFunc(expr, func(n Node) {
+		switch n.(type) {
+		case *FieldLiteral, *BoundFieldLiteral, *IteratorLiteral, *Function, *LookupListLiteral:
+			constant = false
+		}
+	})
+	return constant
+}
+
+// isBoolean determines if the expression yields either
+// the boolean value or no value when evaluated.
+func isBoolean(expr Expr) bool {
+	switch e := expr.(type) {
+	case *BoolLiteral, *NotExpr:
+		return true
+	case *ParenExpr:
+		return isBoolean(e.Expr)
+	case *BinaryExpr:
+		return !e.Op.isArithmetic()
+	case *FieldLiteral:
+		return fieldIsBoolean(e.Value)
+	case *Function:
+		return funcIsBoolean(e.Name)
+	}
+	return false
+}
+
+// isStrict determines if the expression always
+// yields the boolean value when evaluated.
+func isStrict(expr Expr) bool {
+	switch e := expr.(type) {
+	case *BoolLiteral:
+		return true
+	case *ParenExpr:
+		return isStrict(e.Expr)
+	case *NotExpr:
+		switch e.Expr.(type) {
+		case *BinaryExpr, *ParenExpr:
+			return isStrict(e.Expr)
+		}
+	case *BinaryExpr:
+		return e.Op == IEq || e.Op.isComparison()
+	}
+	return false
+}
+
+func unparen(expr Expr) Expr {
+	for {
+		p, ok := expr.(*ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = p.Expr
+	}
+}
+
+// key returns the canonical representation of the expression
+// that is used to identify duplicate operands. Unlike the string
+// representation, literals of different types never produce the
+// same key.
+func key(expr Expr) string {
+	var b strings.Builder
+	writeKey(&b, unparen(expr))
+	return b.String()
+}
+
+func writeKey(b *strings.Builder, expr Expr) {
+	switch e := expr.(type) {
+	case *BinaryExpr:
+		b.WriteByte('(')
+		writeKey(b, e.LHS)
+		b.WriteByte(' ')
+		b.WriteString(e.Op.String())
+		b.WriteByte(' ')
+		writeKey(b, e.RHS)
+		b.WriteByte(')')
+	case *NotExpr:
+		b.WriteString("not(")
+		writeKey(b, e.Expr)
+		b.WriteByte(')')
+	case *ParenExpr:
+		b.WriteString("paren(")
+		writeKey(b, e.Expr)
+		b.WriteByte(')')
+	case *Function:
+		b.WriteString(strings.ToLower(e.Name))
+		b.WriteByte('(')
+		for i, arg := range e.Args {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeKey(b, arg)
+		}
+		b.WriteByte(')')
+	case *StringLiteral:
+		b.WriteString(strconv.Quote(e.Value))
+	case *ListLiteral:
+		b.WriteByte('[')
+		for i, v := range e.Values {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(strconv.Quote(v))
+		}
+		b.WriteByte(']')
+	case *IntegerLiteral:
+		b.WriteString("int:" + strconv.FormatInt(e.Value, 10))
+	case *UnsignedLiteral:
+		b.WriteString("uint:" + strconv.FormatUint(e.Value, 10))
+	case *DecimalLiteral:
+		b.WriteString("dec:" + strconv.FormatFloat(e.Value, 'g', -1, 64))
+	case *IPLiteral:
+		b.WriteString("ip:" + e.Value.String())
+	case *LookupListLiteral:
+		b.WriteString("list:" + strconv.Quote(e.Name))
+	default:
+		b.WriteString(expr.String())
+	}
+}
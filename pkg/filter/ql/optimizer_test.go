@@ -0,0 +1,213 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ql
+
+import (
+	"fmt"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	var tests = []struct {
+		expr      string
+		optimized string
+	}{
+		{`pe.is_signed and kevt.name = 'CreateFile'`, `kevt.name = CreateFile AND pe.is_signed`},
+		{`get_reg_value(registry.key.name) = 'x' or ps.name = 'cmd.exe'`, `ps.name = cmd.exe OR get_reg_value(registry.key.name) = x`},
+		{`1 + 2 = 3 and ps.name = 'cmd.exe'`, `ps.name = cmd.exe`},
+		{`ps.name = 'cmd.exe' or 2 > 1`, `true`},
+		{`ps.name = 'cmd.exe' and 2 < 1`, `false`},
+		{`ps.name = 'cmd.exe' and (kevt.name = 'CreateProcess' and ps.name = 'cmd.exe')`, `kevt.name = CreateProcess AND ps.name = cmd.exe`},
+		{`ps.name in ('cmd.exe') or ps.name in ('cmd.exe')`, `ps.name IN (cmd.exe)`},
+		{`ps.pid = 2 * 2`, `ps.pid = 2 * 2`},
+		{`ps.pid + (2 * 2) > 5`, `ps.pid + 4 > 5`},
+		{`pe.is_signed and not (kevt.name = 'CreateFile' and false)`, `true AND pe.is_signed`},
+		{`file.name imatches ('*.exe') and ps.name = 'cmd.exe' or kevt.name = 'CreateFile'`, `kevt.name = CreateFile OR (ps.name = cmd.exe AND file.name IMATCHES (*.exe))`},
+		{`ps.name = 'cmd.exe' and ps.exe != ''`, `ps.name = cmd.exe AND ps.exe != `},
+		{`ps.name = 'ps.exe' and ps.name = ps.exe`, `ps.name = ps.exe AND ps.name = ps.exe`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := NewParser(tt.expr).ParseExpr()
+			require.NoError(t, err)
+			orig := expr.String()
+			assert.Equal(t, tt.optimized, Optimize(expr).String())
+			// the original expression is left intact
+			assert.Equal(t, orig, expr.String())
+		})
+	}
+}
+
+func TestOptimizeMacros(t *testing.T) {
+	c := config.FiltersWithMacros(map[string]*config.Macro{
+		"spawn_process":   {Expr: "kevt.name = 'CreateProcess'"},
+		"unsigned_parent": {Expr: "spawn_process and ps.parent.name = 'explorer.exe'"},
+	})
+	expr, err := NewParserWithConfig("pe.is_signed = false and spawn_process and unsigned_parent", c).ParseExpr()
+	require.NoError(t, err)
+	assert.Equal(t, "kevt.name = CreateProcess AND ps.parent.name = explorer.exe AND pe.is_signed = false", Optimize(expr).String())
+}
+
+// exprGen generates random filter expressions along with the random
+// field values the expressions are evaluated against.
+type exprGen struct {
+	r *rand.Rand
+	// leaves contains the previously generated leaf expressions
+	leaves []string
+}
+
+var genStrings = map[string][]string{
+	"kevt.name": {"CreateFile", "CreateProcess", "RegSetValue"},
+	"ps.name":   {"cmd.exe", "CMD.EXE", "powershell.exe", "svchost.exe"},
+	"file.name": {"C:/Windows/System32/cmd.exe", "C:/Temp/dropper.exe", "notes.txt", ""},
+}
+
+var genPatterns = []string{"*.exe", "cmd*", "*shell*", "C:/*/System32/*", "?otes.txt", "*"}
+
+func (g *exprGen) pick(values []string) string { return values[g.r.Intn(len(values))] }
+
+func (g *exprGen) stringField() string {
+	return g.pick([]string{"kevt.name", "ps.name", "file.name"})
+}
+
+func (g *exprGen) list(field string, n int) string {
+	values := make([]string, n)
+	for i := range values {
+		values[i] = "'" + g.pick(genStrings[field]) + "'"
+	}
+	return "(" + strings.Join(values, ", ") + ")"
+}
+
+func (g *exprGen) leaf() string {
+	if len(g.leaves) > 0 && g.r.Intn(5) == 0 {
+		// repeat the previous leaf as macro expansion does
+		return g.pick(g.leaves)
+	}
+	var leaf string
+	switch g.r.Intn(12) {
+	case 0:
+		f := g.stringField()
+		op := g.pick([]string{"=", "~=", "!=", "contains", "icontains", "startswith", "iendswith"})
+		leaf = fmt.Sprintf("%s %s '%s'", f, op, g.pick(genStrings[f]))
+	case 1:
+		f := g.stringField()
+		op := g.pick([]string{"in", "iin", "not in", "contains", "istartswith", "endswith", "not icontains"})
+		leaf = fmt.Sprintf("%s %s %s", f, op, g.list(f, 1+g.r.Intn(6)))
+	case 2:
+		f := g.stringField()
+		patterns := make([]string, 1+g.r.Intn(5))
+		for i := range patterns {
+			patterns[i] = "'" + g.pick(genPatterns) + "'"
+		}
+		leaf = fmt.Sprintf("%s %s (%s)", f, g.pick([]string{"matches", "imatches"}), strings.Join(patterns, ", "))
+	case 3:
+		leaf = fmt.Sprintf("ps.pid %s %d", g.pick([]string{"=", "!=", "<", ">=", "in"}), g.r.Intn(10))
+		if strings.Contains(leaf, " in ") {
+			leaf = fmt.Sprintf("ps.pid in ('%d', '%d')", g.r.Intn(10), g.r.Intn(10))
+		}
+	case 4:
+		leaf = fmt.Sprintf("ps.pid + %d > %d", g.r.Intn(5), g.r.Intn(10))
+	case 5:
+		leaf = fmt.Sprintf("ps.pid = %d * 2 + %d", g.r.Intn(3), g.r.Intn(3))
+	case 6:
+		leaf = g.pick([]string{"pe.is_signed", "file.is_dll", "pe.is_signed = true", "file.is_dll != false"})
+	case 7:
+		leaf = g.pick([]string{"true", "false", "1 + 1 = 2", "2 * 3 < 5", "'a' in ('a', 'b')", "(true)"})
+	case 8:
+		leaf = g.pick([]string{"is_abs(file.name)", "cidr_contains(net.dip, '10.0.0.0/8')", "length(ps.name) > 7", "lower(ps.name) = 'cmd.exe'"})
+	case 9:
+		leaf = g.pick([]string{"ps.args in ('-c', '/k')", "ps.args icontains ('WHOAMI', 'net', 'user', 'add')"})
+	case 10:
+		// non-boolean operands of logical operators
+		leaf = g.pick([]string{"ps.name", "ps.pid", "ps.pid + 1", "lower(ps.name)"})
+	default:
+		leaf = fmt.Sprintf("kevt.name = '%s'", g.pick(genStrings["kevt.name"]))
+	}
+	g.leaves = append(g.leaves, leaf)
+	return leaf
+}
+
+func (g *exprGen) expr(depth int) string {
+	if depth == 0 || g.r.Intn(4) == 0 {
+		return g.leaf()
+	}
+	switch g.r.Intn(6) {
+	case 0:
+		return "(" + g.expr(depth-1) + ")"
+	case 1:
+		return g.expr(depth-1) + " " + g.pick([]string{"and", "or"}) + " not " + g.expr(depth-1)
+	default:
+		return g.expr(depth-1) + " " + g.pick([]string{"and", "or"}) + " " + g.expr(depth-1)
+	}
+}
+
+func (g *exprGen) values() map[string]interface{} {
+	m := make(map[string]interface{})
+	maybe := func(k string, v interface{}) {
+		if g.r.Intn(5) > 0 {
+			m[k] = v
+		}
+	}
+	for _, f := range []string{"kevt.name", "ps.name", "file.name"} {
+		maybe(f, g.pick(genStrings[f]))
+	}
+	maybe("ps.pid", uint32(g.r.Intn(10)))
+	maybe("pe.is_signed", g.r.Intn(2) == 0)
+	maybe("file.is_dll", g.r.Intn(2) == 0)
+	maybe("net.dip", net.ParseIP(g.pick([]string{"10.0.0.1", "192.168.1.1"})))
+	maybe("ps.args", g.pick([]string{"/k", "whoami", "-c"}))
+	if args, ok := m["ps.args"].(string); ok {
+		m["ps.args"] = []string{"cmd.exe", args}
+	}
+	return m
+}
+
+// TestOptimizeEquivalence verifies the optimized expressions
+// yield the same values as the original expressions for
+// randomly generated expressions and field values.
+func TestOptimizeEquivalence(t *testing.T) {
+	g := &exprGen{r: rand.New(rand.NewSource(1))}
+
+	for i := 0; i < 20000; i++ {
+		s := g.expr(4)
+		expr, err := NewParser(s).ParseExpr()
+		require.NoError(t, err, s)
+		optimized := Optimize(expr)
+
+		for j := 0; j < 16; j++ {
+			m := g.values()
+			eval := ValuerEval{Valuer: MultiValuer(MapValuer(m), FunctionValuer{m})}
+			expected, actual := eval.Eval(expr), eval.Eval(optimized)
+			if !reflect.DeepEqual(expected, actual) {
+				t.Fatalf("%s optimized to %s yields %v instead of %v for %v", s, optimized, actual, expected, m)
+			}
+		}
+		if i%1000 == 0 {
+			g.leaves = g.leaves[:0]
+		}
+	}
+}
@@ -25,8 +25,12 @@ import (
 	"fmt"
 	"github.com/rabbitstack/fibratus/pkg/config"
 	"github.com/rabbitstack/fibratus/pkg/filter/fields"
+	"github.com/rabbitstack/fibratus/pkg/filter/lists"
+	"github.com/rabbitstack/fibratus/pkg/filter/ql/functions"
 	"github.com/rabbitstack/fibratus/pkg/util/multierror"
+	"math"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -37,6 +41,18 @@ type Parser struct {
 	s    *bufScanner
 	c    *config.Filters
 	expr string
+	// delimited indicates the expression is enclosed by
+	// pipes as in sequences and thresholds. The pipe is
+	// then interpreted as bitwise OR only inside parentheses.
+	delimited bool
+	// macros keeps the identifiers of expanded macros
+	macros map[string]bool
+	// lists is the registry resolving lookup list references
+	lists *lists.Registry
+	// predicates is the nesting depth of quantifier
+	// predicates. The $it reference is only allowed
+	// inside predicates
+	predicates int
 }
 
 // NewParser builds a new parser instance from the expression string.
@@ -49,12 +65,37 @@ func NewParserWithConfig(expr string, config *config.Filters) *Parser {
 	return &Parser{s: newBufScanner(strings.NewReader(expr)), expr: expr, c: config}
 }
 
+// SetLists sets the registry from which lookup lists are resolved.
+func (p *Parser) SetLists(r *lists.Registry) {
+	p.lists = r
+}
+
+// Macros returns the identifiers of all macros expanded
+// by the parser, including the macros referenced from
+// other macros.
+func (p *Parser) Macros() []string {
+	macros := make([]string, 0, len(p.macros))
+	for m := range p.macros {
+		macros = append(macros, m)
+	}
+	sort.Strings(macros)
+	return macros
+}
+
+func (p *Parser) addMacro(id string) {
+	if p.macros == nil {
+		p.macros = make(map[string]bool)
+	}
+	p.macros[id] = true
+}
+
 // ParseSequence parses the collection of binary expressions with possible join
 // statements and time frame constraints. This method assumes the SEQUENCE token
 // has already been consumed.
 func (p *Parser) ParseSequence() (*Sequence, error) {
 	seq := &Sequence{}
 	var exprs []SequenceExpr
+	p.delimited = true
 
 	// parse optional max span
 	tok, _, _ := p.scanIgnoreWhitespace()
@@ -94,6 +135,9 @@ func (p *Parser) ParseSequence() (*Sequence, error) {
 				return nil, fmt.Errorf("%s: maximum number of expressions reached", p.expr)
 			}
 			seq.Expressions = exprs
+			if err := seq.checkNegated(); err != nil {
+				return nil, fmt.Errorf("%s: %v", p.expr, err)
+			}
 			if seq.impairBy() {
 				return nil, fmt.Errorf("%s: all expressions require the 'by' statement", p.expr)
 			}
@@ -105,7 +149,14 @@ func (p *Parser) ParseSequence() (*Sequence, error) {
 		}
 		p.unscan()
 
+		// the expression prefixed with the bang
+		// token represents the absence of the event
+		var isNegated bool
 		tok, posStart, lit := p.scanIgnoreWhitespace()
+		if tok == Bang {
+			isNegated = true
+			tok, posStart, lit = p.scanIgnoreWhitespace()
+		}
 		if tok != Pipe {
 			return nil, newParseError(tokstr(tok, lit), []string{"|"}, posStart, p.expr)
 		}
@@ -137,6 +188,7 @@ func (p *Parser) ParseSequence() (*Sequence, error) {
 			seqexpr = SequenceExpr{Expr: expr}
 			p.unscan()
 		}
+		seqexpr.IsNegated = isNegated
 		seqexpr.init()
 		seqexpr.walk()
 		exprs = append(exprs, seqexpr)
@@ -153,6 +205,80 @@ func (p *Parser) IsSequence() bool {
 	return false
 }
 
+// ParseThreshold parses the threshold expression. Threshold counts the number of
+// events matching the expression within the time window, optionally grouped by
+// the field value. This method assumes the THRESHOLD token has already been consumed.
+func (p *Parser) ParseThreshold() (*Threshold, error) {
+	thresh := &Threshold{}
+	p.delimited = true
+
+	// parse the number of events
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok != Integer {
+		return nil, newParseError(tokstr(tok, lit), []string{"number"}, pos, p.expr)
+	}
+	n, err := strconv.ParseUint(lit, 10, 64)
+	if err != nil || n == 0 {
+		return nil, &ParseError{Message: "threshold count must be a positive number", Pos: pos}
+	}
+	thresh.Count = n
+
+	// parse the time window
+	tok, pos, lit = p.scanIgnoreWhitespace()
+	if tok != Within {
+		return nil, newParseError(tokstr(tok, lit), []string{"within"}, pos, p.expr)
+	}
+	_, pos, _ = p.scanIgnoreWhitespace()
+	p.unscan()
+	thresh.Window, err = p.parseDuration()
+	if err != nil {
+		return nil, err
+	}
+	if thresh.Window > time.Hour*4 {
+		return nil, &ParseError{Message: fmt.Sprintf("threshold window %v cannot be greater than 4h", thresh.Window), Pos: pos}
+	}
+
+	// parse optional group by field
+	tok, _, _ = p.scanIgnoreWhitespace()
+	if tok == By {
+		tok, pos, lit := p.scanIgnoreWhitespace()
+		if tok != Field {
+			return nil, newParseError(tokstr(tok, lit), []string{"field"}, pos, p.expr)
+		}
+		thresh.By = fields.Field(lit)
+	} else {
+		p.unscan()
+	}
+
+	tok, pos, lit = p.scanIgnoreWhitespace()
+	if tok != Pipe {
+		return nil, newParseError(tokstr(tok, lit), []string{"|"}, pos, p.expr)
+	}
+	thresh.Expr, err = p.ParseExpr()
+	if err != nil {
+		return nil, err
+	}
+	tok, pos, lit = p.scanIgnoreWhitespace()
+	if tok != Pipe {
+		return nil, newParseError(tokstr(tok, lit), []string{"|"}, pos, p.expr)
+	}
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != EOF {
+		return nil, newParseError(tokstr(tok, lit), []string{"EOF"}, pos, p.expr)
+	}
+
+	return thresh, nil
+}
+
+// IsThreshold checks whether the expression given to the parser is a threshold.
+func (p *Parser) IsThreshold() bool {
+	tok, _, _ := p.scanIgnoreWhitespace()
+	if tok == Thresh {
+		return true
+	}
+	p.unscan()
+	return false
+}
+
 // ParseExpr parses an expression by building the binary expression tree.
 func (p *Parser) ParseExpr() (Expr, error) {
 	var err error
@@ -168,6 +294,9 @@ func (p *Parser) ParseExpr() (Expr, error) {
 	for {
 		// if the next token is NOT an operator then return the expression.
 		op, pos, lit := p.scanIgnoreWhitespace()
+		if op == Pipe && !p.delimited {
+			op = BitOr
+		}
 		if !op.isOperator() {
 			p.unscan()
 			if op != EOF && op != Rparen && op != Comma && op != Pipe {
@@ -180,7 +309,7 @@ func (p *Parser) ParseExpr() (Expr, error) {
 			// expect LPAREN after in
 			tok, pos, lit := p.scanIgnoreWhitespace()
 			p.unscan()
-			if tok != Lparen && (p.c != nil && !p.c.IsMacroList(lit)) {
+			if tok != Lparen && !isLookupList(tok, lit) && (p.c != nil && !p.c.IsMacroList(lit)) {
 				return nil, newParseError(tokstr(op, lit), []string{"'('"}, pos, p.expr)
 			}
 		}
@@ -192,7 +321,7 @@ func (p *Parser) ParseExpr() (Expr, error) {
 			// The operator that is negated appears immediately
 			// after the `not` operator, e.g. ps.name not in ('cmd.exe')
 			op1, pos, lit := p.scanIgnoreWhitespace()
-			if !op1.isOperator() {
+			if !op1.isOperator() || op1.isArithmetic() {
 				return nil, newParseError(tokstr(op, lit), []string{"operator"}, pos, p.expr)
 			}
 			// parse the next expression after operator
@@ -200,6 +329,10 @@ func (p *Parser) ParseExpr() (Expr, error) {
 			if err != nil {
 				return nil, err
 			}
+			if err := checkLookupList(op1, rhs1, pos); err != nil {
+				return nil, err
+			}
+			compileList(op1, rhs1)
 			rhs = &BinaryExpr{RHS: rhs1, Op: op1}
 		default:
 			op1, _, _ := p.scanIgnoreWhitespace()
@@ -221,6 +354,10 @@ func (p *Parser) ParseExpr() (Expr, error) {
 				if err != nil {
 					return nil, err
 				}
+				if err := checkLookupList(op, rhs, pos); err != nil {
+					return nil, err
+				}
+				compileList(op, rhs)
 			}
 		}
 
@@ -254,8 +391,12 @@ func (p *Parser) parseUnaryExpr() (Expr, error) {
 		tagKeys, err := p.parseList()
 		if err != nil {
 			p.unscan()
-			// if it fails, try to parse the grouped expression
+			// if it fails, try to parse the grouped expression.
+			// The pipe is unambiguous inside parentheses
+			delimited := p.delimited
+			p.delimited = false
 			expr, err := p.ParseExpr()
+			p.delimited = delimited
 			if err != nil {
 				return nil, err
 			}
@@ -278,6 +419,8 @@ func (p *Parser) parseUnaryExpr() (Expr, error) {
 
 	tok, pos, lit := p.scanIgnoreWhitespace()
 	switch tok {
+	case Sub:
+		return p.parseNegation(pos)
 	case Ident:
 		if tok0, _, _ := p.scan(); tok0 == Lparen {
 			return p.parseFunction(lit)
@@ -289,12 +432,17 @@ func (p *Parser) parseUnaryExpr() (Expr, error) {
 		if p.c != nil {
 			macro := p.c.GetMacro(lit)
 			if macro != nil {
+				p.addMacro(lit)
 				if macro.Expr != "" {
-					p := NewParserWithConfig(macro.Expr, p.c)
-					expr, err := p.ParseExpr()
+					mp := NewParserWithConfig(macro.Expr, p.c)
+					mp.lists = p.lists
+					expr, err := mp.ParseExpr()
 					if err != nil {
 						return nil, multierror.WrapWithSeparator("\n", fmt.Errorf("syntax error in %q macro", lit), err)
 					}
+					for _, m := range mp.Macros() {
+						p.addMacro(m)
+					}
 					return expr, nil
 				}
 				return &ListLiteral{Values: macro.List}, nil
@@ -309,6 +457,15 @@ func (p *Parser) parseUnaryExpr() (Expr, error) {
 	case Field:
 		return &FieldLiteral{Value: lit}, nil
 	case BoundField:
+		if isLookupList(tok, lit) {
+			return p.parseLookupList()
+		}
+		if lit == iterator {
+			if p.predicates == 0 {
+				return nil, &ParseError{Message: "$it reference is only allowed in quantifier predicates", Pos: pos}
+			}
+			return &IteratorLiteral{}, nil
+		}
 		n := strings.Index(lit, ".")
 		if n > 0 && fields.Lookup(lit[n+1:]) == "" {
 			return nil, newParseError(tokstr(tok, lit), []string{"field after bound ref"}, pos+n, p.expr)
@@ -353,6 +510,23 @@ func (p *Parser) parseList() ([]string, error) {
 	}
 	idents := []string{lit}
 
+	// the value followed by the operator starts the grouped
+	// expression, e.g. (1 + 2) * 3. The operator and the
+	// whitespace are pushed back, so the caller can unscan
+	// the value and parse the grouped expression instead
+	n := 1
+	tok, pos, lit = p.scan()
+	if tok == WS {
+		tok, pos, lit = p.scan()
+		n++
+	}
+	for i := 0; i < n; i++ {
+		p.unscan()
+	}
+	if tok.isOperator() || tok == Pipe {
+		return []string{}, newParseError(tokstr(tok, lit), []string{"','"}, pos, p.expr)
+	}
+
 	// parse remaining identifiers
 	for {
 		if tok, _, _ := p.scanIgnoreWhitespace(); tok != Comma {
@@ -369,12 +543,83 @@ func (p *Parser) parseList() ([]string, error) {
 	}
 }
 
+// parseLookupList parses the lookup list reference, e.g. $list('bad_domains').
+// This function assumes the $list token has been consumed. The list must be
+// loaded into the parser's registry before the expression is parsed.
+func (p *Parser) parseLookupList() (*LookupListLiteral, error) {
+	if tok, pos, lit := p.scan(); tok != Lparen {
+		return nil, newParseError(tokstr(tok, lit), []string{"'('"}, pos, p.expr)
+	}
+	tok, pos, name := p.scanIgnoreWhitespace()
+	if tok != Str {
+		return nil, newParseError(tokstr(tok, name), []string{"list name"}, pos, p.expr)
+	}
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != Rparen {
+		return nil, newParseError(tokstr(tok, lit), []string{"')'"}, pos, p.expr)
+	}
+	var list *lists.List
+	if p.lists != nil {
+		list = p.lists.Get(name)
+	}
+	if list == nil {
+		return nil, &ParseError{Message: fmt.Sprintf("%q lookup list is not defined", name), Pos: pos}
+	}
+	return &LookupListLiteral{Name: name, List: list}, nil
+}
+
+// isLookupList determines if the token starts the lookup list reference.
+func isLookupList(tok token, lit string) bool {
+	return tok == BoundField && lit == "$list"
+}
+
+// checkLookupList ensures the lookup list is only
+// used as the operand of the membership operators.
+func checkLookupList(op token, expr Expr, pos int) error {
+	if _, ok := expr.(*LookupListLiteral); !ok || op == In || op == IIn {
+		return nil
+	}
+	return &ParseError{Message: "lookup lists are only allowed in the 'in' and 'iin' operators", Pos: pos}
+}
+
+// compileList precompiles the list literal on the right-hand
+// side of the string operator into the multi-pattern matcher.
+func compileList(op token, expr Expr) {
+	if list, ok := expr.(*ListLiteral); ok {
+		list.matcher = newListMatcher(op, list.Values)
+	}
+}
+
+// parseNegation parses the unary minus operator. Number literals are
+// negated in place, while other operands are subtracted from zero.
+func (p *Parser) parseNegation(pos int) (Expr, error) {
+	expr, err := p.parseUnaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	switch e := expr.(type) {
+	case *IntegerLiteral:
+		return &IntegerLiteral{Value: -e.Value}, nil
+	case *UnsignedLiteral:
+		if e.Value == 1<<63 {
+			return &IntegerLiteral{Value: math.MinInt64}, nil
+		}
+		return nil, &ParseError{Message: "integer out of range", Pos: pos}
+	case *DecimalLiteral:
+		return &DecimalLiteral{Value: -e.Value}, nil
+	}
+	return &BinaryExpr{Op: Sub, LHS: &IntegerLiteral{Value: 0}, RHS: expr}, nil
+}
+
 // parseFunction parses a function call. This function assumes
 // the function name and LPAREN have been consumed.
 func (p *Parser) parseFunction(name string) (*Function, error) {
 	name = strings.ToLower(name)
 	args := make([]Expr, 0)
 
+	delimited := p.delimited
+	p.delimited = false
+	defer func() { p.delimited = delimited }()
+
 	// If there's a right paren then just return immediately.
 	// This is the case for functions without arguments
 	if tok, _, _ := p.scan(); tok == Rparen {
@@ -386,7 +631,7 @@ func (p *Parser) parseFunction(name string) (*Function, error) {
 	}
 	p.unscan()
 
-	arg, err := p.ParseExpr()
+	arg, err := p.parseFunctionArg(name, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -401,7 +646,7 @@ func (p *Parser) parseFunction(name string) (*Function, error) {
 		}
 
 		// Parse an expression argument.
-		arg, err := p.ParseExpr()
+		arg, err := p.parseFunctionArg(name, len(args))
 		if err != nil {
 			return nil, err
 		}
@@ -422,6 +667,20 @@ func (p *Parser) parseFunction(name string) (*Function, error) {
 	return fn, nil
 }
 
+// parseFunctionArg parses the function argument at the given index. If
+// the argument is the predicate of the quantifier function, the $it
+// reference to the slice element is allowed in the argument expression.
+func (p *Parser) parseFunctionArg(name string, i int) (Expr, error) {
+	if fn, ok := funcs[strings.ToUpper(name)]; ok {
+		args := fn.Desc().Args
+		if i < len(args) && args[i].ContainsType(functions.Predicate) {
+			p.predicates++
+			defer func() { p.predicates-- }()
+		}
+	}
+	return p.ParseExpr()
+}
+
 // parseDuration parses a string and returns a duration literal.
 func (p *Parser) parseDuration() (time.Duration, error) {
 	tok, pos, lit := p.scanIgnoreWhitespace()
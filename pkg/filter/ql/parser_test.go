@@ -21,6 +21,7 @@ package ql
 import (
 	"errors"
 	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
 	"time"
@@ -65,6 +66,18 @@ func TestParser(t *testing.T) {
 		{expr: "ip_cidr(net.dip) = '24'", err: errors.New("ip_cidr function is undefined. Did you mean one of CIDR_CONTAINS|MD5?")},
 
 		{expr: "ps.name = 'cmd.exe' and not cidr_contains(net.sip, '172.14.0.0')"},
+
+		{expr: "file.io.size * 2 > mem.size"},
+		{expr: "kevt.pid != ps.parent.pid + 0"},
+		{expr: "thread.entrypoint - image.base.address < image.size"},
+		{expr: "ps.access.mask & 0x10 != 0"},
+		{expr: "(mem.size + 4096) / 2 % 3 = 1"},
+		{expr: "mem.size | 0x1000 ^ 0x2000 > 0"},
+		{expr: "length(ps.name) * 2 > 10"},
+		{expr: "mem.size * > 10", err: errors.New("mem.size * > 10\n" +
+			"           ^ expected field, bound field, string, number, bool, ip, function")},
+		{expr: "mem.size not + 10", err: errors.New("mem.size not + 10\n" +
+			"             ^ expected operator")},
 	}
 
 	for i, tt := range tests {
@@ -164,6 +177,19 @@ func TestExpandMacros(t *testing.T) {
 	}
 }
 
+func TestParserMacros(t *testing.T) {
+	c := config.FiltersWithMacros(map[string]*config.Macro{
+		"rename":    {Expr: "kevt.name = 'RenameFile'"},
+		"remove":    {Expr: "kevt.name = 'DeleteFile'"},
+		"modify":    {Expr: "rename or remove"},
+		"create":    {Expr: "kevt.name = 'CreateFile'"},
+		"wcm_files": {List: []string{"?:\\Users\\*\\AppData\\*\\Microsoft\\Credentials\\*"}}})
+	p := NewParserWithConfig("modify and file.name imatches wcm_files", c)
+	_, err := p.ParseExpr()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"modify", "remove", "rename", "wcm_files"}, p.Macros())
+}
+
 func TestParseSequence(t *testing.T) {
 	var tests = []struct {
 		expr          string
@@ -301,6 +327,50 @@ func TestParseSequence(t *testing.T) {
 			time.Minute * 2,
 			true,
 		},
+		{
+
+			`maxspan 30s
+			 by ps.uuid
+			 |kevt.name = 'CreateProcess'|
+			 !|kevt.name = 'LoadImage' and image.signature.level > 0|
+			`,
+			nil,
+			time.Second * 30,
+			true,
+		},
+		{
+
+			`by ps.uuid
+			 |kevt.name = 'CreateProcess'|
+			 !|kevt.name = 'LoadImage'|
+			`,
+			errors.New("negated sequence expressions require the 'maxspan' statement"),
+			time.Duration(0),
+			true,
+		},
+		{
+
+			`maxspan 30s
+			 by ps.uuid
+			 !|kevt.name = 'CreateProcess'|
+			 |kevt.name = 'LoadImage'|
+			`,
+			errors.New("the first sequence expression can't be negated"),
+			time.Second * 30,
+			true,
+		},
+		{
+
+			`maxspan 30s
+			 by ps.uuid
+			 |kevt.name = 'CreateProcess'|
+			 !|kevt.name = 'LoadImage'|
+			 |kevt.name = 'CreateFile'|
+			`,
+			errors.New("only the last sequence expression can be negated"),
+			time.Second * 30,
+			true,
+		},
 	}
 
 	for i, tt := range tests {
@@ -323,6 +393,96 @@ func TestParseSequence(t *testing.T) {
 	}
 }
 
+func TestParseThreshold(t *testing.T) {
+	var tests = []struct {
+		expr   string
+		err    error
+		count  uint64
+		window time.Duration
+		by     string
+	}{
+		{
+			`50 within 10s by ps.uuid |kevt.name = 'OpenProcess' and ps.name = 'lsass.exe'|`,
+			nil,
+			50,
+			time.Second * 10,
+			"ps.uuid",
+		},
+		{
+			`10 within 1m |kevt.name = 'RenameFile'|`,
+			nil,
+			10,
+			time.Minute,
+			"",
+		},
+		{
+			`10 |kevt.name = 'RenameFile'|`,
+			errors.New("expected within"),
+			0,
+			0,
+			"",
+		},
+		{
+			`0 within 1m |kevt.name = 'RenameFile'|`,
+			errors.New("threshold count must be a positive number"),
+			0,
+			0,
+			"",
+		},
+		{
+			`10 within 5h |kevt.name = 'RenameFile'|`,
+			errors.New("threshold window 5h0m0s cannot be greater than 4h at char 11"),
+			0,
+			0,
+			"",
+		},
+		{
+			`10 within 1m |kevt.name = 'OpenProcess' and (ps.access.mask | 0x10) & 0x1410 = 0x1410|`,
+			nil,
+			10,
+			time.Minute,
+			"",
+		},
+		{
+			`10 within 1m |kevt.name = 'OpenProcess' and ps.access.mask | 0x10 = 0x1410|`,
+			errors.New("expected EOF"),
+			0,
+			0,
+			"",
+		},
+		{
+			`10 within 1m by ps.uuid kevt.name = 'RenameFile'|`,
+			errors.New("expected |"),
+			0,
+			0,
+			"",
+		},
+		{
+			`10 within 1m by ps.uuid |kevt.name = 'RenameFile'| |kevt.name = 'CreateFile'|`,
+			errors.New("expected EOF"),
+			0,
+			0,
+			"",
+		},
+	}
+
+	for i, tt := range tests {
+		p := NewParser(tt.expr)
+		thresh, err := p.ParseThreshold()
+		if err == nil && tt.err != nil {
+			t.Errorf("%d. exp=%s expected error=\n%v", i, tt.expr, tt.err)
+		} else if err != nil && tt.err == nil {
+			t.Errorf("%d. exp=%s got error=\n%v", i, tt.expr, err)
+		}
+
+		if thresh != nil {
+			require.Equal(t, tt.count, thresh.Count)
+			require.Equal(t, tt.window, thresh.Window)
+			require.Equal(t, tt.by, thresh.By.String())
+		}
+	}
+}
+
 func TestIsSequenceUnordered(t *testing.T) {
 	var tests = []struct {
 		expr        string
@@ -70,6 +70,14 @@ const (
 	Lte         // <=
 	Gt          // >
 	Gte         // >=
+	Add         // +
+	Sub         // -
+	Mul         // *
+	Div         // /
+	Mod         // %
+	BitAnd      // &
+	BitOr       // |
+	BitXor      // ^
 	opEnd
 
 	Lparen // (
@@ -77,11 +85,15 @@ const (
 	Comma  // ,
 	Dot    // .
 	Pipe   // |
+	Bang   // !
 
 	Seq     // SEQUENCE
 	MaxSpan // MAXSPAN
 	By      // BY
 	As      // AS
+
+	Thresh // THRESHOLD
+	Within // WITHIN
 )
 
 var keywords map[string]token
@@ -91,7 +103,7 @@ func init() {
 	for _, tok := range []token{And, Or, Contains, IContains, In,
 		IIn, Not, Startswith, IStartswith, Endswith, IEndswith,
 		Matches, IMatches, Fuzzy, IFuzzy, Fuzzynorm, IFuzzynorm,
-		Seq, MaxSpan, By, As} {
+		Seq, MaxSpan, By, As, Thresh, Within} {
 		keywords[strings.ToLower(tokens[tok])] = tok
 	}
 	keywords["true"] = True
@@ -143,21 +155,47 @@ var tokens = [...]string{
 	Gt:  ">",
 	Gte: ">=",
 
+	Add:    "+",
+	Sub:    "-",
+	Mul:    "*",
+	Div:    "/",
+	Mod:    "%",
+	BitAnd: "&",
+	BitOr:  "|",
+	BitXor: "^",
+
 	Lparen: "(",
 	Rparen: ")",
 	Comma:  ",",
 	Dot:    ".",
 	Pipe:   "|",
+	Bang:   "!",
 
 	Seq:     "SEQUENCE",
 	MaxSpan: "MAXSPAN",
 	By:      "BY",
 	As:      "AS",
+
+	Thresh: "THRESHOLD",
+	Within: "WITHIN",
 }
 
 // isOperator determines whether the current token is an operator.
 func (tok token) isOperator() bool { return tok > opBeg && tok < opEnd }
 
+// isArithmetic determines whether the current token is an arithmetic or bitwise operator.
+func (tok token) isArithmetic() bool { return tok >= Add && tok <= BitXor }
+
+// isComparison determines whether the current token is an equality or relational operator
+// whose operands are widened to numbers if the other operand is the arithmetic expression.
+func (tok token) isComparison() bool {
+	switch tok {
+	case Eq, Neq, Lt, Lte, Gt, Gte:
+		return true
+	}
+	return false
+}
+
 // String returns the string representation of the token.
 func (tok token) String() string {
 	if tok >= 0 && tok < token(len(tokens)) {
@@ -180,6 +218,16 @@ func (tok token) precedence() int {
 	case In, IIn, Contains, IContains, Startswith, IStartswith, Endswith, IEndswith,
 		Matches, IMatches, Fuzzy, IFuzzy, Fuzzynorm, IFuzzynorm:
 		return 5
+	case BitOr:
+		return 6
+	case BitXor:
+		return 7
+	case BitAnd:
+		return 8
+	case Add, Sub:
+		return 9
+	case Mul, Div, Mod:
+		return 10
 	}
 	return 0
 }
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Trace is the node of the evaluation tree. Each node represents
+// the binary expression, negation, or function call evaluated
+// against the event. Operands skipped by the lazy evaluation of
+// and/or operators don't appear in the trace.
+type Trace struct {
+	// Expr is the string representation of the evaluated expression
+	Expr string `json:"expr"`
+	// Value is the outcome of the expression. Conditions yield the
+	// boolean value, while nil value means the expression couldn't
+	// be evaluated, for example, if the field is absent in the event
+	Value interface{} `json:"value"`
+	// Fields contains the field values resolved from the event
+	Fields map[string]interface{} `json:"fields,omitempty"`
+	// Children contains the traces of subexpressions
+	Children []*Trace `json:"children,omitempty"`
+}
+
+// Matched returns true if the expression yielded the true value.
+func (t *Trace) Matched() bool {
+	if t == nil {
+		return false
+	}
+	v, ok := t.Value.(bool)
+	return ok && v
+}
+
+// String renders the trace as the indented tree.
+func (t *Trace) String() string {
+	var b strings.Builder
+	t.write(&b, 0)
+	return b.String()
+}
+
+func (t *Trace) write(b *strings.Builder, depth int) {
+	b.WriteString(strings.Repeat("  ", depth))
+	b.WriteString(fmt.Sprintf("%s => %v", t.Expr, t.Value))
+	if len(t.Fields) > 0 {
+		names := make([]string, 0, len(t.Fields))
+		for name := range t.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		vals := make([]string, 0, len(names))
+		for _, name := range names {
+			vals = append(vals, fmt.Sprintf("%s=%v", name, t.Fields[name]))
+		}
+		b.WriteString(" [" + strings.Join(vals, ", ") + "]")
+	}
+	b.WriteString("\n")
+	for _, c := range t.Children {
+		c.write(b, depth+1)
+	}
+}
+
+// tracer builds the evaluation tree as the expression
+// is evaluated. The stack holds the nodes of expressions
+// whose evaluation is in progress.
+type tracer struct {
+	stack []*Trace
+}
+
+// trace records the outcome of the expression evaluated by fn.
+func (t *tracer) trace(expr Expr, fn func() interface{}) (*Trace, interface{}) {
+	node := &Trace{Expr: traceString(expr)}
+	if n := len(t.stack); n > 0 {
+		t.stack[n-1].Children = append(t.stack[n-1].Children, node)
+	}
+	t.stack = append(t.stack, node)
+	node.Value = fn()
+	t.stack = t.stack[:len(t.stack)-1]
+	return node, node.Value
+}
+
+// field records the field value in the expression being evaluated.
+func (t *tracer) field(name string, v interface{}) {
+	n := len(t.stack)
+	if n == 0 {
+		return
+	}
+	node := t.stack[n-1]
+	if node.Fields == nil {
+		node.Fields = make(map[string]interface{})
+	}
+	node.Fields[name] = v
+}
+
+func traceString(expr Expr) string {
+	if e, ok := expr.(*NotExpr); ok {
+		return "NOT " + e.Expr.String()
+	}
+	return expr.String()
+}
+
+// Explain evaluates expr against a map that contains the field values
+// and returns the evaluation trace. The outcome is identical to the Eval
+// function outcome.
+func Explain(expr Expr, m map[string]interface{}, useFuncValuer bool) *Trace {
+	eval := ValuerEval{Valuer: MapValuer(m), tracer: &tracer{}}
+	if useFuncValuer {
+		eval.Valuer = MultiValuer(MapValuer(m), FunctionValuer{m})
+	}
+	for {
+		p, ok := expr.(*ParenExpr)
+		if !ok {
+			break
+		}
+		expr = p.Expr
+	}
+	root, _ := eval.tracer.trace(expr, func() interface{} { return eval.eval(expr) })
+	return root
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	m := map[string]interface{}{
+		"ps.name":   "cmd.exe",
+		"ps.pid":    uint32(4),
+		"file.name": `C:\Windows\System32\kernel32.dll`,
+	}
+
+	expr, err := NewParser(`ps.name = 'cmd.exe' and (file.name iendswith '.exe' or ps.pid > 100)`).ParseExpr()
+	require.NoError(t, err)
+	trace := Explain(expr, m, false)
+	require.NotNil(t, trace)
+	assert.False(t, trace.Matched())
+	assert.Equal(t, false, trace.Value)
+	require.Len(t, trace.Children, 2)
+
+	eq := trace.Children[0]
+	assert.Equal(t, "ps.name = cmd.exe", eq.Expr)
+	assert.True(t, eq.Matched())
+	assert.Equal(t, map[string]interface{}{"ps.name": "cmd.exe"}, eq.Fields)
+
+	or := trace.Children[1]
+	assert.False(t, or.Matched())
+	require.Len(t, or.Children, 2)
+	assert.Equal(t, map[string]interface{}{"file.name": `C:\Windows\System32\kernel32.dll`}, or.Children[0].Fields)
+	assert.Equal(t, map[string]interface{}{"ps.pid": uint32(4)}, or.Children[1].Fields)
+
+	// the outcome is identical to the outcome of the evaluator
+	assert.Equal(t, Eval(expr, m, false), trace.Matched())
+}
+
+func TestExplainLazyEvaluation(t *testing.T) {
+	m := map[string]interface{}{
+		"ps.name": "cmd.exe",
+	}
+
+	expr, err := NewParser(`ps.name = 'svchost.exe' and ps.pid = 4`).ParseExpr()
+	require.NoError(t, err)
+	trace := Explain(expr, m, false)
+	assert.False(t, trace.Matched())
+	// the right operand is never evaluated
+	require.Len(t, trace.Children, 1)
+	assert.Equal(t, "ps.name = svchost.exe", trace.Children[0].Expr)
+}
+
+func TestExplainNegationAndFunctions(t *testing.T) {
+	m := map[string]interface{}{
+		"ps.name": "cmd.exe",
+	}
+
+	expr, err := NewParser(`ps.name not in ('powershell.exe', 'wscript.exe') and length(ps.name) = 7 and ps.pid = 4`).ParseExpr()
+	require.NoError(t, err)
+	trace := Explain(expr, m, true)
+	assert.Equal(t, Eval(expr, m, true), trace.Matched())
+	assert.Contains(t, trace.String(), "NOT ps.name IN (powershell.exe, wscript.exe) => true [ps.name=cmd.exe]")
+	assert.Contains(t, trace.String(), "length(ps.name) => 7 [ps.name=cmd.exe]")
+	// absent fields yield no value
+	assert.Contains(t, trace.String(), "ps.pid = 4 => false [ps.pid=<nil>]")
+}
@@ -0,0 +1,226 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/rabbitstack/fibratus/pkg/util/fswatch"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// reloadDebounce specifies the quiet period after the last file
+// system change that must elapse before the rules are reloaded
+var reloadDebounce = time.Second * 2
+
+var (
+	rulesReloads         = expvar.NewInt("filter.rules.reloads")
+	rulesReloadFailures  = expvar.NewInt("filter.rules.reload.failures")
+	rulesReloadLastError = expvar.NewString("filter.rules.reload.last.error")
+)
+
+// Reload compiles the ruleset in the background and swaps
+// it with the active ruleset. If any of the rules fails to
+// compile, the active ruleset is kept, and the error is
+// reported through logs and metrics.
+func (r *Rules) Reload() error {
+	res, err := r.Compile()
+	if err != nil {
+		rulesReloadFailures.Add(1)
+		rulesReloadLastError.Set(err.Error())
+		log.Errorf("unable to reload rules. Keeping the active ruleset: %v", err)
+		return err
+	}
+	rulesReloads.Add(1)
+	rulesReloadLastError.Set("")
+	if res != nil {
+		log.Infof("rules reloaded. Compile summary: %s", res)
+	}
+	return nil
+}
+
+// Reloader reloads rules, macros, and exceptions when rule, macro,
+// or exception files are modified. Rule URL resources and rule bundles
+// are periodically polled and rules reloaded if the content of any
+// resource changes.
+type Reloader struct {
+	rules   *Rules
+	config  *config.Config
+	watcher *fswatch.Watcher
+	ticker  *time.Ticker
+	// digest is the checksum of all URL resources
+	digest string
+	quit   chan struct{}
+}
+
+// NewReloader creates a new rules reloader. It starts watching
+// the directories of all the rule and macro paths.
+func NewReloader(rules *Rules, config *config.Config) (*Reloader, error) {
+	r := &Reloader{
+		rules:  rules,
+		config: config,
+		quit:   make(chan struct{}),
+	}
+	watcher, err := fswatch.New("rule", reloadDebounce, r.isWatched)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range r.dirs() {
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return nil, err
+		}
+	}
+	r.watcher = watcher
+	if len(r.urls()) > 0 {
+		interval := config.Filters.Rules.ReloadInterval
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		r.digest = r.urlsDigest()
+		r.ticker = time.NewTicker(interval)
+	}
+	return r, nil
+}
+
+// Run starts the reloader loop in a separate goroutine.
+func (r *Reloader) Run() {
+	r.watcher.Run()
+	go r.run()
+}
+
+// Close stops watching the rule resources.
+func (r *Reloader) Close() error {
+	close(r.quit)
+	if r.ticker != nil {
+		r.ticker.Stop()
+	}
+	return r.watcher.Close()
+}
+
+func (r *Reloader) run() {
+	var tick <-chan time.Time
+	if r.ticker != nil {
+		tick = r.ticker.C
+	}
+
+	for {
+		select {
+		case <-r.watcher.C():
+			_ = r.rules.Reload()
+		case <-tick:
+			digest := r.urlsDigest()
+			if digest == "" || digest == r.digest {
+				continue
+			}
+			log.Infof("rule URL resources changed")
+			if r.rules.Reload() == nil {
+				r.digest = digest
+			}
+		case <-r.quit:
+			return
+		}
+	}
+}
+
+// dirs returns all distinct directories containing
+// rule, macro, or exception files. Directory paths can contain
+// glob patterns.
+func (r *Reloader) dirs() []string {
+	dirs := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, p := range r.patterns() {
+		matches, err := filepath.Glob(filepath.Dir(p))
+		if err != nil {
+			continue
+		}
+		for _, dir := range matches {
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+func (r *Reloader) patterns() []string {
+	patterns := make([]string, 0)
+	patterns = append(patterns, r.config.Filters.Rules.FromPaths...)
+	patterns = append(patterns, r.config.Filters.Macros.FromPaths...)
+	return append(patterns, r.config.Filters.Exceptions.FromPaths...)
+}
+
+// isWatched determines if the file matches any
+// of the rule, macro, or exception path patterns.
+func (r *Reloader) isWatched(path string) bool {
+	ext := filepath.Ext(path)
+	if ext != ".yml" && ext != ".yaml" {
+		return false
+	}
+	for _, p := range r.patterns() {
+		if ok, _ := filepath.Match(p, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// urls returns all polled rule URL resources
+// including rule bundles and their signatures.
+func (r *Reloader) urls() []string {
+	urls := append([]string{}, r.config.Filters.Rules.FromURLs...)
+	for _, b := range r.config.Filters.Rules.Bundles {
+		urls = append(urls, b.URL, b.GetSignatureURL())
+	}
+	return urls
+}
+
+// urlsDigest computes the checksum over the content
+// of all rule URL resources. Returns an empty string
+// if any of the resources couldn't be fetched.
+func (r *Reloader) urlsDigest() string {
+	h := sha256.New()
+	for _, url := range r.urls() {
+		//nolint:noctx
+		resp, err := http.Get(url)
+		if err != nil {
+			log.Warnf("cannot fetch rule file from %q: %v", url, err)
+			return ""
+		}
+		if resp.StatusCode != http.StatusOK {
+			_ = resp.Body.Close()
+			log.Warnf("got non-ok status code for %q: %s", url, http.StatusText(resp.StatusCode))
+			return ""
+		}
+		_, err = io.Copy(h, resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return ""
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
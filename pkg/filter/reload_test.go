@@ -0,0 +1,141 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"fmt"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"github.com/rabbitstack/fibratus/pkg/kevent/kparams"
+	"github.com/rabbitstack/fibratus/pkg/kevent/ktypes"
+	"github.com/rabbitstack/fibratus/pkg/ps"
+	"github.com/rabbitstack/fibratus/pkg/ps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sequenceRule = `
+name: Command shell created a temp file
+id: 972902be-76e9-4ee7-a48a-6275fa571cf4
+version: %s
+condition: >
+  sequence
+  maxspan 1h
+  |kevt.name = 'CreateProcess' and ps.name = 'cmd.exe'| by ps.exe
+  |kevt.name = 'CreateFile' and file.name icontains 'temp'| by file.name
+min-engine-version: 2.0.0
+`
+
+const simpleRule = `
+name: Suspicious network activity
+id: 3f3c2f2e-4a5b-4d1a-8f3e-1c2d3e4f5a6b
+version: 1.0.0
+condition: %s
+min-engine-version: 2.0.0
+`
+
+func writeRule(t *testing.T, path, tmpl, arg string) {
+	require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(tmpl, arg)), os.ModePerm))
+}
+
+func TestReloadRules(t *testing.T) {
+	dir := t.TempDir()
+	writeRule(t, filepath.Join(dir, "sequence.yml"), sequenceRule, "1.0.0")
+	writeRule(t, filepath.Join(dir, "simple.yml"), simpleRule, "kevt.name = 'Recv' and net.dport = 443")
+
+	psnap := new(ps.SnapshotterMock)
+	rules := NewRules(psnap, newConfig(filepath.Join(dir, "*.yml")))
+	compileRules(t, rules)
+
+	require.Len(t, rules.sequences, 1)
+	ss := rules.sequences[0]
+
+	e := &kevent.Kevent{
+		Type:      ktypes.CreateProcess,
+		Timestamp: time.Now(),
+		Name:      "CreateProcess",
+		Tid:       2484,
+		PID:       859,
+		PS: &types.PS{
+			Name: "cmd.exe",
+			Exe:  "C:\\Windows\\system32\\cmd.exe",
+		},
+		Kparams: kevent.Kparams{
+			kparams.ProcessID: {Name: kparams.ProcessID, Type: kparams.Uint32, Value: uint32(4143)},
+		},
+		Metadata: make(map[kevent.MetadataKey]any),
+	}
+	require.False(t, wrapProcessEvent(e, rules.ProcessEvent))
+	require.Len(t, ss.partials[1], 1)
+
+	// the sequence rule is unchanged, so
+	// the partials survive the reload
+	writeRule(t, filepath.Join(dir, "simple.yml"), simpleRule, "kevt.name = 'Recv' and net.dport = 80")
+	require.NoError(t, rules.Reload())
+	require.Len(t, rules.sequences, 1)
+	assert.Same(t, ss, rules.sequences[0])
+	assert.Len(t, rules.sequences[0].partials[1], 1)
+	assert.Len(t, rules.findFilters(&kevent.Kevent{Type: ktypes.RecvTCPv4}), 1)
+
+	// the new version of the sequence rule
+	// starts with the fresh state
+	writeRule(t, filepath.Join(dir, "sequence.yml"), sequenceRule, "1.0.1")
+	require.NoError(t, rules.Reload())
+	require.Len(t, rules.sequences, 1)
+	assert.NotSame(t, ss, rules.sequences[0])
+	assert.Len(t, rules.sequences[0].partials[1], 0)
+	assert.Len(t, ss.partials[1], 0)
+
+	// the compile failure keeps the active ruleset
+	ss = rules.sequences[0]
+	failures := rulesReloadFailures.Value()
+	writeRule(t, filepath.Join(dir, "simple.yml"), simpleRule, "kevt.name = 'Recv' and net.dport =")
+	require.Error(t, rules.Reload())
+	assert.Equal(t, failures+1, rulesReloadFailures.Value())
+	assert.NotEmpty(t, rulesReloadLastError.Value())
+	require.Len(t, rules.sequences, 1)
+	assert.Same(t, ss, rules.sequences[0])
+	assert.Len(t, rules.findFilters(&kevent.Kevent{Type: ktypes.RecvTCPv4}), 1)
+	// the active config retains the rules of the active ruleset
+	conditions := make([]string, 0)
+	for _, f := range rules.config.GetFilters() {
+		conditions = append(conditions, f.Condition)
+	}
+	assert.Contains(t, strings.Join(conditions, "\n"), "net.dport = 80")
+}
+
+func TestReloaderIsWatched(t *testing.T) {
+	dir := t.TempDir()
+	c := newConfig(filepath.Join(dir, "*.yml"))
+	c.Filters.Macros.FromPaths = []string{filepath.Join(dir, "Macros", "*")}
+
+	r, err := NewReloader(NewRules(new(ps.SnapshotterMock), c), c)
+	require.NoError(t, err)
+	defer r.Close()
+
+	assert.Equal(t, []string{dir}, r.dirs())
+	assert.True(t, r.isWatched(filepath.Join(dir, "rule.yml")))
+	assert.False(t, r.isWatched(filepath.Join(dir, "rule.yaml")))
+	assert.False(t, r.isWatched(filepath.Join(dir, "rule.txt")))
+	assert.True(t, r.isWatched(filepath.Join(dir, "Macros", "macros.yaml")))
+}
@@ -0,0 +1,280 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"expvar"
+	"fmt"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/rabbitstack/fibratus/pkg/filter/action"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	pstypes "github.com/rabbitstack/fibratus/pkg/ps/types"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRiskEntities determines the maximum number of processes tracked by the risk engine
+	maxRiskEntities = 10000
+	// maxRiskHalfLives determines after how many half-lives the contribution is discarded
+	maxRiskHalfLives = 10
+)
+
+var (
+	riskEntities = expvar.NewInt("filter.risk.entities")
+	riskBreaches = expvar.NewInt("filter.risk.entity.breaches")
+	riskAlerts   = expvar.NewInt("filter.risk.alerts")
+)
+
+// riskContribution is the risk score contributed by the rule match.
+type riskContribution struct {
+	rule   *config.FilterConfig
+	events []*kevent.Kevent
+	// timestamp is the timestamp of the event that triggered the rule
+	timestamp time.Time
+}
+
+// riskEntity is the process accumulating the risk scores of
+// rule matches in the process itself and its descendants.
+type riskEntity struct {
+	ps            *pstypes.PS
+	contributions []*riskContribution
+}
+
+// riskAlert describes the process whose accumulated
+// risk score reached the threshold.
+type riskAlert struct {
+	ps            *pstypes.PS
+	score         float64
+	contributions []*riskContribution
+}
+
+// riskEngine accumulates the scores of rules with the risk
+// attribute. The rule match contributes its score to the
+// process that generated the event and all its ancestors.
+// Scores decay exponentially, so several low-risk rules
+// matching in the same process tree in a short time frame
+// reach the threshold, while sporadic matches never do.
+type riskEngine struct {
+	config config.Risk
+
+	entities map[uint64]*riskEntity
+	// latest is the timestamp of the most recent rule match.
+	// Contributions expire relative to this timestamp rather
+	// than the wall clock, so replayed events decay as they
+	// did when they were originally captured
+	latest time.Time
+	// mu guards the entities map and the latest timestamp
+	mu sync.Mutex
+}
+
+func newRiskEngine(c config.Risk) *riskEngine {
+	return &riskEngine{config: c, entities: make(map[uint64]*riskEntity)}
+}
+
+// score returns the decayed score of the contribution at the given time.
+func (r *riskEngine) score(c *riskContribution, t time.Time) float64 {
+	elapsed := t.Sub(c.timestamp)
+	if r.config.HalfLife <= 0 || elapsed <= 0 {
+		return float64(c.rule.Risk)
+	}
+	return float64(c.rule.Risk) * math.Pow(0.5, float64(elapsed)/float64(r.config.HalfLife))
+}
+
+// isExpired determines if the contribution no longer affects the score.
+func (r *riskEngine) isExpired(c *riskContribution, t time.Time) bool {
+	return r.config.HalfLife > 0 && t.Sub(c.timestamp) > r.config.HalfLife*maxRiskHalfLives
+}
+
+// add records the rule match in the process tree of matched events and
+// returns the processes whose accumulated risk reached the threshold.
+// Contributions reported in the alert are removed from all processes,
+// so the same rule matches don't trigger alerts for the ancestors.
+func (r *riskEngine) add(f *config.FilterConfig, evts []*kevent.Kevent) []*riskAlert {
+	if len(evts) == 0 {
+		return nil
+	}
+	c := &riskContribution{rule: f, events: evts}
+	for _, e := range evts {
+		if e.Timestamp.After(c.timestamp) {
+			c.timestamp = e.Timestamp
+		}
+	}
+
+	// collect the processes of all matched events along with
+	// their ancestors. The process of the event that triggered
+	// the rule is visited first, followed by its ancestors
+	procs := make([]*pstypes.PS, 0)
+	seen := make(map[uint64]bool)
+	visit := func(ps *pstypes.PS) {
+		if uuid := ps.UUID(); !seen[uuid] {
+			seen[uuid] = true
+			procs = append(procs, ps)
+		}
+	}
+	for i := len(evts) - 1; i >= 0; i-- {
+		if evts[i].PS == nil {
+			continue
+		}
+		visit(evts[i].PS)
+		pstypes.Walk(visit, evts[i].PS)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c.timestamp.After(r.latest) {
+		r.latest = c.timestamp
+	}
+
+	for _, ps := range procs {
+		uuid := ps.UUID()
+		entity, ok := r.entities[uuid]
+		if !ok {
+			if len(r.entities) >= maxRiskEntities {
+				riskBreaches.Add(1)
+				log.Warnf("max risk entities reached. Dropping risk score of %s rule", f.Name)
+				continue
+			}
+			entity = &riskEntity{ps: ps}
+			r.entities[uuid] = entity
+			riskEntities.Add(1)
+		}
+		entity.contributions = append(entity.contributions, c)
+	}
+
+	var alerts []*riskAlert
+	for _, ps := range procs {
+		entity, ok := r.entities[ps.UUID()]
+		if !ok {
+			continue
+		}
+		var score float64
+		for _, contrib := range entity.contributions {
+			score += r.score(contrib, c.timestamp)
+		}
+		if score < r.config.Threshold {
+			continue
+		}
+		alert := &riskAlert{ps: entity.ps, score: score, contributions: entity.contributions}
+		alerts = append(alerts, alert)
+		r.remove(alert.contributions)
+	}
+	return alerts
+}
+
+// remove discards the contributions from all processes.
+func (r *riskEngine) remove(contributions []*riskContribution) {
+	m := make(map[*riskContribution]bool, len(contributions))
+	for _, c := range contributions {
+		m[c] = true
+	}
+	for uuid, entity := range r.entities {
+		n := 0
+		for _, c := range entity.contributions {
+			if !m[c] {
+				entity.contributions[n] = c
+				n++
+			}
+		}
+		entity.contributions = entity.contributions[:n]
+		if n == 0 {
+			delete(r.entities, uuid)
+			riskEntities.Add(-1)
+		}
+	}
+}
+
+// gc discards contributions that decayed to negligible scores
+// relative to the latest rule match and removes processes
+// without contributions.
+func (r *riskEngine) gc() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for uuid, entity := range r.entities {
+		n := 0
+		for _, c := range entity.contributions {
+			if !r.isExpired(c, r.latest) {
+				entity.contributions[n] = c
+				n++
+			}
+		}
+		entity.contributions = entity.contributions[:n]
+		if n == 0 {
+			log.Debugf("garbage collecting risk score of process %s (%d)", entity.ps.Name, entity.ps.PID)
+			delete(r.entities, uuid)
+			riskEntities.Add(-1)
+		}
+	}
+}
+
+// emit sends the meta-alert listing all rules and
+// events that contributed to the process risk score.
+func (r *riskEngine) emit(alert *riskAlert) error {
+	riskAlerts.Add(1)
+	title := fmt.Sprintf("Risk threshold reached by %s (%d)", alert.ps.Name, alert.ps.PID)
+	text := alert.text()
+
+	tags := make([]string, 0)
+	evts := make([]*kevent.Kevent, 0)
+	seen := make(map[string]bool)
+	for _, c := range alert.contributions {
+		for _, tag := range c.rule.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+		evts = append(evts, c.events...)
+	}
+	sort.Slice(evts, func(i, j int) bool { return evts[i].Timestamp.Before(evts[j].Timestamp) })
+
+	ctx := &config.ActionContext{
+		Events: evts,
+		Filter: &config.FilterConfig{
+			Name:        title,
+			Description: text,
+			Severity:    r.config.Severity,
+			Tags:        tags,
+		},
+	}
+	return action.Emit(ctx, title, text, r.config.Severity, tags)
+}
+
+// text renders the meta-alert text.
+func (a *riskAlert) text() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s (%d) accumulated the risk score of %.1f from %d rule match(es) in the process tree:\n",
+		a.ps.Name, a.ps.PID, a.score, len(a.contributions)))
+	for _, c := range a.contributions {
+		sb.WriteString(fmt.Sprintf("\n- %s (risk %d)\n", c.rule.Name, c.rule.Risk))
+		for _, e := range c.events {
+			proc := fmt.Sprintf("pid %d", e.PID)
+			if e.PS != nil && e.PS.Name != "" {
+				proc = fmt.Sprintf("%s (%d)", e.PS.Name, e.PID)
+			}
+			sb.WriteString(fmt.Sprintf("  - #%d %s %s by %s\n", e.Seq, e.Timestamp.Format(time.RFC3339Nano), e.Name, proc))
+		}
+	}
+	return sb.String()
+}
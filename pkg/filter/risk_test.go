@@ -0,0 +1,145 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"github.com/rabbitstack/fibratus/pkg/alertsender"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	pstypes "github.com/rabbitstack/fibratus/pkg/ps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newRiskProcs() (*pstypes.PS, *pstypes.PS, *pstypes.PS) {
+	explorer := &pstypes.PS{PID: 91001, Name: "explorer.exe", StartTime: time.Unix(0, 0)}
+	cmd := &pstypes.PS{PID: 91002, Name: "cmd.exe", StartTime: time.Unix(0, 0), Parent: explorer}
+	powershell := &pstypes.PS{PID: 91003, Name: "powershell.exe", StartTime: time.Unix(0, 0), Parent: cmd}
+	return explorer, cmd, powershell
+}
+
+func newRiskEvent(seq uint64, ps *pstypes.PS, ts time.Time) *kevent.Kevent {
+	return &kevent.Kevent{Seq: seq, Name: "CreateFile", PID: ps.PID, PS: ps, Timestamp: ts}
+}
+
+func TestRiskEngineAccumulate(t *testing.T) {
+	r := newRiskEngine(config.Risk{Enabled: true, Threshold: 100, HalfLife: time.Hour})
+	explorer, cmd, powershell := newRiskProcs()
+
+	f1 := &config.FilterConfig{Name: "Suspicious file write", Risk: 40}
+	f2 := &config.FilterConfig{Name: "Suspicious registry write", Risk: 40}
+	f3 := &config.FilterConfig{Name: "Suspicious network connection", Risk: 30}
+
+	now := time.Now()
+	assert.Empty(t, r.add(f1, []*kevent.Kevent{newRiskEvent(1, powershell, now)}))
+	// the score is propagated to ancestors
+	assert.Len(t, r.entities, 3)
+	assert.Empty(t, r.add(f2, []*kevent.Kevent{newRiskEvent(2, cmd, now)}))
+	assert.Len(t, r.entities[explorer.UUID()].contributions, 2)
+	assert.Len(t, r.entities[powershell.UUID()].contributions, 1)
+
+	alerts := r.add(f3, []*kevent.Kevent{newRiskEvent(3, cmd, now)})
+	require.Len(t, alerts, 1)
+	alert := alerts[0]
+	assert.Equal(t, cmd, alert.ps)
+	assert.InDelta(t, 110, alert.score, 0.001)
+	require.Len(t, alert.contributions, 3)
+	assert.Equal(t, f1, alert.contributions[0].rule)
+	assert.Equal(t, uint64(1), alert.contributions[0].events[0].Seq)
+	assert.Equal(t, f3, alert.contributions[2].rule)
+
+	// contributions reported in the alert are discarded, so
+	// the ancestor doesn't trigger an alert for the same matches
+	assert.Empty(t, r.entities)
+
+	text := alert.text()
+	assert.Contains(t, text, "cmd.exe (91002) accumulated the risk score of 110.0 from 3 rule match(es)")
+	assert.Contains(t, text, "- Suspicious file write (risk 40)")
+	assert.Contains(t, text, "CreateFile by powershell.exe (91003)")
+}
+
+func TestRiskEngineDecay(t *testing.T) {
+	r := newRiskEngine(config.Risk{Enabled: true, Threshold: 100, HalfLife: time.Minute})
+	_, cmd, _ := newRiskProcs()
+
+	f1 := &config.FilterConfig{Name: "Suspicious file write", Risk: 60}
+	f2 := &config.FilterConfig{Name: "Suspicious registry write", Risk: 60}
+
+	now := time.Now()
+	assert.Empty(t, r.add(f1, []*kevent.Kevent{newRiskEvent(1, cmd, now.Add(-time.Minute))}))
+	// the first contribution decayed to 30
+	assert.Empty(t, r.add(f2, []*kevent.Kevent{newRiskEvent(2, cmd, now)}))
+	assert.InDelta(t, 30, r.score(r.entities[cmd.UUID()].contributions[0], now), 0.001)
+
+	alerts := r.add(f2, []*kevent.Kevent{newRiskEvent(3, cmd, now)})
+	require.Len(t, alerts, 1)
+	assert.InDelta(t, 150, alerts[0].score, 0.001)
+}
+
+func TestRiskEngineGc(t *testing.T) {
+	r := newRiskEngine(config.Risk{Enabled: true, Threshold: 100, HalfLife: time.Millisecond})
+	explorer, cmd, powershell := newRiskProcs()
+
+	f1 := &config.FilterConfig{Name: "Suspicious file write", Risk: 60}
+	f2 := &config.FilterConfig{Name: "Suspicious registry write", Risk: 30}
+
+	ts := time.Unix(1700000000, 0)
+	assert.Empty(t, r.add(f1, []*kevent.Kevent{newRiskEvent(1, cmd, ts)}))
+	assert.Len(t, r.entities, 2)
+
+	// contributions don't expire on the wall clock
+	r.gc()
+	assert.Len(t, r.entities, 2)
+
+	assert.Empty(t, r.add(f2, []*kevent.Kevent{newRiskEvent(2, powershell, ts.Add(time.Second))}))
+	assert.Len(t, r.entities, 3)
+
+	r.gc()
+	assert.Len(t, r.entities, 3)
+	for _, ps := range []*pstypes.PS{explorer, cmd, powershell} {
+		require.Len(t, r.entities[ps.UUID()].contributions, 1)
+		assert.Equal(t, f2, r.entities[ps.UUID()].contributions[0].rule)
+	}
+}
+
+func TestRiskEngineEmit(t *testing.T) {
+	require.NoError(t, alertsender.LoadAll([]alertsender.Config{{Type: alertsender.Noop}}))
+	r := newRiskEngine(config.Risk{Enabled: true, Threshold: 50, HalfLife: time.Hour, Severity: "high"})
+	_, cmd, powershell := newRiskProcs()
+
+	f1 := &config.FilterConfig{Name: "Suspicious file write", Risk: 30, Tags: []string{"T1105"}}
+	f2 := &config.FilterConfig{Name: "Suspicious registry write", Risk: 30, Tags: []string{"T1112", "T1105"}}
+
+	now := time.Now()
+	assert.Empty(t, r.add(f1, []*kevent.Kevent{newRiskEvent(1, powershell, now)}))
+	alerts := r.add(f2, []*kevent.Kevent{newRiskEvent(2, powershell, now)})
+	require.Len(t, alerts, 1)
+
+	require.NoError(t, r.emit(alerts[0]))
+	time.Sleep(time.Millisecond * 25)
+	require.NotNil(t, emitAlert)
+	assert.Equal(t, "Risk threshold reached by powershell.exe (91003)", emitAlert.Title)
+	assert.Contains(t, emitAlert.Text, "Suspicious registry write (risk 30)")
+	assert.Equal(t, alertsender.High, emitAlert.Severity)
+	assert.Equal(t, []string{"T1105", "T1112"}, emitAlert.Tags)
+	assert.Nil(t, r.entities[cmd.UUID()])
+	emitAlert = nil
+}
@@ -25,12 +25,14 @@ import (
 	fsm "github.com/qmuntal/stateless"
 	"github.com/rabbitstack/fibratus/pkg/filter/action"
 	"github.com/rabbitstack/fibratus/pkg/filter/fields"
+	"github.com/rabbitstack/fibratus/pkg/filter/lists"
 	"github.com/rabbitstack/fibratus/pkg/kevent/kparams"
 	"github.com/rabbitstack/fibratus/pkg/kevent/ktypes"
 	"github.com/rabbitstack/fibratus/pkg/ps"
 	"github.com/rabbitstack/fibratus/pkg/util/atomic"
 	"github.com/rabbitstack/fibratus/pkg/util/hashers"
 	"github.com/rabbitstack/fibratus/pkg/util/version"
+	"maps"
 	"sort"
 	"sync"
 	"time"
@@ -54,6 +56,8 @@ var (
 	partialsPerSequence   = expvar.NewMap("sequence.partials.count")
 	partialExpirations    = expvar.NewMap("sequence.partial.expirations")
 	partialBreaches       = expvar.NewMap("sequence.partial.breaches")
+	pendingAbsences       = expvar.NewMap("sequence.pending.absences")
+	absenceViolations     = expvar.NewMap("sequence.absence.violations")
 
 	ErrInvalidFilter = func(rule string, err error) error {
 		return fmt.Errorf("syntax error in rule %q: \n%v", rule, err)
@@ -67,9 +71,18 @@ var (
 	ErrMalformedMinEngineVer = func(rule, v string, err error) error {
 		return fmt.Errorf("rule %q has a malformed minimum engine version: %s: %v", rule, v, err)
 	}
+	ErrInvalidSuppression = func(rule string, err error) error {
+		return fmt.Errorf("invalid suppression in rule %q: %v", rule, err)
+	}
+	ErrInvalidOutput = func(rule string, err error) error {
+		return fmt.Errorf("invalid output template in rule %q: %v", rule, err)
+	}
 
 	// sequenceGcInterval determines how often sequence GC kicks in
 	sequenceGcInterval = time.Minute
+	// absenceSweepInterval determines how often pending absences
+	// are checked for the elapsed max span when no events arrive
+	absenceSweepInterval = time.Second
 	// maxSequencePartialLifetime indicates the maximum time for the
 	// partial to exist in the sequence state. If the partial has been
 	// placed in the sequence state more than allowed, it is removed
@@ -105,20 +118,69 @@ type Rules struct {
 	config  *config.Config
 	psnap   ps.Snapshotter
 
-	matches   []*ruleMatch
-	sequences []*sequenceState
+	matches    []*ruleMatch
+	sequences  []*sequenceState
+	thresholds []*thresholdState
+	// rmu guards the active ruleset, i.e. filters,
+	// sequences, and thresholds. The ruleset is
+	// swapped when the rules are reloaded
+	rmu sync.RWMutex
+	// cmu serializes rules compilation
+	cmu sync.Mutex
+	// mu guards the matches slice. Matches
+	// can be appended either by the event
+	// processing loop, or by the timers of
+	// negated sequences
+	mu sync.Mutex
+	// suppressor deduplicates alerts of rules
+	// with the suppression window
+	suppressor *suppressor
+	// risk accumulates risk scores of rule matches
+	// per process tree. Nil if the risk engine is
+	// disabled
+	risk *riskEngine
+	// matchFn is invoked for each rule match
+	matchFn MatchFunc
+	// replay indicates the recorded events are
+	// replayed, and rule actions are not executed
+	replay bool
+	// lists contains the lookup lists referenced
+	// by the rule conditions
+	lists *lists.Registry
 
 	scavenger *time.Ticker
+	// sweeper fires pending absences in
+	// periods without incoming events
+	sweeper *time.Ticker
+	// clock returns the current time
+	// for the absence sweeper
+	clock func() time.Time
+	// quit stops the state collectors
+	quit chan struct{}
 }
 
+// MatchFunc is the function that is invoked for each rule
+// match before any of the rule actions are executed. The
+// action context contains the rule and matched events.
+type MatchFunc func(ctx *config.ActionContext)
+
 type ruleMatch struct {
-	ctx *config.ActionContext
+	ctx    *config.ActionContext
+	filter *compiledFilter
 }
 
 type compiledFilter struct {
 	filter Filter
 	ss     *sequenceState
+	ts     *thresholdState
 	config *config.FilterConfig
+	// output is the compiled output template.
+	// Nil if the rule doesn't use the template
+	// output format
+	output *outputTemplate
+	// suppressAccessors extract values of the
+	// suppression fields
+	suppressAccessors []Accessor
 }
 
 // sequenceState represents the state of the
@@ -156,6 +218,50 @@ type sequenceState struct {
 	matchedRules map[uint16]bool
 	// mrm guards the matchedRules map
 	mrm sync.RWMutex
+
+	// absences contains matched events of the
+	// sequences with the trailing negated expression
+	// that are awaiting the max span deadline
+	absences []*absence
+	// amu guards the absences slice
+	amu sync.Mutex
+
+	// replay indicates the max span is enforced
+	// on timestamps of replayed events instead of
+	// the wall clock deadlines
+	replay bool
+}
+
+// absence represents the sequence that matched all
+// expressions preceding the negated expression. If
+// the event described by the negated expression doesn't
+// occur before the deadline, the sequence matches.
+type absence struct {
+	// events stores the matched events indexed by the sequence slot
+	events map[uint16]*kevent.Kevent
+	// deadline is the time by which the negated event must occur
+	deadline time.Time
+	// fire is invoked with matched events when the deadline elapses
+	fire func([]*kevent.Kevent)
+}
+
+// partials returns absence events arranged as sequence partials.
+func (a *absence) partials() map[uint16][]*kevent.Kevent {
+	partials := make(map[uint16][]*kevent.Kevent, len(a.events))
+	for idx, e := range a.events {
+		partials[idx] = []*kevent.Kevent{e}
+	}
+	return partials
+}
+
+// sorted returns absence events ordered by timestamp.
+func (a *absence) sorted() []*kevent.Kevent {
+	events := make([]*kevent.Kevent, 0, len(a.events))
+	for _, e := range a.events {
+		events = append(events, e)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+	return events
 }
 
 func newSequenceState(name, initialState string, maxSpan time.Duration) *sequenceState {
@@ -169,6 +275,7 @@ func newSequenceState(name, initialState string, maxSpan time.Duration) *sequenc
 		spanDeadlines: make(map[fsm.State]*time.Timer),
 		initialState:  fsm.State(initialState),
 		inDeadline:    atomic.MakeBool(false),
+		absences:      make([]*absence, 0),
 	}
 
 	ss.initFSM(initialState)
@@ -195,7 +302,7 @@ func (s *sequenceState) initFSM(initialState string) {
 	s.fsm = fsm.NewStateMachine(initialState)
 	s.fsm.OnTransitioned(func(ctx context.Context, transition fsm.Transition) {
 		// schedule span deadline for the current state unless initial/meta states
-		if s.maxSpan != 0 && s.isStateSchedulable(s.currentState()) {
+		if s.maxSpan != 0 && !s.replay && s.isStateSchedulable(s.currentState()) {
 			log.Debugf("scheduling max span deadline of %v for rule %s", s.maxSpan, s.currentState())
 			s.scheduleMaxSpanDeadline(s.currentState(), s.maxSpan)
 		}
@@ -296,7 +403,7 @@ func (s *sequenceState) addPartial(rule string, kevt *kevent.Kevent, outOfOrder
 // more time than specified by max span or if max
 // span is omitted, the partial is allowed to remain
 // in sequence state for four hours.
-func (s *sequenceState) gc() {
+func (s *sequenceState) gc(now time.Time) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	dur := s.maxSpan
@@ -305,7 +412,7 @@ func (s *sequenceState) gc() {
 	}
 	for _, idx := range s.idxs {
 		for i := len(s.partials[idx]) - 1; i >= 0; i-- {
-			if len(s.partials[idx]) > 0 && time.Since(s.partials[idx][i].Timestamp) > dur {
+			if len(s.partials[idx]) > 0 && now.Sub(s.partials[idx][i].Timestamp) > dur {
 				log.Debugf("garbage collecting partial: [%s]", s.partials[idx][i])
 				// remove partial event from the corresponding slot
 				s.partials[idx] = append(
@@ -317,6 +424,34 @@ func (s *sequenceState) gc() {
 	}
 }
 
+// expireSpan enforces the max span on timestamps of replayed
+// events. Partials that fell out of the time window are dropped,
+// and the sequence is reset to the initial state once there are
+// no partials left for the first expression to join with.
+func (s *sequenceState) expireSpan(now time.Time) {
+	s.gc(now)
+	if s.maxSpan == 0 || s.isInitialState() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.partials[1]) > 0 {
+		return
+	}
+	s.mrm.Lock()
+	defer s.mrm.Unlock()
+	log.Debugf("max span of %v exceeded for sequence %s", s.maxSpan, s.name)
+	// transitions to deadline state
+	if err := s.cancelTransition(s.currentState()); err != nil {
+		log.Warnf("deadline transition failed: %v", err)
+		return
+	}
+	// transitions from deadline state to initial state
+	if err := s.fsm.Fire(resetTransition); err != nil {
+		log.Warnf("unable to transition to initial state: %v", err)
+	}
+}
+
 func (s *sequenceState) clear() {
 	s.partials = make(map[uint16][]*kevent.Kevent)
 	s.matches = make(map[uint16]*kevent.Kevent)
@@ -325,6 +460,24 @@ func (s *sequenceState) clear() {
 	partialsPerSequence.Delete(s.name)
 }
 
+// close stops all pending deadline timers and discards
+// the state when the sequence rule is removed from the
+// ruleset.
+func (s *sequenceState) close() {
+	s.amu.Lock()
+	s.absences = make([]*absence, 0)
+	pendingAbsences.Delete(s.name)
+	s.amu.Unlock()
+
+	s.mu.Lock()
+	for _, t := range s.spanDeadlines {
+		t.Stop()
+	}
+	s.mu.Unlock()
+
+	s.clearLocked()
+}
+
 func (s *sequenceState) clearLocked() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -442,8 +595,112 @@ func (s *sequenceState) expire(e *kevent.Kevent) bool {
 	return false
 }
 
-func newCompiledFilter(f Filter, filterConfig *config.FilterConfig, ss *sequenceState) *compiledFilter {
-	return &compiledFilter{config: filterConfig, filter: f, ss: ss}
+// absenceEvents returns the events that matched the
+// expressions preceding the negated expression. If the
+// events couldn't be joined, the latest partial in each
+// slot is picked.
+func (s *sequenceState) absenceEvents() map[uint16]*kevent.Kevent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.mmu.RLock()
+	defer s.mmu.RUnlock()
+	events := make(map[uint16]*kevent.Kevent)
+	for _, idx := range s.idxs {
+		if e, ok := s.matches[idx]; ok {
+			events[idx] = e
+			continue
+		}
+		if n := len(s.partials[idx]); n > 0 {
+			events[idx] = s.partials[idx][n-1]
+		}
+	}
+	return events
+}
+
+// scheduleAbsence registers the absence of the event
+// described by the negated expression. The deadline is
+// relative to the timestamp of the latest matched event.
+// If the absence is not violated before the max span
+// deadline, the provided callback is invoked with matched
+// events when the absence expires.
+func (s *sequenceState) scheduleAbsence(events map[uint16]*kevent.Kevent, fn func([]*kevent.Kevent)) {
+	if len(events) == 0 {
+		return
+	}
+	s.amu.Lock()
+	defer s.amu.Unlock()
+	if len(s.absences) > maxOutstandingPartials {
+		partialBreaches.Add(s.name, 1)
+		log.Warnf("max pending absences encountered in sequence %s. "+
+			"Dropping incoming absence", s.name)
+		return
+	}
+	a := &absence{events: events, fire: fn}
+	for _, e := range events {
+		if e.Timestamp.After(a.deadline) {
+			a.deadline = e.Timestamp
+		}
+	}
+	a.deadline = a.deadline.Add(s.maxSpan)
+	log.Debugf("scheduling absence deadline of %v for sequence %s", s.maxSpan, s.name)
+	pendingAbsences.Add(s.name, 1)
+	s.absences = append(s.absences, a)
+}
+
+// expireAbsences removes and returns pending absences
+// with the deadline elapsed before the given time.
+func (s *sequenceState) expireAbsences(now time.Time) []*absence {
+	s.amu.Lock()
+	defer s.amu.Unlock()
+	var expired []*absence
+	for i := 0; i < len(s.absences); i++ {
+		a := s.absences[i]
+		if !now.After(a.deadline) {
+			continue
+		}
+		log.Debugf("max span of %v elapsed without negated event in sequence %s", s.maxSpan, s.name)
+		expired = append(expired, a)
+		pendingAbsences.Add(s.name, -1)
+		s.absences = append(s.absences[:i], s.absences[i+1:]...)
+		i--
+	}
+	return expired
+}
+
+// violateAbsences evaluates the negated expression for every
+// pending absence. If the expression matches the event that
+// occurred before the absence deadline, and the event is
+// correlated with absence events, the absence is violated.
+func (s *sequenceState) violateAbsences(e *kevent.Kevent, eval func(partials map[uint16][]*kevent.Kevent) bool) {
+	s.amu.Lock()
+	defer s.amu.Unlock()
+	for i := len(s.absences) - 1; i >= 0; i-- {
+		a := s.absences[i]
+		if e.Timestamp.After(a.deadline) || !eval(a.partials()) {
+			continue
+		}
+		log.Debugf("absence violated in sequence %s", s.name)
+		absenceViolations.Add(s.name, 1)
+		pendingAbsences.Add(s.name, -1)
+		s.absences = append(s.absences[:i], s.absences[i+1:]...)
+	}
+}
+
+func newCompiledFilter(f Filter, filterConfig *config.FilterConfig, ss *sequenceState, ts *thresholdState) *compiledFilter {
+	return &compiledFilter{config: filterConfig, filter: f, ss: ss, ts: ts}
+}
+
+// retainState carries over the sequence or threshold state
+// from the previously compiled filter of the same rule. The
+// state is only retained if the sequence expressions or the
+// threshold parameters are identical.
+func (f *compiledFilter) retainState(old *compiledFilter) {
+	if f.ss != nil && old.ss != nil && f.ss.maxSpan == old.ss.maxSpan && maps.Equal(f.ss.idxs, old.ss.idxs) {
+		f.ss = old.ss
+	}
+	if f.ts != nil && old.ts != nil && f.ts.count == old.ts.count && f.ts.window == old.ts.window {
+		f.ts = old.ts
+	}
 }
 
 // isScoped determines if this filter is scoped, i.e. it has the event name or category
@@ -472,43 +729,190 @@ func (f compiledFilter) run(kevt *kevent.Kevent, i int, rawMatch, lock bool) boo
 // NewRules produces a fresh rules engine instance.
 func NewRules(psnap ps.Snapshotter, config *config.Config) *Rules {
 	rules := &Rules{
-		filters:   make(map[uint32][]*compiledFilter),
-		matches:   make([]*ruleMatch, 0),
-		sequences: make([]*sequenceState, 0),
-		psnap:     psnap,
-		config:    config,
-		scavenger: time.NewTicker(sequenceGcInterval),
+		filters:    make(map[uint32][]*compiledFilter),
+		matches:    make([]*ruleMatch, 0),
+		sequences:  make([]*sequenceState, 0),
+		thresholds: make([]*thresholdState, 0),
+		suppressor: newSuppressor(),
+		psnap:      psnap,
+		config:     config,
+		scavenger:  time.NewTicker(sequenceGcInterval),
+		sweeper:    time.NewTicker(absenceSweepInterval),
+		clock:      time.Now,
+		lists:      lists.NewRegistry(),
+		quit:       make(chan struct{}),
+	}
+	if config.Filters != nil && config.Filters.Risk.Enabled {
+		rules.risk = newRiskEngine(config.Filters.Risk)
 	}
 
-	go rules.gcSequences()
+	go rules.gcStates()
+	go rules.sweepAbsences()
 
 	return rules
 }
 
+// Close stops the garbage collection of sequence and threshold
+// states, and the sweeper of negated sequence absences. The rule
+// engine must not be used after it is closed.
+func (r *Rules) Close() {
+	r.scavenger.Stop()
+	r.sweeper.Stop()
+	close(r.quit)
+}
+
+// Lists returns the registry of lookup lists referenced by the rules.
+func (r *Rules) Lists() *lists.Registry { return r.lists }
+
+// OnMatch registers the function that is invoked for each rule match.
+func (r *Rules) OnMatch(fn MatchFunc) { r.matchFn = fn }
+
+// EnableReplay prepares the rule engine for replaying recorded
+// events. Rule matches are only reported to the match function,
+// while alerts and other rule actions are not executed. The garbage
+// collection of sequence and threshold states is stopped, as it
+// evicts the state relative to the wall clock and would discard
+// the partials of past events. For the same reason, the max span
+// of sequences and absences of negated sequences are enforced on
+// timestamps of replayed events. Replay must be enabled before the
+// rules are compiled.
+func (r *Rules) EnableReplay() {
+	r.replay = true
+	r.scavenger.Stop()
+	r.sweeper.Stop()
+}
+
+// Partials returns the events that matched the expressions of
+// the sequences still awaiting the remaining events. Partials are
+// keyed by the rule name and the sequence slot. Slots start at 1.
+func (r *Rules) Partials() map[string]map[uint16][]*kevent.Kevent {
+	r.rmu.RLock()
+	defer r.rmu.RUnlock()
+	partials := make(map[string]map[uint16][]*kevent.Kevent)
+	for _, seq := range r.sequences {
+		seq.mu.RLock()
+		for idx, evts := range seq.partials {
+			if len(evts) == 0 {
+				continue
+			}
+			if partials[seq.name] == nil {
+				partials[seq.name] = make(map[uint16][]*kevent.Kevent)
+			}
+			partials[seq.name][idx] = append([]*kevent.Kevent(nil), evts...)
+		}
+		seq.mu.RUnlock()
+	}
+	return partials
+}
+
+// Absences returns the events of negated sequences that matched
+// all expressions preceding the negated expression, and are still
+// awaiting the end of the time window. Absences are keyed by the
+// rule name, and events of each absence are ordered by timestamp.
+func (r *Rules) Absences() map[string][][]*kevent.Kevent {
+	r.rmu.RLock()
+	defer r.rmu.RUnlock()
+	absences := make(map[string][][]*kevent.Kevent)
+	for _, seq := range r.sequences {
+		seq.amu.Lock()
+		for _, a := range seq.absences {
+			absences[seq.name] = append(absences[seq.name], a.sorted())
+		}
+		seq.amu.Unlock()
+	}
+	return absences
+}
+
 // Compile loads macros and rules from all
 // indicated resources and compiles the filters.
 // It also sets up the state machine transitions
-// for sequence rules.
+// for sequence rules. If the rules were already
+// compiled, the new ruleset replaces the active
+// ruleset only if all rules compile successfully.
+// Sequence and threshold states of the rules with
+// unchanged identifier and version are retained.
 func (r *Rules) Compile() (*config.RulesCompileResult, error) {
-	if err := r.config.Filters.LoadMacros(); err != nil {
+	r.cmu.Lock()
+	defer r.cmu.Unlock()
+
+	rs, err := r.compile()
+	if err != nil {
+		return nil, err
+	}
+	r.swap(rs)
+	r.lists.Commit(rs.lists)
+	*r.config.Filters = *rs.config
+
+	if len(rs.filters) == 0 {
+		return nil, nil
+	}
+
+	return buildCompileResult(rs.filters), nil
+}
+
+// ruleset contains the compiled filters along with
+// sequence and threshold states of the compiled rules.
+type ruleset struct {
+	filters    map[uint32][]*compiledFilter
+	sequences  []*sequenceState
+	thresholds []*thresholdState
+	count      int64
+	// config holds rules and macros
+	// loaded for this ruleset
+	config *config.Filters
+	// lists holds the lookup lists
+	// staged for this ruleset
+	lists *lists.Registry
+}
+
+func (r *Rules) compile() (*ruleset, error) {
+	// lookup lists must be loaded before rule
+	// conditions referencing them are parsed. The
+	// lists are staged, so the active lists are
+	// only replaced along with the ruleset
+	reg, err := r.lists.Stage(r.config.Filters.Lists)
+	if err != nil {
+		return nil, err
+	}
+	// rules and macros are loaded into the copy of the
+	// filters config, so the active config is only replaced
+	// if the whole ruleset compiles successfully
+	filters := *r.config.Filters
+	cfg := *r.config
+	cfg.Filters = &filters
+	if err := filters.LoadMacros(); err != nil {
+		return nil, err
+	}
+	if err := filters.LoadExceptions(); err != nil {
 		return nil, err
 	}
-	if err := r.config.Filters.LoadFilters(); err != nil {
+	if err := filters.LoadFilters(); err != nil {
 		return nil, err
 	}
 
-	for _, f := range r.config.GetFilters() {
+	rs := &ruleset{
+		filters:    make(map[uint32][]*compiledFilter),
+		sequences:  make([]*sequenceState, 0),
+		thresholds: make([]*thresholdState, 0),
+		config:     &filters,
+		lists:      reg,
+	}
+	prev := r.compiledFilters()
+
+	for _, f := range cfg.GetFilters() {
 		if f.IsDisabled() {
 			log.Warnf("[%s] rule is disabled", f.Name)
 			continue
 		}
 
-		filtersCount.Add(1)
+		rs.count++
 
 		// compile filter and for sequence rules
-		// configure the FSM states and transitions
-		fltr := New(f.Condition, r.config, WithPSnapshotter(r.psnap))
-		err := fltr.Compile()
+		// configure the FSM states and transitions.
+		// Events matching any of the exceptions
+		// scoped to the rule are excluded
+		fltr := New(f.Condition, &cfg, WithPSnapshotter(r.psnap), WithExceptions(filters.GetExceptions(f)...), WithLists(reg))
+		err = fltr.Compile()
 		if err != nil {
 			return nil, ErrInvalidFilter(f.Name, err)
 		}
@@ -532,11 +936,29 @@ func (r *Rules) Compile() (*config.RulesCompileResult, error) {
 					f.Name, field, d.Since, d.Fields, field)
 			}
 		}
-		cf := newCompiledFilter(fltr, f, configureFSM(f, fltr))
+		cf := newCompiledFilter(fltr, f, configureFSM(f, fltr, r.replay), configureThreshold(f, fltr))
+		if f.IsOutputTemplate() {
+			cf.output, err = compileOutput(f, matchSize(fltr))
+			if err != nil {
+				return nil, ErrInvalidOutput(f.Name, err)
+			}
+		}
+		if f.IsSuppressed() {
+			cf.suppressAccessors, err = suppressionAccessors(f)
+			if err != nil {
+				return nil, ErrInvalidSuppression(f.Name, err)
+			}
+		}
+		if old, ok := prev[ruleKey(f)]; ok {
+			cf.retainState(old)
+		}
 		if fltr.IsSequence() && cf.ss != nil {
 			// store the sequences in rules
 			// for more convenient tracking
-			r.sequences = append(r.sequences, cf.ss)
+			rs.sequences = append(rs.sequences, cf.ss)
+		}
+		if fltr.IsThreshold() && cf.ts != nil {
+			rs.thresholds = append(rs.thresholds, cf.ts)
 		}
 
 		// traverse all event name or category fields and determine
@@ -557,30 +979,75 @@ func (r *Rules) Compile() (*config.RulesCompileResult, error) {
 			for _, v := range values {
 				if name == fields.KevtName || name == fields.KevtCategory {
 					hash := hashers.FnvUint32([]byte(v))
-					r.filters[hash] = append(r.filters[hash], cf)
+					rs.filters[hash] = append(rs.filters[hash], cf)
 				}
 			}
 		}
 	}
 
-	if len(r.filters) == 0 {
-		return nil, nil
+	return rs, nil
+}
+
+// swap replaces the active ruleset with the new ruleset.
+// Sequence states that are not retained in the new
+// ruleset are discarded along with their timers.
+func (r *Rules) swap(rs *ruleset) {
+	r.rmu.Lock()
+	defer r.rmu.Unlock()
+	retained := make(map[*sequenceState]bool)
+	for _, ss := range rs.sequences {
+		retained[ss] = true
 	}
+	for _, ss := range r.sequences {
+		if !retained[ss] {
+			ss.close()
+		}
+	}
+	r.filters = rs.filters
+	r.sequences = rs.sequences
+	r.thresholds = rs.thresholds
+	filtersCount.Set(rs.count)
+}
 
-	return r.buildCompileResult(), nil
+// compiledFilters returns the active compiled
+// filters indexed by the rule identifier and
+// version.
+func (r *Rules) compiledFilters() map[string]*compiledFilter {
+	r.rmu.RLock()
+	defer r.rmu.RUnlock()
+	filters := make(map[string]*compiledFilter)
+	for _, fltrs := range r.filters {
+		for _, f := range fltrs {
+			if f.config.ID == "" {
+				continue
+			}
+			filters[ruleKey(f.config)] = f
+		}
+	}
+	return filters
 }
 
-func configureFSM(filter *config.FilterConfig, f Filter) *sequenceState {
+// ruleKey returns the key that identifies the
+// specific version of the rule.
+func ruleKey(f *config.FilterConfig) string { return f.ID + "@" + f.Version }
+
+func configureFSM(filter *config.FilterConfig, f Filter, replay bool) *sequenceState {
 	if !f.IsSequence() {
 		return nil
 	}
 	seq := f.GetSequence()
 	expressions := seq.Expressions
+	if seq.IsNegated() {
+		// the negated expression doesn't take
+		// part in state machine transitions
+		expressions = expressions[:len(expressions)-1]
+	}
 	if len(expressions) == 0 {
 		return nil
 	}
 	initialState := expressions[0].Expr.String()
 	seqState := newSequenceState(filter.Name, initialState, seq.MaxSpan)
+	seqState.replay = replay
 	// setup finite state machine states. The last rule
 	// in the sequence transitions to the terminal state
 	// if all rules match
@@ -616,13 +1083,21 @@ func configureFSM(filter *config.FilterConfig, f Filter) *sequenceState {
 	return seqState
 }
 
-func (r *Rules) buildCompileResult() *config.RulesCompileResult {
+func configureThreshold(filter *config.FilterConfig, f Filter) *thresholdState {
+	if !f.IsThreshold() {
+		return nil
+	}
+	thresh := f.GetThreshold()
+	return newThresholdState(filter.Name, thresh.Count, thresh.Window)
+}
+
+func buildCompileResult(filters map[uint32][]*compiledFilter) *config.RulesCompileResult {
 	rs := &config.RulesCompileResult{}
 
 	m := make(map[ktypes.Ktype]bool)
 	events := make([]ktypes.Ktype, 0)
 
-	for _, fltrs := range r.filters {
+	for _, fltrs := range filters {
 		for _, cf := range fltrs {
 			rs.NumberRules++
 			for name, values := range cf.filter.GetStringFields() {
@@ -694,6 +1169,8 @@ func (r *Rules) findFilters(evt *kevent.Kevent) []*compiledFilter {
 func (*Rules) CanEnqueue() bool { return true }
 
 func (r *Rules) ProcessEvent(evt *kevent.Kevent) (bool, error) {
+	r.rmu.RLock()
+	defer r.rmu.RUnlock()
 	if !r.hasRules() {
 		return true, nil
 	}
@@ -705,24 +1182,104 @@ func (r *Rules) ProcessEvent(evt *kevent.Kevent) (bool, error) {
 			seq.expire(evt)
 		}
 	}
+	if r.replay {
+		// the partials of past events are
+		// expired relative to the event time
+		for _, seq := range r.sequences {
+			seq.expireSpan(evt.Timestamp)
+		}
+	}
+	// absences with the deadline preceding the
+	// event are fired before the event is evaluated,
+	// so the late negated event can't violate them
+	r.mu.Lock()
+	r.expireAbsences(evt.Timestamp)
+	r.mu.Unlock()
 	return r.runRules(r.findFilters(evt), evt), nil
 }
 
-func (r *Rules) gcSequences() {
+func (r *Rules) gcStates() {
 	for {
-		<-r.scavenger.C
+		select {
+		case <-r.scavenger.C:
+		case <-r.quit:
+			return
+		}
+		r.rmu.RLock()
 		for _, seq := range r.sequences {
-			seq.gc()
+			seq.gc(time.Now())
+		}
+		for _, thresh := range r.thresholds {
+			thresh.gc()
+		}
+		r.rmu.RUnlock()
+		r.suppressor.gc()
+		if r.risk != nil {
+			r.risk.gc()
+		}
+	}
+}
+
+// sweepAbsences periodically fires absences of negated sequences
+// whose deadline elapsed while no events were flowing through the
+// engine.
+func (r *Rules) sweepAbsences() {
+	for {
+		select {
+		case <-r.sweeper.C:
+			r.sweep()
+		case <-r.quit:
+			return
 		}
 	}
 }
 
+func (r *Rules) sweep() {
+	r.rmu.RLock()
+	defer r.rmu.RUnlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expireAbsences(r.clock())
+}
+
+// expireAbsences fires all absences with the deadline elapsed
+// before the given time. The caller must hold the rules lock,
+// so absences fire on the same path as regular rule matches.
+func (r *Rules) expireAbsences(now time.Time) {
+	for _, seq := range r.sequences {
+		for _, a := range seq.expireAbsences(now) {
+			a.fire(a.sorted())
+		}
+	}
+}
+
+// runThreshold evaluates the threshold expression and if the
+// event matches, it is added to the sliding window. Returns all
+// events in the window if the threshold count is reached.
+func (r *Rules) runThreshold(kevt *kevent.Kevent, f *compiledFilter) []*kevent.Kevent {
+	match, key := f.filter.RunThreshold(kevt)
+	if !match {
+		return nil
+	}
+	return f.ts.add(key, kevt)
+}
+
 func (r *Rules) runSequence(kevt *kevent.Kevent, f *compiledFilter) bool {
 	seq := f.filter.GetSequence()
 	if seq == nil {
 		return false
 	}
+	if expr := seq.NegatedExpr(); expr != nil && expr.IsEvaluable(kevt) {
+		// check if the event violates any of the pending absences
+		n := uint16(len(seq.Expressions) - 1)
+		f.ss.violateAbsences(kevt, func(partials map[uint16][]*kevent.Kevent) bool {
+			return f.filter.RunSequence(kevt, n, partials, false)
+		})
+	}
 	for i, expr := range seq.Expressions {
+		if expr.IsNegated {
+			continue
+		}
 		// only try to evaluate the expression
 		// if upstream expressions have matched
 		if !f.ss.next(i) {
@@ -772,30 +1329,56 @@ func (r *Rules) runSequence(kevt *kevent.Kevent, f *compiledFilter) bool {
 	// collect all events involved in the rule match
 	isTerminal := f.ss.isTerminalState()
 	if isTerminal {
-		f.ss.mu.RLock()
-		defer f.ss.mu.RUnlock()
-		nseqs := uint16(len(f.ss.partials))
-
-		setMatch := func(idx uint16, e *kevent.Kevent) {
-			f.ss.mmu.Lock()
-			defer f.ss.mmu.Unlock()
-			if f.ss.matches[idx] == nil {
-				f.ss.matches[idx] = e
-			}
+		f.ss.joinPartials()
+	}
+	// for sequences terminated by the negated expression,
+	// reaching the terminal state only means the expressions
+	// preceding the negated expression matched. The sequence
+	// matches if the negated event doesn't occur in max span
+	if isTerminal && seq.IsNegated() {
+		f.ss.scheduleAbsence(f.ss.absenceEvents(), func(evts []*kevent.Kevent) {
+			r.fireAbsence(f, evts)
+		})
+		f.ss.clearLocked()
+		return false
+	}
+	return isTerminal
+}
+
+// joinPartials collects all events involved in the rule
+// match by joining the partials with the specified field(s).
+func (s *sequenceState) joinPartials() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	nseqs := uint16(len(s.partials))
+
+	setMatch := func(idx uint16, e *kevent.Kevent) {
+		s.mmu.Lock()
+		defer s.mmu.Unlock()
+		if s.matches[idx] == nil {
+			s.matches[idx] = e
 		}
+	}
 
-		for i := uint16(1); i < nseqs+1; i++ {
-			for _, outer := range f.ss.partials[i] {
-				for _, inner := range f.ss.partials[i+1] {
-					if compareSeqJoin(outer.SequenceBy(), inner.SequenceBy()) {
-						setMatch(i, outer)
-						setMatch(i+1, inner)
-					}
+	for i := uint16(1); i < nseqs+1; i++ {
+		for _, outer := range s.partials[i] {
+			for _, inner := range s.partials[i+1] {
+				if compareSeqJoin(outer.SequenceBy(), inner.SequenceBy()) {
+					setMatch(i, outer)
+					setMatch(i+1, inner)
 				}
 			}
 		}
 	}
-	return isTerminal
+}
+
+// fireAbsence is invoked when the max span of the negated
+// sequence elapses without the occurrence of the negated event.
+func (r *Rules) fireAbsence(f *compiledFilter, evts []*kevent.Kevent) {
+	r.appendMatch(f, evts...)
+	if err := r.processActions(); err != nil {
+		log.Errorf("unable to execute rule action: %v", err)
+	}
 }
 
 func (r *Rules) matchUnorderedPartials(f *compiledFilter) {
@@ -827,18 +1410,27 @@ func (r *Rules) triggerSequencesInFilters(e *kevent.Kevent, filters []*compiledF
 			continue
 		}
 		if r.runSequence(e, f) {
-			r.appendMatch(f.config, f.ss.events()...)
+			r.appendMatch(f, f.ss.events()...)
 			f.ss.clearLocked()
 		}
 	}
 }
 
 func (r *Rules) runRules(filters []*compiledFilter, kevt *kevent.Kevent) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	for i, f := range filters {
-		var match bool
-		if f.ss != nil {
+		var (
+			match bool
+			evts  []*kevent.Kevent
+		)
+		switch {
+		case f.ss != nil:
 			match = r.runSequence(kevt, f)
-		} else {
+		case f.ts != nil:
+			evts = r.runThreshold(kevt, f)
+			match = len(evts) > 0
+		default:
 			match = f.run(kevt, i, false, false)
 			if match {
 				// transition sequence states since a match
@@ -848,11 +1440,14 @@ func (r *Rules) runRules(filters []*compiledFilter, kevt *kevent.Kevent) bool {
 			}
 		}
 		if match {
-			if f.ss != nil {
-				r.appendMatch(f.config, f.ss.events()...)
+			switch {
+			case f.ss != nil:
+				r.appendMatch(f, f.ss.events()...)
 				f.ss.clearLocked()
-			} else {
-				r.appendMatch(f.config, kevt)
+			case f.ts != nil:
+				r.appendMatch(f, evts...)
+			default:
+				r.appendMatch(f, kevt)
 			}
 			err := r.processActions()
 			if err != nil {
@@ -878,10 +1473,41 @@ func (r *Rules) processActions() error {
 		f, evts := m.ctx.Filter, m.ctx.Events
 		filterMatches.Add(f.Name, 1)
 		log.Debugf("[%s] rule matched", f.Name)
-		err := action.Emit(m.ctx, f.Name, InterpolateFields(f.Output, evts), f.Severity, f.Tags)
+		text, err := m.renderOutput()
 		if err != nil {
 			return ErrRuleAction(f.Name, err)
 		}
+		m.ctx.Output = text
+		if r.matchFn != nil {
+			r.matchFn(m.ctx)
+		}
+		if r.replay {
+			continue
+		}
+		if r.risk != nil && f.HasRisk() {
+			// rules contributing to the risk score
+			// don't emit alerts individually
+			for _, alert := range r.risk.add(f, evts) {
+				log.Infof("process %s (%d) reached the risk score of %.1f", alert.ps.Name, alert.ps.PID, alert.score)
+				if err := r.risk.emit(alert); err != nil {
+					return fmt.Errorf("fail to emit risk alert: %v", err)
+				}
+			}
+		} else {
+			suppressed, n := r.suppressor.suppress(m.filter, evts)
+			if !suppressed {
+				if n > 0 {
+					m.ctx.Suppressed = n
+					text += fmt.Sprintf(" (%d similar alert(s) were suppressed)", n)
+				}
+				err := action.Emit(m.ctx, f.Name, text, f.Severity, f.Tags)
+				if err != nil {
+					return ErrRuleAction(f.Name, err)
+				}
+			} else {
+				log.Debugf("[%s] alert suppressed", f.Name)
+			}
+		}
 
 		actions, err := f.DecodeActions()
 		if err != nil {
@@ -900,9 +1526,13 @@ func (r *Rules) processActions() error {
 	return nil
 }
 
-func (r *Rules) appendMatch(f *config.FilterConfig, evts ...*kevent.Kevent) {
+func (r *Rules) appendMatch(cf *compiledFilter, evts ...*kevent.Kevent) {
+	f := cf.config
 	for _, evt := range evts {
 		evt.AddMeta(kevent.RuleNameKey, f.Name)
+		if f.Severity != "" {
+			evt.AddMeta(kevent.RuleSeverityKey, f.Severity)
+		}
 		for k, v := range f.Labels {
 			evt.AddMeta(kevent.MetadataKey(k), v)
 		}
@@ -911,7 +1541,15 @@ func (r *Rules) appendMatch(f *config.FilterConfig, evts ...*kevent.Kevent) {
 		Events: evts,
 		Filter: f,
 	}
-	r.matches = append(r.matches, &ruleMatch{ctx: ctx})
+	r.matches = append(r.matches, &ruleMatch{ctx: ctx, filter: cf})
+}
+
+// renderOutput produces the alert text from the rule output.
+func (m *ruleMatch) renderOutput() (string, error) {
+	if m.filter != nil && m.filter.output != nil {
+		return m.filter.output.render(m.ctx.Filter, m.ctx.Events)
+	}
+	return InterpolateFields(m.ctx.Filter.Output, m.ctx.Events), nil
 }
 
 func (r *Rules) clearMatches() {
@@ -0,0 +1,173 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"github.com/rabbitstack/fibratus/pkg/filter/ql"
+	"github.com/rabbitstack/fibratus/pkg/fs"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"github.com/rabbitstack/fibratus/pkg/kevent/kparams"
+	"github.com/rabbitstack/fibratus/pkg/kevent/ktypes"
+	"github.com/rabbitstack/fibratus/pkg/ps"
+	pstypes "github.com/rabbitstack/fibratus/pkg/ps/types"
+	"github.com/stretchr/testify/require"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+// benchEvents returns the mix of events that exercises
+// the shipped rules without triggering most of them.
+func benchEvents() []*kevent.Kevent {
+	proc := &pstypes.PS{
+		PID:     2436,
+		Ppid:    1068,
+		Name:    "explorer.exe",
+		Exe:     "C:\\Windows\\explorer.exe",
+		Cmdline: "C:\\Windows\\explorer.exe",
+		SID:     "S-1-5-21-2271034452-2606270099-984871569-1001",
+		Parent: &pstypes.PS{
+			PID:  1068,
+			Name: "userinit.exe",
+			Exe:  "C:\\Windows\\System32\\userinit.exe",
+		},
+	}
+	newEvent := func(typ ktypes.Ktype, name string, cat ktypes.Category, kpars kevent.Kparams) *kevent.Kevent {
+		return &kevent.Kevent{
+			Type:      typ,
+			Name:      name,
+			Category:  cat,
+			Tid:       2484,
+			PID:       2436,
+			Timestamp: time.Now(),
+			PS:        proc,
+			Kparams:   kpars,
+			Metadata:  make(map[kevent.MetadataKey]any),
+		}
+	}
+
+	return []*kevent.Kevent{
+		newEvent(ktypes.CreateProcess, "CreateProcess", ktypes.Process, kevent.Kparams{
+			kparams.ProcessID:       {Name: kparams.ProcessID, Type: kparams.PID, Value: uint32(9832)},
+			kparams.ProcessParentID: {Name: kparams.ProcessParentID, Type: kparams.PID, Value: uint32(2436)},
+			kparams.ProcessName:     {Name: kparams.ProcessName, Type: kparams.UnicodeString, Value: "notepad.exe"},
+			kparams.Exe:             {Name: kparams.Exe, Type: kparams.UnicodeString, Value: "C:\\Windows\\System32\\notepad.exe"},
+			kparams.Cmdline:         {Name: kparams.Cmdline, Type: kparams.UnicodeString, Value: "C:\\Windows\\System32\\notepad.exe C:\\Users\\admin\\Documents\\notes.txt"},
+		}),
+		newEvent(ktypes.CreateFile, "CreateFile", ktypes.File, kevent.Kparams{
+			kparams.FileName:      {Name: kparams.FileName, Type: kparams.UnicodeString, Value: "C:\\Users\\admin\\AppData\\Local\\Microsoft\\Windows\\INetCache\\IE\\index.dat"},
+			kparams.FileOperation: {Name: kparams.FileOperation, Type: kparams.Enum, Value: uint32(1), Enum: fs.FileCreateDispositions},
+		}),
+		newEvent(ktypes.CreateFile, "CreateFile", ktypes.File, kevent.Kparams{
+			kparams.FileName:      {Name: kparams.FileName, Type: kparams.UnicodeString, Value: "C:\\ProgramData\\Microsoft\\Windows Defender\\Scans\\History\\Service\\DetectionHistory\\01\\log.bin"},
+			kparams.FileOperation: {Name: kparams.FileOperation, Type: kparams.Enum, Value: uint32(2), Enum: fs.FileCreateDispositions},
+		}),
+		newEvent(ktypes.RegSetValue, "RegSetValue", ktypes.Registry, kevent.Kparams{
+			kparams.RegKeyName: {Name: kparams.RegKeyName, Type: kparams.UnicodeString, Value: "HKEY_CURRENT_USER\\Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\RecentDocs\\MRUListEx"},
+			kparams.RegValue:   {Name: kparams.RegValue, Type: kparams.Uint32, Value: uint32(1)},
+		}),
+		newEvent(ktypes.LoadImage, "LoadImage", ktypes.Image, kevent.Kparams{
+			kparams.ImageFilename: {Name: kparams.ImageFilename, Type: kparams.UnicodeString, Value: "C:\\Windows\\System32\\shell32.dll"},
+		}),
+		newEvent(ktypes.ConnectTCPv4, "Connect", ktypes.Net, kevent.Kparams{
+			kparams.NetDIP:   {Name: kparams.NetDIP, Type: kparams.IPv4, Value: net.ParseIP("216.58.201.174")},
+			kparams.NetDport: {Name: kparams.NetDport, Type: kparams.Uint16, Value: uint16(443)},
+		}),
+	}
+}
+
+// BenchmarkShippedRules measures the throughput of the rule engine
+// loaded with the shipped ruleset. The baseline disables precompiled
+// list matchers, so list values are evaluated one by one.
+func BenchmarkShippedRules(b *testing.B) {
+	events := benchEvents()
+
+	var benchmarks = []struct {
+		name      string
+		threshold int
+	}{
+		{"matcher", ql.ListMatcherThreshold},
+		{"baseline", math.MaxInt},
+	}
+
+	for _, bb := range benchmarks {
+		b.Run(bb.name, func(b *testing.B) {
+			defer func(threshold int) { ql.ListMatcherThreshold = threshold }(ql.ListMatcherThreshold)
+			ql.ListMatcherThreshold = bb.threshold
+
+			c := newConfig("../../rules/*.yml")
+			c.Filters.Macros.FromPaths = []string{"../../rules/macros/*.yml"}
+			rules := NewRules(new(ps.SnapshotterMock), c)
+			rules.EnableReplay()
+			_, err := rules.Compile()
+			require.NoError(b, err)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, e := range events {
+					_, _ = rules.ProcessEvent(e)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkListMatcher compares evaluating the large wildcard
+// list with and without the precompiled list matcher.
+func BenchmarkListMatcher(b *testing.B) {
+	expr := `file.name imatches (` +
+		`'?:\\Windows\\System32\\config\\SAM', '?:\\Windows\\System32\\config\\SECURITY', ` +
+		`'?:\\Users\\*\\AppData\\*\\Microsoft\\Protect\\*', '?:\\Users\\*\\AppData\\*\\Microsoft\\Credentials\\*', ` +
+		`'?:\\Users\\*\\AppData\\*\\Microsoft\\Vault\\*', '?:\\ProgramData\\Microsoft\\Vault\\*', ` +
+		`'?:\\Users\\*\\AppData\\*\\Google\\Chrome\\User Data\\*\\Login Data*', '?:\\Users\\*\\AppData\\*\\Mozilla\\Firefox\\Profiles\\*\\logins.json', ` +
+		`'?:\\Users\\*\\AppData\\*\\Microsoft\\Edge\\User Data\\*\\Login Data*', '?:\\Users\\*\\.ssh\\*', ` +
+		`'*\\ntds.dit', '*\\unattend.xml', '*\\sysprep.inf', '*.kdbx', '*.vcrd', '*.vpol', '*\\CREDHIST', '*\\lsass*.dmp'` +
+		`)`
+	e := &kevent.Kevent{
+		Type:     ktypes.CreateFile,
+		Name:     "CreateFile",
+		Category: ktypes.File,
+		Kparams: kevent.Kparams{
+			kparams.FileName: {Name: kparams.FileName, Type: kparams.UnicodeString, Value: "C:\\Users\\admin\\AppData\\Local\\Microsoft\\Windows\\INetCache\\IE\\index.dat"},
+		},
+		Metadata: make(map[kevent.MetadataKey]any),
+	}
+
+	for _, threshold := range []int{ql.ListMatcherThreshold, math.MaxInt} {
+		name := "matcher"
+		if threshold == math.MaxInt {
+			name = "baseline"
+		}
+		b.Run(name, func(b *testing.B) {
+			defer func(threshold int) { ql.ListMatcherThreshold = threshold }(ql.ListMatcherThreshold)
+			ql.ListMatcherThreshold = threshold
+
+			f := New(expr, cfg)
+			require.NoError(b, f.Compile())
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				f.Run(e)
+			}
+		})
+	}
+}
@@ -19,8 +19,11 @@
 package filter
 
 import (
+	"expvar"
 	"github.com/rabbitstack/fibratus/pkg/alertsender"
 	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/rabbitstack/fibratus/pkg/filter/fields"
+	"github.com/rabbitstack/fibratus/pkg/filter/ql"
 	"github.com/rabbitstack/fibratus/pkg/fs"
 	"github.com/rabbitstack/fibratus/pkg/kevent"
 	"github.com/rabbitstack/fibratus/pkg/kevent/kparams"
@@ -601,6 +604,302 @@ func TestSimpleSequencePolicyWithMaxSpanNotReached(t *testing.T) {
 	require.True(t, wrapProcessEvent(e2, rules.ProcessEvent))
 }
 
+func TestNegatedSequenceRule(t *testing.T) {
+	psnap := new(ps.SnapshotterMock)
+	rules := NewRules(psnap, newConfig("_fixtures/sequence_rule_negated.yml"))
+	compileRules(t, rules)
+
+	ruleName := "Command shell spawned without creating a temp file"
+	matches := func() int64 {
+		v, ok := filterMatches.Get(ruleName).(*expvar.Int)
+		if !ok {
+			return 0
+		}
+		return v.Value()
+	}
+
+	e1 := &kevent.Kevent{
+		Type:      ktypes.CreateProcess,
+		Timestamp: time.Now(),
+		Name:      "CreateProcess",
+		Tid:       2484,
+		PID:       859,
+		PS: &types.PS{
+			Name: "cmd.exe",
+			Exe:  "C:\\Windows\\system32\\cmd.exe",
+		},
+		Kparams: kevent.Kparams{
+			kparams.ProcessID: {Name: kparams.ProcessID, Type: kparams.Uint32, Value: uint32(4143)},
+		},
+		Metadata: make(map[kevent.MetadataKey]any),
+	}
+
+	e2 := &kevent.Kevent{
+		Type:      ktypes.CreateFile,
+		Timestamp: time.Now(),
+		Name:      "CreateFile",
+		Tid:       2484,
+		PID:       859,
+		Category:  ktypes.File,
+		PS: &types.PS{
+			Name: "cmd.exe",
+			Exe:  "C:\\Windows\\system32\\cmd.exe",
+		},
+		Kparams: kevent.Kparams{
+			kparams.FileName: {Name: kparams.FileName, Type: kparams.UnicodeString, Value: "C:\\Temp\\dropper"},
+		},
+		Metadata: make(map[kevent.MetadataKey]any),
+	}
+
+	// absences are swept on the injected clock
+	rules.sweeper.Stop()
+	now := time.Now()
+	rules.clock = func() time.Time { return now }
+	at := func(e *kevent.Kevent, ts time.Time) *kevent.Kevent {
+		e.Timestamp = ts
+		return e
+	}
+
+	// the negated event doesn't occur within the max span
+	require.False(t, wrapProcessEvent(at(e1, now), rules.ProcessEvent))
+	now = now.Add(time.Millisecond * 50)
+	rules.sweep()
+	require.Equal(t, int64(0), matches())
+	now = now.Add(time.Millisecond * 100)
+	rules.sweep()
+	require.Equal(t, int64(1), matches())
+
+	// the negated event occurs within the max span
+	require.False(t, wrapProcessEvent(at(e1, now), rules.ProcessEvent))
+	require.False(t, wrapProcessEvent(at(e2, now.Add(time.Millisecond*10)), rules.ProcessEvent))
+	now = now.Add(time.Millisecond * 150)
+	rules.sweep()
+	require.Equal(t, int64(1), matches())
+
+	// the negated event pertains to a different process
+	e2.PID = 1234
+	require.False(t, wrapProcessEvent(at(e1, now), rules.ProcessEvent))
+	require.False(t, wrapProcessEvent(at(e2, now.Add(time.Millisecond*10)), rules.ProcessEvent))
+	now = now.Add(time.Millisecond * 150)
+	rules.sweep()
+	require.Equal(t, int64(2), matches())
+
+	// the negated event occurs after the max span elapsed. The
+	// absence expires on the event timestamp without the sweep
+	e2.PID = 859
+	require.False(t, wrapProcessEvent(at(e1, now), rules.ProcessEvent))
+	require.False(t, wrapProcessEvent(at(e2, now.Add(time.Millisecond*150)), rules.ProcessEvent))
+	require.Equal(t, int64(3), matches())
+}
+
+func TestThresholdRule(t *testing.T) {
+	psnap := new(ps.SnapshotterMock)
+	rules := NewRules(psnap, newConfig("_fixtures/threshold_rule.yml"))
+	compileRules(t, rules)
+
+	newEvent := func(pid uint32, ts time.Time) *kevent.Kevent {
+		return &kevent.Kevent{
+			Type:      ktypes.CreateFile,
+			Timestamp: ts,
+			Name:      "CreateFile",
+			Tid:       2484,
+			PID:       pid,
+			Category:  ktypes.File,
+			PS: &types.PS{
+				Name: "cmd.exe",
+				Exe:  "C:\\Windows\\system32\\cmd.exe",
+			},
+			Kparams: kevent.Kparams{
+				kparams.FileName: {Name: kparams.FileName, Type: kparams.UnicodeString, Value: "C:\\Temp\\dropper"},
+			},
+			Metadata: make(map[kevent.MetadataKey]any),
+		}
+	}
+
+	now := time.Now()
+
+	require.False(t, wrapProcessEvent(newEvent(859, now), rules.ProcessEvent))
+	require.False(t, wrapProcessEvent(newEvent(859, now.Add(time.Millisecond*100)), rules.ProcessEvent))
+	// the event from another process is counted separately
+	require.False(t, wrapProcessEvent(newEvent(1234, now.Add(time.Millisecond*150)), rules.ProcessEvent))
+	require.True(t, wrapProcessEvent(newEvent(859, now.Add(time.Millisecond*200)), rules.ProcessEvent))
+
+	// the window is reset after the threshold fires
+	require.False(t, wrapProcessEvent(newEvent(859, now.Add(time.Millisecond*300)), rules.ProcessEvent))
+	require.False(t, wrapProcessEvent(newEvent(859, now.Add(time.Millisecond*400)), rules.ProcessEvent))
+	// the first two events fall out of the time window
+	require.False(t, wrapProcessEvent(newEvent(859, now.Add(time.Millisecond*1500)), rules.ProcessEvent))
+	require.False(t, wrapProcessEvent(newEvent(859, now.Add(time.Millisecond*1600)), rules.ProcessEvent))
+	require.True(t, wrapProcessEvent(newEvent(859, now.Add(time.Millisecond*1700)), rules.ProcessEvent))
+
+	require.Len(t, rules.thresholds, 1)
+	ts := rules.thresholds[0]
+	require.Len(t, ts.windows, 1)
+	ts.gc()
+	// the window of the other process is still within time frame
+	require.Len(t, ts.windows, 1)
+	time.Sleep(time.Second + time.Millisecond*300)
+	ts.gc()
+	require.Len(t, ts.windows, 0)
+}
+
+func TestSuppressedRule(t *testing.T) {
+	psnap := new(ps.SnapshotterMock)
+	rules := NewRules(psnap, newConfig("_fixtures/suppressed_rule.yml"))
+	compileRules(t, rules)
+
+	newEvent := func(exe, filename string, ts time.Time) *kevent.Kevent {
+		return &kevent.Kevent{
+			Type:      ktypes.CreateFile,
+			Timestamp: ts,
+			Name:      "CreateFile",
+			Tid:       2484,
+			PID:       859,
+			Category:  ktypes.File,
+			PS: &types.PS{
+				Name: "cmd.exe",
+				Exe:  exe,
+			},
+			Kparams: kevent.Kparams{
+				kparams.FileName: {Name: kparams.FileName, Type: kparams.UnicodeString, Value: filename},
+			},
+			Metadata: make(map[kevent.MetadataKey]any),
+		}
+	}
+
+	name := "Temp file created"
+	suppressed := func() int64 {
+		if v, ok := suppressedAlerts.Get(name).(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+
+	now := time.Now().Add(-time.Hour)
+
+	require.True(t, wrapProcessEvent(newEvent("C:\\Windows\\system32\\cmd.exe", "C:\\Temp\\dropper", now), rules.ProcessEvent))
+	require.Equal(t, int64(0), suppressed())
+	// the alert for the same tuple of field values is suppressed
+	require.True(t, wrapProcessEvent(newEvent("C:\\Windows\\system32\\cmd.exe", "C:\\Temp\\dropper", now.Add(time.Second)), rules.ProcessEvent))
+	require.True(t, wrapProcessEvent(newEvent("C:\\Windows\\system32\\cmd.exe", "C:\\Temp\\dropper", now.Add(time.Second*2)), rules.ProcessEvent))
+	require.Equal(t, int64(2), suppressed())
+	// distinct field values are not suppressed
+	require.True(t, wrapProcessEvent(newEvent("C:\\Windows\\system32\\cmd.exe", "C:\\Temp\\payload", now.Add(time.Second*3)), rules.ProcessEvent))
+	require.True(t, wrapProcessEvent(newEvent("C:\\Windows\\powershell.exe", "C:\\Temp\\dropper", now.Add(time.Second*4)), rules.ProcessEvent))
+	require.Equal(t, int64(2), suppressed())
+	require.Len(t, rules.suppressor.suppressions, 3)
+
+	// the window expired, so the alert is sent and
+	// the number of suppressed alerts is reported
+	f := rules.filters[ktypes.CreateFile.Hash()][0]
+	ok, n := rules.suppressor.suppress(f, []*kevent.Kevent{newEvent("C:\\Windows\\system32\\cmd.exe", "C:\\Temp\\dropper", now.Add(time.Minute*2))})
+	require.False(t, ok)
+	require.Equal(t, uint64(2), n)
+	ok, n = rules.suppressor.suppress(f, []*kevent.Kevent{newEvent("C:\\Windows\\system32\\cmd.exe", "C:\\Temp\\dropper", now.Add(time.Minute*2+time.Second))})
+	require.True(t, ok)
+	require.Equal(t, uint64(0), n)
+
+	// expired suppressions are removed unless
+	// they keep track of suppressed alerts
+	rules.suppressor.gc()
+	require.Len(t, rules.suppressor.suppressions, 1)
+}
+
+func TestSuppressedRuleInvalidField(t *testing.T) {
+	psnap := new(ps.SnapshotterMock)
+	rules := NewRules(psnap, newConfig("_fixtures/suppressed_rule_invalid_field.yml"))
+	_, err := rules.Compile()
+	require.EqualError(t, err, `invalid suppression in rule "Temp file created with misspelled suppression field": "ps.exee" is not a valid field`)
+}
+
+func TestRuleExceptions(t *testing.T) {
+	psnap := new(ps.SnapshotterMock)
+	c := newConfig("_fixtures/exceptions_rule.yml")
+	c.Filters.Exceptions.FromPaths = []string{"_fixtures/exceptions/*.yml"}
+	rules := NewRules(psnap, c)
+	compileRules(t, rules)
+
+	newEvent := func(name, filename string) *kevent.Kevent {
+		return &kevent.Kevent{
+			Type:      ktypes.CreateFile,
+			Timestamp: time.Now(),
+			Name:      "CreateFile",
+			Tid:       2484,
+			PID:       859,
+			Category:  ktypes.File,
+			PS: &types.PS{
+				Name: name,
+			},
+			Kparams: kevent.Kparams{
+				kparams.FileName: {Name: kparams.FileName, Type: kparams.UnicodeString, Value: filename},
+			},
+			Metadata: make(map[kevent.MetadataKey]any),
+		}
+	}
+
+	require.True(t, wrapProcessEvent(newEvent("cmd.exe", "C:\\Temp\\dropper.exe"), rules.ProcessEvent))
+	// excluded by the rule exception
+	require.False(t, wrapProcessEvent(newEvent("msiexec.exe", "C:\\Temp\\dropper.exe"), rules.ProcessEvent))
+	// excluded by the global exception scoped by tag
+	require.False(t, wrapProcessEvent(newEvent("cmd.exe", "C:\\Temp\\setup.msi"), rules.ProcessEvent))
+	// the global exception scoped to another rule doesn't apply
+	require.True(t, wrapProcessEvent(newEvent("backup.exe", "C:\\Temp\\dropper.exe"), rules.ProcessEvent))
+
+	// exceptions don't contribute event types to the rule
+	assert.Len(t, rules.filters, 1)
+}
+
+func TestRuleExceptionsSequence(t *testing.T) {
+	f := New(`sequence
+maxspan 1m
+|kevt.name = 'CreateProcess'| by ps.uuid
+|kevt.name = 'CreateFile'| by ps.uuid
+`, newConfig(), WithExceptions(
+		config.FilterException{Expr: "ps.name = 'msiexec.exe'"},
+		config.FilterException{Expr: "kevt.name = 'OpenProcess'"},
+	))
+	require.NoError(t, f.Compile())
+
+	seq := f.GetSequence()
+	require.Len(t, seq.Expressions, 2)
+	for _, e := range seq.Expressions {
+		require.IsType(t, &ql.BinaryExpr{}, e.Expr)
+		assert.IsType(t, &ql.NotExpr{}, e.Expr.(*ql.BinaryExpr).RHS)
+	}
+	assert.Contains(t, f.GetFields(), fields.PsName)
+	assert.NotContains(t, f.GetStringFields()[fields.KevtName], "OpenProcess")
+
+	f = New("kevt.name = 'CreateFile'", newConfig(), WithExceptions(config.FilterException{Expr: "$e1.ps.name = 'cmd.exe'"}))
+	require.Error(t, f.Compile())
+}
+
+func TestRuleExceptionsFunctionsAndStrings(t *testing.T) {
+	f := New("kevt.name = 'CreateFile'", newConfig(), WithExceptions(
+		config.FilterException{Expr: "ext(file.name) = '.msi'"},
+		config.FilterException{Expr: "file.name in ('update.exe')"},
+		config.FilterException{Expr: "kevt.name = 'OpenProcess'"},
+	))
+	require.NoError(t, f.Compile())
+	assert.True(t, f.(*filter).hasFunctions)
+	assert.Contains(t, f.GetStringFields()[fields.FileName], "update.exe")
+	assert.NotContains(t, f.GetStringFields()[fields.KevtName], "OpenProcess")
+
+	newEvent := func(filename string) *kevent.Kevent {
+		return &kevent.Kevent{
+			Type:     ktypes.CreateFile,
+			Name:     "CreateFile",
+			Category: ktypes.File,
+			Kparams: kevent.Kparams{
+				kparams.FileName: {Name: kparams.FileName, Type: kparams.UnicodeString, Value: filename},
+			},
+			Metadata: make(map[kevent.MetadataKey]any),
+		}
+	}
+	assert.True(t, f.Run(newEvent("dropper.exe")))
+	assert.False(t, f.Run(newEvent("setup.msi")))
+	assert.False(t, f.Run(newEvent("update.exe")))
+}
+
 func TestComplexSequenceRule(t *testing.T) {
 	psnap := new(ps.SnapshotterMock)
 	rules := NewRules(psnap, newConfig("_fixtures/sequence_rule_complex.yml"))
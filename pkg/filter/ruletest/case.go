@@ -0,0 +1,165 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ruletest
+
+import (
+	"fmt"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"github.com/rabbitstack/fibratus/pkg/kevent/ktypes"
+	pstypes "github.com/rabbitstack/fibratus/pkg/ps/types"
+	"gopkg.in/yaml.v3"
+	"os"
+	"time"
+)
+
+// File contains test cases of a single rule.
+type File struct {
+	Tests []Case `json:"tests" yaml:"tests"`
+}
+
+// Case is the rule test case. It describes the
+// events that are fed into the rule engine and
+// the expected outcome.
+type Case struct {
+	// Name is the test case description
+	Name string `json:"name" yaml:"name"`
+	// Events is the sequence of events processed by the rule engine
+	Events []Event `json:"events" yaml:"events"`
+	// Match indicates if the rule is expected to fire
+	Match bool `json:"match" yaml:"match"`
+	// Output is the expected rule output text. If empty, the output is not asserted
+	Output string `json:"output" yaml:"output"`
+}
+
+// Event describes the event fed into the rule engine.
+type Event struct {
+	Name      string         `json:"name" yaml:"name"`
+	PID       uint32         `json:"pid" yaml:"pid"`
+	Tid       uint32         `json:"tid" yaml:"tid"`
+	Timestamp string         `json:"timestamp" yaml:"timestamp"`
+	Params    map[string]any `json:"params" yaml:"params"`
+	PS        *Process       `json:"ps" yaml:"ps"`
+}
+
+// Process describes the state of the process that generated the event.
+type Process struct {
+	PID       uint32            `json:"pid" yaml:"pid"`
+	Ppid      uint32            `json:"ppid" yaml:"ppid"`
+	Name      string            `json:"name" yaml:"name"`
+	Exe       string            `json:"exe" yaml:"exe"`
+	Cmdline   string            `json:"cmdline" yaml:"cmdline"`
+	Cwd       string            `json:"cwd" yaml:"cwd"`
+	SID       string            `json:"sid" yaml:"sid"`
+	Username  string            `json:"username" yaml:"username"`
+	Domain    string            `json:"domain" yaml:"domain"`
+	SessionID uint32            `json:"session" yaml:"session"`
+	Args      []string          `json:"args" yaml:"args"`
+	Envs      map[string]string `json:"envs" yaml:"envs"`
+	Parent    *Process          `json:"parent" yaml:"parent"`
+}
+
+// Load reads test cases from the YAML or JSON file.
+func Load(path string) (*File, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read test file %s: %v", path, err)
+	}
+	// JSON is a subset of YAML, so the
+	// same decoder handles both formats
+	var f File
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("%s is an invalid test file: %v", path, err)
+	}
+	if len(f.Tests) == 0 {
+		return nil, fmt.Errorf("%s doesn't contain any test cases", path)
+	}
+	for _, c := range f.Tests {
+		if len(c.Events) == 0 {
+			return nil, fmt.Errorf("test case %q in %s doesn't contain any events", c.Name, path)
+		}
+	}
+	return &f, nil
+}
+
+// Kevent builds the event from the event descriptor.
+// If the RFC3339 timestamp is not given, the provided
+// timestamp is assigned to the event.
+func (e Event) Kevent(seq uint64, ts time.Time) (*kevent.Kevent, error) {
+	ktype := ktypes.KeventNameToKtypes(e.Name)[0]
+	if ktype == ktypes.UnknownKtype {
+		return nil, fmt.Errorf("unknown event name: %s", e.Name)
+	}
+	if e.Timestamp != "" {
+		var err error
+		ts, err = time.Parse(time.RFC3339Nano, e.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("%s event has invalid timestamp: %v", e.Name, err)
+		}
+	}
+	kevt := &kevent.Kevent{
+		Seq:       seq,
+		PID:       e.PID,
+		Tid:       e.Tid,
+		Type:      ktype,
+		Name:      e.Name,
+		Category:  ktype.Category(),
+		Timestamp: ts,
+		Kparams:   make(kevent.Kparams),
+		Metadata:  make(map[kevent.MetadataKey]any),
+	}
+	for name, v := range e.Params {
+		kpar, err := newKparam(name, v)
+		if err != nil {
+			return nil, fmt.Errorf("%s event: %v", e.Name, err)
+		}
+		kevt.Kparams[name] = kpar
+	}
+	if e.PS != nil {
+		kevt.PS = e.PS.ps()
+		if kevt.PID == 0 {
+			kevt.PID = kevt.PS.PID
+		}
+	}
+	return kevt, nil
+}
+
+func (p *Process) ps() *pstypes.PS {
+	if p == nil {
+		return nil
+	}
+	ps := &pstypes.PS{
+		PID:       p.PID,
+		Ppid:      p.Ppid,
+		Name:      p.Name,
+		Exe:       p.Exe,
+		Cmdline:   p.Cmdline,
+		Cwd:       p.Cwd,
+		SID:       p.SID,
+		Username:  p.Username,
+		Domain:    p.Domain,
+		SessionID: p.SessionID,
+		Args:      p.Args,
+		Envs:      p.Envs,
+		Parent:    p.Parent.ps(),
+	}
+	if ps.Parent != nil && ps.Ppid == 0 {
+		ps.Ppid = ps.Parent.PID
+	}
+	return ps
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ruletest
+
+import (
+	"errors"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/rabbitstack/fibratus/pkg/filter"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"io"
+)
+
+// Explained pairs the replayed event with the explanation
+// of the rule evaluation against the event.
+type Explained struct {
+	// Event is the replayed event
+	Event *kevent.Kevent
+	// Explanation describes the rule evaluation. Sequence and
+	// threshold state reflect the events replayed so far
+	Explanation *filter.Explanation
+	// Fired indicates the rule fired after the event was processed
+	Fired bool
+}
+
+// Explain replays events from the newline-delimited JSON stream
+// through the rule engine and explains the evaluation of the rule
+// identified by the rule identifier or name against every event.
+func Explain(filters *config.Filters, rule string, r io.Reader) ([]Explained, error) {
+	cfg := replayConfig(filters)
+	rules := filter.NewRules(newSnapshotter(nil), cfg)
+	defer rules.Close()
+	rules.EnableReplay()
+	res, err := rules.Compile()
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, errors.New("no rules to explain")
+	}
+
+	var fired bool
+	rules.OnMatch(func(ctx *config.ActionContext) {
+		if ctx.Filter.ID == rule || ctx.Filter.Name == rule {
+			fired = true
+		}
+	})
+
+	explained := make([]Explained, 0)
+	dec := kevent.NewDecoder(r)
+	for {
+		kevt, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		e, err := rules.Explain(rule, kevt)
+		if err != nil {
+			return nil, err
+		}
+		fired = false
+		if _, err := rules.ProcessEvent(kevt); err != nil {
+			return nil, err
+		}
+		explained = append(explained, Explained{Event: kevt, Explanation: e, Fired: fired})
+	}
+
+	return explained, nil
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ruletest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	f, err := os.Open("_fixtures/events/events.ndjson")
+	require.NoError(t, err)
+	defer f.Close()
+
+	explained, err := Explain(newConfig().Filters, "Command shell created a temp file", f)
+	require.NoError(t, err)
+	require.Len(t, explained, 4)
+
+	e1 := explained[0]
+	assert.Equal(t, uint64(1), e1.Event.Seq)
+	assert.True(t, e1.Explanation.Evaluated)
+	assert.True(t, e1.Explanation.Match)
+	assert.False(t, e1.Fired)
+	require.NotNil(t, e1.Explanation.Sequence)
+	assert.True(t, e1.Explanation.Sequence.Steps[0].Match)
+	assert.EqualValues(t, 4143, e1.Explanation.Sequence.Steps[0].JoinKey)
+
+	e2 := explained[1]
+	assert.True(t, e2.Explanation.Match)
+	assert.True(t, e2.Fired)
+	step := e2.Explanation.Sequence.Steps[1]
+	assert.True(t, step.Reachable)
+	assert.True(t, step.Match)
+	require.Len(t, e2.Explanation.Sequence.Steps[0].Partials, 1)
+	assert.Equal(t, uint64(1), e2.Explanation.Sequence.Steps[0].Partials[0].Seq)
+
+	assert.False(t, explained[2].Fired)
+	assert.False(t, explained[3].Explanation.Match)
+
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	_, err = Explain(newConfig().Filters, "Unknown rule", f)
+	require.Error(t, err)
+}
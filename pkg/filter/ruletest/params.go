@@ -0,0 +1,191 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ruletest
+
+import (
+	"fmt"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"github.com/rabbitstack/fibratus/pkg/kevent/kparams"
+	"math"
+	"net"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// paramTypes maps the type names that can be given
+// in the explicitly typed parameter to parameter types.
+var paramTypes = map[string]kparams.Type{
+	"unicode": kparams.UnicodeString,
+	"ansi":    kparams.AnsiString,
+	"int8":    kparams.Int8,
+	"uint8":   kparams.Uint8,
+	"int16":   kparams.Int16,
+	"uint16":  kparams.Uint16,
+	"int32":   kparams.Int32,
+	"uint32":  kparams.Uint32,
+	"int64":   kparams.Int64,
+	"uint64":  kparams.Uint64,
+	"float":   kparams.Float,
+	"double":  kparams.Double,
+	"bool":    kparams.Bool,
+	"pid":     kparams.PID,
+	"tid":     kparams.TID,
+	"port":    kparams.Port,
+	"ipv4":    kparams.IPv4,
+	"ipv6":    kparams.IPv6,
+	"time":    kparams.Time,
+	"slice":   kparams.Slice,
+	"sid":     kparams.SID,
+	"path":    kparams.FilePath,
+}
+
+// newKparam builds the event parameter from the value given
+// in the test file. The parameter type is inferred from the
+// value and the parameter name, unless the value is given as
+// the map with the type and value keys, e.g.
+//
+//	size: {type: uint64, value: 1024}
+func newKparam(name string, v any) (*kevent.Kparam, error) {
+	if m, ok := v.(map[string]any); ok {
+		typ, ok := paramTypes[fmt.Sprintf("%v", m["type"])]
+		if !ok {
+			return nil, fmt.Errorf("%s parameter has unknown type %v", name, m["type"])
+		}
+		val, err := convert(typ, m["value"])
+		if err != nil {
+			return nil, fmt.Errorf("%s parameter: %v", name, err)
+		}
+		return &kevent.Kparam{Name: name, Type: typ, Value: val}, nil
+	}
+	typ := inferType(name, v)
+	val, err := convert(typ, v)
+	if err != nil {
+		return nil, fmt.Errorf("%s parameter: %v", name, err)
+	}
+	return &kevent.Kparam{Name: name, Type: typ, Value: val}, nil
+}
+
+// inferType determines the parameter type from the
+// well-known parameter names or the value type.
+func inferType(name string, v any) kparams.Type {
+	switch name {
+	case kparams.ProcessID, kparams.ProcessParentID, kparams.ProcessRealParentID, kparams.TargetProcessID:
+		return kparams.PID
+	case kparams.ThreadID:
+		return kparams.TID
+	case kparams.NetDport, kparams.NetSport:
+		return kparams.Port
+	case kparams.NetDIP, kparams.NetSIP:
+		if ip := net.ParseIP(fmt.Sprintf("%v", v)); ip != nil && ip.To4() == nil {
+			return kparams.IPv6
+		}
+		return kparams.IPv4
+	}
+	switch v.(type) {
+	case bool:
+		return kparams.Bool
+	case int, int64:
+		if reflect.ValueOf(v).Int() < 0 {
+			return kparams.Int64
+		}
+		return kparams.Uint32
+	case uint64:
+		if v.(uint64) > math.MaxUint32 {
+			return kparams.Uint64
+		}
+		return kparams.Uint32
+	case float64:
+		return kparams.Double
+	case time.Time:
+		return kparams.Time
+	case []any:
+		return kparams.Slice
+	default:
+		return kparams.UnicodeString
+	}
+}
+
+// convert coerces the value to the Go type
+// expected by the given parameter type.
+func convert(typ kparams.Type, v any) (kparams.Value, error) {
+	s := fmt.Sprintf("%v", v)
+	switch typ {
+	case kparams.Int8, kparams.Int16, kparams.Int32, kparams.Int64:
+		n, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case kparams.Int8:
+			return int8(n), nil
+		case kparams.Int16:
+			return int16(n), nil
+		case kparams.Int32:
+			return int32(n), nil
+		default:
+			return n, nil
+		}
+	case kparams.Uint8, kparams.Uint16, kparams.Port, kparams.Uint32, kparams.PID, kparams.TID, kparams.Uint64:
+		n, err := strconv.ParseUint(s, 0, 64)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case kparams.Uint8:
+			return uint8(n), nil
+		case kparams.Uint16, kparams.Port:
+			return uint16(n), nil
+		case kparams.Uint32, kparams.PID, kparams.TID:
+			return uint32(n), nil
+		default:
+			return n, nil
+		}
+	case kparams.Float:
+		n, err := strconv.ParseFloat(s, 32)
+		return float32(n), err
+	case kparams.Double:
+		return strconv.ParseFloat(s, 64)
+	case kparams.Bool:
+		return strconv.ParseBool(s)
+	case kparams.IPv4, kparams.IPv6:
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address: %s", s)
+		}
+		return ip, nil
+	case kparams.Time:
+		if t, ok := v.(time.Time); ok {
+			return t, nil
+		}
+		return time.Parse(time.RFC3339, s)
+	case kparams.Slice:
+		items, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("expected list value but got %T", v)
+		}
+		vals := make([]string, 0, len(items))
+		for _, item := range items {
+			vals = append(vals, fmt.Sprintf("%v", item))
+		}
+		return vals, nil
+	default:
+		return s, nil
+	}
+}
@@ -0,0 +1,216 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ruletest runs rule test cases. Test cases are declared
+// in YAML or JSON files located next to the rule file. Each test
+// case describes the events that are fed into the rule engine and
+// whether the rule is expected to fire on those events. The package
+// also simulates the whole ruleset against the recorded event log.
+package ruletest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/rabbitstack/fibratus/pkg/filter"
+	"github.com/rabbitstack/fibratus/pkg/ps"
+	pstypes "github.com/rabbitstack/fibratus/pkg/ps/types"
+	"github.com/stretchr/testify/mock"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// testExts contains the extensions of the test files
+var testExts = []string{".test.yml", ".test.yaml", ".test.json"}
+
+// Result represents the outcome of a single test case.
+type Result struct {
+	// Rule is the name of the tested rule
+	Rule string
+	// File is the path of the rule file
+	File string
+	// Case is the test case name
+	Case string
+	// Err contains the reason of the test case failure
+	Err error
+}
+
+// Passed indicates if the test case passed.
+func (r Result) Passed() bool { return r.Err == nil }
+
+// Test pairs the rule file with its test file.
+type Test struct {
+	RuleFile string
+	TestFile string
+}
+
+// Discover finds all rule files in the given paths
+// that have the accompanying test file. Paths can
+// contain glob patterns.
+func Discover(paths []string) ([]Test, error) {
+	tests := make([]Test, 0)
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		files, err := filepath.Glob(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			ext := filepath.Ext(file)
+			if (ext != ".yml" && ext != ".yaml") || config.IsRuleTestFile(file) || seen[file] {
+				continue
+			}
+			seen[file] = true
+			base := strings.TrimSuffix(file, ext)
+			for _, testExt := range testExts {
+				if _, err := os.Stat(base + testExt); err == nil {
+					tests = append(tests, Test{RuleFile: file, TestFile: base + testExt})
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(tests, func(i, j int) bool { return tests[i].RuleFile < tests[j].RuleFile })
+	return tests, nil
+}
+
+// Runner executes rule test cases.
+type Runner struct {
+	filters *config.Filters
+}
+
+// NewRunner creates a new test runner. Macros, lookup lists, and
+// global exceptions are loaded from the filters of the given config.
+func NewRunner(c *config.Config) *Runner {
+	return &Runner{filters: c.Filters}
+}
+
+// Run executes all test cases of the rule.
+func (r *Runner) Run(t Test) ([]Result, error) {
+	f, err := Load(t.TestFile)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, 0, len(f.Tests))
+	for i, c := range f.Tests {
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("test #%d", i+1)
+		}
+		rule, err := r.runCase(t.RuleFile, c)
+		results = append(results, Result{Rule: rule, File: t.RuleFile, Case: name, Err: err})
+	}
+	return results, nil
+}
+
+// runCase compiles the rule in the isolated rule engine, so the
+// state of sequence or threshold rules is not shared between test
+// cases, and feeds all test case events into the engine. Returns
+// the rule name and the error if the test case fails.
+func (r *Runner) runCase(path string, c Case) (string, error) {
+	cfg := replayConfig(&config.Filters{
+		Rules:      config.Rules{FromPaths: []string{path}},
+		Macros:     r.filters.Macros,
+		Lists:      r.filters.Lists,
+		Exceptions: r.filters.Exceptions,
+	})
+
+	rules := filter.NewRules(newSnapshotter(c.Events), cfg)
+	defer rules.Close()
+	rules.EnableReplay()
+	if _, err := rules.Compile(); err != nil {
+		return "", err
+	}
+	filters := cfg.GetFilters()
+	if len(filters) == 0 {
+		return "", fmt.Errorf("no rule found in %s", path)
+	}
+	rule := filters[0]
+	if rule.IsDisabled() {
+		return rule.Name, errors.New("rule is disabled")
+	}
+
+	var matches []*config.ActionContext
+	rules.OnMatch(func(ctx *config.ActionContext) {
+		matches = append(matches, ctx)
+	})
+
+	// events without the timestamp are
+	// spaced one millisecond apart
+	ts := time.Now()
+	for i, e := range c.Events {
+		kevt, err := e.Kevent(uint64(i+1), ts.Add(time.Millisecond))
+		if err != nil {
+			return rule.Name, err
+		}
+		ts = kevt.Timestamp
+		if _, err := rules.ProcessEvent(kevt); err != nil {
+			return rule.Name, err
+		}
+	}
+
+	switch {
+	case c.Match && len(matches) == 0:
+		return rule.Name, errors.New("expected the rule to match, but it didn't")
+	case !c.Match && len(matches) > 0:
+		return rule.Name, fmt.Errorf("expected the rule not to match, but it matched %d time(s)", len(matches))
+	}
+	if c.Match && c.Output != "" {
+		if matches[0].Output != c.Output {
+			return rule.Name, fmt.Errorf("expected output %q, but got %q", c.Output, matches[0].Output)
+		}
+	}
+	return rule.Name, nil
+}
+
+// replayConfig builds the config of the rule
+// engine that processes the replayed events.
+func replayConfig(filters *config.Filters) *config.Config {
+	return &config.Config{
+		// enable all accessors
+		Kstream: config.KstreamConfig{
+			EnableThreadKevents:   true,
+			EnableImageKevents:    true,
+			EnableFileIOKevents:   true,
+			EnableRegistryKevents: true,
+			EnableNetKevents:      true,
+			EnableHandleKevents:   true,
+			EnableMemKevents:      true,
+			EnableDNSEvents:       true,
+		},
+		Filters: filters,
+	}
+}
+
+// newSnapshotter creates the mock process snapshotter
+// populated with the processes of all test case events.
+func newSnapshotter(events []Event) ps.Snapshotter {
+	psnap := new(ps.SnapshotterMock)
+	for _, e := range events {
+		for p := e.PS.ps(); p != nil; p = p.Parent {
+			psnap.On("Find", p.PID).Return(true, p)
+			psnap.On("FindAndPut", p.PID).Return(p)
+		}
+	}
+	psnap.On("Find", mock.Anything).Return(false, (*pstypes.PS)(nil))
+	psnap.On("FindAndPut", mock.Anything).Return((*pstypes.PS)(nil))
+	return psnap
+}
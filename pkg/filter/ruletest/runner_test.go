@@ -0,0 +1,123 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ruletest
+
+import (
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/rabbitstack/fibratus/pkg/kevent/kparams"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func newConfig() *config.Config {
+	return &config.Config{
+		Filters: &config.Filters{
+			Rules:  config.Rules{FromPaths: []string{"_fixtures/*"}},
+			Macros: config.Macros{FromPaths: []string{"_fixtures/macros/*.yml"}},
+		},
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	tests, err := Discover(newConfig().Filters.Rules.FromPaths)
+	require.NoError(t, err)
+	require.Len(t, tests, 2)
+	assert.Equal(t, Test{RuleFile: filepath.Join("_fixtures", "spawn_cmd.yml"), TestFile: filepath.Join("_fixtures", "spawn_cmd.test.yml")}, tests[0])
+	assert.Equal(t, Test{RuleFile: filepath.Join("_fixtures", "temp_file_sequence.yml"), TestFile: filepath.Join("_fixtures", "temp_file_sequence.test.json")}, tests[1])
+}
+
+func TestRun(t *testing.T) {
+	c := newConfig()
+	tests, err := Discover(c.Filters.Rules.FromPaths)
+	require.NoError(t, err)
+
+	runner := NewRunner(c)
+
+	results, err := runner.Run(tests[0])
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+
+	for _, res := range results {
+		assert.Equal(t, "Command shell spawned by Office application", res.Rule)
+	}
+	assert.True(t, results[0].Passed(), results[0].Err)
+	assert.True(t, results[1].Passed(), results[1].Err)
+	require.False(t, results[2].Passed())
+	assert.EqualError(t, results[2].Err, `expected output "excel.exe spawned powershell.exe", but got "excel.exe spawned cmd.exe /c whoami"`)
+	require.False(t, results[3].Passed())
+	assert.EqualError(t, results[3].Err, "expected the rule not to match, but it matched 1 time(s)")
+
+	results, err = runner.Run(tests[1])
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	for _, res := range results {
+		assert.True(t, res.Passed(), res.Err)
+	}
+}
+
+func TestRunWithListsAndExceptions(t *testing.T) {
+	c := newConfig()
+	c.Filters.Lists = []config.List{{Name: "shells", Path: "_fixtures/lists/shells.txt"}}
+	c.Filters.Exceptions = config.Exceptions{FromPaths: []string{"_fixtures/lists/exceptions.yml"}}
+	tests, err := Discover([]string{"_fixtures/lists/*"})
+	require.NoError(t, err)
+	require.Len(t, tests, 1)
+
+	results, err := NewRunner(c).Run(tests[0])
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	for _, res := range results {
+		assert.True(t, res.Passed(), res.Err)
+	}
+}
+
+func TestNewKparam(t *testing.T) {
+	var tests = []struct {
+		name string
+		v    any
+		typ  kparams.Type
+		val  kparams.Value
+	}{
+		{kparams.ProcessID, 4143, kparams.PID, uint32(4143)},
+		{kparams.NetDport, 443, kparams.Port, uint16(443)},
+		{kparams.NetDIP, "216.58.201.174", kparams.IPv4, net.ParseIP("216.58.201.174")},
+		{kparams.NetSIP, "fe80::1", kparams.IPv6, net.ParseIP("fe80::1")},
+		{kparams.FileName, "C:\\Temp\\dropper.exe", kparams.UnicodeString, "C:\\Temp\\dropper.exe"},
+		{kparams.FileIsDLL, true, kparams.Bool, true},
+		{kparams.FileOffset, map[string]any{"type": "uint64", "value": 1024}, kparams.Uint64, uint64(1024)},
+		{kparams.DNSAnswers, []any{"1.1.1.1", "8.8.8.8"}, kparams.Slice, []string{"1.1.1.1", "8.8.8.8"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kpar, err := newKparam(tt.name, tt.v)
+			require.NoError(t, err)
+			assert.Equal(t, tt.typ, kpar.Type)
+			assert.Equal(t, tt.val, kpar.Value)
+		})
+	}
+
+	_, err := newKparam(kparams.FileOffset, map[string]any{"type": "uint128", "value": 1024})
+	require.Error(t, err)
+	_, err = newKparam(kparams.ProcessID, "cmd.exe")
+	require.Error(t, err)
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ruletest
+
+import (
+	"errors"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/rabbitstack/fibratus/pkg/filter"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Hits summarizes the matches of a single rule.
+type Hits struct {
+	// Rule is the rule name
+	Rule string
+	// ID is the rule identifier
+	ID string
+	// Count is the number of rule matches
+	Count int
+	// First is the timestamp of the event that triggered the first match
+	First time.Time
+	// Last is the timestamp of the event that triggered the last match
+	Last time.Time
+	// Samples contains the events of the first matches
+	Samples [][]*kevent.Kevent
+}
+
+// Pending describes the sequence rule that matched some of its
+// expressions, but was still awaiting the remaining events, or
+// the end of the time window of the negated expression, when
+// the replay finished.
+type Pending struct {
+	// Rule is the sequence rule name
+	Rule string
+	// Partials contains the matched events keyed by the sequence slot
+	Partials map[uint16][]*kevent.Kevent
+	// Absences contains the matched events of the negated sequence
+	// for which the negated event didn't occur within the replayed
+	// events, but the time window hasn't elapsed either
+	Absences [][]*kevent.Kevent
+}
+
+// Report is the outcome of the simulation.
+type Report struct {
+	// Events is the number of replayed events
+	Events int
+	// Rules is the number of compiled rules
+	Rules int
+	// Hits contains matched rules ordered by the number of matches
+	Hits []*Hits
+	// Pending contains sequence rules with outstanding partials
+	Pending []Pending
+	// Duration is the time elapsed while replaying events
+	Duration time.Duration
+}
+
+// Simulator replays recorded events through the rule engine and
+// reports all rule matches. Rule actions are never executed, so
+// the simulation can be used to assess the false positive rate
+// of the ruleset before it is deployed.
+type Simulator struct {
+	filters *config.Filters
+	samples int
+}
+
+// NewSimulator creates the simulator that compiles rules, macros, and
+// exceptions from the given filters config. Up to samples matches are
+// retained for each rule.
+func NewSimulator(filters *config.Filters, samples int) *Simulator {
+	return &Simulator{filters: filters, samples: samples}
+}
+
+// Run compiles the ruleset and feeds all events from the
+// newline-delimited JSON stream into the rule engine.
+func (s *Simulator) Run(r io.Reader) (*Report, error) {
+	cfg := replayConfig(s.filters)
+	rules := filter.NewRules(newSnapshotter(nil), cfg)
+	defer rules.Close()
+	rules.EnableReplay()
+	res, err := rules.Compile()
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, errors.New("no rules to simulate")
+	}
+
+	report := &Report{Rules: len(cfg.GetFilters())}
+	hits := make(map[string]*Hits)
+	var mu sync.Mutex
+	rules.OnMatch(func(ctx *config.ActionContext) {
+		mu.Lock()
+		defer mu.Unlock()
+		f := ctx.Filter
+		h, ok := hits[f.Name]
+		if !ok {
+			h = &Hits{Rule: f.Name, ID: f.ID}
+			hits[f.Name] = h
+		}
+		h.Count++
+		ts := triggeredAt(ctx.Events)
+		if h.First.IsZero() || ts.Before(h.First) {
+			h.First = ts
+		}
+		if ts.After(h.Last) {
+			h.Last = ts
+		}
+		if len(h.Samples) < s.samples {
+			h.Samples = append(h.Samples, ctx.Events)
+		}
+	})
+
+	start := time.Now()
+	dec := kevent.NewDecoder(r)
+	for {
+		kevt, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		report.Events++
+		if _, err := rules.ProcessEvent(kevt); err != nil {
+			return nil, err
+		}
+	}
+	report.Duration = time.Since(start)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, h := range hits {
+		report.Hits = append(report.Hits, h)
+	}
+	sort.Slice(report.Hits, func(i, j int) bool {
+		if report.Hits[i].Count == report.Hits[j].Count {
+			return report.Hits[i].Rule < report.Hits[j].Rule
+		}
+		return report.Hits[i].Count > report.Hits[j].Count
+	})
+	pending := make(map[string]*Pending)
+	for rule, partials := range rules.Partials() {
+		pending[rule] = &Pending{Rule: rule, Partials: partials}
+	}
+	for rule, absences := range rules.Absences() {
+		if pending[rule] == nil {
+			pending[rule] = &Pending{Rule: rule}
+		}
+		pending[rule].Absences = absences
+	}
+	for _, p := range pending {
+		report.Pending = append(report.Pending, *p)
+	}
+	sort.Slice(report.Pending, func(i, j int) bool { return report.Pending[i].Rule < report.Pending[j].Rule })
+
+	return report, nil
+}
+
+// triggeredAt returns the timestamp of the most recent
+// event, i.e. the event that triggered the rule.
+func triggeredAt(evts []*kevent.Kevent) time.Time {
+	var ts time.Time
+	for _, e := range evts {
+		if e.Timestamp.After(ts) {
+			ts = e.Timestamp
+		}
+	}
+	return ts
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ruletest
+
+import (
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSimulate(t *testing.T) {
+	f, err := os.Open("_fixtures/events/events.ndjson")
+	require.NoError(t, err)
+	defer f.Close()
+
+	report, err := NewSimulator(newConfig().Filters, 1).Run(f)
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, report.Events)
+	assert.Equal(t, 2, report.Rules)
+	require.Len(t, report.Hits, 2)
+
+	spawn := report.Hits[0]
+	assert.Equal(t, "Command shell spawned by Office application", spawn.Rule)
+	assert.Equal(t, "8a1c3e0d-6b7f-4d21-9c2e-5f8a0b9d3e72", spawn.ID)
+	assert.Equal(t, 2, spawn.Count)
+	assert.Equal(t, time.Date(2024, 2, 1, 10, 0, 0, 100000000, time.UTC), spawn.First.UTC())
+	assert.Equal(t, time.Date(2024, 2, 1, 11, 30, 0, 0, time.UTC), spawn.Last.UTC())
+	require.Len(t, spawn.Samples, 1)
+	assert.Equal(t, uint64(1), spawn.Samples[0][0].Seq)
+
+	seq := report.Hits[1]
+	assert.Equal(t, "Command shell created a temp file", seq.Rule)
+	assert.Equal(t, 1, seq.Count)
+	require.Len(t, seq.Samples, 1)
+	require.Len(t, seq.Samples[0], 2)
+	assert.Equal(t, uint64(2), seq.Samples[0][1].Seq)
+
+	// the partial of the third event is dropped as the
+	// timestamp of the last event is past the max span
+	require.Len(t, report.Pending, 0)
+
+	report, err = NewSimulator(newConfig().Filters, 1).Run(strings.NewReader(readEvents(t, 3)))
+	require.NoError(t, err)
+	require.Len(t, report.Pending, 1)
+	assert.Equal(t, "Command shell created a temp file", report.Pending[0].Rule)
+	require.Len(t, report.Pending[0].Partials[1], 1)
+	assert.Equal(t, uint64(3), report.Pending[0].Partials[1][0].Seq)
+}
+
+func TestSimulateMaxSpan(t *testing.T) {
+	// the file is created after the one minute max span
+	evts := strings.Replace(readEvents(t, 2), "2024-02-01T10:00:02.500Z", "2024-02-01T10:01:30Z", 1)
+	report, err := NewSimulator(newConfig().Filters, 1).Run(strings.NewReader(evts))
+	require.NoError(t, err)
+	require.Len(t, report.Hits, 1)
+	assert.Equal(t, "Command shell spawned by Office application", report.Hits[0].Rule)
+	assert.Len(t, report.Pending, 0)
+}
+
+func TestSimulateNegatedSequence(t *testing.T) {
+	filters := &config.Filters{Rules: config.Rules{FromPaths: []string{"_fixtures/simulate/*.yml"}}}
+
+	report, err := NewSimulator(filters, 1).Run(strings.NewReader(readEvents(t, 4)))
+	require.NoError(t, err)
+	require.Len(t, report.Hits, 1)
+	assert.Equal(t, 1, report.Hits[0].Count)
+	assert.Equal(t, uint64(3), report.Hits[0].Samples[0][0].Seq)
+	assert.Len(t, report.Pending, 0)
+
+	// the time window of the absence hasn't elapsed
+	// when the replay finishes at the third event
+	report, err = NewSimulator(filters, 1).Run(strings.NewReader(readEvents(t, 3)))
+	require.NoError(t, err)
+	require.Len(t, report.Hits, 0)
+	require.Len(t, report.Pending, 1)
+	assert.Equal(t, "Command shell spawned without file activity", report.Pending[0].Rule)
+	require.Len(t, report.Pending[0].Absences, 1)
+	assert.Equal(t, uint64(3), report.Pending[0].Absences[0][0].Seq)
+}
+
+// readEvents returns the first n events of the event log fixture.
+func readEvents(t *testing.T, n int) string {
+	b, err := os.ReadFile("_fixtures/events/events.ndjson")
+	require.NoError(t, err)
+	lines := strings.SplitAfter(string(b), "\n")
+	require.GreaterOrEqual(t, len(lines), n)
+	return strings.Join(lines[:n], "")
+}
+
+func TestSimulateInvalidEvents(t *testing.T) {
+	_, err := NewSimulator(newConfig().Filters, 1).Run(strings.NewReader(`{"name": "SpawnProcess"}`))
+	require.EqualError(t, err, "invalid event #1: unknown event name: SpawnProcess")
+}
@@ -0,0 +1,322 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sigma
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// node is the node of the boolean expression tree
+// built from Sigma search identifiers and condition.
+type node interface{}
+
+// leaf is the single comparison rendered in the filter language
+type leaf string
+
+// and is the conjunction of nodes
+type and []node
+
+// or is the disjunction of nodes
+type or []node
+
+// not negates the node
+type not struct{ n node }
+
+// normalize flattens nested conjunctions and disjunctions, removes double
+// negations and rearranges the operands, so the negated operand is always
+// the last one in the group. The filter language parses everything that
+// follows the `not` operator as the negated expression, and it doesn't
+// accept the leading `not`. Multiple negated operands are merged into a
+// single negation by applying De Morgan's laws.
+func normalize(n node) node {
+	switch n := n.(type) {
+	case not:
+		c := normalize(n.n)
+		if c, ok := c.(not); ok {
+			return c.n
+		}
+		return not{c}
+	case and:
+		pos, neg := split(n)
+		if len(neg) > 1 {
+			neg = []node{not{or(unwrap(neg))}}
+		}
+		return group(pos, neg, func(nodes []node) node { return and(nodes) })
+	case or:
+		pos, neg := split(n)
+		if len(neg) > 1 {
+			neg = []node{not{and(unwrap(neg))}}
+		}
+		return group(pos, neg, func(nodes []node) node { return or(nodes) })
+	}
+	return n
+}
+
+// split normalizes and flattens the operands of the conjunction
+// or disjunction, and divides them into positive and negated ones.
+func split(n node) (pos []node, neg []node) {
+	var nodes []node
+	switch n := n.(type) {
+	case and:
+		nodes = n
+	case or:
+		nodes = n
+	}
+	for _, c := range nodes {
+		c = normalize(c)
+		switch c := c.(type) {
+		case not:
+			neg = append(neg, c)
+			continue
+		case and:
+			if _, ok := n.(and); ok {
+				p, ng := split(c)
+				pos, neg = append(pos, p...), append(neg, ng...)
+				continue
+			}
+		case or:
+			if _, ok := n.(or); ok {
+				p, ng := split(c)
+				pos, neg = append(pos, p...), append(neg, ng...)
+				continue
+			}
+		}
+		pos = append(pos, c)
+	}
+	return pos, neg
+}
+
+func unwrap(neg []node) []node {
+	nodes := make([]node, len(neg))
+	for i, n := range neg {
+		nodes[i] = n.(not).n
+	}
+	return nodes
+}
+
+func group(pos, neg []node, fn func([]node) node) node {
+	nodes := append(pos, neg...)
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+	return fn(nodes)
+}
+
+// render produces the filter expression from the normalized node.
+// The operands of the top-level conjunction are joined with sep.
+func render(n node, sep string) string {
+	switch n := n.(type) {
+	case leaf:
+		return string(n)
+	case not:
+		return "not (" + render(n.n, " and ") + ")"
+	case and:
+		return join(n, sep)
+	case or:
+		return join(n, " or ")
+	}
+	return ""
+}
+
+func join(nodes []node, sep string) string {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		switch n.(type) {
+		case and, or:
+			parts[i] = "(" + render(n, " and ") + ")"
+		default:
+			parts[i] = render(n, " and ")
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+// conditionParser is the recursive descent parser of the
+// Sigma condition. The precedence of operators from the
+// highest to the lowest is: not, and, or.
+type conditionParser struct {
+	toks     []string
+	pos      int
+	searches map[string]node
+	// ids are search identifiers in the declaration order
+	ids []string
+}
+
+func parseCondition(cond string, ids []string, searches map[string]node) (node, error) {
+	p := &conditionParser{toks: tokenize(cond), ids: ids, searches: searches}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok != "" {
+		if tok == "|" {
+			return nil, fmt.Errorf("aggregation expressions are not supported")
+		}
+		return nil, fmt.Errorf("unexpected %q in condition", tok)
+	}
+	return n, nil
+}
+
+func tokenize(cond string) []string {
+	var toks []string
+	var b strings.Builder
+	flush := func() {
+		if b.Len() > 0 {
+			toks = append(toks, b.String())
+			b.Reset()
+		}
+	}
+	for _, r := range cond {
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case r == '(' || r == ')' || r == '|':
+			flush()
+			toks = append(toks, string(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	flush()
+	return toks
+}
+
+func (p *conditionParser) peek() string {
+	if p.pos >= len(p.toks) {
+		return ""
+	}
+	return p.toks[p.pos]
+}
+
+func (p *conditionParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *conditionParser) parseOr() (node, error) {
+	n, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	nodes := or{n}
+	for strings.EqualFold(p.peek(), "or") {
+		p.next()
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *conditionParser) parseAnd() (node, error) {
+	n, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	nodes := and{n}
+	for strings.EqualFold(p.peek(), "and") {
+		p.next()
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *conditionParser) parseNot() (node, error) {
+	if strings.EqualFold(p.peek(), "not") {
+		p.next()
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return not{n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *conditionParser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of condition")
+	case tok == "(":
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis in condition")
+		}
+		return n, nil
+	case tok == "1" || strings.EqualFold(tok, "all") || strings.EqualFold(tok, "any"):
+		if !strings.EqualFold(p.next(), "of") {
+			return nil, fmt.Errorf("expected 'of' after %q in condition", tok)
+		}
+		nodes, err := p.match(p.next())
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(tok, "all") {
+			return and(nodes), nil
+		}
+		return or(nodes), nil
+	}
+	n, ok := p.searches[tok]
+	if !ok {
+		return nil, fmt.Errorf("unknown search identifier %q in condition", tok)
+	}
+	return n, nil
+}
+
+// match returns the searches whose identifiers match the pattern. The
+// `them` keyword matches all searches except those starting with the
+// underscore.
+func (p *conditionParser) match(pattern string) ([]node, error) {
+	var nodes []node
+	for _, id := range p.ids {
+		if pattern == "them" {
+			if !strings.HasPrefix(id, "_") {
+				nodes = append(nodes, p.searches[id])
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, id); ok {
+			nodes = append(nodes, p.searches[id])
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no search identifiers match %q in condition", pattern)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sigma
+
+// kind determines how the field values are rendered in the condition
+type kind uint8
+
+const (
+	// str is the string field compared with case-insensitive operators
+	str kind = iota
+	// num is the numeric field
+	num
+	// ip is the IP address field
+	ip
+)
+
+// field is the Fibratus field the Sigma field maps to
+type field struct {
+	name string
+	kind kind
+}
+
+// logsource describes the events of the Sigma log source category
+type logsource struct {
+	// cond is the expression that selects the events of the log source
+	cond string
+	// fields overrides the default field mappings
+	fields map[string]field
+}
+
+// defaultFields maps Sigma field names to Fibratus fields.
+var defaultFields = map[string]field{
+	"Image":             {"ps.exe", str},
+	"CommandLine":       {"ps.cmdline", str},
+	"ParentImage":       {"ps.parent.exe", str},
+	"ParentCommandLine": {"ps.parent.cmdline", str},
+	"CurrentDirectory":  {"ps.cwd", str},
+	"ProcessId":         {"ps.pid", num},
+	"ParentProcessId":   {"ps.parent.pid", num},
+	"User":              {"ps.username", str},
+	"OriginalFileName":  {"pe.file.name", str},
+	"TargetFilename":    {"file.name", str},
+	"ImageLoaded":       {"image.name", str},
+	"DestinationIp":     {"net.dip", ip},
+	"DestinationPort":   {"net.dport", num},
+	"SourceIp":          {"net.sip", ip},
+	"SourcePort":        {"net.sport", num},
+	"TargetObject":      {"registry.key.name", str},
+	"Details":           {"registry.value", str},
+	"QueryName":         {"dns.name", str},
+	"SourceImage":       {"ps.exe", str},
+	"TargetImage":       {"ps.child.exe", str},
+	"GrantedAccess":     {"ps.access.mask", str},
+}
+
+// logsources maps Sigma log source categories to Fibratus events.
+// On process creation events, the ps.* fields refer to the parent
+// process, while the ps.child.* fields refer to the created process,
+// so process fields are remapped for this category.
+var logsources = map[string]logsource{
+	"process_creation": {
+		cond: "kevt.name = 'CreateProcess'",
+		fields: map[string]field{
+			"Image":             {"ps.child.exe", str},
+			"CommandLine":       {"ps.child.cmdline", str},
+			"ProcessId":         {"ps.child.pid", num},
+			"User":              {"ps.child.username", str},
+			"OriginalFileName":  {"pe.ps.child.file.name", str},
+			"ParentImage":       {"ps.exe", str},
+			"ParentCommandLine": {"ps.cmdline", str},
+			"ParentProcessId":   {"ps.pid", num},
+		},
+	},
+	"process_access":     {cond: "kevt.name = 'OpenProcess'"},
+	"file_event":         {cond: "kevt.name = 'CreateFile'"},
+	"file_delete":        {cond: "kevt.name = 'DeleteFile'"},
+	"file_rename":        {cond: "kevt.name = 'RenameFile'"},
+	"image_load":         {cond: "kevt.name = 'LoadImage'"},
+	"network_connection": {cond: "kevt.name = 'Connect'"},
+	"dns_query":          {cond: "kevt.name = 'QueryDns'"},
+	"registry_add":       {cond: "kevt.name = 'RegCreateKey'"},
+	"registry_set":       {cond: "kevt.name = 'RegSetValue'"},
+	"registry_delete":    {cond: "kevt.name in ('RegDeleteKey', 'RegDeleteValue')"},
+	"registry_event":     {cond: "kevt.category = 'registry'"},
+}
+
+// lookup resolves the Fibratus field for the Sigma field name.
+func (l logsource) lookup(name string) (field, bool) {
+	if f, ok := l.fields[name]; ok {
+		return f, true
+	}
+	f, ok := defaultFields[name]
+	return f, ok
+}
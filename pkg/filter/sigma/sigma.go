@@ -0,0 +1,393 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package sigma converts Sigma rules to Fibratus rules. The log source
+// of the Sigma rule determines the event the rule is evaluated on, and
+// the detection section is translated into the filter expression.
+// Sigma constructs that have no equivalent in the filter language are
+// reported, and the rule is not converted.
+package sigma
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"gopkg.in/yaml.v3"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// minEngineVersion is the minimum engine version of the converted rules
+const minEngineVersion = "2.0.0"
+
+// Rule is the Sigma rule.
+type Rule struct {
+	Title          string    `yaml:"title"`
+	ID             string    `yaml:"id"`
+	Status         string    `yaml:"status"`
+	Description    string    `yaml:"description"`
+	References     []string  `yaml:"references"`
+	Author         string    `yaml:"author"`
+	Tags           []string  `yaml:"tags"`
+	Logsource      Logsource `yaml:"logsource"`
+	Detection      yaml.Node `yaml:"detection"`
+	Falsepositives []string  `yaml:"falsepositives"`
+	Level          string    `yaml:"level"`
+}
+
+// Logsource describes the log data the Sigma rule is applied on.
+type Logsource struct {
+	Category string `yaml:"category"`
+	Product  string `yaml:"product"`
+	Service  string `yaml:"service"`
+}
+
+// UnsupportedError is returned when the Sigma rule contains
+// constructs that can't be translated to the filter language.
+type UnsupportedError struct {
+	// Rule is the Sigma rule title
+	Rule string
+	// Reasons enumerates all untranslatable constructs
+	Reasons []string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%q rule can't be converted: %s", e.Rule, strings.Join(e.Reasons, "; "))
+}
+
+// Load reads the Sigma rule from the file.
+func Load(path string) (*Rule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read Sigma rule %s: %v", path, err)
+	}
+	r, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return r, nil
+}
+
+// Parse decodes the Sigma rule from the YAML document.
+func Parse(b []byte) (*Rule, error) {
+	var r Rule
+	if err := yaml.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("invalid Sigma rule: %v", err)
+	}
+	if r.Title == "" {
+		return nil, fmt.Errorf("invalid Sigma rule: missing title")
+	}
+	if r.Detection.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("invalid Sigma rule: missing detection")
+	}
+	return &r, nil
+}
+
+// converter accumulates untranslatable constructs
+// while converting the detection section.
+type converter struct {
+	ls      logsource
+	reasons []string
+}
+
+func (c *converter) unsupported(format string, args ...any) {
+	c.reasons = append(c.reasons, fmt.Sprintf(format, args...))
+}
+
+// Convert translates the Sigma rule to the Fibratus rule. If the rule
+// contains constructs that can't be translated, UnsupportedError is
+// returned with all the reasons.
+func Convert(r *Rule) (*config.FilterConfig, error) {
+	c := &converter{}
+	ls, ok := logsources[r.Logsource.Category]
+	switch {
+	case r.Logsource.Product != "" && r.Logsource.Product != "windows":
+		c.unsupported("%s product is not supported", r.Logsource.Product)
+	case r.Logsource.Category == "":
+		c.unsupported("log source without category is not supported")
+	case !ok:
+		c.unsupported("%s log source category is not supported", r.Logsource.Category)
+	}
+	c.ls = ls
+
+	var cond string
+	var ids []string
+	searches := make(map[string]node)
+	for i := 0; i+1 < len(r.Detection.Content); i += 2 {
+		key, val := r.Detection.Content[i].Value, r.Detection.Content[i+1]
+		switch key {
+		case "condition":
+			cond = c.condition(val)
+		case "timeframe":
+			c.unsupported("timeframe is not supported")
+		default:
+			ids = append(ids, key)
+			searches[key] = c.search(key, val)
+		}
+	}
+	if cond == "" {
+		c.unsupported("detection has no condition")
+	}
+
+	var expr node
+	if len(c.reasons) == 0 {
+		n, err := parseCondition(cond, ids, searches)
+		if err != nil {
+			c.unsupported("%v", err)
+		} else {
+			expr = normalize(and{leaf(ls.cond), n})
+		}
+	}
+	if len(c.reasons) > 0 {
+		return nil, &UnsupportedError{Rule: r.Title, Reasons: c.reasons}
+	}
+
+	id := r.ID
+	if id == "" {
+		id = uuid.New().String()
+	}
+	return &config.FilterConfig{
+		Name:             r.Title,
+		ID:               id,
+		Version:          "1.0.0",
+		Description:      description(r),
+		Condition:        render(expr, "\n  and\n"),
+		Severity:         severity(r.Level),
+		Labels:           labels(r.Tags),
+		References:       r.References,
+		MinEngineVersion: minEngineVersion,
+	}, nil
+}
+
+// condition returns the condition expression. Multiple
+// conditions given as a list are OR-ed.
+func (c *converter) condition(n *yaml.Node) string {
+	var conds []string
+	switch n.Kind {
+	case yaml.ScalarNode:
+		conds = []string{n.Value}
+	case yaml.SequenceNode:
+		for _, item := range n.Content {
+			conds = append(conds, "("+item.Value+")")
+		}
+	}
+	return strings.Join(conds, " or ")
+}
+
+// search translates the search identifier. The map of field
+// conditions is AND-ed, and the list of maps is OR-ed.
+func (c *converter) search(id string, n *yaml.Node) node {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return c.fields(n)
+	case yaml.SequenceNode:
+		nodes := make(or, 0, len(n.Content))
+		for _, item := range n.Content {
+			if item.Kind != yaml.MappingNode {
+				c.unsupported("keyword search in %q is not supported", id)
+				return nil
+			}
+			nodes = append(nodes, c.fields(item))
+		}
+		return nodes
+	}
+	c.unsupported("keyword search in %q is not supported", id)
+	return nil
+}
+
+func (c *converter) fields(n *yaml.Node) node {
+	nodes := make(and, 0, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i].Value, n.Content[i+1]
+		mods := strings.Split(key, "|")
+		f, ok := c.ls.lookup(mods[0])
+		if !ok {
+			c.unsupported("%s field is not supported", mods[0])
+			continue
+		}
+		m, err := parseModifiers(mods[1:])
+		if err != nil {
+			c.unsupported("%s field: %v", mods[0], err)
+			continue
+		}
+		vals, ok := values(val)
+		if !ok {
+			c.unsupported("%s field: null or nested values are not supported", mods[0])
+			continue
+		}
+		fn, err := fieldNode(f, m, vals)
+		if err != nil {
+			c.unsupported("%s field: %v", mods[0], err)
+			continue
+		}
+		nodes = append(nodes, fn)
+	}
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+	return nodes
+}
+
+// values returns the scalar value or the list of scalar values.
+func values(n *yaml.Node) ([]string, bool) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return nil, false
+		}
+		return []string{n.Value}, true
+	case yaml.SequenceNode:
+		vals := make([]string, 0, len(n.Content))
+		for _, item := range n.Content {
+			if item.Kind != yaml.ScalarNode || item.Tag == "!!null" {
+				return nil, false
+			}
+			vals = append(vals, item.Value)
+		}
+		return vals, len(vals) > 0
+	}
+	return nil, false
+}
+
+func description(r *Rule) string {
+	desc := strings.TrimSpace(r.Description)
+	if r.Author == "" {
+		return desc
+	}
+	if desc != "" {
+		desc += "\n\n"
+	}
+	return desc + fmt.Sprintf("Converted from the Sigma rule authored by %s.", r.Author)
+}
+
+// severity maps the Sigma level to the rule severity
+func severity(level string) string {
+	switch level {
+	case "informational", "low":
+		return "low"
+	case "medium", "high", "critical":
+		return level
+	}
+	return ""
+}
+
+var (
+	techniqueTag = regexp.MustCompile(`^attack\.t(\d{4})(?:\.(\d{3}))?$`)
+	tacticNames  = map[string]string{
+		"initial_access":       "TA0001",
+		"execution":            "TA0002",
+		"persistence":          "TA0003",
+		"privilege_escalation": "TA0004",
+		"defense_evasion":      "TA0005",
+		"credential_access":    "TA0006",
+		"discovery":            "TA0007",
+		"lateral_movement":     "TA0008",
+		"collection":           "TA0009",
+		"command_and_control":  "TA0011",
+		"exfiltration":         "TA0010",
+		"impact":               "TA0040",
+		"resource_development": "TA0042",
+		"reconnaissance":       "TA0043",
+	}
+)
+
+// labels derives MITRE ATT&CK labels from the Sigma tags. Only
+// the first tactic, technique, and subtechnique are considered.
+func labels(tags []string) map[string]string {
+	labels := make(map[string]string)
+	for _, tag := range tags {
+		tag = strings.ToLower(tag)
+		if id, ok := tacticNames[strings.TrimPrefix(tag, "attack.")]; ok && labels["tactic.id"] == "" {
+			labels["tactic.id"] = id
+			labels["tactic.name"] = tacticName(strings.TrimPrefix(tag, "attack."))
+			labels["tactic.ref"] = fmt.Sprintf("https://attack.mitre.org/tactics/%s/", id)
+			continue
+		}
+		m := techniqueTag.FindStringSubmatch(tag)
+		if m == nil {
+			continue
+		}
+		if labels["technique.id"] == "" {
+			labels["technique.id"] = "T" + m[1]
+			labels["technique.ref"] = fmt.Sprintf("https://attack.mitre.org/techniques/T%s/", m[1])
+		}
+		if m[2] != "" && labels["subtechnique.id"] == "" {
+			labels["subtechnique.id"] = "T" + m[1] + "." + m[2]
+			labels["subtechnique.ref"] = fmt.Sprintf("https://attack.mitre.org/techniques/T%s/%s/", m[1], m[2])
+		}
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
+// tacticName converts the Sigma tactic tag to the
+// tactic name, e.g. command_and_control becomes
+// Command and Control.
+func tacticName(tag string) string {
+	words := strings.Split(tag, "_")
+	for i, w := range words {
+		if w == "and" {
+			continue
+		}
+		words[i] = strings.ToUpper(w[:1]) + w[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// rule is the rule file layout. It
+// dictates the order of rule keys.
+type rule struct {
+	Name             string            `yaml:"name"`
+	ID               string            `yaml:"id"`
+	Version          string            `yaml:"version"`
+	Description      string            `yaml:"description,omitempty"`
+	Labels           map[string]string `yaml:"labels,omitempty"`
+	References       []string          `yaml:"references,omitempty"`
+	Condition        string            `yaml:"condition"`
+	Severity         string            `yaml:"severity,omitempty"`
+	MinEngineVersion string            `yaml:"min-engine-version"`
+}
+
+// Marshal encodes the converted rule as the rule file.
+func Marshal(f *config.FilterConfig) ([]byte, error) {
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	err := enc.Encode(rule{
+		Name:             f.Name,
+		ID:               f.ID,
+		Version:          f.Version,
+		Description:      f.Description,
+		Labels:           f.Labels,
+		References:       f.References,
+		Condition:        f.Condition,
+		Severity:         f.Severity,
+		MinEngineVersion: f.MinEngineVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sigma
+
+import (
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/rabbitstack/fibratus/pkg/filter/ql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+	"strings"
+	"testing"
+)
+
+func sigmaRule(category, detection string) string {
+	return `
+title: Test rule
+id: 0a5ac2a5-b1e2-4a45-9d0b-1d1f1e6d0a9c
+logsource:
+  category: ` + category + `
+  product: windows
+detection:
+` + detection
+}
+
+func TestConvert(t *testing.T) {
+	var tests = []struct {
+		category  string
+		detection string
+		cond      string
+	}{
+		{
+			"process_creation",
+			`
+  selection:
+    Image|endswith: '\whoami.exe'
+  condition: selection`,
+			`kevt.name = 'CreateProcess' and ps.child.exe iendswith '\\whoami.exe'`,
+		},
+		{
+			"process_creation",
+			`
+  selection:
+    Image:
+      - 'C:\Windows\System32\cmd.exe'
+      - 'C:\Windows\System32\conhost.exe'
+    ParentImage|contains|all:
+      - 'Office'
+      - 'WINWORD'
+  condition: selection`,
+			`kevt.name = 'CreateProcess' and ps.child.exe iin ('C:\\Windows\\System32\\cmd.exe', 'C:\\Windows\\System32\\conhost.exe') and ps.exe icontains 'Office' and ps.exe icontains 'WINWORD'`,
+		},
+		{
+			"process_creation",
+			`
+  selection:
+    CommandLine:
+      - '* -enc *'
+      - '*\Temp\\*'
+      - 'powershell'
+  condition: selection`,
+			`kevt.name = 'CreateProcess' and (ps.child.cmdline ~= 'powershell' or ps.child.cmdline imatches ('* -enc *', '*\\Temp\\*'))`,
+		},
+		{
+			"process_creation",
+			`
+  selection:
+    CommandLine|contains: 'it''s'
+    CommandLine|re|i: '\s-e(nc)?\s'
+  condition: selection`,
+			`kevt.name = 'CreateProcess' and ps.child.cmdline icontains 'it\'s' and regex(ps.child.cmdline, '(?i)\\s-e(nc)?\\s') = true`,
+		},
+		{
+			"file_event",
+			`
+  selection1:
+    TargetFilename|startswith: 'C:\Users\'
+  selection2:
+    TargetFilename|endswith: '.lnk'
+  filter1:
+    Image: 'C:\Windows\explorer.exe'
+  filter2:
+    Image|contains: '\Temp\'
+  condition: 1 of selection* and not 1 of filter*`,
+			`kevt.name = 'CreateFile' and (file.name istartswith 'C:\\Users\\' or file.name iendswith '.lnk') and not (ps.exe ~= 'C:\\Windows\\explorer.exe' or ps.exe icontains '\\Temp\\')`,
+		},
+		{
+			"image_load",
+			`
+  selection:
+    ImageLoaded|endswith: '\dbghelp.dll'
+  filter1:
+    Image|startswith: 'C:\Windows\'
+  filter2:
+    Image|startswith: 'C:\Program Files\'
+  condition: selection and not filter1 and not filter2`,
+			`kevt.name = 'LoadImage' and image.name iendswith '\\dbghelp.dll' and not (ps.exe istartswith 'C:\\Windows\\' or ps.exe istartswith 'C:\\Program Files\\')`,
+		},
+		{
+			"network_connection",
+			`
+  selection:
+    DestinationPort:
+      - 4444
+      - 0x539
+    DestinationIp: 10.0.0.1
+  filter:
+    DestinationIp|cidr: '192.168.0.0/16'
+  condition: selection or not filter`,
+			`kevt.name = 'Connect' and ((net.dport in (4444, 1337) and net.dip = 10.0.0.1) or not (cidr_contains(net.dip, '192.168.0.0/16') = true))`,
+		},
+		{
+			"registry_set",
+			`
+  selection:
+    TargetObject|contains: '\CurrentVersion\Run'
+  condition: all of them`,
+			`kevt.name = 'RegSetValue' and registry.key.name icontains '\\CurrentVersion\\Run'`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			r, err := Parse([]byte(sigmaRule(tt.category, tt.detection)))
+			require.NoError(t, err)
+			f, err := Convert(r)
+			require.NoError(t, err)
+			cond := strings.ReplaceAll(f.Condition, "\n  and\n", " and ")
+			assert.Equal(t, tt.cond, cond)
+			_, err = ql.NewParser(f.Condition).ParseExpr()
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestConvertUnsupported(t *testing.T) {
+	var tests = []struct {
+		category  string
+		detection string
+		reason    string
+	}{
+		{"process_creation", "  keywords:\n    - mimikatz\n  condition: keywords", `keyword search in "keywords" is not supported`},
+		{"process_creation", "  selection:\n    Hashes|contains: 'MD5='\n  condition: selection", "Hashes field is not supported"},
+		{"process_creation", "  selection:\n    CommandLine|base64offset|contains: 'http'\n  condition: selection", `CommandLine field: "base64offset" modifier is not supported`},
+		{"process_creation", "  selection:\n    CommandLine: null\n  condition: selection", "CommandLine field: null or nested values are not supported"},
+		{"process_creation", "  selection:\n    Image|endswith: '\\cmd.exe'\n  condition: selection | count() by ParentImage > 10", "aggregation expressions are not supported"},
+		{"process_creation", "  selection:\n    Image|endswith: '\\cmd.exe'\n  condition: selection and filter", `unknown search identifier "filter" in condition`},
+		{"process_creation", "  selection:\n    Image|endswith: '\\cmd.exe'\n  timeframe: 5m\n  condition: selection", "timeframe is not supported"},
+		{"network_connection", "  selection:\n    DestinationIp|startswith: '10.'\n  condition: selection", "DestinationIp field: startswith modifier is not supported on net.dip field"},
+		{"pipe_created", "  selection:\n    PipeName: '\\psexec'\n  condition: selection", "pipe_created log source category is not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			r, err := Parse([]byte(sigmaRule(tt.category, tt.detection)))
+			require.NoError(t, err)
+			_, err = Convert(r)
+			require.Error(t, err)
+			require.IsType(t, &UnsupportedError{}, err)
+			assert.Contains(t, err.(*UnsupportedError).Reasons, tt.reason)
+		})
+	}
+}
+
+func TestConvertFile(t *testing.T) {
+	r, err := Load("_fixtures/proc_creation_win_vaultcmd_list_creds.yml")
+	require.NoError(t, err)
+	f, err := Convert(r)
+	require.NoError(t, err)
+
+	b, err := Marshal(f)
+	require.NoError(t, err)
+
+	var c config.FilterConfig
+	require.NoError(t, yaml.Unmarshal(b, &c))
+
+	assert.Equal(t, "Windows Credential Manager Access via VaultCmd", c.Name)
+	assert.Equal(t, "58f50261-c53b-4c88-bd12-1d71f12eda4c", c.ID)
+	assert.Equal(t, "1.0.0", c.Version)
+	assert.Equal(t, "medium", c.Severity)
+	assert.Equal(t, "2.0.0", c.MinEngineVersion)
+	assert.Contains(t, c.Description, "Converted from the Sigma rule authored by frack113.")
+	assert.Len(t, c.References, 1)
+	assert.Equal(t, map[string]string{
+		"tactic.id":        "TA0006",
+		"tactic.name":      "Credential Access",
+		"tactic.ref":       "https://attack.mitre.org/tactics/TA0006/",
+		"technique.id":     "T1555",
+		"technique.ref":    "https://attack.mitre.org/techniques/T1555/",
+		"subtechnique.id":  "T1555.004",
+		"subtechnique.ref": "https://attack.mitre.org/techniques/T1555/004/",
+	}, c.Labels)
+	assert.Equal(t, `kevt.name = 'CreateProcess'
+  and
+(ps.child.exe iendswith '\\VaultCmd.exe' or pe.ps.child.file.name ~= 'VAULTCMD.EXE')
+  and
+ps.child.cmdline icontains '/listcreds:'
+  and
+not (ps.exe istartswith 'C:\\Program Files\\')`, c.Condition)
+
+	_, err = ql.NewParser(c.Condition).ParseExpr()
+	require.NoError(t, err)
+}
+
+func TestTacticName(t *testing.T) {
+	assert.Equal(t, "Command and Control", tacticName("command_and_control"))
+	assert.Equal(t, "Defense Evasion", tacticName("defense_evasion"))
+}
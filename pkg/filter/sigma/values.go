@@ -0,0 +1,274 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sigma
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// value is the parsed Sigma string value
+type value struct {
+	// text is the literal string or the glob pattern
+	text string
+	// glob indicates if the value contains unescaped wildcards
+	glob bool
+	// escaped indicates if the value contains escaped wildcards
+	escaped bool
+}
+
+// parseValue interprets wildcards and escape sequences in the
+// Sigma string value. The backslash escapes wildcards and itself.
+// The backslash followed by any other character is literal.
+func parseValue(s string) value {
+	var v value
+	var b strings.Builder
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case r == '\\' && i+1 < len(rs) && (rs[i+1] == '*' || rs[i+1] == '?' || rs[i+1] == '\\'):
+			if rs[i+1] != '\\' {
+				v.escaped = true
+			}
+			b.WriteRune(rs[i+1])
+			i++
+		case r == '*' || r == '?':
+			v.glob = true
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	v.text = b.String()
+	return v
+}
+
+// quote produces the string literal of the filter language.
+func quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`)
+	return "'" + r.Replace(s) + "'"
+}
+
+func quoteAll(vals []string) []string {
+	quoted := make([]string, len(vals))
+	for i, v := range vals {
+		quoted[i] = quote(v)
+	}
+	return quoted
+}
+
+// list renders the single value or the list of values.
+func list(vals []string) string {
+	if len(vals) == 1 {
+		return vals[0]
+	}
+	return "(" + strings.Join(vals, ", ") + ")"
+}
+
+// modifiers holds the parsed field modifiers
+type modifiers struct {
+	op  string
+	all bool
+	// flags are regular expression flags
+	flags string
+}
+
+var stringOps = map[string]string{
+	"":           "~=",
+	"contains":   "icontains",
+	"startswith": "istartswith",
+	"endswith":   "iendswith",
+}
+
+var numOps = map[string]string{
+	"lt":  "<",
+	"lte": "<=",
+	"gt":  ">",
+	"gte": ">=",
+}
+
+func parseModifiers(mods []string) (modifiers, error) {
+	var m modifiers
+	for _, mod := range mods {
+		switch mod {
+		case "all":
+			m.all = true
+		case "contains", "startswith", "endswith", "re", "cidr", "lt", "lte", "gt", "gte":
+			if m.op != "" {
+				return m, fmt.Errorf("%q modifier can't be combined with %q modifier", mod, m.op)
+			}
+			m.op = mod
+		case "i", "m", "s":
+			if m.op != "re" {
+				return m, fmt.Errorf("%q modifier is only valid with the regular expression modifier", mod)
+			}
+			m.flags += mod
+		default:
+			return m, fmt.Errorf("%q modifier is not supported", mod)
+		}
+	}
+	return m, nil
+}
+
+// fieldNode translates the field, its modifiers and values into
+// the expression node. Multiple values are OR-ed, unless the `all`
+// modifier is present.
+func fieldNode(f field, mods modifiers, vals []string) (node, error) {
+	var leaves []node
+	var err error
+	switch {
+	case mods.op == "re":
+		leaves = regexLeaves(f, mods, vals)
+	case mods.op == "cidr":
+		if f.kind != ip {
+			return nil, fmt.Errorf("cidr modifier requires the IP address field, but %s is not", f.name)
+		}
+		leaves = funcLeaves("cidr_contains", f, quoteAll(vals), mods.all)
+	case numOps[mods.op] != "":
+		if f.kind != num {
+			return nil, fmt.Errorf("%s modifier requires the numeric field, but %s is not", mods.op, f.name)
+		}
+		leaves, err = compareLeaves(f, mods, vals)
+	case f.kind == str:
+		leaves, err = stringLeaves(f, mods, vals)
+	case mods.op != "":
+		return nil, fmt.Errorf("%s modifier is not supported on %s field", mods.op, f.name)
+	default:
+		leaves, err = compareLeaves(f, mods, vals)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(leaves) == 1 {
+		return leaves[0], nil
+	}
+	if mods.all {
+		return and(leaves), nil
+	}
+	return or(leaves), nil
+}
+
+// stringLeaves renders case-insensitive string comparisons. Values
+// with wildcards are matched with the glob operator, while plain values
+// are grouped in the list and matched with the corresponding operator.
+func stringLeaves(f field, mods modifiers, vals []string) ([]node, error) {
+	var plain, globs []string
+	for _, s := range vals {
+		v := parseValue(s)
+		if !v.glob {
+			plain = append(plain, v.text)
+			continue
+		}
+		if v.escaped {
+			return nil, fmt.Errorf("value %q mixes wildcards and escaped wildcards", s)
+		}
+		switch mods.op {
+		case "contains":
+			v.text = "*" + v.text + "*"
+		case "startswith":
+			v.text += "*"
+		case "endswith":
+			v.text = "*" + v.text
+		}
+		globs = append(globs, v.text)
+	}
+
+	op := stringOps[mods.op]
+	var leaves []node
+	if mods.all {
+		for _, v := range plain {
+			leaves = append(leaves, leaf(fmt.Sprintf("%s %s %s", f.name, op, quote(v))))
+		}
+		for _, v := range globs {
+			leaves = append(leaves, leaf(fmt.Sprintf("%s imatches %s", f.name, quote(v))))
+		}
+		return leaves, nil
+	}
+	if len(plain) > 0 {
+		if op == "~=" && len(plain) > 1 {
+			op = "iin"
+		}
+		leaves = append(leaves, leaf(fmt.Sprintf("%s %s %s", f.name, op, list(quoteAll(plain)))))
+	}
+	if len(globs) > 0 {
+		leaves = append(leaves, leaf(fmt.Sprintf("%s imatches %s", f.name, list(quoteAll(globs)))))
+	}
+	return leaves, nil
+}
+
+// compareLeaves renders comparisons of numeric and IP address fields.
+func compareLeaves(f field, mods modifiers, vals []string) ([]node, error) {
+	vals = append([]string(nil), vals...)
+	for i, v := range vals {
+		switch f.kind {
+		case num:
+			n, err := strconv.ParseInt(v, 0, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a valid number for %s field", v, f.name)
+			}
+			// the filter language only accepts decimal numbers
+			vals[i] = strconv.FormatInt(n, 10)
+		case ip:
+			if net.ParseIP(v) == nil {
+				return nil, fmt.Errorf("%q is not a valid IP address for %s field", v, f.name)
+			}
+		}
+	}
+	op := "="
+	if numOps[mods.op] != "" {
+		op = numOps[mods.op]
+	}
+	if mods.all || op != "=" || len(vals) == 1 {
+		leaves := make([]node, len(vals))
+		for i, v := range vals {
+			leaves[i] = leaf(fmt.Sprintf("%s %s %s", f.name, op, v))
+		}
+		return leaves, nil
+	}
+	return []node{leaf(fmt.Sprintf("%s in %s", f.name, list(vals)))}, nil
+}
+
+func regexLeaves(f field, mods modifiers, vals []string) []node {
+	patterns := make([]string, len(vals))
+	for i, v := range vals {
+		if mods.flags != "" {
+			v = "(?" + mods.flags + ")" + v
+		}
+		patterns[i] = quote(v)
+	}
+	return funcLeaves("regex", f, patterns, mods.all)
+}
+
+// funcLeaves renders the call of the boolean function that accepts
+// the field and a variable number of arguments, any of which must
+// match. If all arguments must match, the function is called for
+// each argument.
+func funcLeaves(fn string, f field, args []string, all bool) []node {
+	if !all {
+		return []node{leaf(fmt.Sprintf("%s(%s, %s) = true", fn, f.name, strings.Join(args, ", ")))}
+	}
+	leaves := make([]node, len(args))
+	for i, arg := range args {
+		leaves[i] = leaf(fmt.Sprintf("%s(%s, %s) = true", fn, f.name, arg))
+	}
+	return leaves
+}
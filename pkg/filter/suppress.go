@@ -0,0 +1,152 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"expvar"
+	"fmt"
+	"github.com/rabbitstack/fibratus/pkg/config"
+	"github.com/rabbitstack/fibratus/pkg/filter/fields"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSuppressionLifetime indicates how long the expired suppression
+// with pending suppressed alerts is retained before it is discarded
+var maxSuppressionLifetime = time.Hour * 24
+
+var suppressedAlerts = expvar.NewMap("filter.alerts.suppressed")
+
+// suppression tracks the alert suppression window for
+// the distinct tuple of field values in the rule.
+type suppression struct {
+	expires time.Time
+	// count is the number of alerts suppressed in the window
+	count uint64
+}
+
+// suppressor deduplicates rule alerts by the values of the fields
+// declared in the rule suppression settings. Suppressions are keyed
+// by rule identifier, so the state is retained across rule reloads.
+type suppressor struct {
+	suppressions map[string]*suppression
+	// mu guards the suppressions map
+	mu sync.Mutex
+}
+
+func newSuppressor() *suppressor {
+	return &suppressor{suppressions: make(map[string]*suppression)}
+}
+
+// suppress determines whether the alert for the rule match should be
+// suppressed. If the alert is not suppressed, this method returns the
+// number of alerts that were suppressed since the last alert was sent.
+func (s *suppressor) suppress(cf *compiledFilter, evts []*kevent.Kevent) (bool, uint64) {
+	f := cf.config
+	if !f.IsSuppressed() || len(evts) == 0 {
+		return false, 0
+	}
+	key := suppressionKey(f, cf.suppressAccessors, evts)
+	// the window starts at the timestamp of
+	// the last event that triggered the rule
+	ts := evts[len(evts)-1].Timestamp
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sup, ok := s.suppressions[key]
+	if ok && ts.Before(sup.expires) {
+		sup.count++
+		suppressedAlerts.Add(f.Name, 1)
+		return true, 0
+	}
+	var n uint64
+	if ok {
+		n = sup.count
+	}
+	s.suppressions[key] = &suppression{expires: ts.Add(f.Suppress.Window)}
+	return false, n
+}
+
+// gc removes expired suppressions without suppressed alerts. The
+// suppressions holding the number of suppressed alerts are removed
+// after the maximum suppression lifetime.
+func (s *suppressor) gc() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, sup := range s.suppressions {
+		if time.Now().Before(sup.expires) {
+			continue
+		}
+		if sup.count == 0 || time.Since(sup.expires) > maxSuppressionLifetime {
+			delete(s.suppressions, key)
+		}
+	}
+}
+
+// suppressionAccessors validates the suppression fields of
+// the rule and returns accessors for extracting field values.
+func suppressionAccessors(f *config.FilterConfig) ([]Accessor, error) {
+	flds := make([]fields.Field, 0, len(f.Suppress.By))
+	for _, name := range f.Suppress.By {
+		field := fields.Lookup(name)
+		if field == "" {
+			return nil, fmt.Errorf("%q is not a valid field", name)
+		}
+		flds = append(flds, field)
+	}
+	accessors := GetAccessors()
+	for _, accessor := range accessors {
+		accessor.SetFields(flds)
+	}
+	return accessors, nil
+}
+
+// suppressionKey builds the key from the rule identifier and the
+// values of suppression fields. The field value is extracted from
+// the first event where the field is present.
+func suppressionKey(f *config.FilterConfig, accessors []Accessor, evts []*kevent.Kevent) string {
+	var sb strings.Builder
+	sb.WriteString(f.ID)
+	if f.ID == "" {
+		sb.WriteString(f.Name)
+	}
+	for _, name := range f.Suppress.By {
+		var val any
+	outer:
+		for _, kevt := range evts {
+			for _, accessor := range accessors {
+				v, err := accessor.Get(fields.Field(name), kevt)
+				if err != nil {
+					continue
+				}
+				if v != nil {
+					val = v
+					break outer
+				}
+			}
+		}
+		sb.WriteString("|")
+		if val != nil {
+			sb.WriteString(fmt.Sprintf("%v", val))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"expvar"
+	"fmt"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// maxThresholdKeys determines the maximum number of distinct group keys per threshold
+	maxThresholdKeys = 10000
+)
+
+var (
+	thresholdKeys      = expvar.NewMap("threshold.keys.count")
+	thresholdBreaches  = expvar.NewMap("threshold.key.breaches")
+	thresholdEvictions = expvar.NewMap("threshold.key.evictions")
+	// thresholdUngrouped counts events matching the threshold
+	// expression that lack the value of the grouping field
+	thresholdUngrouped = expvar.NewInt("threshold.ungrouped.events")
+)
+
+// thresholdState keeps the sliding window of events
+// matching the threshold expression for each distinct
+// value of the field the events are grouped by. When
+// the number of events in the window reaches the count,
+// the threshold fires, and the window is reset.
+type thresholdState struct {
+	name   string
+	count  uint64
+	window time.Duration
+
+	// windows stores matched events per group key
+	windows map[string][]*kevent.Kevent
+	// mu guards the windows map
+	mu sync.Mutex
+}
+
+func newThresholdState(name string, count uint64, window time.Duration) *thresholdState {
+	return &thresholdState{
+		name:    name,
+		count:   count,
+		window:  window,
+		windows: make(map[string][]*kevent.Kevent),
+	}
+}
+
+// add appends the event to the window identified by the group
+// key and slides the window to evict events that fall out of
+// the time frame. If the number of events in the window reaches
+// the threshold count, all events in the window are returned.
+func (t *thresholdState) add(key any, kevt *kevent.Kevent) []*kevent.Kevent {
+	k := thresholdKey(key)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	evts, ok := t.windows[k]
+	if !ok {
+		if len(t.windows) >= maxThresholdKeys {
+			thresholdBreaches.Add(t.name, 1)
+			log.Warnf("max group keys encountered in threshold %s. "+
+				"Dropping incoming event", t.name)
+			return nil
+		}
+		thresholdKeys.Add(t.name, 1)
+	}
+
+	// evict events older than the time window
+	// relative to the timestamp of the incoming
+	// event
+	n := 0
+	for _, e := range evts {
+		if kevt.Timestamp.Sub(e.Timestamp) <= t.window {
+			evts[n] = e
+			n++
+		}
+	}
+	evts = append(evts[:n], kevt)
+
+	if uint64(len(evts)) < t.count {
+		t.windows[k] = evts
+		return nil
+	}
+
+	log.Debugf("threshold %s reached %d events within %v", t.name, t.count, t.window)
+	delete(t.windows, k)
+	thresholdKeys.Add(t.name, -1)
+
+	return evts
+}
+
+// gc removes windows whose latest event is
+// older than the threshold time window.
+func (t *thresholdState) gc() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for k, evts := range t.windows {
+		if len(evts) > 0 && time.Since(evts[len(evts)-1].Timestamp) <= t.window {
+			continue
+		}
+		log.Debugf("garbage collecting threshold window for key %s in %s", k, t.name)
+		delete(t.windows, k)
+		thresholdKeys.Add(t.name, -1)
+		thresholdEvictions.Add(t.name, 1)
+	}
+}
+
+// thresholdKey converts the group field value into the map key.
+func thresholdKey(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case net.IP:
+		return val.String()
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
@@ -43,6 +43,8 @@ const (
 	YaraMatchesKey MetadataKey = "yara.matches"
 	// RuleNameKey identifies the rule that was triggered by the event
 	RuleNameKey MetadataKey = "rule.name"
+	// RuleSeverityKey represents the severity of the triggered rule
+	RuleSeverityKey MetadataKey = "rule.severity"
 	// RuleGroupKey identifies the group to which the triggered rule pertains
 	RuleGroupKey MetadataKey = "rule.group"
 	// RuleSequenceByKey represents the join field value in sequence rules
@@ -191,6 +193,15 @@ func NewFromKcap(buf []byte, ver kcapver.Version) (*Kevent, error) {
 	return e, nil
 }
 
+// NewFromJSON recovers the event instance from the JSON payload.
+func NewFromJSON(b []byte) (*Kevent, error) {
+	e := &Kevent{}
+	if err := e.UnmarshalJSON(b); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
 // AddMeta appends a key/value pair to event's metadata.
 func (e *Kevent) AddMeta(k MetadataKey, v any) {
 	e.mmux.Lock()
@@ -224,6 +235,43 @@ func (e *Kevent) ContainsMeta(k MetadataKey) bool {
 	return e.Metadata[k] != nil
 }
 
+// Clone returns a copy of the event that can be modified without
+// affecting the original event. Parameters and metadata are copied,
+// while the process state and the callstack are shared with the
+// original event.
+func (e *Kevent) Clone() *Kevent {
+	e.mmux.RLock()
+	defer e.mmux.RUnlock()
+	evt := &Kevent{
+		Seq:         e.Seq,
+		PID:         e.PID,
+		Tid:         e.Tid,
+		Type:        e.Type,
+		CPU:         e.CPU,
+		Name:        e.Name,
+		Category:    e.Category,
+		Description: e.Description,
+		Host:        e.Host,
+		Timestamp:   e.Timestamp,
+		Kparams:     make(Kparams, len(e.Kparams)),
+		Metadata:    make(Metadata, len(e.Metadata)),
+		PS:          e.PS,
+		Callstack:   e.Callstack,
+		WaitEnqueue: e.WaitEnqueue,
+	}
+	for name, kpar := range e.Kparams {
+		if kpar == nil {
+			continue
+		}
+		p := *kpar
+		evt.Kparams[name] = &p
+	}
+	for k, v := range e.Metadata {
+		evt.Metadata[k] = v
+	}
+	return evt
+}
+
 // AppendParam adds a new parameter to this event.
 func (e *Kevent) AppendParam(name string, typ kparams.Type, value kparams.Value, opts ...ParamOption) {
 	e.Kparams.Append(name, typ, value, opts...)
@@ -119,3 +119,33 @@ func TestPartialKey(t *testing.T) {
 		})
 	}
 }
+
+func TestKeventClone(t *testing.T) {
+	kevt := &Kevent{
+		Type:     ktypes.CreateFile,
+		Tid:      2484,
+		PID:      859,
+		Name:     "CreateFile",
+		Category: ktypes.File,
+		Kparams: Kparams{
+			kparams.FileName: {Name: kparams.FileName, Type: kparams.FileDosPath, Value: "C:\\Windows\\system32\\user32.dll"},
+		},
+		Metadata: map[MetadataKey]any{"foo": "bar"},
+		PS:       &pstypes.PS{Name: "cmd.exe"},
+	}
+
+	clone := kevt.Clone()
+	require.NotNil(t, clone)
+	assert.Equal(t, kevt.Type, clone.Type)
+	assert.Equal(t, kevt.Name, clone.Name)
+	assert.Same(t, kevt.PS, clone.PS)
+	assert.Equal(t, "C:\\Windows\\system32\\user32.dll", clone.GetParamAsString(kparams.FileName))
+
+	// modifying the clone leaves the original event intact
+	require.NoError(t, clone.Kparams.SetValue(kparams.FileName, "C:\\Windows\\system32\\kernel32.dll"))
+	clone.Kparams.Remove(kparams.FileName)
+	clone.AddMeta("rule.name", "Suspicious DLL load")
+	assert.Equal(t, "C:\\Windows\\system32\\user32.dll", kevt.GetParamAsString(kparams.FileName))
+	assert.False(t, kevt.ContainsMeta("rule.name"))
+	assert.Equal(t, "bar", clone.GetMetaAsString("foo"))
+}
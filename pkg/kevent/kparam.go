@@ -114,6 +114,34 @@ func (k Kparam) KcapType() kparams.Type {
 	}
 }
 
+// JSONType returns the parameter type that is serialized
+// along with the parameter value in the JSON payload. Types
+// whose values are rendered as human-readable strings, such
+// as SIDs or status codes, are reported as Unicode strings,
+// so the value can be restored as is.
+func (k Kparam) JSONType() kparams.Type {
+	switch k.Type {
+	case kparams.Int8, kparams.Uint8, kparams.Int16, kparams.Uint16, kparams.Int32, kparams.Uint32,
+		kparams.Int64, kparams.Uint64, kparams.Float, kparams.Double, kparams.Bool, kparams.PID,
+		kparams.TID, kparams.Port, kparams.IPv4, kparams.IPv6, kparams.Time, kparams.Address,
+		kparams.AnsiString, kparams.FilePath:
+		return k.Type
+	case kparams.Slice:
+		if _, ok := k.Value.([]string); ok {
+			return k.Type
+		}
+	case kparams.Enum:
+		if k.Enum != nil {
+			return k.Type
+		}
+	case kparams.Flags, kparams.Flags64:
+		if k.Flags != nil {
+			return k.Type
+		}
+	}
+	return kparams.UnicodeString
+}
+
 // Kparams is the type that represents the sequence of kernel event parameters
 type Kparams map[string]*Kparam
 
@@ -112,6 +112,8 @@ const (
 // String return the type string representation.
 func (t Type) String() string {
 	switch t {
+	case Null:
+		return "null"
 	case UnicodeString:
 		return "unicode"
 	case AnsiString:
@@ -132,19 +134,73 @@ func (t Type) String() string {
 		return "int64"
 	case Uint64:
 		return "uint64"
-	case SID, WbemSID:
+	case Float:
+		return "float"
+	case Double:
+		return "double"
+	case Bool:
+		return "bool"
+	case Binary:
+		return "binary"
+	case GUID:
+		return "guid"
+	case Pointer:
+		return "pointer"
+	case SID:
 		return "sid"
+	case WbemSID:
+		return "wbemsid"
 	case TID:
 		return "tid"
 	case PID:
 		return "pid"
 	case Port:
 		return "port"
+	case IP:
+		return "ip"
 	case IPv6:
 		return "ipv6"
 	case IPv4:
 		return "ipv4"
+	case Time:
+		return "time"
+	case Slice:
+		return "slice"
+	case Enum:
+		return "enum"
+	case Map:
+		return "map"
+	case Object:
+		return "object"
+	case FileDosPath:
+		return "dospath"
+	case FilePath:
+		return "path"
+	case Status:
+		return "status"
+	case Key:
+		return "key"
+	case Flags:
+		return "flags"
+	case Flags64:
+		return "flags64"
+	case Address:
+		return "address"
+	case HandleType:
+		return "handletype"
 	default:
 		return "unknown"
 	}
 }
+
+// ParseType returns the parameter type from its string
+// representation. The second return value is false if
+// the type name is not recognized.
+func ParseType(s string) (Type, bool) {
+	for t := Null; t <= HandleType; t++ {
+		if t.String() == s {
+			return t, true
+		}
+	}
+	return Null, false
+}
@@ -19,11 +19,16 @@
 package kevent
 
 import (
+	"bytes"
 	"encoding/json"
+	"github.com/rabbitstack/fibratus/pkg/fs"
 	kcapver "github.com/rabbitstack/fibratus/pkg/kcap/version"
 	"github.com/rabbitstack/fibratus/pkg/util/va"
 	"golang.org/x/sys/windows"
+	"io"
+	"net"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -364,6 +369,191 @@ func TestKeventMarshalJSONMultiple(t *testing.T) {
 	}
 }
 
+func TestKeventUnmarshalJSON(t *testing.T) {
+	now, err := time.Parse(time.RFC3339Nano, time.Now().Format(time.RFC3339Nano))
+	require.NoError(t, err)
+
+	kevt := &Kevent{
+		Type:        ktypes.OpenProcess,
+		Tid:         2484,
+		PID:         859,
+		CPU:         1,
+		Seq:         2,
+		Name:        "OpenProcess",
+		Timestamp:   now,
+		Category:    ktypes.Process,
+		Host:        "archrabbit",
+		Description: "Opens the process handle",
+		Kparams: Kparams{
+			kparams.ProcessID:     {Name: kparams.ProcessID, Type: kparams.PID, Value: uint32(1204)},
+			kparams.ProcessName:   {Name: kparams.ProcessName, Type: kparams.AnsiString, Value: "lsass.exe"},
+			kparams.DesiredAccess: {Name: kparams.DesiredAccess, Type: kparams.Flags, Value: uint32(0x1400), Flags: PsAccessRightFlags},
+			kparams.FileOperation: {Name: kparams.FileOperation, Type: kparams.Enum, Value: uint32(windows.FILE_CREATE), Enum: fs.FileCreateDispositions},
+			kparams.BasePrio:      {Name: kparams.BasePrio, Type: kparams.Int8, Value: int8(-2)},
+			kparams.FileObject:    {Name: kparams.FileObject, Type: kparams.Uint64, Value: uint64(12456738026482168384)},
+			kparams.KstackLimit:   {Name: kparams.KstackLimit, Type: kparams.Address, Value: uint64(0xfffff80312345678)},
+			kparams.StartTime:     {Name: kparams.StartTime, Type: kparams.Time, Value: now},
+			kparams.NetDIP:        {Name: kparams.NetDIP, Type: kparams.IPv4, Value: net.ParseIP("172.17.0.2")},
+			kparams.NetDIPNames:   {Name: kparams.NetDIPNames, Type: kparams.Slice, Value: []string{"dns.google.", "github.com."}},
+			kparams.Exe:           {Name: kparams.Exe, Type: kparams.FileDosPath, Value: `C:\Windows\System32\lsass.exe`},
+		},
+		Metadata: map[MetadataKey]any{"foo": "bar"},
+		PS: &pstypes.PS{
+			PID:       2436,
+			Ppid:      6304,
+			Name:      "procdump.exe",
+			Exe:       `C:\Tools\procdump.exe`,
+			Cmdline:   `procdump.exe -ma lsass.exe`,
+			SID:       "archrabbit\\SYSTEM",
+			Args:      []string{"-ma", "lsass.exe"},
+			SessionID: 1,
+			Threads: map[uint32]pstypes.Thread{
+				3453: {Tid: 3453, Pid: 2436, Entrypoint: va.Address(140729524944768), IOPrio: 2, PagePrio: 5, KstackBase: va.Address(18446677035730165760), KstackLimit: va.Address(18446677035730137088), UstackLimit: va.Address(86376448), UstackBase: va.Address(86372352)},
+			},
+			Modules: []pstypes.Module{{Name: `C:\Windows\System32\ntdll.dll`, Size: 2031616}},
+			Handles: []htypes.Handle{{Num: windows.Handle(0x1c4), Name: `\Device\HarddiskVolume2\Windows`, Type: "File", Object: 0xffffd105e9baaf70}},
+			Parent: &pstypes.PS{
+				PID:  6304,
+				Ppid: 4,
+				Name: "cmd.exe",
+				Exe:  `C:\Windows\System32\cmd.exe`,
+			},
+		},
+		Callstack: Callstack{
+			{Addr: 0x7ffb5c1d0396, Offset: 0x396, Symbol: "NtOpenProcess", Module: `C:\Windows\System32\ntdll.dll`},
+			{Addr: 0x2638e59e0a5, Module: "unbacked"},
+		},
+	}
+
+	clone, err := NewFromJSON(kevt.MarshalJSON())
+	require.NoError(t, err)
+
+	assert.Equal(t, ktypes.OpenProcess, clone.Type)
+	assert.Equal(t, ktypes.Process, clone.Category)
+	assert.Equal(t, uint64(2), clone.Seq)
+	assert.Equal(t, uint32(859), clone.PID)
+	assert.Equal(t, uint32(2484), clone.Tid)
+	assert.Equal(t, uint8(1), clone.CPU)
+	assert.Equal(t, "archrabbit", clone.Host)
+	assert.True(t, now.Equal(clone.Timestamp))
+	assert.Equal(t, "bar", clone.Metadata["foo"])
+
+	require.Len(t, clone.Kparams, len(kevt.Kparams))
+	for name, kpar := range kevt.Kparams {
+		assert.Equal(t, kpar.JSONType(), clone.Kparams[name].Type, name)
+	}
+	pid, err := clone.Kparams.GetPid()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1204), pid)
+	assert.Equal(t, uint32(0x1400), clone.Kparams.MustGetUint32(kparams.DesiredAccess))
+	assert.Equal(t, "QUERY_INFORMATION|QUERY_LIMITED_INFORMATION", clone.GetParamAsString(kparams.DesiredAccess))
+	assert.Equal(t, "CREATE", clone.GetParamAsString(kparams.FileOperation))
+	assert.Equal(t, int8(-2), clone.Kparams[kparams.BasePrio].Value)
+	assert.Equal(t, uint64(12456738026482168384), clone.Kparams[kparams.FileObject].Value)
+	assert.Equal(t, uint64(0xfffff80312345678), clone.Kparams[kparams.KstackLimit].Value)
+	assert.True(t, now.Equal(clone.Kparams[kparams.StartTime].Value.(time.Time)))
+	assert.Equal(t, "172.17.0.2", clone.GetParamAsString(kparams.NetDIP))
+	assert.Equal(t, []string{"dns.google.", "github.com."}, clone.Kparams[kparams.NetDIPNames].Value)
+	assert.Equal(t, kevt.GetParamAsString(kparams.Exe), clone.GetParamAsString(kparams.Exe))
+
+	require.Len(t, clone.Callstack, 2)
+	assert.Equal(t, kevt.Callstack.String(), clone.Callstack.String())
+	assert.True(t, clone.Callstack.ContainsUnbacked())
+
+	require.NotNil(t, clone.PS)
+	assert.Equal(t, uint32(2436), clone.PS.PID)
+	assert.Equal(t, uint32(6304), clone.PS.Ppid)
+	assert.Equal(t, "procdump.exe -ma lsass.exe", clone.PS.Cmdline)
+	assert.Equal(t, uint32(1), clone.PS.SessionID)
+	assert.Equal(t, kevt.PS.Threads, clone.PS.Threads)
+	require.Len(t, clone.PS.Modules, 1)
+	assert.Equal(t, uint64(2031616), clone.PS.Modules[0].Size)
+	require.Len(t, clone.PS.Handles, 1)
+	assert.Equal(t, uint64(0xffffd105e9baaf70), clone.PS.Handles[0].Object)
+	require.NotNil(t, clone.PS.Parent)
+	assert.Equal(t, uint32(6304), clone.PS.Parent.PID)
+	assert.Equal(t, uint32(4), clone.PS.Parent.Ppid)
+	assert.Equal(t, "cmd.exe", clone.PS.Parent.Name)
+}
+
+func TestKeventUnmarshalJSONWithoutTypes(t *testing.T) {
+	clone, err := NewFromJSON([]byte(`{"seq":1,"pid":2484,"tid":1204,"name":"CreateProcess","timestamp":"2024-02-01T10:00:00Z",
+		"kparams":{"pid":4143,"name":"cmd.exe","exit_status":-1,"size":8589934592,"ratio":0.5,"args":["/c","whoami"],"dip":"::1"},
+		"meta":{"count":3,"score":0.75,"rule.seq.by":17135479430154727417,"env":"prod"},
+		"ps":{"pid":2484,"ppid":812,"name":"excel.exe","parent":{"name":"explorer.exe","parent":{"pid":4,"name":"System"}}}}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, ktypes.Process, clone.Category)
+	assert.Equal(t, kparams.PID, clone.Kparams[kparams.ProcessID].Type)
+	assert.Equal(t, uint32(4143), clone.Kparams[kparams.ProcessID].Value)
+	assert.Equal(t, kparams.UnicodeString, clone.Kparams[kparams.ProcessName].Type)
+	assert.Equal(t, int64(-1), clone.Kparams["exit_status"].Value)
+	assert.Equal(t, uint64(8589934592), clone.Kparams["size"].Value)
+	assert.Equal(t, 0.5, clone.Kparams["ratio"].Value)
+	assert.Equal(t, []string{"/c", "whoami"}, clone.Kparams["args"].Value)
+	assert.Equal(t, kparams.IPv6, clone.Kparams[kparams.NetDIP].Type)
+
+	assert.Equal(t, int64(3), clone.Metadata["count"])
+	assert.Equal(t, 0.75, clone.Metadata["score"])
+	assert.Equal(t, uint64(17135479430154727417), clone.Metadata[RuleSequenceByKey])
+	assert.Equal(t, "prod", clone.Metadata["env"])
+
+	require.NotNil(t, clone.PS.Parent)
+	assert.Equal(t, uint32(812), clone.PS.Parent.PID)
+	require.NotNil(t, clone.PS.Parent.Parent)
+	assert.Equal(t, "System", clone.PS.Parent.Parent.Name)
+	assert.Equal(t, uint32(4), clone.PS.Parent.Parent.PID)
+
+	_, err = NewFromJSON([]byte(`{"name":"SpawnProcess"}`))
+	require.EqualError(t, err, "unknown event name: SpawnProcess")
+	_, err = NewFromJSON([]byte(`{"name":"CreateProcess","kparams":{"pid":"foo"},"kparams_types":{"pid":"pid"}}`))
+	require.Error(t, err)
+}
+
+func TestDecoder(t *testing.T) {
+	evts := make([]*Kevent, 0, 3)
+	for i := 0; i < 3; i++ {
+		evts = append(evts, &Kevent{
+			Seq:       uint64(i + 1),
+			Type:      ktypes.CreateFile,
+			Name:      "CreateFile",
+			Category:  ktypes.File,
+			Timestamp: time.Now(),
+			Kparams: Kparams{
+				kparams.FileName: {Name: kparams.FileName, Type: kparams.UnicodeString, Value: `C:\Windows\System32\user32.dll`},
+			},
+			Metadata: map[MetadataKey]any{},
+		})
+	}
+
+	var buf bytes.Buffer
+	buf.Write(evts[0].MarshalJSON())
+	buf.WriteByte('\n')
+	buf.Write(NewBatch(evts[1], evts[2]).MarshalJSON())
+	buf.WriteByte('\n')
+
+	dec := NewDecoder(&buf)
+	for i := 0; i < 3; i++ {
+		e, err := dec.Decode()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(i+1), e.Seq)
+		assert.Equal(t, `C:\Windows\System32\user32.dll`, e.GetParamAsString(kparams.FileName))
+	}
+	_, err := dec.Decode()
+	require.Equal(t, io.EOF, err)
+
+	dec = NewDecoder(strings.NewReader(`{"name":"CreateFile"}` + "\n" + `{"name":`))
+	_, err = dec.Decode()
+	require.NoError(t, err)
+	_, err = dec.Decode()
+	require.Error(t, err)
+	dec = NewDecoder(strings.NewReader(`{"name":"CreateFile"}` + "\n" + `{"name":"Foo"}`))
+	_, err = dec.Decode()
+	require.NoError(t, err)
+	_, err = dec.Decode()
+	require.EqualError(t, err, "invalid event #2: unknown event name: Foo")
+}
+
 func BenchmarkKeventMarshalJSON(b *testing.B) {
 	kevt := &Kevent{
 		Type:        ktypes.CreateFile,
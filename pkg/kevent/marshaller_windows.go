@@ -504,6 +504,8 @@ func (e *Kevent) MarshalJSON() []byte {
 					}
 				}
 				js.writeArrayEnd()
+			default:
+				js.writeEscapeString(e.GetParamAsString(kpar.Name))
 			}
 		default:
 			js.writeEscapeString(e.GetParamAsString(kpar.Name))
@@ -515,6 +517,21 @@ func (e *Kevent) MarshalJSON() []byte {
 	// end kparams
 	js.writeObjectEnd().writeMore()
 
+	// start kparams types. Types are required
+	// to restore the parameters when the event
+	// is unmarshaled
+	js.writeObjectField("kparams_types")
+	js.writeObjectStart()
+	for i, kpar := range pars {
+		writeMore := js.shouldWriteMore(i, len(pars))
+		js.writeObjectField(kpar.Name).writeString(kpar.JSONType().String())
+		if writeMore {
+			js.writeMore()
+		}
+	}
+	// end kparams types
+	js.writeObjectEnd().writeMore()
+
 	// start metadata
 	js.writeObjectField("meta")
 	js.writeObjectStart()
@@ -530,6 +547,28 @@ func (e *Kevent) MarshalJSON() []byte {
 
 	// end metadata
 	js.writeObjectEnd()
+
+	// start callstack
+	if !e.Callstack.IsEmpty() {
+		js.writeMore()
+		js.writeObjectField("callstack")
+		js.writeArrayStart()
+		for i, frame := range e.Callstack {
+			writeMore := js.shouldWriteMore(i, len(e.Callstack))
+			js.writeObjectStart()
+			js.writeObjectField("address").writeString(frame.Addr.String()).writeMore()
+			js.writeObjectField("offset").writeUint64(frame.Offset).writeMore()
+			js.writeObjectField("symbol").writeEscapeString(frame.Symbol).writeMore()
+			js.writeObjectField("module").writeEscapeString(frame.Module)
+			js.writeObjectEnd()
+			if writeMore {
+				js.writeMore()
+			}
+		}
+		// end callstack
+		js.writeArrayEnd()
+	}
+
 	ps := e.PS
 	if ps != nil {
 		js.writeMore()
@@ -567,6 +606,8 @@ func (e *Kevent) MarshalJSON() []byte {
 			js.writeObjectField("parent")
 			js.writeObjectStart()
 
+			js.writeObjectField("pid").writeUint32(parent.PID).writeMore()
+			js.writeObjectField("ppid").writeUint32(parent.Ppid).writeMore()
 			js.writeObjectField("name").writeString(parent.Name).writeMore()
 			js.writeObjectField("cmdline").writeEscapeString(parent.Cmdline).writeMore()
 			js.writeObjectField("exe").writeEscapeString(parent.Exe).writeMore()
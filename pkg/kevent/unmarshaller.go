@@ -0,0 +1,506 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kevent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rabbitstack/fibratus/pkg/kevent/kparams"
+	"github.com/rabbitstack/fibratus/pkg/kevent/ktypes"
+	"github.com/rabbitstack/fibratus/pkg/util/va"
+)
+
+// timeLayout is the layout of the time parameter
+// value as rendered by the time.Time String method
+const timeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// jsonKevent is the layout of the event produced by MarshalJSON
+type jsonKevent struct {
+	Seq          uint64                     `json:"seq"`
+	PID          uint32                     `json:"pid"`
+	Tid          uint32                     `json:"tid"`
+	CPU          uint8                      `json:"cpu"`
+	Name         string                     `json:"name"`
+	Category     string                     `json:"category"`
+	Description  string                     `json:"description"`
+	Host         string                     `json:"host"`
+	Timestamp    time.Time                  `json:"timestamp"`
+	Kparams      map[string]json.RawMessage `json:"kparams"`
+	KparamsTypes map[string]string          `json:"kparams_types"`
+	Meta         map[string]any             `json:"meta"`
+	Callstack    []jsonFrame                `json:"callstack"`
+	PS           *jsonPS                    `json:"ps"`
+}
+
+type jsonFrame struct {
+	Addr   string `json:"address"`
+	Offset uint64 `json:"offset"`
+	Symbol string `json:"symbol"`
+	Module string `json:"module"`
+}
+
+type jsonPS struct {
+	PID       uint32            `json:"pid"`
+	Ppid      uint32            `json:"ppid"`
+	Name      string            `json:"name"`
+	Cmdline   string            `json:"cmdline"`
+	Exe       string            `json:"exe"`
+	Cwd       string            `json:"cwd"`
+	SID       string            `json:"sid"`
+	Args      []string          `json:"args"`
+	SessionID uint32            `json:"sessionid"`
+	Envs      map[string]string `json:"envs"`
+	Threads   []jsonThread      `json:"threads"`
+	Modules   []jsonModule      `json:"modules"`
+	Handles   []jsonHandle      `json:"handles"`
+	PE        *jsonPE           `json:"pe"`
+	Parent    *jsonPS           `json:"parent"`
+}
+
+type jsonThread struct {
+	Tid         uint32 `json:"tid"`
+	IOPrio      uint8  `json:"ioprio"`
+	BasePrio    uint8  `json:"baseprio"`
+	PagePrio    uint8  `json:"pageprio"`
+	Entrypoint  string `json:"entrypoint"`
+	UstackBase  string `json:"ustack_base"`
+	UstackLimit string `json:"ustack_limit"`
+	KstackBase  string `json:"kstack_base"`
+	KstackLimit string `json:"kstack_limit"`
+}
+
+type jsonModule struct {
+	Name string `json:"name"`
+	Size uint64 `json:"size"`
+}
+
+type jsonHandle struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	ID     uint64 `json:"id"`
+	Object string `json:"object"`
+}
+
+type jsonPE struct {
+	NumberOfSections uint16            `json:"nsections"`
+	NumberOfSymbols  uint32            `json:"nsymbols"`
+	ImageBase        string            `json:"image_base"`
+	EntryPoint       string            `json:"entrypoint"`
+	LinkTime         time.Time         `json:"link_time"`
+	Sections         []jsonSection     `json:"sections"`
+	Symbols          []string          `json:"symbols"`
+	Imports          []string          `json:"imports"`
+	VersionResources map[string]string `json:"resources"`
+}
+
+type jsonSection struct {
+	Name    string  `json:"name"`
+	Size    uint32  `json:"size"`
+	Entropy float64 `json:"entropy"`
+	Md5     string  `json:"md5"`
+}
+
+// UnmarshalJSON recovers the state of the event from the JSON payload
+// produced by the MarshalJSON method. Parameter types are restored from
+// the parameter types metadata. If the payload lacks types metadata, for
+// example, when it was produced by an older version, the parameter type
+// is inferred from the parameter name and value.
+func (e *Kevent) UnmarshalJSON(b []byte) error {
+	var evt jsonKevent
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&evt); err != nil {
+		return err
+	}
+
+	ktype := ktypes.KeventNameToKtype(evt.Name)
+	if ktype == ktypes.UnknownKtype {
+		return fmt.Errorf("unknown event name: %s", evt.Name)
+	}
+
+	e.Seq = evt.Seq
+	e.PID = evt.PID
+	e.Tid = evt.Tid
+	e.CPU = evt.CPU
+	e.Type = ktype
+	e.Name = evt.Name
+	e.Category = ktypes.Category(evt.Category)
+	if e.Category == "" {
+		e.Category = ktype.Category()
+	}
+	e.Description = evt.Description
+	e.Host = evt.Host
+	e.Timestamp = evt.Timestamp
+
+	// restore parameters
+	e.Kparams = make(Kparams, len(evt.Kparams))
+	for name, raw := range evt.Kparams {
+		typ, ok := kparams.ParseType(evt.KparamsTypes[name])
+		if !ok {
+			typ = inferParamType(name, raw)
+		}
+		kpar, err := unmarshalKparam(name, typ, raw, ktype)
+		if err != nil {
+			return fmt.Errorf("invalid %q parameter: %v", name, err)
+		}
+		e.Kparams[name] = kpar
+	}
+
+	// restore metadata
+	e.Metadata = make(map[MetadataKey]any, len(evt.Meta))
+	for k, v := range evt.Meta {
+		if n, ok := v.(json.Number); ok {
+			v = metaNumber(MetadataKey(k), n)
+		}
+		e.Metadata[MetadataKey(k)] = v
+	}
+
+	// restore callstack
+	if len(evt.Callstack) > 0 {
+		e.Callstack.Init(len(evt.Callstack))
+		for _, f := range evt.Callstack {
+			addr, err := parseAddress(f.Addr)
+			if err != nil {
+				return fmt.Errorf("invalid callstack frame address: %v", err)
+			}
+			e.Callstack.PushFrame(Frame{Addr: addr, Offset: f.Offset, Symbol: f.Symbol, Module: f.Module})
+		}
+	}
+
+	// restore process state
+	ps, err := evt.PS.ps()
+	if err != nil {
+		return err
+	}
+	e.PS = ps
+
+	return nil
+}
+
+// Decoder reads events from the stream of JSON payloads. The stream
+// may contain newline-delimited events, or arrays of events as
+// produced by the Batch.MarshalJSON method.
+type Decoder struct {
+	dec *json.Decoder
+	buf []json.RawMessage
+	n   int
+}
+
+// NewDecoder creates the decoder that reads events from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{dec: json.NewDecoder(r)}
+}
+
+// Decode reads the next event from the stream.
+// It returns io.EOF when there are no more events.
+func (d *Decoder) Decode() (*Kevent, error) {
+	for len(d.buf) == 0 {
+		var raw json.RawMessage
+		if err := d.dec.Decode(&raw); err != nil {
+			if err == io.EOF {
+				return nil, err
+			}
+			return nil, fmt.Errorf("invalid event #%d: %v", d.n+1, err)
+		}
+		if len(raw) > 0 && raw[0] == '[' {
+			// the batch of events
+			if err := json.Unmarshal(raw, &d.buf); err != nil {
+				return nil, fmt.Errorf("invalid event #%d: %v", d.n+1, err)
+			}
+			continue
+		}
+		d.buf = append(d.buf, raw)
+	}
+	raw := d.buf[0]
+	d.buf = d.buf[1:]
+	d.n++
+	e, err := NewFromJSON(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event #%d: %v", d.n, err)
+	}
+	return e, nil
+}
+
+// inferParamType determines the type of the parameter
+// from the well-known parameter names or the JSON value.
+func inferParamType(name string, raw json.RawMessage) kparams.Type {
+	switch name {
+	case kparams.ProcessID, kparams.ProcessParentID, kparams.ProcessRealParentID, kparams.TargetProcessID:
+		return kparams.PID
+	case kparams.ThreadID:
+		return kparams.TID
+	case kparams.NetDport, kparams.NetSport:
+		return kparams.Port
+	}
+	v, err := decodeValue(raw)
+	if err != nil {
+		return kparams.UnicodeString
+	}
+	switch v := v.(type) {
+	case bool:
+		return kparams.Bool
+	case json.Number:
+		if _, err := strconv.ParseUint(v.String(), 10, 32); err == nil {
+			return kparams.Uint32
+		}
+		if _, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			return kparams.Uint64
+		}
+		if _, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			return kparams.Int64
+		}
+		return kparams.Double
+	case []any:
+		return kparams.Slice
+	case string:
+		if name == kparams.NetDIP || name == kparams.NetSIP {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() == nil {
+				return kparams.IPv6
+			}
+			return kparams.IPv4
+		}
+	}
+	return kparams.UnicodeString
+}
+
+// unmarshalKparam builds the parameter of the given type from the JSON value.
+func unmarshalKparam(name string, typ kparams.Type, raw json.RawMessage, ktype ktypes.Ktype) (*Kparam, error) {
+	v, err := decodeValue(raw)
+	if err != nil {
+		return nil, err
+	}
+	var s string
+	if v != nil {
+		s = fmt.Sprintf("%v", v)
+	}
+
+	var val kparams.Value
+	switch typ {
+	case kparams.Int8, kparams.Int16, kparams.Int32, kparams.Int64:
+		n, err := strconv.ParseInt(s, 0, bitSize(typ))
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case kparams.Int8:
+			val = int8(n)
+		case kparams.Int16:
+			val = int16(n)
+		case kparams.Int32:
+			val = int32(n)
+		default:
+			val = n
+		}
+	case kparams.Uint8, kparams.Uint16, kparams.Port, kparams.Uint32, kparams.PID, kparams.TID, kparams.Uint64:
+		n, err := strconv.ParseUint(s, 0, bitSize(typ))
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case kparams.Uint8:
+			val = uint8(n)
+		case kparams.Uint16, kparams.Port:
+			val = uint16(n)
+		case kparams.Uint32, kparams.PID, kparams.TID:
+			val = uint32(n)
+		default:
+			val = n
+		}
+	case kparams.Float:
+		n, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return nil, err
+		}
+		val = float32(n)
+	case kparams.Double:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		val = n
+	case kparams.Bool:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected bool value but got %s", s)
+		}
+		val = b
+	case kparams.IPv4, kparams.IPv6:
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address: %s", s)
+		}
+		val = ip
+	case kparams.Time:
+		ts, err := parseTime(s)
+		if err != nil {
+			return nil, err
+		}
+		val = ts
+	case kparams.Slice:
+		items, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("expected list value but got %s", s)
+		}
+		vals := make([]string, 0, len(items))
+		for _, item := range items {
+			vals = append(vals, fmt.Sprintf("%v", item))
+		}
+		val = vals
+	case kparams.Address:
+		addr, err := parseAddress(s)
+		if err != nil {
+			return nil, err
+		}
+		val = addr.Uint64()
+	case kparams.Enum, kparams.Flags, kparams.Flags64:
+		// enums and flags are serialized as symbolical
+		// names, so we have to map them back to values.
+		// If the names are not recognized, the parameter
+		// is restored as string
+		kpar := NewKparamFromKcap(name, typ, nil, ktype)
+		switch {
+		case typ == kparams.Enum && kpar.Enum != nil:
+			for n, sym := range kpar.Enum {
+				if sym == s {
+					kpar.Value = n
+					return kpar, nil
+				}
+			}
+		case typ != kparams.Enum && kpar.Flags != nil:
+			if f, ok := parseFlags(s, kpar.Flags); ok {
+				if typ == kparams.Flags {
+					kpar.Value = uint32(f)
+				} else {
+					kpar.Value = f
+				}
+				return kpar, nil
+			}
+		}
+		return NewKparamFromKcap(name, kparams.UnicodeString, s, ktype), nil
+	default:
+		if typ != kparams.AnsiString && typ != kparams.FilePath {
+			typ = kparams.UnicodeString
+		}
+		val = s
+	}
+	return NewKparamFromKcap(name, typ, val, ktype), nil
+}
+
+// metaNumber converts the numeric metadata value. The sequence
+// join value is the unsigned hash, while other values become
+// signed integers, or floating point numbers if they have the
+// fractional part or exceed the range of 64-bit integers.
+func metaNumber(key MetadataKey, n json.Number) any {
+	if key == RuleSequenceByKey {
+		if u, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+			return u
+		}
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if u, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+		return u
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return n.String()
+}
+
+func decodeValue(raw json.RawMessage) (any, error) {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func bitSize(typ kparams.Type) int {
+	switch typ {
+	case kparams.Int8, kparams.Uint8:
+		return 8
+	case kparams.Int16, kparams.Uint16, kparams.Port:
+		return 16
+	case kparams.Int32, kparams.Uint32, kparams.PID, kparams.TID:
+		return 32
+	default:
+		return 64
+	}
+}
+
+// parseFlags converts the flag names delimited by the
+// `|` separator to the bitmask. Returns false if any of
+// the flag names is not present in the flags.
+func parseFlags(s string, flags ParamFlags) (uint64, bool) {
+	var f uint64
+	if s == "" {
+		return f, true
+	}
+	for _, name := range strings.Split(s, "|") {
+		var ok bool
+		for _, flag := range flags {
+			if flag.Name == name {
+				f |= flag.Value
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return 0, false
+		}
+	}
+	return f, true
+}
+
+// parseTime parses the time parameter value. The value
+// may contain the monotonic clock reading, which is
+// stripped before parsing.
+func parseTime(s string) (time.Time, error) {
+	if i := strings.Index(s, " m="); i > 0 {
+		s = s[:i]
+	}
+	ts, err := time.Parse(timeLayout, s)
+	if err == nil {
+		return ts, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// parseAddress parses the hexadecimal memory address
+// with an optional 0x prefix.
+func parseAddress(s string) (va.Address, error) {
+	if s == "" {
+		return 0, nil
+	}
+	addr, err := strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address: %s", s)
+	}
+	return va.Address(addr), nil
+}
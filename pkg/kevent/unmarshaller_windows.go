@@ -0,0 +1,122 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kevent
+
+import (
+	"fmt"
+
+	htypes "github.com/rabbitstack/fibratus/pkg/handle/types"
+	pex "github.com/rabbitstack/fibratus/pkg/pe"
+	pstypes "github.com/rabbitstack/fibratus/pkg/ps/types"
+	"github.com/rabbitstack/fibratus/pkg/util/va"
+	"golang.org/x/sys/windows"
+)
+
+// ps restores the process state along with
+// threads, modules, handles, PE metadata,
+// and the chain of parent processes.
+func (p *jsonPS) ps() (*pstypes.PS, error) {
+	if p == nil {
+		return nil, nil
+	}
+	ps := &pstypes.PS{
+		PID:       p.PID,
+		Ppid:      p.Ppid,
+		Name:      p.Name,
+		Cmdline:   p.Cmdline,
+		Exe:       p.Exe,
+		Cwd:       p.Cwd,
+		SID:       p.SID,
+		Args:      p.Args,
+		SessionID: p.SessionID,
+		Envs:      p.Envs,
+		Threads:   make(map[uint32]pstypes.Thread, len(p.Threads)),
+	}
+
+	for _, t := range p.Threads {
+		thread := pstypes.Thread{
+			Tid:      t.Tid,
+			Pid:      p.PID,
+			IOPrio:   t.IOPrio,
+			BasePrio: t.BasePrio,
+			PagePrio: t.PagePrio,
+		}
+		addrs := map[*va.Address]string{
+			&thread.Entrypoint:  t.Entrypoint,
+			&thread.UstackBase:  t.UstackBase,
+			&thread.UstackLimit: t.UstackLimit,
+			&thread.KstackBase:  t.KstackBase,
+			&thread.KstackLimit: t.KstackLimit,
+		}
+		for addr, s := range addrs {
+			var err error
+			if *addr, err = parseAddress(s); err != nil {
+				return nil, fmt.Errorf("invalid thread %d: %v", t.Tid, err)
+			}
+		}
+		ps.Threads[t.Tid] = thread
+	}
+
+	for _, m := range p.Modules {
+		ps.Modules = append(ps.Modules, pstypes.Module{Name: m.Name, Size: m.Size})
+	}
+
+	for _, h := range p.Handles {
+		object, err := parseAddress(h.Object)
+		if err != nil {
+			return nil, fmt.Errorf("invalid handle %d: %v", h.ID, err)
+		}
+		ps.Handles = append(ps.Handles, htypes.Handle{
+			Num:    windows.Handle(h.ID),
+			Object: object.Uint64(),
+			Pid:    p.PID,
+			Type:   h.Type,
+			Name:   h.Name,
+		})
+	}
+
+	if p.PE != nil {
+		ps.PE = &pex.PE{
+			NumberOfSections: p.PE.NumberOfSections,
+			NumberOfSymbols:  p.PE.NumberOfSymbols,
+			ImageBase:        p.PE.ImageBase,
+			EntryPoint:       p.PE.EntryPoint,
+			LinkTime:         p.PE.LinkTime,
+			Symbols:          p.PE.Symbols,
+			Imports:          p.PE.Imports,
+			VersionResources: p.PE.VersionResources,
+		}
+		for _, sec := range p.PE.Sections {
+			ps.PE.Sections = append(ps.PE.Sections, pex.Sec{Name: sec.Name, Size: sec.Size, Entropy: sec.Entropy, Md5: sec.Md5})
+		}
+	}
+
+	parent, err := p.Parent.ps()
+	if err != nil {
+		return nil, err
+	}
+	// older payloads don't carry
+	// the parent process identifier
+	if parent != nil && parent.PID == 0 {
+		parent.PID = p.Ppid
+	}
+	ps.Parent = parent
+
+	return ps, nil
+}
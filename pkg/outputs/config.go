@@ -20,13 +20,34 @@ package outputs
 
 import (
 	"fmt"
+	"github.com/rabbitstack/fibratus/pkg/aggregator/transformers"
+	"github.com/rabbitstack/fibratus/pkg/kevent"
 	"github.com/spf13/pflag"
 )
 
+// FieldValuer extracts the value of the filter field from the event.
+type FieldValuer func(kevt *kevent.Kevent) (any, error)
+
+// FieldResolver resolves the filter field name to the valuer. It lets
+// outputs access event fields through the filter accessors without
+// depending on the filter engine.
+type FieldResolver func(field string) (FieldValuer, error)
+
 // Config contains the output configuration.
 type Config struct {
 	Type   Type
 	Output interface{}
+	// Filter is the optional filter expression that determines
+	// which events are routed to the output. All events are
+	// forwarded to the output if the filter is empty.
+	Filter string
+	// Transformers contains the transformers that are only
+	// applied to the events routed to this output.
+	Transformers []transformers.Config
+	// Resolver resolves filter fields referenced by the output
+	// configuration. It is set by the aggregator before the
+	// output is loaded and may be nil.
+	Resolver FieldResolver
 }
 
 // TLSConfig stores the client TLS parameters.
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	fileEnabled       = "output.file.enabled"
+	filePath          = "output.file.path"
+	fileFormat        = "output.file.format"
+	fileTemplate      = "output.file.template"
+	fileMaxSize       = "output.file.max-size"
+	fileMaxAge        = "output.file.max-age"
+	fileMaxBackups    = "output.file.max-backups"
+	fileCompress      = "output.file.compress"
+	fileFsync         = "output.file.fsync"
+	fileFsyncInterval = "output.file.fsync-interval"
+)
+
+// Config contains the options for tweaking the file output behaviour.
+type Config struct {
+	// Enabled determines whether the file output is enabled.
+	Enabled bool `mapstructure:"enabled"`
+	// Path is the path of the file where events are written. It may contain time specifiers.
+	Path string `mapstructure:"path"`
+	// Format specifies the format of the event lines (json, pretty).
+	Format string `mapstructure:"format"`
+	// Template is the event formatting template used in the pretty format.
+	Template string `mapstructure:"template"`
+	// MaxSize is the maximum size in megabytes of the file before it gets rotated.
+	MaxSize int `mapstructure:"max-size"`
+	// MaxAge is the maximum age of the file before it gets rotated.
+	MaxAge time.Duration `mapstructure:"max-age"`
+	// MaxBackups is the maximum number of rotated files to retain.
+	MaxBackups int `mapstructure:"max-backups"`
+	// Compress specifies the compression algorithm of the rotated files (none, gzip, zstd).
+	Compress string `mapstructure:"compress"`
+	// Fsync determines when the written events are committed to stable storage (none, batch, interval).
+	Fsync string `mapstructure:"fsync"`
+	// FsyncInterval is the minimum interval between two consecutive commits in the interval fsync policy.
+	FsyncInterval time.Duration `mapstructure:"fsync-interval"`
+}
+
+// path returns the file path template. If no path is
+// given, events are written to the Events directory
+// under the installation directory.
+func (c Config) path() string {
+	if c.Path != "" {
+		return c.Path
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return filepath.Join(os.Getenv("PROGRAMFILES"), "Fibratus", "Events", "fibratus-%Y-%m-%d.json")
+	}
+	return filepath.Join(filepath.Dir(exe), "..", "Events", "fibratus-%Y-%m-%d.json")
+}
+
+// AddFlags registers persistent flags for the file output.
+func AddFlags(flags *pflag.FlagSet) {
+	flags.Bool(fileEnabled, false, "Determines whether the file output is enabled")
+	flags.String(filePath, "", "Specifies the path of the file where events are written. It may contain time specifiers")
+	flags.String(fileFormat, string(json), "Specifies the format of the event lines (json|pretty)")
+	flags.String(fileTemplate, "", "Event formatting template used in the pretty format")
+	flags.Int(fileMaxSize, 100, "Specifies the maximum size in megabytes of the file before it gets rotated")
+	flags.Duration(fileMaxAge, time.Hour*24, "Specifies the maximum age of the file before it gets rotated")
+	flags.Int(fileMaxBackups, 10, "Specifies the maximum number of rotated files to retain")
+	flags.String(fileCompress, none, "Specifies the compression algorithm of the rotated files (none|gzip|zstd)")
+	flags.String(fileFsync, batchFsync, "Determines when the written events are committed to stable storage (none|batch|interval)")
+	flags.Duration(fileFsyncInterval, time.Second, "Specifies the minimum interval between two consecutive commits in the interval fsync policy")
+}
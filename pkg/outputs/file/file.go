@@ -0,0 +1,154 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"expvar"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"github.com/rabbitstack/fibratus/pkg/outputs"
+)
+
+// fileErrors counts the number of failed event writes
+var fileErrors = expvar.NewInt("output.file.errors")
+
+type format string
+
+const (
+	pretty format = "pretty"
+	json   format = "json"
+	// template represents the default template used in pretty rendering mode
+	template = "{{ .Seq }} {{ .Timestamp }} - {{ .CPU }} {{ .Process }} ({{ .Pid }}) - {{ .Type }} ({{ .Kparams }})"
+)
+
+type file struct {
+	path      string
+	format    format
+	formatter *kevent.Formatter
+	r         *rotator
+}
+
+func init() {
+	outputs.Register(outputs.File, initFile)
+}
+
+func initFile(config outputs.Config) (outputs.OutputGroup, error) {
+	cfg, ok := config.Output.(Config)
+	if !ok {
+		return outputs.Fail(outputs.ErrInvalidConfig(outputs.File, config.Output))
+	}
+	if cfg.Format == "" {
+		cfg.Format = string(json)
+	}
+	if cfg.Compress == "" {
+		cfg.Compress = none
+	}
+	if cfg.Fsync == "" {
+		cfg.Fsync = batchFsync
+	}
+
+	f := &file{
+		path:   cfg.path(),
+		format: format(cfg.Format),
+	}
+
+	switch f.format {
+	case json:
+	case pretty:
+		tmpl := cfg.Template
+		if tmpl == "" {
+			tmpl = template
+		}
+		var err error
+		f.formatter, err = kevent.NewFormatter(tmpl)
+		if err != nil {
+			return outputs.Fail(err)
+		}
+	default:
+		return outputs.Fail(fmt.Errorf("unsupported file output format: %s", cfg.Format))
+	}
+	switch cfg.Compress {
+	case none, gzipCompress, zstdCompress:
+	default:
+		return outputs.Fail(fmt.Errorf("unsupported file compression: %s", cfg.Compress))
+	}
+	switch cfg.Fsync {
+	case none, batchFsync, intervalFsync:
+	default:
+		return outputs.Fail(fmt.Errorf("unsupported file fsync policy: %s", cfg.Fsync))
+	}
+
+	f.r = newRotator(f.path, cfg)
+
+	return outputs.Success(f), nil
+}
+
+// Connect is a no-op since the file is
+// lazily opened on the first write.
+func (f *file) Connect() error { return nil }
+
+func (f *file) Close() error { return f.r.close() }
+
+func (f *file) Publish(batch *kevent.Batch) error {
+	name := f.filename(f.r.now())
+	for _, kevt := range batch.Events {
+		var buf []byte
+		switch f.format {
+		case json:
+			buf = kevt.MarshalJSON()
+		case pretty:
+			buf = f.formatter.Format(kevt)
+		}
+		buf = append(buf, '\n')
+		if err := f.r.write(name, buf); err != nil {
+			fileErrors.Add(1)
+			return err
+		}
+	}
+	if err := f.r.sync(); err != nil {
+		fileErrors.Add(1)
+		return err
+	}
+	return nil
+}
+
+// filename creates the file name by replacing time
+// specifiers with the current time. The wall clock
+// time is used instead of event timestamps, so the
+// output never switches back to an older file. If
+// no time specifiers are used, the path is returned
+// as is.
+func (f *file) filename(timestamp time.Time) string {
+	if !strings.Contains(f.path, "%") {
+		return f.path
+	}
+	return specifiers(timestamp).Replace(f.path)
+}
+
+func specifiers(timestamp time.Time) *strings.Replacer {
+	return strings.NewReplacer(
+		"%Y", timestamp.UTC().Format("2006"),
+		"%y", timestamp.UTC().Format("06"),
+		"%m", timestamp.UTC().Format("01"),
+		"%d", timestamp.UTC().Format("02"),
+		"%H", timestamp.UTC().Format("15"))
+}
@@ -0,0 +1,251 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	encjson "encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"github.com/rabbitstack/fibratus/pkg/kevent/ktypes"
+	"github.com/rabbitstack/fibratus/pkg/outputs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	zstd "github.com/valyala/gozstd"
+)
+
+// clock is the fake clock driving time specifiers and rotations
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newFile(t *testing.T, cfg Config, c *clock) *file {
+	out, err := initFile(outputs.Config{Type: outputs.File, Output: cfg})
+	require.NoError(t, err)
+	require.Len(t, out.Clients, 1)
+	f := out.Clients[0].(*file)
+	if c != nil {
+		f.r.now = c.now
+	}
+	return f
+}
+
+func newBatch(seqs ...uint64) *kevent.Batch {
+	evts := make([]*kevent.Kevent, 0, len(seqs))
+	for _, seq := range seqs {
+		evts = append(evts, &kevent.Kevent{
+			Type:      ktypes.CreateFile,
+			Seq:       seq,
+			Tid:       2484,
+			PID:       859,
+			Name:      "CreateFile",
+			Category:  ktypes.File,
+			Host:      "archrabbit",
+			Timestamp: time.Now(),
+			Kparams:   kevent.Kparams{},
+			Metadata:  make(map[kevent.MetadataKey]any),
+		})
+	}
+	return kevent.NewBatch(evts...)
+}
+
+func readLines(t *testing.T, r io.Reader) []string {
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
+
+func readFile(t *testing.T, name string) []string {
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+	return readLines(t, f)
+}
+
+func seqs(t *testing.T, lines []string) []uint64 {
+	s := make([]uint64, 0, len(lines))
+	for _, line := range lines {
+		var evt struct {
+			Seq uint64 `json:"seq"`
+		}
+		require.NoError(t, encjson.Unmarshal([]byte(line), &evt))
+		s = append(s, evt.Seq)
+	}
+	return s
+}
+
+func TestFileNDJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+	f := newFile(t, Config{Path: path}, nil)
+
+	require.NoError(t, f.Publish(newBatch(1, 2)))
+	require.NoError(t, f.Publish(newBatch(3)))
+	require.NoError(t, f.Close())
+
+	assert.Equal(t, []uint64{1, 2, 3}, seqs(t, readFile(t, path)))
+
+	// events are appended to the existing file
+	f = newFile(t, Config{Path: path}, nil)
+	require.NoError(t, f.Publish(newBatch(4)))
+	require.NoError(t, f.Close())
+
+	assert.Equal(t, []uint64{1, 2, 3, 4}, seqs(t, readFile(t, path)))
+}
+
+func TestFilePretty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	f := newFile(t, Config{Path: path, Format: "pretty", Template: "{{ .Seq }} {{ .Type }}", Fsync: intervalFsync, FsyncInterval: time.Second}, nil)
+
+	require.NoError(t, f.Publish(newBatch(1, 2)))
+	require.NoError(t, f.Close())
+
+	assert.Equal(t, []string{"1 CreateFile", "2 CreateFile"}, readFile(t, path))
+}
+
+func TestFilePathTemplate(t *testing.T) {
+	dir := t.TempDir()
+	c := &clock{t: time.Date(2023, 5, 3, 23, 59, 0, 0, time.UTC)}
+	f := newFile(t, Config{Path: filepath.Join(dir, "%Y", "fibratus-%m-%d.json")}, c)
+
+	require.NoError(t, f.Publish(newBatch(1)))
+	c.advance(time.Minute * 2)
+	require.NoError(t, f.Publish(newBatch(2, 3)))
+	require.NoError(t, f.Close())
+
+	assert.Equal(t, []uint64{1}, seqs(t, readFile(t, filepath.Join(dir, "2023", "fibratus-05-03.json"))))
+	assert.Equal(t, []uint64{2, 3}, seqs(t, readFile(t, filepath.Join(dir, "2023", "fibratus-05-04.json"))))
+}
+
+func TestFileRotateSize(t *testing.T) {
+	dir := t.TempDir()
+	c := &clock{t: time.Date(2023, 5, 3, 15, 4, 5, 0, time.UTC)}
+	f := newFile(t, Config{Path: filepath.Join(dir, "events.json"), MaxBackups: 2}, c)
+	// one event per file
+	f.r.maxSize = 10
+
+	for seq := uint64(1); seq <= 4; seq++ {
+		require.NoError(t, f.Publish(newBatch(seq)))
+		c.advance(time.Second)
+	}
+	require.NoError(t, f.Close())
+
+	assert.Equal(t, []uint64{4}, seqs(t, readFile(t, filepath.Join(dir, "events.json"))))
+	assert.Equal(t, []uint64{3}, seqs(t, readFile(t, filepath.Join(dir, "events-2023-05-03T15-04-08.000.json"))))
+	assert.Equal(t, []uint64{2}, seqs(t, readFile(t, filepath.Join(dir, "events-2023-05-03T15-04-07.000.json"))))
+	// the oldest backup was removed
+	assert.NoFileExists(t, filepath.Join(dir, "events-2023-05-03T15-04-06.000.json"))
+}
+
+func TestFileRotateAge(t *testing.T) {
+	dir := t.TempDir()
+	c := &clock{t: time.Date(2023, 5, 3, 15, 4, 5, 0, time.UTC)}
+	f := newFile(t, Config{Path: filepath.Join(dir, "events.json"), MaxAge: time.Hour}, c)
+
+	require.NoError(t, f.Publish(newBatch(1)))
+	c.advance(time.Minute * 30)
+	require.NoError(t, f.Publish(newBatch(2)))
+	c.advance(time.Minute * 30)
+	require.NoError(t, f.Publish(newBatch(3)))
+	require.NoError(t, f.Close())
+
+	assert.Equal(t, []uint64{3}, seqs(t, readFile(t, filepath.Join(dir, "events.json"))))
+	assert.Equal(t, []uint64{1, 2}, seqs(t, readFile(t, filepath.Join(dir, "events-2023-05-03T16-04-05.000.json"))))
+}
+
+func TestFileCompress(t *testing.T) {
+	var tests = []struct {
+		compress string
+		ext      string
+		read     func(t *testing.T, name string) []string
+	}{
+		{gzipCompress, ".gz", func(t *testing.T, name string) []string {
+			f, err := os.Open(name)
+			require.NoError(t, err)
+			defer f.Close()
+			zr, err := gzip.NewReader(f)
+			require.NoError(t, err)
+			return readLines(t, zr)
+		}},
+		{zstdCompress, ".zst", func(t *testing.T, name string) []string {
+			b, err := os.ReadFile(name)
+			require.NoError(t, err)
+			b, err = zstd.Decompress(nil, b)
+			require.NoError(t, err)
+			return readLines(t, strings.NewReader(string(b)))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.compress, func(t *testing.T) {
+			dir := t.TempDir()
+			c := &clock{t: time.Date(2023, 5, 3, 15, 4, 5, 0, time.UTC)}
+			f := newFile(t, Config{Path: filepath.Join(dir, "events.json"), Compress: tt.compress}, c)
+			f.r.maxSize = 10
+
+			for seq := uint64(1); seq <= 3; seq++ {
+				require.NoError(t, f.Publish(newBatch(seq)))
+				c.advance(time.Second)
+			}
+			require.NoError(t, f.Close())
+
+			matches, err := filepath.Glob(filepath.Join(dir, "*"))
+			require.NoError(t, err)
+			sort.Strings(matches)
+			require.Equal(t, []string{
+				filepath.Join(dir, "events-2023-05-03T15-04-06.000.json"+tt.ext),
+				filepath.Join(dir, "events-2023-05-03T15-04-07.000.json"+tt.ext),
+				filepath.Join(dir, "events.json"),
+			}, matches)
+
+			assert.Equal(t, []uint64{1}, seqs(t, tt.read(t, matches[0])))
+			assert.Equal(t, []uint64{2}, seqs(t, tt.read(t, matches[1])))
+		})
+	}
+}
+
+func TestFileInvalidConfig(t *testing.T) {
+	var tests = []struct {
+		cfg Config
+		err string
+	}{
+		{Config{Format: "xml"}, "unsupported file output format: xml"},
+		{Config{Compress: "lz4"}, "unsupported file compression: lz4"},
+		{Config{Fsync: "always"}, "unsupported file fsync policy: always"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err, func(t *testing.T) {
+			_, err := initFile(outputs.Config{Type: outputs.File, Output: tt.cfg})
+			require.EqualError(t, err, tt.err)
+		})
+	}
+}
@@ -0,0 +1,409 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	"expvar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	zstd "github.com/valyala/gozstd"
+)
+
+const (
+	none = "none"
+
+	gzipCompress = "gzip"
+	zstdCompress = "zstd"
+
+	batchFsync    = "batch"
+	intervalFsync = "interval"
+
+	// backupTimeFormat is the timestamp layout appended to the rotated file names
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+
+	megabyte = 1024 * 1024
+)
+
+var (
+	// fileRotations counts the number of times the file was rotated
+	fileRotations = expvar.NewInt("output.file.rotations")
+	// fileMillErrors counts the number of errors produced by compressing or removing rotated files
+	fileMillErrors = expvar.NewInt("output.file.mill.errors")
+)
+
+// rotator writes events to the file and rotates it when the size or
+// age limits are exceeded, or when the file name derived from the path
+// template changes. Rotated files are compressed and expired in the
+// background.
+type rotator struct {
+	pattern       string
+	maxSize       int64
+	maxAge        time.Duration
+	maxBackups    int
+	compress      string
+	fsync         string
+	fsyncInterval time.Duration
+
+	mu     sync.Mutex // guards the active file name accessed by the mill
+	file   *os.File
+	w      *bufio.Writer
+	name   string
+	size   int64
+	opened time.Time
+	synced time.Time
+
+	millc chan struct{}
+	wg    sync.WaitGroup
+
+	now func() time.Time
+}
+
+func newRotator(path string, config Config) *rotator {
+	r := &rotator{
+		pattern:       globPattern(path),
+		maxSize:       int64(config.MaxSize) * megabyte,
+		maxAge:        config.MaxAge,
+		maxBackups:    config.MaxBackups,
+		compress:      config.Compress,
+		fsync:         config.Fsync,
+		fsyncInterval: config.FsyncInterval,
+		millc:         make(chan struct{}, 1),
+		now:           time.Now,
+	}
+	r.wg.Add(1)
+	go r.run()
+	return r
+}
+
+// write appends the buffer to the file with the given name. The
+// current file is rotated if writing the buffer would exceed the
+// max size, the file is older than max age, or the name changed.
+func (r *rotator) write(name string, b []byte) error {
+	switch {
+	case r.file == nil:
+		if err := r.open(name); err != nil {
+			return err
+		}
+		// process the files left over by the previous run
+		r.mill()
+	case r.name != name:
+		if err := r.closeFile(); err != nil {
+			return err
+		}
+		if err := r.open(name); err != nil {
+			return err
+		}
+		r.mill()
+	case r.size > 0 && r.shouldRotate(len(b)):
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := r.w.Write(b)
+	r.size += int64(n)
+	return err
+}
+
+func (r *rotator) shouldRotate(n int) bool {
+	if r.maxSize > 0 && r.size+int64(n) > r.maxSize {
+		return true
+	}
+	return r.maxAge > 0 && r.now().Sub(r.opened) >= r.maxAge
+}
+
+// sync flushes buffered events to the file and commits
+// them to stable storage according to the fsync policy.
+func (r *rotator) sync() error {
+	if r.file == nil {
+		return nil
+	}
+	if err := r.w.Flush(); err != nil {
+		return err
+	}
+	switch r.fsync {
+	case batchFsync:
+	case intervalFsync:
+		if r.now().Sub(r.synced) < r.fsyncInterval {
+			return nil
+		}
+	default:
+		return nil
+	}
+	r.synced = r.now()
+	return r.file.Sync()
+}
+
+func (r *rotator) open(name string) error {
+	if err := os.MkdirAll(filepath.Dir(name), os.ModePerm); err != nil {
+		return err
+	}
+	// the file is created while holding the lock, so
+	// the mill can't mistake it for the rotated file
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %v", name, err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	r.name = name
+	r.file = f
+	r.size = fi.Size()
+	r.opened = r.now()
+	r.synced = r.opened
+	if r.w == nil {
+		r.w = bufio.NewWriterSize(f, 64*1024)
+	} else {
+		r.w.Reset(f)
+	}
+	return nil
+}
+
+// rotate closes the current file, renames it by appending
+// the rotation timestamp, and opens a new file in its place.
+func (r *rotator) rotate() error {
+	name := r.name
+	if err := r.closeFile(); err != nil {
+		return err
+	}
+	if err := os.Rename(name, backupName(name, r.now())); err != nil {
+		return err
+	}
+	fileRotations.Add(1)
+	if err := r.open(name); err != nil {
+		return err
+	}
+	r.mill()
+	return nil
+}
+
+func (r *rotator) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+	f := r.file
+	r.file = nil
+	if err := r.w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if r.fsync != none {
+		if err := f.Sync(); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+func (r *rotator) close() error {
+	err := r.closeFile()
+	close(r.millc)
+	r.wg.Wait()
+	return err
+}
+
+// mill signals the background goroutine to process rotated files.
+func (r *rotator) mill() {
+	select {
+	case r.millc <- struct{}{}:
+	default:
+	}
+}
+
+func (r *rotator) run() {
+	defer r.wg.Done()
+	for range r.millc {
+		r.processBackups()
+	}
+}
+
+// processBackups compresses rotated files and removes the
+// oldest files exceeding the max number of backups.
+func (r *rotator) processBackups() {
+	backups, err := r.backups()
+	if err != nil {
+		fileMillErrors.Add(1)
+		log.Warnf("unable to list rotated files: %v", err)
+		return
+	}
+	if r.maxBackups > 0 && len(backups) > r.maxBackups {
+		for _, backup := range backups[r.maxBackups:] {
+			if err := os.Remove(backup.name); err != nil && !os.IsNotExist(err) {
+				fileMillErrors.Add(1)
+				log.Warnf("unable to remove rotated file %s: %v", backup.name, err)
+			}
+		}
+		backups = backups[:r.maxBackups]
+	}
+	if r.compress == none {
+		return
+	}
+	for _, backup := range backups {
+		if isCompressed(backup.name) {
+			continue
+		}
+		if err := compressFile(backup.name, r.compress, backup.modTime); err != nil {
+			fileMillErrors.Add(1)
+			log.Warnf("unable to compress rotated file %s: %v", backup.name, err)
+		}
+	}
+}
+
+type backup struct {
+	name    string
+	modTime time.Time
+}
+
+// backups returns all files produced by the path template except
+// the active file. Files are sorted by modification time with the
+// most recent file coming first.
+func (r *rotator) backups() ([]backup, error) {
+	r.mu.Lock()
+	active := r.name
+	matches, err := filepath.Glob(r.pattern)
+	r.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]backup, 0, len(matches))
+	for _, match := range matches {
+		if match == active {
+			continue
+		}
+		// the compressed file is incomplete if the original
+		// file still exists, since the compression was
+		// interrupted. It is overwritten once the original
+		// file is compressed again
+		if isCompressed(match) && contains(matches, strings.TrimSuffix(match, filepath.Ext(match))) {
+			continue
+		}
+		fi, err := os.Stat(match)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		backups = append(backups, backup{name: match, modTime: fi.ModTime()})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].modTime.Equal(backups[j].modTime) {
+			return backups[i].name > backups[j].name
+		}
+		return backups[i].modTime.After(backups[j].modTime)
+	})
+	return backups, nil
+}
+
+// compressFile compresses the file with the given algorithm and
+// removes the original file. The compressed file retains the
+// modification time of the original file.
+func compressFile(name, algo string, modTime time.Time) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+compressExt(algo), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	switch algo {
+	case gzipCompress:
+		zw := gzip.NewWriter(dst)
+		if _, err = io.Copy(zw, src); err == nil {
+			err = zw.Close()
+		}
+	case zstdCompress:
+		zw := zstd.NewWriter(dst)
+		if _, err = io.Copy(zw, src); err == nil {
+			err = zw.Close()
+		}
+		zw.Release()
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(name + compressExt(algo))
+		return err
+	}
+	_ = os.Chtimes(name+compressExt(algo), modTime, modTime)
+	// the source file must be closed before it is removed
+	_ = src.Close()
+	return os.Remove(name)
+}
+
+func compressExt(algo string) string {
+	switch algo {
+	case gzipCompress:
+		return ".gz"
+	case zstdCompress:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+func isCompressed(name string) bool {
+	return strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".zst")
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// backupName produces the name of the rotated file by inserting
+// the rotation timestamp between the file name and the extension.
+func backupName(name string, t time.Time) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "-" + t.UTC().Format(backupTimeFormat) + ext
+}
+
+// globPattern builds the pattern matching the files produced by the
+// path template. Time specifiers are replaced by wildcards and the
+// wildcard between the file name and the extension matches the
+// rotation timestamp, while the trailing wildcard matches the
+// compression extension.
+func globPattern(path string) string {
+	pattern := strings.NewReplacer("%Y", "*", "%y", "*", "%m", "*", "%d", "*", "%H", "*").Replace(path)
+	ext := filepath.Ext(pattern)
+	return strings.TrimSuffix(pattern, ext) + "*" + ext + "*"
+}
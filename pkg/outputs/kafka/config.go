@@ -0,0 +1,91 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"time"
+
+	"github.com/rabbitstack/fibratus/pkg/outputs"
+	"github.com/spf13/pflag"
+)
+
+const (
+	kafkaEnabled         = "output.kafka.enabled"
+	kafkaBrokers         = "output.kafka.brokers"
+	kafkaTopic           = "output.kafka.topic"
+	kafkaPartitionKey    = "output.kafka.partition-key"
+	kafkaAcks            = "output.kafka.acks"
+	kafkaCompression     = "output.kafka.compression"
+	kafkaMaxMessageBytes = "output.kafka.max-message-bytes"
+	kafkaTimeout         = "output.kafka.timeout"
+	kafkaClientID        = "output.kafka.client-id"
+	kafkaEnableTLS       = "output.kafka.enable-tls"
+	kafkaSASLMechanism   = "output.kafka.sasl-mechanism"
+	kafkaSASLUsername    = "output.kafka.sasl-username"
+	kafkaSASLPassword    = "output.kafka.sasl-password"
+)
+
+// Config contains the options for tweaking the Kafka output behaviour.
+type Config struct {
+	outputs.TLSConfig
+	// Enabled determines whether Kafka output is enabled.
+	Enabled bool `mapstructure:"enabled"`
+	// Brokers contains the addresses of the bootstrap brokers.
+	Brokers []string `mapstructure:"brokers"`
+	// Topic is the topic name. It may contain event formatting template fields.
+	Topic string `mapstructure:"topic"`
+	// PartitionKey determines the event field used as the message key (host, ps.uuid, or any filter field).
+	PartitionKey string `mapstructure:"partition-key"`
+	// Acks represents the delivery acknowledgement level (none, leader, all).
+	Acks string `mapstructure:"acks"`
+	// Compression is the compression codec of the record batches (none, gzip, snappy, lz4, zstd).
+	Compression string `mapstructure:"compression"`
+	// MaxMessageBytes is the maximum size of the record batch sent to the single partition.
+	MaxMessageBytes int `mapstructure:"max-message-bytes"`
+	// Timeout represents the timeout for connecting to brokers and waiting for responses.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// ClientID is the client identifier sent in requests.
+	ClientID string `mapstructure:"client-id"`
+	// EnableTLS determines whether the connection to brokers is secured with TLS.
+	EnableTLS bool `mapstructure:"enable-tls"`
+	// SASLMechanism is the SASL authentication mechanism (plain, scram-sha-256, scram-sha-512).
+	SASLMechanism string `mapstructure:"sasl-mechanism"`
+	// SASLUsername is the username for the SASL authentication.
+	SASLUsername string `mapstructure:"sasl-username"`
+	// SASLPassword is the password for the SASL authentication.
+	SASLPassword string `mapstructure:"sasl-password"`
+}
+
+// AddFlags registers persistent flags for the Kafka output.
+func AddFlags(flags *pflag.FlagSet) {
+	flags.Bool(kafkaEnabled, false, "Determines whether the Kafka output is enabled")
+	flags.StringSlice(kafkaBrokers, []string{"localhost:9092"}, "Contains the addresses of the bootstrap brokers")
+	flags.String(kafkaTopic, "fibratus", "Specifies the topic name. It may contain event formatting template fields")
+	flags.String(kafkaPartitionKey, "", "Determines the event field used as the message key (host|ps.uuid|any filter field)")
+	flags.String(kafkaAcks, acksAll, "Represents the delivery acknowledgement level (none|leader|all)")
+	flags.String(kafkaCompression, none, "Specifies the compression codec of the record batches (none|gzip|snappy|lz4|zstd)")
+	flags.Int(kafkaMaxMessageBytes, 1000000, "Specifies the maximum size of the record batch sent to the single partition")
+	flags.Duration(kafkaTimeout, time.Second*10, "Represents the timeout for connecting to brokers and waiting for responses")
+	flags.String(kafkaClientID, "fibratus", "Specifies the client identifier sent in requests")
+	flags.Bool(kafkaEnableTLS, false, "Determines whether the connection to brokers is secured with TLS")
+	flags.String(kafkaSASLMechanism, "", "Specifies the SASL authentication mechanism (plain|scram-sha-256|scram-sha-512)")
+	flags.String(kafkaSASLUsername, "", "Specifies the username for the SASL authentication")
+	flags.String(kafkaSASLPassword, "", "Specifies the password for the SASL authentication")
+	outputs.AddTLSFlags(flags, outputs.Kafka)
+}
@@ -0,0 +1,346 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"expvar"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"github.com/rabbitstack/fibratus/pkg/outputs"
+	tlsutil "github.com/rabbitstack/fibratus/pkg/util/tls"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	none = "none"
+
+	gzipCompression   = "gzip"
+	snappyCompression = "snappy"
+	lz4Compression    = "lz4"
+	zstdCompression   = "zstd"
+
+	acksLeader = "leader"
+	acksAll    = "all"
+
+	plainMechanism       = "plain"
+	scramSHA256Mechanism = "scram-sha-256"
+	scramSHA512Mechanism = "scram-sha-512"
+
+	hostKey   = "host"
+	psUUIDKey = "ps.uuid"
+
+	// maxAttempts is the maximum number of attempts to produce
+	// the record batch that failed with retriable errors
+	maxAttempts = 3
+	// retryBackoff is the minimum time to wait before producing
+	// the record batch again
+	retryBackoff = time.Millisecond * 250
+	// batchTimeout is the time the writer waits for more events
+	// to land in the partition before the record batch is sent.
+	// Events are already batched by the aggregator, so the writer
+	// flushes as soon as all events of the batch are assigned
+	batchTimeout = time.Millisecond * 5
+)
+
+var (
+	// kafkaErrors counts the number of batches that failed to be produced
+	kafkaErrors = expvar.NewInt("output.kafka.errors")
+	// kafkaMessages counts the number of produced messages
+	kafkaMessages = expvar.NewInt("output.kafka.messages")
+	// kafkaOversizedMessages counts the number of messages dropped due to exceeding the max message size
+	kafkaOversizedMessages = expvar.NewInt("output.kafka.oversized.messages")
+)
+
+type kafka struct {
+	config    Config
+	transport *kafkago.Transport
+	writer    *kafkago.Writer
+	// topic renders the topic name if the topic contains template fields
+	topic *kevent.Formatter
+	// key extracts the message key from the event
+	key func(kevt *kevent.Kevent) []byte
+}
+
+func init() {
+	outputs.Register(outputs.Kafka, initKafka)
+}
+
+func initKafka(config outputs.Config) (outputs.OutputGroup, error) {
+	cfg, ok := config.Output.(Config)
+	if !ok {
+		return outputs.Fail(outputs.ErrInvalidConfig(outputs.Kafka, config.Output))
+	}
+	if len(cfg.Brokers) == 0 {
+		return outputs.Fail(errors.New("at least one kafka broker is required"))
+	}
+	if cfg.Topic == "" {
+		cfg.Topic = "fibratus"
+	}
+	if cfg.Acks == "" {
+		cfg.Acks = acksAll
+	}
+	if cfg.Compression == "" {
+		cfg.Compression = none
+	}
+	if cfg.MaxMessageBytes <= 0 {
+		cfg.MaxMessageBytes = 1000000
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Second * 10
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "fibratus"
+	}
+	cfg.SASLMechanism = strings.ToLower(cfg.SASLMechanism)
+
+	var acks kafkago.RequiredAcks
+	switch cfg.Acks {
+	case none:
+		acks = kafkago.RequireNone
+	case acksLeader:
+		acks = kafkago.RequireOne
+	case acksAll:
+		acks = kafkago.RequireAll
+	default:
+		return outputs.Fail(fmt.Errorf("unsupported kafka acks: %s", cfg.Acks))
+	}
+
+	var codec kafkago.Compression
+	switch cfg.Compression {
+	case none:
+	case gzipCompression:
+		codec = kafkago.Gzip
+	case snappyCompression:
+		codec = kafkago.Snappy
+	case lz4Compression:
+		codec = kafkago.Lz4
+	case zstdCompression:
+		codec = kafkago.Zstd
+	default:
+		return outputs.Fail(fmt.Errorf("unsupported kafka compression: %s", cfg.Compression))
+	}
+
+	mechanism, err := newSASLMechanism(cfg)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	k := &kafka{config: cfg}
+
+	if strings.Contains(cfg.Topic, "{{") {
+		k.topic, err = kevent.NewFormatter(cfg.Topic)
+		if err != nil {
+			return outputs.Fail(fmt.Errorf("invalid kafka topic template: %v", err))
+		}
+	}
+
+	k.key, err = newKeyFunc(cfg.PartitionKey, config.Resolver)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	tlsConfig, err := tlsutil.MakeConfig(cfg.TLSCert, cfg.TLSKey, cfg.TLSCA, cfg.TLSInsecureSkipVerify)
+	if err != nil {
+		return outputs.Fail(fmt.Errorf("invalid TLS config: %v", err))
+	}
+	if tlsConfig == nil && cfg.EnableTLS {
+		tlsConfig = &tls.Config{InsecureSkipVerify: cfg.TLSInsecureSkipVerify} //nolint:gosec
+	}
+
+	k.transport = &kafkago.Transport{
+		DialTimeout: cfg.Timeout,
+		ClientID:    cfg.ClientID,
+		TLS:         tlsConfig,
+		SASL:        mechanism,
+	}
+	k.writer = &kafkago.Writer{
+		Addr:                   kafkago.TCP(cfg.Brokers...),
+		Balancer:               &partitioner{},
+		MaxAttempts:            maxAttempts,
+		WriteBackoffMin:        retryBackoff,
+		BatchSize:              math.MaxInt32,
+		BatchBytes:             int64(cfg.MaxMessageBytes),
+		BatchTimeout:           batchTimeout,
+		ReadTimeout:            cfg.Timeout,
+		WriteTimeout:           cfg.Timeout,
+		RequiredAcks:           acks,
+		Compression:            codec,
+		Transport:              k.transport,
+		AllowAutoTopicCreation: true,
+	}
+
+	return outputs.Success(k), nil
+}
+
+// newSASLMechanism returns the SASL mechanism for authenticating
+// to brokers or nil if the authentication is disabled.
+func newSASLMechanism(cfg Config) (sasl.Mechanism, error) {
+	switch cfg.SASLMechanism {
+	case "":
+		return nil, nil
+	case plainMechanism:
+		return plain.Mechanism{Username: cfg.SASLUsername, Password: cfg.SASLPassword}, nil
+	case scramSHA256Mechanism:
+		return scram.Mechanism(scram.SHA256, cfg.SASLUsername, cfg.SASLPassword)
+	case scramSHA512Mechanism:
+		return scram.Mechanism(scram.SHA512, cfg.SASLUsername, cfg.SASLPassword)
+	default:
+		return nil, fmt.Errorf("unsupported kafka SASL mechanism: %s", cfg.SASLMechanism)
+	}
+}
+
+// newKeyFunc returns the function that extracts the message key from the
+// event. The host and the process UUID keys are resolved directly, while
+// other keys are evaluated by the filter field resolver.
+func newKeyFunc(partitionKey string, resolver outputs.FieldResolver) (func(*kevent.Kevent) []byte, error) {
+	switch partitionKey {
+	case "":
+		return nil, nil
+	case hostKey:
+		return func(kevt *kevent.Kevent) []byte {
+			if kevt.Host == "" {
+				return nil
+			}
+			return []byte(kevt.Host)
+		}, nil
+	case psUUIDKey:
+		return func(kevt *kevent.Kevent) []byte {
+			if kevt.PS == nil {
+				return nil
+			}
+			return strconv.AppendUint(nil, kevt.PS.UUID(), 10)
+		}, nil
+	}
+	if resolver == nil {
+		return nil, fmt.Errorf("unable to resolve kafka partition key %s", partitionKey)
+	}
+	valuer, err := resolver(partitionKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kafka partition key: %v", err)
+	}
+	return func(kevt *kevent.Kevent) []byte {
+		v, err := valuer(kevt)
+		if err != nil || v == nil {
+			return nil
+		}
+		return []byte(fmt.Sprintf("%v", v))
+	}, nil
+}
+
+// Connect fetches the cluster metadata from bootstrap brokers to
+// verify the brokers are reachable and accept the credentials.
+// Connections to partition leaders are established by the writer
+// on demand.
+func (k *kafka) Connect() error {
+	client := &kafkago.Client{
+		Addr:      k.writer.Addr,
+		Timeout:   k.config.Timeout,
+		Transport: k.transport,
+	}
+	if _, err := client.Metadata(context.Background(), &kafkago.MetadataRequest{}); err != nil {
+		return fmt.Errorf("unable to fetch metadata from kafka brokers %s: %v", strings.Join(k.config.Brokers, ","), err)
+	}
+	return nil
+}
+
+func (k *kafka) Close() error {
+	err := k.writer.Close()
+	k.transport.CloseIdleConnections()
+	return err
+}
+
+// Publish produces the event batch. Events are assigned to topic
+// partitions and each partition receives a single record batch
+// unless the records exceed the max message size. Record batches
+// that fail with retriable errors are produced again, so the
+// delivery guarantee is at-least-once.
+func (k *kafka) Publish(batch *kevent.Batch) error {
+	msgs := make([]kafkago.Message, 0, batch.Len())
+	for _, kevt := range batch.Events {
+		msg := kafkago.Message{
+			Topic: k.topicName(kevt),
+			Value: kevt.MarshalJSON(),
+			Time:  kevt.Timestamp,
+		}
+		if k.key != nil {
+			msg.Key = k.key(kevt)
+		}
+		msgs = append(msgs, msg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), k.config.Timeout*maxAttempts)
+	defer cancel()
+	err := k.writer.WriteMessages(ctx, msgs...)
+	// the writer rejects the whole batch if any of the messages
+	// exceeds the max message size. Such messages can never be
+	// produced, so they're dropped and the rest is written again
+	var tooLarge kafkago.MessageTooLargeError
+	for errors.As(err, &tooLarge) {
+		log.Warnf("dropping event of %d bytes exceeding the max kafka message size in topic %s", len(tooLarge.Message.Value), tooLarge.Message.Topic)
+		kafkaOversizedMessages.Add(1)
+		msgs = tooLarge.Remaining
+		err = k.writer.WriteMessages(ctx, msgs...)
+	}
+	if err != nil {
+		kafkaErrors.Add(1)
+		var werrs kafkago.WriteErrors
+		if errors.As(err, &werrs) {
+			kafkaMessages.Add(int64(len(msgs) - werrs.Count()))
+		}
+		return fmt.Errorf("unable to produce events to kafka: %v", err)
+	}
+	kafkaMessages.Add(int64(len(msgs)))
+	return nil
+}
+
+func (k *kafka) topicName(kevt *kevent.Kevent) string {
+	if k.topic == nil {
+		return k.config.Topic
+	}
+	return string(k.topic.Format(kevt))
+}
+
+// partitioner selects the partition for the message. Messages with
+// the key are assigned to the partition by the murmur2 hash of the
+// key, which is consistent with the default partitioner of the Java
+// client. Messages without the key are distributed in the round-robin
+// fashion.
+type partitioner struct {
+	hash       kafkago.Murmur2Balancer
+	roundRobin kafkago.RoundRobin
+}
+
+func (p *partitioner) Balance(msg kafkago.Message, partitions ...int) int {
+	if len(msg.Key) == 0 {
+		return p.roundRobin.Balance(msg, partitions...)
+	}
+	return p.hash.Balance(msg, partitions...)
+}
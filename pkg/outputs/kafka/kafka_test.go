@@ -0,0 +1,249 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"github.com/rabbitstack/fibratus/pkg/kevent/ktypes"
+	"github.com/rabbitstack/fibratus/pkg/outputs"
+	pstypes "github.com/rabbitstack/fibratus/pkg/ps/types"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKafka(t *testing.T, cfg Config, resolver outputs.FieldResolver) *kafka {
+	out, err := initKafka(outputs.Config{Type: outputs.Kafka, Output: cfg, Resolver: resolver})
+	require.NoError(t, err)
+	require.Len(t, out.Clients, 1)
+	return out.Clients[0].(*kafka)
+}
+
+func newBatch(n int) *kevent.Batch {
+	ts, _ := time.Parse(time.RFC3339, "2023-05-03T15:04:05.323Z")
+	evts := make([]*kevent.Kevent, 0, n)
+	for i := 0; i < n; i++ {
+		typ, name, cat := ktypes.CreateFile, "CreateFile", ktypes.File
+		if i%2 == 1 {
+			typ, name, cat = ktypes.CreateProcess, "CreateProcess", ktypes.Process
+		}
+		evts = append(evts, &kevent.Kevent{
+			Type:      typ,
+			Seq:       uint64(i + 1),
+			Tid:       2484,
+			PID:       uint32(859 + i%3),
+			Name:      name,
+			Category:  cat,
+			Host:      fmt.Sprintf("archrabbit-%d", i%4),
+			Timestamp: ts.Add(time.Millisecond * time.Duration(i)),
+			Kparams:   kevent.Kparams{},
+			Metadata:  make(map[kevent.MetadataKey]any),
+		})
+	}
+	return kevent.NewBatch(evts...)
+}
+
+func TestKafkaInvalidConfig(t *testing.T) {
+	var tests = []struct {
+		cfg Config
+		err string
+	}{
+		{Config{}, "at least one kafka broker is required"},
+		{Config{Brokers: []string{"localhost:9092"}, Acks: "most"}, "unsupported kafka acks: most"},
+		{Config{Brokers: []string{"localhost:9092"}, Compression: "brotli"}, "unsupported kafka compression: brotli"},
+		{Config{Brokers: []string{"localhost:9092"}, SASLMechanism: "GSSAPI"}, "unsupported kafka SASL mechanism: gssapi"},
+		{Config{Brokers: []string{"localhost:9092"}, PartitionKey: "ps.name"}, "unable to resolve kafka partition key ps.name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err, func(t *testing.T) {
+			_, err := initKafka(outputs.Config{Type: outputs.Kafka, Output: tt.cfg})
+			require.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestKafkaConfig(t *testing.T) {
+	k := newKafka(t, Config{Brokers: []string{"localhost:9092"}}, nil)
+	assert.Equal(t, "fibratus", k.config.Topic)
+	assert.Equal(t, kafkago.RequireAll, k.writer.RequiredAcks)
+	assert.Equal(t, kafkago.Compression(0), k.writer.Compression)
+	assert.Equal(t, int64(1000000), k.writer.BatchBytes)
+	assert.Equal(t, "fibratus", k.transport.ClientID)
+	assert.Nil(t, k.transport.TLS)
+	assert.Nil(t, k.transport.SASL)
+
+	k = newKafka(t, Config{
+		Brokers:       []string{"localhost:9092"},
+		Acks:          acksLeader,
+		Compression:   zstdCompression,
+		ClientID:      "edr",
+		EnableTLS:     true,
+		SASLMechanism: "SCRAM-SHA-512",
+		SASLUsername:  "fibratus",
+		SASLPassword:  "s3cr3t",
+	}, nil)
+	assert.Equal(t, kafkago.RequireOne, k.writer.RequiredAcks)
+	assert.Equal(t, kafkago.Zstd, k.writer.Compression)
+	assert.Equal(t, "edr", k.transport.ClientID)
+	assert.NotNil(t, k.transport.TLS)
+	require.NotNil(t, k.transport.SASL)
+	assert.Equal(t, "SCRAM-SHA-512", k.transport.SASL.Name())
+}
+
+func TestKafkaTopicTemplate(t *testing.T) {
+	k := newKafka(t, Config{Brokers: []string{"localhost:9092"}, Topic: "fibratus-{{ .Type }}"}, nil)
+	batch := newBatch(2)
+	assert.Equal(t, "fibratus-CreateFile", k.topicName(batch.Events[0]))
+	assert.Equal(t, "fibratus-CreateProcess", k.topicName(batch.Events[1]))
+}
+
+func TestKafkaPartitionKey(t *testing.T) {
+	resolver := func(field string) (outputs.FieldValuer, error) {
+		if field != "ps.pid" {
+			return nil, fmt.Errorf("%q is not a valid field", field)
+		}
+		return func(kevt *kevent.Kevent) (any, error) { return kevt.PID, nil }, nil
+	}
+	ps := &pstypes.PS{PID: 859, StartTime: time.Unix(1683126245, 0)}
+	kevt := &kevent.Kevent{PID: 859, Host: "archrabbit", PS: ps}
+
+	var tests = []struct {
+		key      string
+		kevt     *kevent.Kevent
+		expected []byte
+	}{
+		{hostKey, kevt, []byte("archrabbit")},
+		{hostKey, &kevent.Kevent{}, nil},
+		{psUUIDKey, kevt, []byte(fmt.Sprintf("%d", ps.UUID()))},
+		{psUUIDKey, &kevent.Kevent{}, nil},
+		{"ps.pid", kevt, []byte("859")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			k := newKafka(t, Config{Brokers: []string{"localhost:9092"}, PartitionKey: tt.key}, resolver)
+			assert.Equal(t, tt.expected, k.key(tt.kevt))
+		})
+	}
+
+	_, err := initKafka(outputs.Config{Type: outputs.Kafka, Output: Config{Brokers: []string{"localhost:9092"}, PartitionKey: "ps.foo"}, Resolver: resolver})
+	require.EqualError(t, err, `invalid kafka partition key: "ps.foo" is not a valid field`)
+}
+
+func TestPartitioner(t *testing.T) {
+	partitions := make([]int, 1000)
+	for i := range partitions {
+		partitions[i] = i
+	}
+
+	// partitions are consistent with the default partitioner of the Java client
+	var tests = []struct {
+		key       string
+		partition int
+	}{
+		{"21", 340},
+		{"foobar", 166},
+		{"a-little-bit-long-string", 112},
+		{"a-little-bit-longer-string", 819},
+		{"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8", 677},
+		{"abc", 107},
+	}
+
+	p := &partitioner{}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.partition, p.Balance(kafkago.Message{Key: []byte(tt.key)}, partitions...))
+		})
+	}
+
+	// messages without the key are distributed in the round-robin fashion
+	seen := make(map[int]int)
+	for i := 0; i < 9; i++ {
+		seen[p.Balance(kafkago.Message{}, 0, 1, 2)]++
+	}
+	assert.Equal(t, map[int]int{0: 3, 1: 3, 2: 3}, seen)
+}
+
+// TestKafkaPublish produces events to the real Kafka cluster. The test
+// is skipped unless the KAFKA_BROKERS environment variable contains the
+// comma-separated list of bootstrap brokers that permit topic creation.
+func TestKafkaPublish(t *testing.T) {
+	brokers := os.Getenv("KAFKA_BROKERS")
+	if brokers == "" {
+		t.Skip("KAFKA_BROKERS environment variable is not set")
+	}
+	addrs := strings.Split(brokers, ",")
+	topic := fmt.Sprintf("fibratus-test-%d", time.Now().UnixNano())
+
+	client := &kafkago.Client{Addr: kafkago.TCP(addrs...), Timeout: time.Second * 10}
+	resp, err := client.CreateTopics(context.Background(), &kafkago.CreateTopicsRequest{
+		Topics: []kafkago.TopicConfig{{Topic: topic, NumPartitions: 3, ReplicationFactor: 1}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, resp.Errors[topic])
+
+	for _, compression := range []string{none, gzipCompression, snappyCompression, lz4Compression, zstdCompression} {
+		t.Run(compression, func(t *testing.T) {
+			k := newKafka(t, Config{Brokers: addrs, Topic: topic, PartitionKey: hostKey, Compression: compression, Timeout: time.Second * 10}, nil)
+			require.NoError(t, k.Connect())
+			defer k.Close()
+			require.NoError(t, k.Publish(newBatch(16)))
+		})
+	}
+
+	// events are consumed from all partitions. Messages
+	// with the same key land in the same partition
+	keys := make(map[string]int)
+	n := 0
+	for partition := 0; partition < 3; partition++ {
+		r := kafkago.NewReader(kafkago.ReaderConfig{Brokers: addrs, Topic: topic, Partition: partition})
+		lag, err := r.ReadLag(context.Background())
+		require.NoError(t, err)
+		for i := int64(0); i < lag; i++ {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+			msg, err := r.ReadMessage(ctx)
+			cancel()
+			require.NoError(t, err)
+			if p, ok := keys[string(msg.Key)]; ok {
+				assert.Equal(t, p, msg.Partition)
+			}
+			keys[string(msg.Key)] = msg.Partition
+
+			// the message timestamp is the event timestamp
+			var v struct {
+				Timestamp time.Time `json:"timestamp"`
+			}
+			require.NoError(t, json.Unmarshal(msg.Value, &v))
+			assert.True(t, v.Timestamp.Equal(msg.Time), msg.Time)
+			n++
+		}
+		require.NoError(t, r.Close())
+	}
+	assert.Equal(t, 16*5, n)
+	assert.Len(t, keys, 4)
+}
@@ -49,6 +49,12 @@ const (
 	HTTP
 	// Eventlog denotes the eventlog output.
 	Eventlog
+	// Syslog denotes the syslog output.
+	Syslog
+	// File denotes the file output.
+	File
+	// Kafka denotes the Kafka output.
+	Kafka
 	// Null is the null output.
 	Null
 	// Unknown is an undefined output type.
@@ -68,6 +74,12 @@ func (t Type) String() string {
 		return "http"
 	case Eventlog:
 		return "eventlog"
+	case Syslog:
+		return "syslog"
+	case File:
+		return "file"
+	case Kafka:
+		return "kafka"
 	case Null:
 		return "null"
 	default:
@@ -88,6 +100,12 @@ func TypeFromString(s string) Type {
 		return HTTP
 	case "eventlog":
 		return Eventlog
+	case "syslog":
+		return Syslog
+	case "file":
+		return File
+	case "kafka":
+		return Kafka
 	case "null":
 		return Null
 	default:
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"time"
+
+	"github.com/rabbitstack/fibratus/pkg/outputs"
+	"github.com/spf13/pflag"
+)
+
+const (
+	syslogEnabled  = "output.syslog.enabled"
+	syslogNetwork  = "output.syslog.network"
+	syslogAddress  = "output.syslog.address"
+	syslogTimeout  = "output.syslog.timeout"
+	syslogFormat   = "output.syslog.format"
+	syslogFraming  = "output.syslog.framing"
+	syslogFacility = "output.syslog.facility"
+	syslogSeverity = "output.syslog.severity"
+	syslogAppName  = "output.syslog.app-name"
+	syslogBody     = "output.syslog.body"
+	syslogTemplate = "output.syslog.template"
+)
+
+// Config contains the options for tweaking the syslog output behaviour.
+type Config struct {
+	outputs.TLSConfig
+	// Enabled determines whether syslog output is enabled.
+	Enabled bool `mapstructure:"enabled"`
+	// Network is the transport protocol used to reach the syslog server (udp, tcp, tls).
+	Network string `mapstructure:"network"`
+	// Address is the host:port address of the syslog server.
+	Address string `mapstructure:"address"`
+	// Timeout represents the timeout for connecting to the syslog server and writing messages.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Format is the syslog message format (rfc5424, rfc3164).
+	Format string `mapstructure:"format"`
+	// Framing is the message framing for the stream transports (octet-counting, non-transparent).
+	Framing string `mapstructure:"framing"`
+	// Facility is the syslog facility of the messages.
+	Facility string `mapstructure:"facility"`
+	// Severity is the severity of the messages produced by events that didn't trigger any rule.
+	Severity string `mapstructure:"severity"`
+	// AppName identifies the application that originated the message.
+	AppName string `mapstructure:"app-name"`
+	// Body determines whether the message body is the JSON event or the event rendered by the template (json, template).
+	Body string `mapstructure:"body"`
+	// Template is the event formatting template used to render the message body.
+	Template string `mapstructure:"template"`
+}
+
+// AddFlags registers persistent flags for the syslog output.
+func AddFlags(flags *pflag.FlagSet) {
+	flags.Bool(syslogEnabled, false, "Determines whether the syslog output is enabled")
+	flags.String(syslogNetwork, "udp", "Specifies the transport protocol used to reach the syslog server (udp|tcp|tls)")
+	flags.String(syslogAddress, "localhost:514", "Specifies the host:port address of the syslog server")
+	flags.Duration(syslogTimeout, time.Second*5, "Represents the timeout for connecting to the syslog server and writing messages")
+	flags.String(syslogFormat, rfc5424, "Specifies the syslog message format (rfc5424|rfc3164)")
+	flags.String(syslogFraming, octetCounting, "Specifies the message framing for TCP and TLS transports (octet-counting|non-transparent)")
+	flags.String(syslogFacility, "local0", "Specifies the syslog facility of the messages")
+	flags.String(syslogSeverity, "info", "Specifies the severity of the messages produced by events that didn't trigger any rule")
+	flags.String(syslogAppName, "fibratus", "Identifies the application that originated the message")
+	flags.String(syslogBody, jsonBody, "Determines whether the message body is the JSON event or the event rendered by the template (json|template)")
+	flags.String(syslogTemplate, "", "Event formatting template used to render the message body")
+	outputs.AddTLSFlags(flags, outputs.Syslog)
+}
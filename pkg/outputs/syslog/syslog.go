@@ -0,0 +1,374 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"crypto/tls"
+	"expvar"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"github.com/rabbitstack/fibratus/pkg/outputs"
+	tlsutil "github.com/rabbitstack/fibratus/pkg/util/tls"
+)
+
+const (
+	rfc5424 = "rfc5424"
+	rfc3164 = "rfc3164"
+
+	octetCounting  = "octet-counting"
+	nonTransparent = "non-transparent"
+
+	jsonBody     = "json"
+	templateBody = "template"
+
+	// template represents the default template used to render the message body
+	template = "{{ .Seq }} {{ .Timestamp }} - {{ .CPU }} {{ .Process }} ({{ .Pid }}) - {{ .Type }} ({{ .Kparams }})"
+
+	// sdID is the identifier of the structured data element carrying event fields
+	sdID = "fibratus@32473"
+	// nilValue represents the absent value in RFC 5424 header fields
+	nilValue = "-"
+)
+
+// syslogErrors counts the number of messages that failed to be sent
+var syslogErrors = expvar.NewInt("output.syslog.errors")
+
+// facilities maps facility names to facility codes
+var facilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// severities maps syslog and rule severity names to severity codes
+var severities = map[string]int{
+	"emerg":    0,
+	"alert":    1,
+	"crit":     2,
+	"critical": 2,
+	"err":      3,
+	"error":    3,
+	"high":     3,
+	"warning":  4,
+	"warn":     4,
+	"medium":   4,
+	"notice":   5,
+	"low":      5,
+	"info":     6,
+	"debug":    7,
+}
+
+type syslog struct {
+	config    Config
+	conn      net.Conn
+	tlsConfig *tls.Config
+	formatter *kevent.Formatter
+	facility  int
+	severity  int
+	hostname  string
+}
+
+func init() {
+	outputs.Register(outputs.Syslog, initSyslog)
+}
+
+func initSyslog(config outputs.Config) (outputs.OutputGroup, error) {
+	cfg, ok := config.Output.(Config)
+	if !ok {
+		return outputs.Fail(outputs.ErrInvalidConfig(outputs.Syslog, config.Output))
+	}
+	if cfg.Network == "" {
+		cfg.Network = "udp"
+	}
+	if cfg.Format == "" {
+		cfg.Format = rfc5424
+	}
+	if cfg.Framing == "" {
+		cfg.Framing = octetCounting
+	}
+	if cfg.Body == "" {
+		cfg.Body = jsonBody
+	}
+	if cfg.AppName == "" {
+		cfg.AppName = "fibratus"
+	}
+	if cfg.Facility == "" {
+		cfg.Facility = "local0"
+	}
+	if cfg.Severity == "" {
+		cfg.Severity = "info"
+	}
+
+	switch cfg.Network {
+	case "udp", "tcp", "tls":
+	default:
+		return outputs.Fail(fmt.Errorf("unsupported syslog network: %s", cfg.Network))
+	}
+	switch cfg.Format {
+	case rfc5424, rfc3164:
+	default:
+		return outputs.Fail(fmt.Errorf("unsupported syslog format: %s", cfg.Format))
+	}
+	switch cfg.Framing {
+	case octetCounting, nonTransparent:
+	default:
+		return outputs.Fail(fmt.Errorf("unsupported syslog framing: %s", cfg.Framing))
+	}
+	facility, ok := facilities[strings.ToLower(cfg.Facility)]
+	if !ok {
+		return outputs.Fail(fmt.Errorf("unknown syslog facility: %s", cfg.Facility))
+	}
+	severity, ok := severities[strings.ToLower(cfg.Severity)]
+	if !ok {
+		return outputs.Fail(fmt.Errorf("unknown syslog severity: %s", cfg.Severity))
+	}
+
+	s := &syslog{
+		config:   cfg,
+		facility: facility,
+		severity: severity,
+	}
+	s.hostname, _ = os.Hostname()
+
+	switch cfg.Body {
+	case jsonBody:
+	case templateBody:
+		tmpl := cfg.Template
+		if tmpl == "" {
+			tmpl = template
+		}
+		var err error
+		s.formatter, err = kevent.NewFormatter(tmpl)
+		if err != nil {
+			return outputs.Fail(err)
+		}
+	default:
+		return outputs.Fail(fmt.Errorf("unsupported syslog message body: %s", cfg.Body))
+	}
+
+	if cfg.Network == "tls" {
+		tlsConfig, err := tlsutil.MakeConfig(cfg.TLSCert, cfg.TLSKey, cfg.TLSCA, cfg.TLSInsecureSkipVerify)
+		if err != nil {
+			return outputs.Fail(fmt.Errorf("invalid TLS config: %v", err))
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{InsecureSkipVerify: cfg.TLSInsecureSkipVerify} //nolint:gosec
+		}
+		s.tlsConfig = tlsConfig
+	}
+
+	return outputs.Success(s), nil
+}
+
+func (s *syslog) Connect() error {
+	dialer := &net.Dialer{Timeout: s.config.Timeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch s.config.Network {
+	case "tls":
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.config.Address, s.tlsConfig)
+	default:
+		conn, err = dialer.Dial(s.config.Network, s.config.Address)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to connect to syslog server %s: %v", s.config.Address, err)
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *syslog) Close() error {
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
+
+func (s *syslog) Publish(batch *kevent.Batch) error {
+	// the connection is reestablished
+	// if the previous write failed
+	if s.conn == nil {
+		if err := s.Connect(); err != nil {
+			return err
+		}
+	}
+	for _, kevt := range batch.Events {
+		if err := s.write(s.frame(s.format(kevt))); err != nil {
+			syslogErrors.Add(1)
+			_ = s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syslog) write(msg []byte) error {
+	if s.config.Timeout > 0 {
+		if err := s.conn.SetWriteDeadline(time.Now().Add(s.config.Timeout)); err != nil {
+			return err
+		}
+	}
+	_, err := s.conn.Write(msg)
+	return err
+}
+
+// frame applies the framing to the message. Datagrams
+// carry a single message, so they don't need framing.
+// Stream transports use either the octet-counting or
+// the non-transparent framing as described in RFC 6587.
+func (s *syslog) frame(msg []byte) []byte {
+	if s.config.Network == "udp" {
+		return msg
+	}
+	if s.config.Framing == nonTransparent {
+		return append(msg, '\n')
+	}
+	b := make([]byte, 0, len(msg)+8)
+	b = strconv.AppendInt(b, int64(len(msg)), 10)
+	b = append(b, ' ')
+	return append(b, msg...)
+}
+
+// format produces the syslog message from the event.
+func (s *syslog) format(kevt *kevent.Kevent) []byte {
+	pri := s.facility*8 + s.eventSeverity(kevt)
+	hostname := kevt.Host
+	if hostname == "" {
+		hostname = s.hostname
+	}
+	if hostname == "" {
+		hostname = nilValue
+	}
+
+	var b []byte
+	switch s.config.Format {
+	case rfc3164:
+		b = fmt.Appendf(b, "<%d>%s %s %s[%d]: ",
+			pri,
+			kevt.Timestamp.Format(time.Stamp),
+			hostname,
+			s.config.AppName,
+			kevt.PID)
+	default:
+		b = fmt.Appendf(b, "<%d>1 %s %s %s %d %s ",
+			pri,
+			kevt.Timestamp.Format("2006-01-02T15:04:05.000000Z07:00"),
+			truncate(hostname, 255),
+			truncate(s.config.AppName, 48),
+			kevt.PID,
+			msgID(kevt))
+		b = s.appendStructuredData(b, kevt)
+		b = append(b, ' ')
+	}
+
+	if s.formatter != nil {
+		return append(b, s.formatter.Format(kevt)...)
+	}
+	return append(b, kevt.MarshalJSON()...)
+}
+
+// eventSeverity returns the severity of the triggered rule
+// or the configured severity if the event didn't match any
+// rule.
+func (s *syslog) eventSeverity(kevt *kevent.Kevent) int {
+	if sev, ok := severities[strings.ToLower(kevt.GetMetaAsString(kevent.RuleSeverityKey))]; ok {
+		return sev
+	}
+	return s.severity
+}
+
+// appendStructuredData appends the structured data element with key event fields.
+func (s *syslog) appendStructuredData(b []byte, kevt *kevent.Kevent) []byte {
+	b = append(b, '[')
+	b = append(b, sdID...)
+	b = appendParam(b, "seq", strconv.FormatUint(kevt.Seq, 10))
+	b = appendParam(b, "pid", strconv.FormatUint(uint64(kevt.PID), 10))
+	b = appendParam(b, "tid", strconv.FormatUint(uint64(kevt.Tid), 10))
+	b = appendParam(b, "cpu", strconv.FormatUint(uint64(kevt.CPU), 10))
+	b = appendParam(b, "name", kevt.Name)
+	b = appendParam(b, "category", string(kevt.Category))
+	if kevt.PS != nil {
+		b = appendParam(b, "ps", kevt.PS.Name)
+		b = appendParam(b, "exe", kevt.PS.Exe)
+	}
+	if rule := kevt.GetMetaAsString(kevent.RuleNameKey); rule != "" {
+		b = appendParam(b, "rule", rule)
+	}
+	if severity := kevt.GetMetaAsString(kevent.RuleSeverityKey); severity != "" {
+		b = appendParam(b, "severity", severity)
+	}
+	return append(b, ']')
+}
+
+// appendParam appends the structured data parameter. The
+// characters '"', '\' and ']' are escaped in the value.
+func appendParam(b []byte, name, value string) []byte {
+	b = append(b, ' ')
+	b = append(b, name...)
+	b = append(b, '=', '"')
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '"', '\\', ']':
+			b = append(b, '\\')
+		}
+		b = append(b, value[i])
+	}
+	return append(b, '"')
+}
+
+// msgID returns the event name as the message identifier.
+func msgID(kevt *kevent.Kevent) string {
+	if kevt.Name == "" {
+		return nilValue
+	}
+	return truncate(kevt.Name, 32)
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,261 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rabbitstack/fibratus/pkg/kevent"
+	"github.com/rabbitstack/fibratus/pkg/kevent/kparams"
+	"github.com/rabbitstack/fibratus/pkg/kevent/ktypes"
+	"github.com/rabbitstack/fibratus/pkg/outputs"
+	pstypes "github.com/rabbitstack/fibratus/pkg/ps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSyslog(t *testing.T, cfg Config) outputs.Client {
+	out, err := initSyslog(outputs.Config{Type: outputs.Syslog, Output: cfg})
+	require.NoError(t, err)
+	require.Len(t, out.Clients, 1)
+	return out.Clients[0]
+}
+
+func newBatch() *kevent.Batch {
+	ts, _ := time.Parse(time.RFC3339, "2023-05-03T15:04:05.323Z")
+	kevt1 := &kevent.Kevent{
+		Type:      ktypes.CreateFile,
+		Seq:       1,
+		Tid:       2484,
+		PID:       859,
+		CPU:       1,
+		Name:      "CreateFile",
+		Category:  ktypes.File,
+		Host:      "archrabbit",
+		Timestamp: ts,
+		Kparams: kevent.Kparams{
+			kparams.FileName: {Name: kparams.FileName, Type: kparams.UnicodeString, Value: "C:\\Windows\\system32\\user32.dll"},
+		},
+		Metadata: map[kevent.MetadataKey]any{
+			kevent.RuleNameKey:     "Suspicious \"DLL\" [load]",
+			kevent.RuleSeverityKey: "high",
+		},
+		PS: &pstypes.PS{Name: "cmd.exe", Exe: "C:\\Windows\\system32\\cmd.exe"},
+	}
+	kevt2 := &kevent.Kevent{
+		Type:      ktypes.CreateProcess,
+		Seq:       2,
+		Tid:       2484,
+		PID:       859,
+		Name:      "CreateProcess",
+		Category:  ktypes.Process,
+		Host:      "archrabbit",
+		Timestamp: ts,
+		Kparams:   kevent.Kparams{},
+		Metadata:  make(map[kevent.MetadataKey]any),
+	}
+	return kevent.NewBatch(kevt1, kevt2)
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	s := newSyslog(t, Config{
+		Network:  "udp",
+		Address:  conn.LocalAddr().String(),
+		Facility: "local4",
+		Body:     templateBody,
+		Template: "{{ .Seq }} {{ .Type }}",
+	})
+	require.NoError(t, s.Connect())
+	defer s.Close()
+	require.NoError(t, s.Publish(newBatch()))
+
+	msgs := make([]string, 0)
+	buf := make([]byte, 64*1024)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second*5)))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		msgs = append(msgs, string(buf[:n]))
+	}
+
+	// local4 facility and error severity mapped from the high rule severity
+	assert.Equal(t, `<163>1 2023-05-03T15:04:05.323000Z archrabbit fibratus 859 CreateFile `+
+		`[fibratus@32473 seq="1" pid="859" tid="2484" cpu="1" name="CreateFile" category="file" ps="cmd.exe" exe="C:\\Windows\\system32\\cmd.exe" `+
+		`rule="Suspicious \"DLL\" [load\]" severity="high"] 1 CreateFile`, msgs[0])
+	// the event didn't match any rule, so the default info severity is used
+	assert.Equal(t, `<166>1 2023-05-03T15:04:05.323000Z archrabbit fibratus 859 CreateProcess `+
+		`[fibratus@32473 seq="2" pid="859" tid="2484" cpu="0" name="CreateProcess" category="process"] 2 CreateProcess`, msgs[1])
+}
+
+func TestSyslogTCPOctetCounting(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	msgs := make(chan string, 2)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			size, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(size))
+			if err != nil {
+				return
+			}
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				return
+			}
+			msgs <- string(msg)
+		}
+	}()
+
+	s := newSyslog(t, Config{
+		Network: "tcp",
+		Address: l.Addr().String(),
+		Format:  rfc3164,
+		Timeout: time.Second * 5,
+	})
+	require.NoError(t, s.Connect())
+	defer s.Close()
+	require.NoError(t, s.Publish(newBatch()))
+
+	for _, seq := range []uint64{1, 2} {
+		select {
+		case msg := <-msgs:
+			pri := "<131>"
+			if seq == 2 {
+				pri = "<134>"
+			}
+			prefix := pri + "May  3 15:04:05 archrabbit fibratus[859]: "
+			require.True(t, strings.HasPrefix(msg, prefix), msg)
+			var evt map[string]any
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(msg, prefix)), &evt))
+			assert.Equal(t, float64(seq), evt["seq"])
+		case <-time.After(time.Second * 5):
+			t.Fatal("timed out waiting for syslog message")
+		}
+	}
+}
+
+func TestSyslogTLS(t *testing.T) {
+	cert := generateCert(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+	require.NoError(t, err)
+	defer l.Close()
+
+	msgs := make(chan string, 2)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			msgs <- strings.TrimSuffix(line, "\n")
+		}
+	}()
+
+	s := newSyslog(t, Config{
+		TLSConfig: outputs.TLSConfig{TLSInsecureSkipVerify: true},
+		Network:   "tls",
+		Address:   l.Addr().String(),
+		Framing:   nonTransparent,
+		Body:      templateBody,
+		Template:  "{{ .Seq }}",
+		Timeout:   time.Second * 5,
+	})
+	require.NoError(t, s.Connect())
+	defer s.Close()
+	require.NoError(t, s.Publish(newBatch()))
+
+	for _, seq := range []string{"1", "2"} {
+		select {
+		case msg := <-msgs:
+			assert.True(t, strings.HasSuffix(msg, "] "+seq), msg)
+		case <-time.After(time.Second * 5):
+			t.Fatal("timed out waiting for syslog message")
+		}
+	}
+}
+
+func TestSyslogInvalidConfig(t *testing.T) {
+	var tests = []struct {
+		cfg Config
+		err string
+	}{
+		{Config{Network: "quic"}, "unsupported syslog network: quic"},
+		{Config{Format: "rfc1234"}, "unsupported syslog format: rfc1234"},
+		{Config{Facility: "local9"}, "unknown syslog facility: local9"},
+		{Config{Severity: "fatal"}, "unknown syslog severity: fatal"},
+		{Config{Body: "xml"}, "unsupported syslog message body: xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err, func(t *testing.T) {
+			_, err := initSyslog(outputs.Config{Type: outputs.Syslog, Output: tt.cfg})
+			require.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func generateCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ahocorasick implements the Aho-Corasick automaton for
+// finding occurrences of many patterns in the text in a single pass.
+package ahocorasick
+
+// Matcher is the Aho-Corasick automaton built from the set of patterns.
+// The automaton is compiled into the deterministic transition table
+// indexed by byte classes. Only bytes occurring in patterns get their
+// own class, so the table stays compact even for large pattern sets.
+// The matcher is safe for concurrent use.
+type Matcher struct {
+	// classes maps each byte to its equivalence class.
+	// Class 0 groups all bytes not found in any pattern
+	classes [256]uint16
+	// stride is the number of byte classes
+	stride int
+	// delta is the transition table
+	delta []int32
+	// depth is the length of the prefix the state represents
+	depth []int32
+	// term contains the index of the pattern terminating at the state or -1
+	term []int32
+	// dict links the state to the closest state on the failure
+	// path where some pattern terminates or is -1
+	dict []int32
+	// emit indicates if some pattern terminates at the state
+	// or at any of the states on its failure path
+	emit []bool
+	// dups chains the indices of duplicate patterns
+	dups map[int32][]int32
+	// empty indicates if the empty pattern is present
+	empty bool
+}
+
+// New builds the automaton from the given patterns.
+func New(patterns []string) *Matcher {
+	m := &Matcher{dups: make(map[int32][]int32)}
+
+	n := 1
+	for _, p := range patterns {
+		for i := 0; i < len(p); i++ {
+			if m.classes[p[i]] == 0 {
+				m.classes[p[i]] = uint16(n)
+				n++
+			}
+		}
+	}
+	m.stride = n
+	m.addState(0)
+
+	// build the trie of patterns
+	for i, p := range patterns {
+		if p == "" {
+			m.empty = true
+		}
+		s := int32(0)
+		for j := 0; j < len(p); j++ {
+			c := int(m.classes[p[j]])
+			next := m.delta[int(s)*m.stride+c]
+			if next <= 0 {
+				next = m.addState(m.depth[s] + 1)
+				m.delta[int(s)*m.stride+c] = next
+			}
+			s = next
+		}
+		if m.term[s] >= 0 {
+			m.dups[m.term[s]] = append(m.dups[m.term[s]], int32(i))
+			continue
+		}
+		m.term[s] = int32(i)
+	}
+
+	// compute failure links in breadth-first order and turn
+	// the trie into the complete transition table. Missing
+	// transitions are borrowed from the failure state
+	fail := make([]int32, len(m.depth))
+	queue := make([]int32, 0, len(m.depth))
+	for c := 0; c < m.stride; c++ {
+		if s := m.delta[c]; s > 0 {
+			queue = append(queue, s)
+		}
+	}
+	m.emit[0] = m.term[0] >= 0
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		f := fail[s]
+		if m.term[f] >= 0 && f > 0 {
+			m.dict[s] = f
+		} else {
+			m.dict[s] = m.dict[f]
+		}
+		m.emit[s] = m.term[s] >= 0 || m.dict[s] >= 0
+		for c := 0; c < m.stride; c++ {
+			i := int(s)*m.stride + c
+			next := m.delta[i]
+			fnext := m.delta[int(f)*m.stride+c]
+			if next > 0 && m.depth[next] == m.depth[s]+1 {
+				fail[next] = fnext
+				queue = append(queue, next)
+				continue
+			}
+			m.delta[i] = fnext
+		}
+	}
+
+	return m
+}
+
+func (m *Matcher) addState(depth int32) int32 {
+	s := int32(len(m.depth))
+	for c := 0; c < m.stride; c++ {
+		m.delta = append(m.delta, 0)
+	}
+	m.depth = append(m.depth, depth)
+	m.term = append(m.term, -1)
+	m.dict = append(m.dict, -1)
+	m.emit = append(m.emit, false)
+	return s
+}
+
+// Contains determines if any of the patterns occurs in the text.
+func (m *Matcher) Contains(text string) bool {
+	if m.empty {
+		return true
+	}
+	s := int32(0)
+	for i := 0; i < len(text); i++ {
+		s = m.delta[int(s)*m.stride+int(m.classes[text[i]])]
+		if m.emit[s] {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPrefix determines if the text begins with any of the patterns.
+func (m *Matcher) HasPrefix(text string) bool {
+	if m.empty {
+		return true
+	}
+	s := int32(0)
+	for i := 0; i < len(text); i++ {
+		next := m.delta[int(s)*m.stride+int(m.classes[text[i]])]
+		// the transition must follow the trie edge,
+		// otherwise no pattern is the prefix of text
+		if m.depth[next] != m.depth[s]+1 {
+			return false
+		}
+		if m.term[next] >= 0 {
+			return true
+		}
+		s = next
+	}
+	return false
+}
+
+// HasSuffix determines if the text ends with any of the patterns.
+// The state reached after consuming the whole text represents the
+// longest suffix of text that is also the prefix of some pattern,
+// so the patterns terminating at this state or on its failure path
+// are exactly the patterns text ends with.
+func (m *Matcher) HasSuffix(text string) bool {
+	if m.empty {
+		return true
+	}
+	s := int32(0)
+	for i := 0; i < len(text); i++ {
+		s = m.delta[int(s)*m.stride+int(m.classes[text[i]])]
+	}
+	return s > 0 && m.emit[s]
+}
+
+// Match invokes the callback with the index of every pattern found
+// in the text. The same pattern index is reported for each occurrence
+// of the pattern. The search stops when the callback returns false.
+func (m *Matcher) Match(text string, fn func(i int) bool) {
+	if m.empty && !m.emitAll(0, fn) {
+		return
+	}
+	s := int32(0)
+	for i := 0; i < len(text); i++ {
+		s = m.delta[int(s)*m.stride+int(m.classes[text[i]])]
+		if !m.emit[s] {
+			continue
+		}
+		for o := s; o > 0; o = m.dict[o] {
+			if m.term[o] >= 0 && !m.emitAll(o, fn) {
+				return
+			}
+		}
+	}
+}
+
+// emitAll reports the pattern terminating at the
+// state along with all of its duplicates.
+func (m *Matcher) emitAll(s int32, fn func(i int) bool) bool {
+	idx := m.term[s]
+	if !fn(int(idx)) {
+		return false
+	}
+	for _, dup := range m.dups[idx] {
+		if !fn(int(dup)) {
+			return false
+		}
+	}
+	return true
+}
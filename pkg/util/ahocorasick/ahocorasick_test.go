@@ -0,0 +1,144 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ahocorasick
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	m := New([]string{"he", "she", "his", "hers", "\\temp\\"})
+
+	var tests = []struct {
+		text      string
+		contains  bool
+		hasPrefix bool
+		hasSuffix bool
+	}{
+		{"ushers", true, false, true},
+		{"hers", true, true, true},
+		{"this", true, false, true},
+		{"hi", false, false, false},
+		{"", false, false, false},
+		{"C:\\Users\\admin\\AppData\\Local\\Temp\\", false, false, false},
+		{"C:\\Windows\\temp\\a.exe", true, false, false},
+		{"\\temp\\", true, true, true},
+		{"shell", true, true, false},
+		{"ash", false, false, false},
+		{"ahe", true, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.contains, m.Contains(tt.text))
+			assert.Equal(t, tt.hasPrefix, m.HasPrefix(tt.text))
+			assert.Equal(t, tt.hasSuffix, m.HasSuffix(tt.text))
+		})
+	}
+}
+
+func TestMatcherMatch(t *testing.T) {
+	m := New([]string{"he", "she", "his", "hers", "she"})
+
+	var matches []int
+	m.Match("ushers", func(i int) bool {
+		matches = append(matches, i)
+		return true
+	})
+	sort.Ints(matches)
+	assert.Equal(t, []int{0, 1, 3, 4}, matches)
+
+	var n int
+	m.Match("ushers", func(i int) bool {
+		n++
+		return false
+	})
+	assert.Equal(t, 1, n)
+}
+
+func TestMatcherEmptyPattern(t *testing.T) {
+	m := New([]string{"", "foo"})
+	assert.True(t, m.Contains("bar"))
+	assert.True(t, m.HasPrefix("bar"))
+	assert.True(t, m.HasSuffix("bar"))
+	assert.False(t, New(nil).Contains("bar"))
+}
+
+// TestMatcherRandom compares the automaton with
+// the naive search on randomly generated input.
+func TestMatcherRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	gen := func(n int) string {
+		var sb strings.Builder
+		for i := 0; i < n; i++ {
+			sb.WriteByte("abc"[r.Intn(3)])
+		}
+		return sb.String()
+	}
+
+	for i := 0; i < 200; i++ {
+		patterns := make([]string, r.Intn(8)+1)
+		for j := range patterns {
+			patterns[j] = gen(r.Intn(4) + 1)
+		}
+		m := New(patterns)
+		for j := 0; j < 50; j++ {
+			text := gen(r.Intn(12))
+			var contains, prefix, suffix bool
+			for _, p := range patterns {
+				contains = contains || strings.Contains(text, p)
+				prefix = prefix || strings.HasPrefix(text, p)
+				suffix = suffix || strings.HasSuffix(text, p)
+			}
+			assert.Equal(t, contains, m.Contains(text), text)
+			assert.Equal(t, prefix, m.HasPrefix(text), text)
+			assert.Equal(t, suffix, m.HasSuffix(text), text)
+		}
+	}
+}
+
+func BenchmarkMatcherContains(b *testing.B) {
+	patterns := make([]string, 0, 200)
+	for i := 0; i < 200; i++ {
+		patterns = append(patterns, "\\pattern"+strings.Repeat("x", i%10)+"\\")
+	}
+	m := New(patterns)
+	text := "C:\\Windows\\System32\\WindowsPowerShell\\v1.0\\powershell.exe"
+
+	b.Run("ahocorasick", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m.Contains(text)
+		}
+	})
+	b.Run("naive", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, p := range patterns {
+				if strings.Contains(text, p) {
+					break
+				}
+			}
+		}
+	})
+}
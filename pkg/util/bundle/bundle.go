@@ -0,0 +1,189 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package bundle implements signed rule bundles. The rule bundle is a tar,
+// gzip-compressed tar, or zip archive with the bundle manifest and rule
+// files. The archive is accompanied by the detached ed25519 or minisign
+// signature, which is verified against trusted public keys before the
+// archive content is used.
+package bundle
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ManifestFile is the name of the bundle manifest file in the archive root.
+const ManifestFile = "bundle.yml"
+
+// maxSize is the maximum size of the uncompressed bundle content
+const maxSize = 64 * 1024 * 1024
+
+// ErrUnsupportedFormat is returned when the archive format can't be inferred from the bundle name
+var ErrUnsupportedFormat = errors.New("unsupported bundle format. Supported formats are .zip, .tar, .tar.gz, and .tgz")
+
+// Manifest describes the rule bundle.
+type Manifest struct {
+	// Name is the bundle name
+	Name string `yaml:"name"`
+	// Version is the bundle version used for version pinning
+	Version string `yaml:"version"`
+}
+
+// File is the file contained in the bundle.
+type File struct {
+	// Path is the slash-separated file path relative to the archive root
+	Path string
+	// Data is the file content
+	Data []byte
+}
+
+// Bundle is the unpacked rule bundle.
+type Bundle struct {
+	Manifest Manifest
+	// Files contains bundle files sorted by path, excluding the manifest
+	Files []File
+}
+
+// IsBundle determines if the name designates the archive supported as rule bundle.
+func IsBundle(name string) bool {
+	_, err := format(name)
+	return err == nil
+}
+
+func format(name string) (string, error) {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return "zip", nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tgz", nil
+	case strings.HasSuffix(name, ".tar"):
+		return "tar", nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// Open unpacks the bundle archive in memory. The archive format is
+// inferred from the bundle name extension. The archive must contain
+// the manifest file with the bundle version. The signature of the
+// archive must be verified before the bundle is opened.
+func Open(name string, b []byte) (*Bundle, error) {
+	f, err := format(name)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	var size int64
+	add := func(p string, r io.Reader) error {
+		p = path.Clean(strings.TrimPrefix(strings.ReplaceAll(p, "\\", "/"), "/"))
+		if p == ".." || strings.HasPrefix(p, "../") {
+			return fmt.Errorf("illegal file path %q in bundle", p)
+		}
+		if _, ok := files[p]; ok {
+			return fmt.Errorf("duplicate file %q in bundle", p)
+		}
+		data, err := io.ReadAll(io.LimitReader(r, maxSize-size+1))
+		if err != nil {
+			return err
+		}
+		size += int64(len(data))
+		if size > maxSize {
+			return fmt.Errorf("bundle content exceeds %d bytes", maxSize)
+		}
+		files[p] = data
+		return nil
+	}
+
+	switch f {
+	case "zip":
+		zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid zip archive: %v", err)
+		}
+		for _, zf := range zr.File {
+			if zf.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return nil, err
+			}
+			err = add(zf.Name, rc)
+			_ = rc.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	case "tar", "tgz":
+		var r io.Reader = bytes.NewReader(b)
+		if f == "tgz" {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, fmt.Errorf("invalid gzip archive: %v", err)
+			}
+			defer gz.Close()
+			r = gz
+		}
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid tar archive: %v", err)
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			if err := add(hdr.Name, tr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	manifest, ok := files[ManifestFile]
+	if !ok {
+		return nil, fmt.Errorf("bundle manifest %s not found", ManifestFile)
+	}
+	bundle := &Bundle{Files: make([]File, 0, len(files)-1)}
+	if err := yaml.Unmarshal(manifest, &bundle.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest: %v", err)
+	}
+	if bundle.Manifest.Version == "" {
+		return nil, fmt.Errorf("bundle manifest doesn't declare the version")
+	}
+	delete(files, ManifestFile)
+
+	for p, data := range files {
+		bundle.Files = append(bundle.Files, File{Path: p, Data: data})
+	}
+	sort.Slice(bundle.Files, func(i, j int) bool { return bundle.Files[i].Path < bundle.Files[j].Path })
+
+	return bundle, nil
+}
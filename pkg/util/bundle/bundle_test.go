@@ -0,0 +1,180 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bundle
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+	"testing"
+)
+
+func makeTarGz(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func makeZip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// minisign produces the minisign signature and public key for the data.
+func minisign(data []byte, priv ed25519.PrivateKey, prehashed bool) (string, string) {
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	alg, msg := "Ed", data
+	if prehashed {
+		h := blake2b.Sum512(data)
+		alg, msg = "ED", h[:]
+	}
+	sig := ed25519.Sign(priv, msg)
+	comment := "timestamp:1700000000\tfile:rules.tar.gz"
+	globalSig := ed25519.Sign(priv, append(append([]byte{}, sig...), comment...))
+
+	sigLine := base64.StdEncoding.EncodeToString(append(append([]byte(alg), keyID...), sig...))
+	signature := fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		sigLine, comment, base64.StdEncoding.EncodeToString(globalSig))
+
+	pub := priv.Public().(ed25519.PublicKey)
+	key := fmt.Sprintf("untrusted comment: minisign public key 0807060504030201\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pub...)))
+	return signature, key
+}
+
+func TestOpen(t *testing.T) {
+	files := map[string]string{
+		"bundle.yml":                  "name: fibratus-rules\nversion: 2.1.0\n",
+		"rules/credential_access.yml": "name: LSASS memory dumping",
+		"rules/execution.yml":         "name: Suspicious execution",
+	}
+
+	for _, b := range []struct {
+		name string
+		data []byte
+	}{
+		{"rules.tar.gz", makeTarGz(t, files)},
+		{"RULES.ZIP", makeZip(t, files)},
+	} {
+		t.Run(b.name, func(t *testing.T) {
+			bundle, err := Open(b.name, b.data)
+			require.NoError(t, err)
+			assert.Equal(t, "fibratus-rules", bundle.Manifest.Name)
+			assert.Equal(t, "2.1.0", bundle.Manifest.Version)
+			require.Len(t, bundle.Files, 2)
+			assert.Equal(t, "rules/credential_access.yml", bundle.Files[0].Path)
+			assert.Equal(t, "name: LSASS memory dumping", string(bundle.Files[0].Data))
+		})
+	}
+
+	_, err := Open("rules.tar.gz", makeTarGz(t, map[string]string{"rules/execution.yml": "name: Suspicious execution"}))
+	require.EqualError(t, err, "bundle manifest bundle.yml not found")
+	_, err = Open("rules.zip", makeZip(t, map[string]string{"bundle.yml": "name: fibratus-rules"}))
+	require.EqualError(t, err, "bundle manifest doesn't declare the version")
+	_, err = Open("rules.zip", makeZip(t, map[string]string{"bundle.yml": "version: 1.0.0", "../evil.yml": "name: evil"}))
+	require.Error(t, err)
+	_, err = Open("rules.rar", nil)
+	require.ErrorIs(t, err, ErrUnsupportedFormat)
+
+	assert.True(t, IsBundle("https://rules.fibratus.io/rules-2.1.0.tgz"))
+	assert.False(t, IsBundle("https://rules.fibratus.io/rule.yml"))
+}
+
+func TestVerifyEd25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	data := []byte("bundle content")
+	key, err := ParsePublicKey(base64.StdEncoding.EncodeToString(pub))
+	require.NoError(t, err)
+	assert.Nil(t, key.ID)
+
+	// raw and base64-encoded signatures
+	sig := ed25519.Sign(priv, data)
+	require.NoError(t, Verify(data, sig, []*PublicKey{key}))
+	require.NoError(t, Verify(data, []byte(base64.StdEncoding.EncodeToString(sig)+"\n"), []*PublicKey{key}))
+
+	require.ErrorIs(t, Verify([]byte("tampered content"), sig, []*PublicKey{key}), ErrInvalidSignature)
+	require.ErrorIs(t, Verify(data, ed25519.Sign(other, data), []*PublicKey{key}), ErrInvalidSignature)
+	require.ErrorIs(t, Verify(data, sig, nil), ErrNoTrustedKeys)
+	require.Error(t, Verify(data, []byte("garbage"), []*PublicKey{key}))
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	data := []byte("bundle content")
+
+	for _, prehashed := range []bool{false, true} {
+		sig, pubKey := minisign(data, priv, prehashed)
+		key, err := ParsePublicKey(pubKey)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8}, key.ID)
+		assert.Equal(t, "minisign key 0807060504030201", key.String())
+
+		require.NoError(t, Verify(data, []byte(sig), []*PublicKey{key}))
+		require.ErrorIs(t, Verify([]byte("tampered content"), []byte(sig), []*PublicKey{key}), ErrInvalidSignature)
+	}
+
+	sig, pubKey := minisign(data, priv, true)
+	key, err := ParsePublicKey(pubKey)
+	require.NoError(t, err)
+
+	// tampered trusted comment invalidates the global signature
+	tampered := bytes.Replace([]byte(sig), []byte("timestamp:1700000000"), []byte("timestamp:1800000000"), 1)
+	require.EqualError(t, Verify(data, tampered, []*PublicKey{key}), "invalid minisign global signature")
+
+	// signature from the key that isn't trusted
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherKey := minisign(data, other, true)
+	okey, err := ParsePublicKey(otherKey)
+	require.NoError(t, err)
+	okey.ID = []byte{8, 8, 8, 8, 8, 8, 8, 8}
+	require.EqualError(t, Verify(data, []byte(sig), []*PublicKey{okey}), "signature is created by the untrusted minisign key 0807060504030201")
+
+	_, err = ParsePublicKey("not a key")
+	require.Error(t, err)
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bundle
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/blake2b"
+	"strings"
+)
+
+const (
+	untrustedCommentPrefix = "untrusted comment:"
+	trustedCommentPrefix   = "trusted comment: "
+)
+
+var (
+	// ErrNoTrustedKeys is returned when the signature is verified without trusted public keys
+	ErrNoTrustedKeys = errors.New("no trusted public keys configured")
+	// ErrInvalidSignature is returned when the signature doesn't match any of the trusted keys
+	ErrInvalidSignature = errors.New("signature doesn't match any of the trusted public keys")
+)
+
+// PublicKey is the trusted ed25519 public key.
+type PublicKey struct {
+	// ID is the minisign key identifier. Nil for raw ed25519 keys
+	ID  []byte
+	key ed25519.PublicKey
+}
+
+// String returns the key identifier.
+func (k *PublicKey) String() string {
+	if k.ID != nil {
+		return fmt.Sprintf("minisign key %X", reverse(k.ID))
+	}
+	return fmt.Sprintf("ed25519 key %s", hex.EncodeToString(k.key[:8]))
+}
+
+// ParsePublicKey parses the base64-encoded public key. The key is either
+// the raw 32-byte ed25519 public key or the minisign public key. The content
+// of the minisign public key file, including the untrusted comment, is
+// accepted as well.
+func ParsePublicKey(s string) (*PublicKey, error) {
+	var line string
+	for _, l := range strings.Split(s, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, untrustedCommentPrefix) {
+			continue
+		}
+		line = l
+		break
+	}
+	b, err := base64.StdEncoding.DecodeString(line)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key encoding: %v", err)
+	}
+	switch {
+	case len(b) == ed25519.PublicKeySize:
+		return &PublicKey{key: b}, nil
+	case len(b) == 2+8+ed25519.PublicKeySize && string(b[:2]) == "Ed":
+		return &PublicKey{ID: b[2:10], key: b[10:]}, nil
+	}
+	return nil, fmt.Errorf("unrecognized public key format. Expected the ed25519 or minisign public key")
+}
+
+// Verify verifies the detached signature of the data against trusted keys.
+// The signature is either the minisign signature file, or the raw ed25519
+// signature, optionally base64-encoded.
+func Verify(data, sig []byte, keys []*PublicKey) error {
+	if len(keys) == 0 {
+		return ErrNoTrustedKeys
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(sig), []byte(untrustedCommentPrefix)) {
+		return verifyMinisign(data, sig, keys)
+	}
+
+	signature := sig
+	if len(signature) != ed25519.SignatureSize {
+		b, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+		if err != nil || len(b) != ed25519.SignatureSize {
+			return fmt.Errorf("malformed ed25519 signature")
+		}
+		signature = b
+	}
+	for _, key := range keys {
+		if key.ID != nil {
+			continue
+		}
+		if ed25519.Verify(key.key, data, signature) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// verifyMinisign verifies the minisign signature. Both legacy and
+// prehashed signatures are supported. The global signature, which
+// covers the trusted comment, must be valid as well.
+func verifyMinisign(data, sig []byte, keys []*PublicKey) error {
+	lines := make([]string, 0, 4)
+	for _, l := range strings.Split(string(sig), "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], trustedCommentPrefix) {
+		return fmt.Errorf("malformed minisign signature")
+	}
+	b, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(b) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("malformed minisign signature")
+	}
+	alg, keyID, signature := string(b[:2]), b[2:10], b[10:]
+	globalSig, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return fmt.Errorf("malformed minisign global signature")
+	}
+
+	msg := data
+	switch alg {
+	case "Ed":
+	case "ED":
+		h := blake2b.Sum512(data)
+		msg = h[:]
+	default:
+		return fmt.Errorf("unsupported minisign signature algorithm %q", alg)
+	}
+
+	for _, key := range keys {
+		if key.ID == nil || !bytes.Equal(key.ID, keyID) {
+			continue
+		}
+		if !ed25519.Verify(key.key, msg, signature) {
+			return ErrInvalidSignature
+		}
+		comment := []byte(strings.TrimPrefix(lines[2], trustedCommentPrefix))
+		if !ed25519.Verify(key.key, append(append([]byte{}, signature...), comment...), globalSig) {
+			return fmt.Errorf("invalid minisign global signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("signature is created by the untrusted minisign key %X", reverse(keyID))
+}
+
+// reverse returns the key identifier in the byte order displayed by minisign.
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
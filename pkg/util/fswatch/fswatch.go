@@ -0,0 +1,137 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fswatch watches directories for file changes and
+// coalesces bursts of file system notifications into batches.
+package fswatch
+
+import (
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Watcher delivers the files changed in the watched directories. Files
+// are batched until no further changes are observed for the debounce
+// period, so bursts of notifications produced by editors or feed
+// downloaders result in a single batch.
+type Watcher struct {
+	name     string
+	watcher  *fsnotify.Watcher
+	debounce time.Duration
+	// match decides whether the changed file is reported
+	match func(path string) bool
+	c     chan []string
+	// dirs contains the watched directories
+	dirs map[string]bool
+	mu   sync.Mutex
+	quit chan struct{}
+}
+
+// New creates a new watcher. The name describes the watched resources
+// in log messages. Only the files accepted by the match function are
+// delivered.
+func New(name string, debounce time.Duration, match func(path string) bool) (*Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create %s watcher: %v", name, err)
+	}
+	return &Watcher{
+		name:     name,
+		watcher:  watcher,
+		debounce: debounce,
+		match:    match,
+		c:        make(chan []string),
+		dirs:     make(map[string]bool),
+		quit:     make(chan struct{}),
+	}, nil
+}
+
+// Add starts watching the directory. Adding the
+// directory that is already watched has no effect.
+func (w *Watcher) Add(dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.dirs[dir] {
+		return nil
+	}
+	log.Infof("watching %s directory for %s changes", dir, w.name)
+	if err := w.watcher.Add(dir); err != nil {
+		return fmt.Errorf("unable to watch %s directory: %v", dir, err)
+	}
+	w.dirs[dir] = true
+	return nil
+}
+
+// C returns the channel that receives batches of changed files.
+func (w *Watcher) C() <-chan []string { return w.c }
+
+// Run starts the watcher loop in a separate goroutine.
+func (w *Watcher) Run() {
+	go w.run()
+}
+
+// Close stops watching the directories.
+func (w *Watcher) Close() error {
+	close(w.quit)
+	return w.watcher.Close()
+}
+
+func (w *Watcher) run() {
+	debounce := time.NewTimer(w.debounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	pending := make(map[string]bool)
+	for {
+		select {
+		case e, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if !w.match(e.Name) {
+				continue
+			}
+			log.Debugf("%s changed: %s", w.name, e)
+			pending[e.Name] = true
+			debounce.Reset(w.debounce)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Warnf("%s watcher error: %v", w.name, err)
+		case <-debounce.C:
+			paths := make([]string, 0, len(pending))
+			for path := range pending {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			pending = make(map[string]bool)
+			select {
+			case w.c <- paths:
+			case <-w.quit:
+				return
+			}
+		case <-w.quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fswatch
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	w, err := New("test", time.Millisecond*50, func(path string) bool { return strings.HasSuffix(path, ".yml") })
+	require.NoError(t, err)
+	defer w.Close()
+	require.NoError(t, w.Add(dir))
+	// adding the watched directory is a no-op
+	require.NoError(t, w.Add(dir))
+	require.Error(t, w.Add(filepath.Join(dir, "missing")))
+	w.Run()
+
+	rule := filepath.Join(dir, "rule.yml")
+	for i := 0; i < 5; i++ {
+		require.NoError(t, os.WriteFile(rule, []byte("name: rule"), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "rule.txt"), []byte("name: rule"), os.ModePerm))
+	}
+
+	select {
+	case paths := <-w.C():
+		assert.Equal(t, []string{rule}, paths)
+	case <-time.After(time.Second * 5):
+		t.Fatal("no changes delivered")
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeCertKeyPair(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fibratus"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return certFile, keyFile
+}
+
+func TestMakeConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertKeyPair(t, dir)
+
+	var tests = []struct {
+		name               string
+		certFile           string
+		keyFile            string
+		caFile             string
+		insecureSkipVerify bool
+		wantNil            bool
+		wantCerts          int
+		wantCA             bool
+		wantErr            bool
+	}{
+		{name: "no files", insecureSkipVerify: true, wantNil: true},
+		{name: "certificate and key", certFile: certFile, keyFile: keyFile, wantCerts: 1},
+		{name: "certificate authority", caFile: certFile, wantCA: true},
+		{name: "certificate, key and authority", certFile: certFile, keyFile: keyFile, caFile: certFile, insecureSkipVerify: true, wantCerts: 1, wantCA: true},
+		{name: "certificate without key", certFile: certFile},
+		{name: "missing key file", certFile: certFile, keyFile: filepath.Join(dir, "missing.pem"), wantErr: true},
+		{name: "invalid certificate authority", caFile: keyFile, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := MakeConfig(tt.certFile, tt.keyFile, tt.caFile, tt.insecureSkipVerify)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.wantNil {
+				assert.Nil(t, config)
+				return
+			}
+			require.NotNil(t, config)
+			assert.Len(t, config.Certificates, tt.wantCerts)
+			assert.Equal(t, tt.wantCA, config.RootCAs != nil)
+			assert.Equal(t, tt.insecureSkipVerify, config.InsecureSkipVerify)
+		})
+	}
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright 2021-2022 by Nedim Sabic Sabic
+ * https://www.fibratus.io
+ * All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wildcard
+
+import (
+	"github.com/rabbitstack/fibratus/pkg/util/ahocorasick"
+	"strings"
+)
+
+// Matcher matches the text against many wildcard patterns at once.
+// Patterns are classified by shape. Literal patterns are stored in
+// the hash set, while patterns such as foo*, *foo, or *foo* are
+// compiled into Aho-Corasick automatons. The remaining patterns are
+// indexed by their longest literal segment. The full wildcard match
+// is only attempted for patterns whose literal segment occurs in the
+// text.
+type Matcher struct {
+	any        bool
+	exact      map[string]struct{}
+	prefixes   *ahocorasick.Matcher
+	suffixes   *ahocorasick.Matcher
+	substrings *ahocorasick.Matcher
+	// literals contains the longest literal segments of complex patterns
+	literals *ahocorasick.Matcher
+	// candidates maps the literal segment to complex pattern indices
+	candidates [][]int
+	complex    []string
+	// unanchored contains complex patterns without literal segments
+	unanchored []string
+}
+
+// NewMatcher builds the matcher from the given wildcard patterns.
+func NewMatcher(patterns []string) *Matcher {
+	m := &Matcher{exact: make(map[string]struct{})}
+	var (
+		prefixes   []string
+		suffixes   []string
+		substrings []string
+		literals   []string
+	)
+	// index maps the literal segment to its position
+	index := make(map[string]int)
+	for _, p := range patterns {
+		switch {
+		case !strings.ContainsAny(p, "*?"):
+			m.exact[p] = struct{}{}
+		case strings.Trim(p, "*") == "":
+			m.any = true
+		case strings.ContainsRune(p, '?'):
+			m.addComplex(p, &literals, index)
+		default:
+			lit := strings.Trim(p, "*")
+			if strings.ContainsRune(lit, '*') {
+				m.addComplex(p, &literals, index)
+				continue
+			}
+			leading, trailing := p[0] == '*', p[len(p)-1] == '*'
+			switch {
+			case leading && trailing:
+				substrings = append(substrings, lit)
+			case leading:
+				suffixes = append(suffixes, lit)
+			default:
+				prefixes = append(prefixes, lit)
+			}
+		}
+	}
+	if len(prefixes) > 0 {
+		m.prefixes = ahocorasick.New(prefixes)
+	}
+	if len(suffixes) > 0 {
+		m.suffixes = ahocorasick.New(suffixes)
+	}
+	if len(substrings) > 0 {
+		m.substrings = ahocorasick.New(substrings)
+	}
+	if len(literals) > 0 {
+		m.literals = ahocorasick.New(literals)
+	}
+	return m
+}
+
+// addComplex indexes the pattern by its longest literal segment.
+func (m *Matcher) addComplex(p string, literals *[]string, index map[string]int) {
+	lit := longestLiteral(p)
+	if lit == "" {
+		m.unanchored = append(m.unanchored, p)
+		return
+	}
+	m.complex = append(m.complex, p)
+	n := len(m.complex) - 1
+	if i, ok := index[lit]; ok {
+		m.candidates[i] = append(m.candidates[i], n)
+		return
+	}
+	index[lit] = len(*literals)
+	*literals = append(*literals, lit)
+	m.candidates = append(m.candidates, []int{n})
+}
+
+// Match determines if the text matches any of the patterns.
+func (m *Matcher) Match(text string) bool {
+	if m.any {
+		return true
+	}
+	if _, ok := m.exact[text]; ok {
+		return true
+	}
+	if m.prefixes != nil && m.prefixes.HasPrefix(text) {
+		return true
+	}
+	if m.suffixes != nil && m.suffixes.HasSuffix(text) {
+		return true
+	}
+	if m.substrings != nil && m.substrings.Contains(text) {
+		return true
+	}
+	for _, p := range m.unanchored {
+		if Match(p, text) {
+			return true
+		}
+	}
+	if m.literals == nil {
+		return false
+	}
+	var (
+		matches bool
+		seen    []bool
+	)
+	m.literals.Match(text, func(i int) bool {
+		for _, n := range m.candidates[i] {
+			if seen == nil {
+				seen = make([]bool, len(m.complex))
+			}
+			if seen[n] {
+				continue
+			}
+			seen[n] = true
+			if Match(m.complex[n], text) {
+				matches = true
+				return false
+			}
+		}
+		return true
+	})
+	return matches
+}
+
+// longestLiteral returns the longest pattern segment without wildcards.
+func longestLiteral(p string) string {
+	var lit string
+	for _, seg := range strings.FieldsFunc(p, func(r rune) bool { return r == '*' || r == '?' }) {
+		if len(seg) > len(lit) {
+			lit = seg
+		}
+	}
+	return lit
+}
@@ -25,3 +25,53 @@ func TestMatch(t *testing.T) {
 	assert.True(t, Match("HKEY_USERS\\*\\Environment\\windir", "HKEY_USERS\\S-1-5-21-2271034452-2606270099-984871569-1001\\Environment\\windir"))
 	assert.True(t, Match("C:\\Windows\\SoftwareDistribution\\*", "C:\\Windows\\SoftwareDistribution\\SLS\\7971F918-A847-4430-9279-4A52D1EFE18D\\sls.rar"))
 }
+
+func TestMatcher(t *testing.T) {
+	patterns := []string{
+		"C:\\Windows\\System32\\cmd.exe",
+		"C:\\Users\\*\\AppData\\*",
+		"*\\Temp\\*",
+		"*.ps1",
+		"C:\\ProgramData\\*",
+		"?:\\Windows\\Tasks\\*.job",
+		"*\\lsass?.dmp",
+		"HKEY_USERS\\*\\Environment\\windir",
+	}
+	m := NewMatcher(patterns)
+
+	names := []string{
+		"C:\\Windows\\System32\\cmd.exe",
+		"C:\\Windows\\System32\\cmd.exe.bak",
+		"C:\\Users\\admin\\AppData\\Local\\evil.dll",
+		"C:\\Users\\admin\\Desktop\\evil.dll",
+		"C:\\Users\\admin\\AppData\\Local\\Temp\\evil.dll",
+		"D:\\scripts\\payload.ps1",
+		"D:\\scripts\\payload.ps1.txt",
+		"C:\\ProgramData\\evil.exe",
+		"D:\\Windows\\Tasks\\update.job",
+		"D:\\Windows\\Tasks\\update.jobs",
+		"C:\\Windows\\Temp\\lsass1.dmp",
+		"C:\\dumps\\lsass2.dmp",
+		"C:\\dumps\\lsass.dmp",
+		"HKEY_USERS\\S-1-5-21-2271034452-2606270099-984871569-1001\\Environment\\windir",
+		"",
+	}
+
+	for _, name := range names {
+		var expected bool
+		for _, p := range patterns {
+			if Match(p, name) {
+				expected = true
+				break
+			}
+		}
+		assert.Equal(t, expected, m.Match(name), name)
+	}
+
+	assert.True(t, NewMatcher([]string{"foo", "**"}).Match("bar"))
+	assert.True(t, NewMatcher([]string{"foo", ""}).Match(""))
+	assert.False(t, NewMatcher([]string{"foo", "b?r"}).Match("baar"))
+	assert.True(t, NewMatcher([]string{"foo", "b?r"}).Match("bar"))
+	assert.True(t, NewMatcher([]string{"?*?"}).Match("ab"))
+	assert.False(t, NewMatcher([]string{"?*?"}).Match("a"))
+}